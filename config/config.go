@@ -1,30 +1,593 @@
 package config
 
-// Database configuration
-const (
-	DBHost     = "69.62.73.139"
-	DBName     = "HSANNU"
-	DBUser     = "postgres"
-	DBPassword = "2008"
-	DBPort     = "5433"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
 )
 
-// APNs configuration
+// Supported environment profiles
 const (
-	AuthKeyPath = "key.p8"
-	AuthKeyID   = "BK88TAV8F8"
-	TeamID      = "CNSN2FZNRR"
-	APNSTopic   = "com.leo.hsannu"
+	EnvDev     = "dev"
+	EnvStaging = "staging"
+	EnvProd    = "prod"
 )
 
-// SMTP Email configuration
-const (
-	SMTPHost     = "smtp.hostinger.com"
-	SMTPPort     = "587"
-	SMTPUsername = "support@hsannu.com" // Replace with actual email
-	SMTPPassword = "Hsannu_123"         // Replace with actual app password
-	SMTPSender   = "HSANNU Support <support@hsannu.com>"
+// devTokenSigningKey is only accepted in the dev profile
+const devTokenSigningKey = "hsannu-connect-dev-signing-key"
+
+// Config is the complete server configuration
+type Config struct {
+	Env        string           `yaml:"env" toml:"env" json:"env"`
+	Server     ServerConfig     `yaml:"server" toml:"server" json:"server"`
+	Database   DatabaseConfig   `yaml:"database" toml:"database" json:"database"`
+	APNs       APNsConfig       `yaml:"apns" toml:"apns" json:"apns"`
+	SMTP       SMTPConfig       `yaml:"smtp" toml:"smtp" json:"smtp"`
+	Token      TokenConfig      `yaml:"token" toml:"token" json:"token"`
+	Attendance AttendanceConfig `yaml:"attendance" toml:"attendance" json:"attendance"`
+	Leave      LeaveConfig      `yaml:"leave" toml:"leave" json:"leave"`
+}
+
+// ServerConfig holds HTTP server settings
+type ServerConfig struct {
+	Port string `yaml:"port" toml:"port" json:"port"`
+}
+
+// DatabaseConfig holds PostgreSQL connection settings
+type DatabaseConfig struct {
+	Host     string `yaml:"host" toml:"host" json:"host"`
+	Port     string `yaml:"port" toml:"port" json:"port"`
+	User     string `yaml:"user" toml:"user" json:"user"`
+	Password Secret `yaml:"password" toml:"password" json:"password"`
+	Name     string `yaml:"name" toml:"name" json:"name"`
+	SSLMode  string `yaml:"sslmode" toml:"sslmode" json:"sslmode"`
+
+	// Connection pool limits shared by the whole server
+	MaxOpenConns    int      `yaml:"max_open_conns" toml:"max_open_conns" json:"max_open_conns"`
+	MaxIdleConns    int      `yaml:"max_idle_conns" toml:"max_idle_conns" json:"max_idle_conns"`
+	ConnMaxLifetime Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime" json:"conn_max_lifetime"`
+	ConnMaxIdleTime Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time" json:"conn_max_idle_time"`
+}
+
+// APNsConfig holds Apple Push Notification service settings
+type APNsConfig struct {
+	AuthKeyPath string `yaml:"auth_key_path" toml:"auth_key_path" json:"auth_key_path"` // the .p8 signing key, kept out of the repository
+	AuthKeyID   string `yaml:"auth_key_id" toml:"auth_key_id" json:"auth_key_id"`
+	TeamID      string `yaml:"team_id" toml:"team_id" json:"team_id"`
+	Topic       string `yaml:"topic" toml:"topic" json:"topic"`
+	Production  bool   `yaml:"production" toml:"production" json:"production"` // Use the production APNs gateway instead of development
+
+	// LiveActivityAttributesType names the app's ActivityAttributes type for leave
+	// requests, which push-to-start payloads must match
+	LiveActivityAttributesType string `yaml:"live_activity_attributes_type" toml:"live_activity_attributes_type" json:"live_activity_attributes_type"`
+}
+
+// SMTPConfig holds the outgoing email settings
+type SMTPConfig struct {
+	Host     string `yaml:"host" toml:"host" json:"host"`
+	Port     string `yaml:"port" toml:"port" json:"port"`
+	Username string `yaml:"username" toml:"username" json:"username"`
+	Password Secret `yaml:"password" toml:"password" json:"password"`
+	Sender   string `yaml:"sender" toml:"sender" json:"sender"`
+}
+
+// TokenConfig holds session token settings
+type TokenConfig struct {
+	SigningKey      Secret   `yaml:"signing_key" toml:"signing_key" json:"signing_key"` // HMAC key for access tokens
+	Issuer          string   `yaml:"issuer" toml:"issuer" json:"issuer"`
+	AccessTokenTTL  Duration `yaml:"access_token_ttl" toml:"access_token_ttl" json:"access_token_ttl"`
+	RefreshTokenTTL Duration `yaml:"refresh_token_ttl" toml:"refresh_token_ttl" json:"refresh_token_ttl"`
+}
+
+// AttendanceConfig holds the daily attendance register settings
+type AttendanceConfig struct {
+	RolloverTime string   `yaml:"rollover_time" toml:"rollover_time" json:"rollover_time"` // HH:MM local time at which the day's register is finalised
+	Holidays     []string `yaml:"holidays" toml:"holidays" json:"holidays"`                // YYYY-MM-DD dates without school
+
+	// LockAfter is how long after a day's rollover its register stays open to staff;
+	// later only the attendance office can amend it. Zero never locks registers.
+	LockAfter Duration `yaml:"lock_after" toml:"lock_after" json:"lock_after"`
+
+	// QR self check-in at reception
+	LateAfter      string   `yaml:"late_after" toml:"late_after" json:"late_after"`                      // HH:MM local time after which arrivals are marked Late
+	CheckInCodeTTL Duration `yaml:"check_in_code_ttl" toml:"check_in_code_ttl" json:"check_in_code_ttl"` // lifetime of a displayed check-in code, at most one minute
+
+	// LowAttendanceThreshold is the attendance rate, in percent, under which analytics flag a student
+	LowAttendanceThreshold float64 `yaml:"low_attendance_threshold" toml:"low_attendance_threshold" json:"low_attendance_threshold"`
+
+	// AlertRules raise an alert to the homeroom teacher and guardians when broken
+	AlertRules []AttendanceAlertRule `yaml:"alert_rules" toml:"alert_rules" json:"alert_rules"`
+}
+
+// AttendanceAlertRule is broken when a student has Count records with Status within
+// the last SchoolDays school days, or the last Days calendar days; set exactly one
+type AttendanceAlertRule struct {
+	Name        string `yaml:"name" toml:"name" json:"name"`
+	Status      string `yaml:"status" toml:"status" json:"status"` // "absent", "late", "medical" or "early"
+	Count       int    `yaml:"count" toml:"count" json:"count"`
+	SchoolDays  int    `yaml:"school_days" toml:"school_days" json:"school_days"`
+	Days        int    `yaml:"days" toml:"days" json:"days"`
+	Unexplained bool   `yaml:"unexplained" toml:"unexplained" json:"unexplained"` // only count records not covered by approved leave
+}
+
+// LeaveConfig holds the leave request settings
+type LeaveConfig struct {
+	// DutyRole is the role, primary or additional, whose users are notified of every
+	// new leave request besides the student's homeroom teacher. Empty notifies nobody else.
+	DutyRole string `yaml:"duty_role" toml:"duty_role" json:"duty_role"`
+
+	// EscalationTiers notify further roles about requests left unanswered, in order
+	EscalationTiers []LeaveEscalationTier `yaml:"escalation_tiers" toml:"escalation_tiers" json:"escalation_tiers"`
+
+	// LiveActivityDismissal is how long a request's Live Activity stays on the Lock
+	// Screen after the request is rejected, cancelled or finished. 0 removes it at once.
+	LiveActivityDismissal Duration `yaml:"live_activity_dismissal" toml:"live_activity_dismissal" json:"live_activity_dismissal"`
+}
+
+// LeaveEscalationTier notifies the users with Role when a leave request has waited
+// After since it was sent without a response
+type LeaveEscalationTier struct {
+	Role  string   `yaml:"role" toml:"role" json:"role"`
+	After Duration `yaml:"after" toml:"after" json:"after"`
+}
+
+var (
+	current *Config
+	mu      sync.RWMutex
 )
 
-// Server configuration
-const ServerPort = "2000"
+// Get returns the configuration loaded by Load.
+// If Load has not been called yet, the dev profile defaults are returned.
+func Get() *Config {
+	mu.RLock()
+	defer mu.RUnlock()
+	if current == nil {
+		return Defaults(EnvDev)
+	}
+	return current
+}
+
+// Defaults returns the default configuration for a profile.
+// Secrets are never defaulted, except for the dev token signing key.
+func Defaults(env string) *Config {
+	cfg := &Config{
+		Env:    env,
+		Server: ServerConfig{Port: "2000"},
+		Database: DatabaseConfig{
+			Host:    "localhost",
+			Port:    "5432",
+			User:    "postgres",
+			Name:    "HSANNU",
+			SSLMode: "disable",
+
+			MaxOpenConns:    25,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: Duration{30 * time.Minute},
+			ConnMaxIdleTime: Duration{5 * time.Minute},
+		},
+		APNs: APNsConfig{
+			Topic: "com.leo.hsannu",
+
+			LiveActivityAttributesType: "LeaveRequestAttributes",
+		},
+		SMTP: SMTPConfig{
+			Host:   "smtp.hostinger.com",
+			Port:   "587",
+			Sender: "HSANNU Support <support@hsannu.com>",
+		},
+		Token: TokenConfig{
+			Issuer:          "hsannu-connect",
+			AccessTokenTTL:  Duration{15 * time.Minute},
+			RefreshTokenTTL: Duration{30 * 24 * time.Hour},
+		},
+		Attendance: AttendanceConfig{
+			RolloverTime:   "17:00",
+			LockAfter:      Duration{48 * time.Hour},
+			LateAfter:      "08:00",
+			CheckInCodeTTL: Duration{30 * time.Second},
+
+			LowAttendanceThreshold: 90,
+			AlertRules: []AttendanceAlertRule{
+				{Name: "unexplained-absences", Status: "absent", Count: 3, SchoolDays: 10, Unexplained: true},
+				{Name: "frequent-lates", Status: "late", Count: 5, Days: 30},
+			},
+		},
+		Leave: LeaveConfig{
+			DutyRole:              "attendance",
+			LiveActivityDismissal: Duration{15 * time.Minute},
+		},
+	}
+
+	switch env {
+	case EnvDev:
+		cfg.Token.SigningKey = devTokenSigningKey
+	case EnvStaging:
+		cfg.Database.SSLMode = "prefer"
+	case EnvProd:
+		cfg.Database.SSLMode = "require"
+		cfg.APNs.Production = true
+	}
+
+	return cfg
+}
+
+/**
+ * Load builds the configuration and makes it available through Get.
+ *
+ * Values are applied in order, each overriding the previous one:
+ * 1. Profile defaults selected by APP_ENV or the file's env key (dev, staging or prod; default dev)
+ * 2. The optional config file at path (.yaml, .yml or .toml)
+ * 3. Environment variables (see applyEnv)
+ *
+ * The result is validated before it is stored; every problem found is reported.
+ */
+func Load(path string) (*Config, error) {
+	var data []byte
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read config file %s: %v", path, err)
+		}
+	}
+
+	// APP_ENV wins over the env key of the config file
+	env := strings.ToLower(strings.TrimSpace(os.Getenv("APP_ENV")))
+	if env == "" && data != nil {
+		var profile struct {
+			Env string `yaml:"env" toml:"env"`
+		}
+		if err := decodeFile(path, data, &profile); err != nil {
+			return nil, err
+		}
+		env = strings.ToLower(strings.TrimSpace(profile.Env))
+	}
+	if env == "" {
+		env = EnvDev
+	}
+	if !isValidEnv(env) {
+		return nil, fmt.Errorf("invalid environment %q: must be one of %s, %s, %s", env, EnvDev, EnvStaging, EnvProd)
+	}
+
+	cfg := Defaults(env)
+
+	if data != nil {
+		if err := decodeFile(path, data, cfg); err != nil {
+			return nil, err
+		}
+		cfg.Env = env
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	current = cfg
+	mu.Unlock()
+
+	return cfg, nil
+}
+
+// decodeFile decodes YAML or TOML data into out, based on the file extension of path
+func decodeFile(path string, data []byte, out interface{}) error {
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, out)
+	case ".toml":
+		err = toml.Unmarshal(data, out)
+	default:
+		return fmt.Errorf("unsupported config file type %q: use .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("unable to parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// applyEnv overrides cfg with any configuration environment variables that are set
+func applyEnv(cfg *Config) error {
+	stringVars := map[string]*string{
+		"SERVER_PORT":   &cfg.Server.Port,
+		"DB_HOST":       &cfg.Database.Host,
+		"DB_PORT":       &cfg.Database.Port,
+		"DB_USER":       &cfg.Database.User,
+		"DB_NAME":       &cfg.Database.Name,
+		"DB_SSLMODE":    &cfg.Database.SSLMode,
+		"APNS_KEY_PATH": &cfg.APNs.AuthKeyPath,
+		"APNS_KEY_ID":   &cfg.APNs.AuthKeyID,
+		"APNS_TEAM_ID":  &cfg.APNs.TeamID,
+		"APNS_TOPIC":    &cfg.APNs.Topic,
+		"SMTP_HOST":     &cfg.SMTP.Host,
+		"SMTP_PORT":     &cfg.SMTP.Port,
+		"SMTP_USERNAME": &cfg.SMTP.Username,
+		"SMTP_SENDER":   &cfg.SMTP.Sender,
+		"TOKEN_ISSUER":  &cfg.Token.Issuer,
+
+		"APNS_LIVE_ACTIVITY_ATTRIBUTES_TYPE": &cfg.APNs.LiveActivityAttributesType,
+
+		"ATTENDANCE_ROLLOVER_TIME": &cfg.Attendance.RolloverTime,
+		"ATTENDANCE_LATE_AFTER":    &cfg.Attendance.LateAfter,
+
+		"LEAVE_DUTY_ROLE": &cfg.Leave.DutyRole,
+	}
+	for name, field := range stringVars {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = value
+		}
+	}
+
+	secretVars := map[string]*Secret{
+		"DB_PASSWORD":       &cfg.Database.Password,
+		"SMTP_PASSWORD":     &cfg.SMTP.Password,
+		"TOKEN_SIGNING_KEY": &cfg.Token.SigningKey,
+	}
+	for name, field := range secretVars {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = Secret(value)
+		}
+	}
+
+	intVars := map[string]*int{
+		"DB_MAX_OPEN_CONNS": &cfg.Database.MaxOpenConns,
+		"DB_MAX_IDLE_CONNS": &cfg.Database.MaxIdleConns,
+	}
+	for name, field := range intVars {
+		if value, ok := os.LookupEnv(name); ok {
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %v", name, err)
+			}
+			*field = number
+		}
+	}
+
+	durationVars := map[string]*Duration{
+		"DB_CONN_MAX_LIFETIME":  &cfg.Database.ConnMaxLifetime,
+		"DB_CONN_MAX_IDLE_TIME": &cfg.Database.ConnMaxIdleTime,
+		"ACCESS_TOKEN_TTL":      &cfg.Token.AccessTokenTTL,
+		"REFRESH_TOKEN_TTL":     &cfg.Token.RefreshTokenTTL,
+
+		"ATTENDANCE_CHECK_IN_CODE_TTL": &cfg.Attendance.CheckInCodeTTL,
+		"ATTENDANCE_LOCK_AFTER":        &cfg.Attendance.LockAfter,
+
+		"LEAVE_LIVE_ACTIVITY_DISMISSAL": &cfg.Leave.LiveActivityDismissal,
+	}
+	for name, field := range durationVars {
+		if value, ok := os.LookupEnv(name); ok {
+			if err := field.UnmarshalText([]byte(value)); err != nil {
+				return fmt.Errorf("invalid %s: %v", name, err)
+			}
+		}
+	}
+
+	// ATTENDANCE_HOLIDAYS is a comma-separated list of dates
+	if value, ok := os.LookupEnv("ATTENDANCE_HOLIDAYS"); ok {
+		cfg.Attendance.Holidays = nil
+		for _, date := range strings.Split(value, ",") {
+			if date = strings.TrimSpace(date); date != "" {
+				cfg.Attendance.Holidays = append(cfg.Attendance.Holidays, date)
+			}
+		}
+	}
+
+	if value, ok := os.LookupEnv("ATTENDANCE_LOW_THRESHOLD"); ok {
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid ATTENDANCE_LOW_THRESHOLD: %v", err)
+		}
+		cfg.Attendance.LowAttendanceThreshold = threshold
+	}
+
+	if value, ok := os.LookupEnv("APNS_PRODUCTION"); ok {
+		production, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid APNS_PRODUCTION: %v", err)
+		}
+		cfg.APNs.Production = production
+	}
+
+	return nil
+}
+
+// Validate checks the configuration and returns every problem found.
+// Staging and prod additionally require all secrets and APNs credentials.
+func (c *Config) Validate() error {
+	var errs []error
+	require := func(value, name string) {
+		if strings.TrimSpace(value) == "" {
+			errs = append(errs, fmt.Errorf("%s is required", name))
+		}
+	}
+	requirePort := func(value, name string) {
+		if port, err := strconv.Atoi(value); err != nil || port < 1 || port > 65535 {
+			errs = append(errs, fmt.Errorf("%s must be a port number, got %q", name, value))
+		}
+	}
+
+	if !isValidEnv(c.Env) {
+		errs = append(errs, fmt.Errorf("env must be one of %s, %s, %s, got %q", EnvDev, EnvStaging, EnvProd, c.Env))
+	}
+
+	requirePort(c.Server.Port, "server.port")
+
+	require(c.Database.Host, "database.host")
+	requirePort(c.Database.Port, "database.port")
+	require(c.Database.User, "database.user")
+	require(c.Database.Name, "database.name")
+	if c.Database.MaxOpenConns < 1 {
+		errs = append(errs, errors.New("database.max_open_conns must be at least 1"))
+	}
+	if c.Database.MaxIdleConns < 0 || c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		errs = append(errs, errors.New("database.max_idle_conns must be between 0 and database.max_open_conns"))
+	}
+	if c.Database.ConnMaxLifetime.Duration < 0 || c.Database.ConnMaxIdleTime.Duration < 0 {
+		errs = append(errs, errors.New("database.conn_max_lifetime and database.conn_max_idle_time must not be negative"))
+	}
+
+	if c.Token.SigningKey == "" {
+		errs = append(errs, errors.New("token.signing_key is required"))
+	}
+	require(c.Token.Issuer, "token.issuer")
+	if c.Token.AccessTokenTTL.Duration <= 0 {
+		errs = append(errs, errors.New("token.access_token_ttl must be positive"))
+	}
+	if c.Token.RefreshTokenTTL.Duration <= c.Token.AccessTokenTTL.Duration {
+		errs = append(errs, errors.New("token.refresh_token_ttl must be longer than token.access_token_ttl"))
+	}
+
+	if c.SMTP.Host != "" {
+		requirePort(c.SMTP.Port, "smtp.port")
+	}
+
+	if _, err := time.Parse("15:04", c.Attendance.RolloverTime); err != nil {
+		errs = append(errs, fmt.Errorf("attendance.rollover_time must be in HH:MM format, got %q", c.Attendance.RolloverTime))
+	}
+	if _, err := time.Parse("15:04", c.Attendance.LateAfter); err != nil {
+		errs = append(errs, fmt.Errorf("attendance.late_after must be in HH:MM format, got %q", c.Attendance.LateAfter))
+	}
+	if c.Attendance.LockAfter.Duration < 0 {
+		errs = append(errs, fmt.Errorf("attendance.lock_after must not be negative, got %s", c.Attendance.LockAfter.Duration))
+	}
+	if ttl := c.Attendance.CheckInCodeTTL.Duration; ttl < 5*time.Second || ttl > time.Minute {
+		errs = append(errs, fmt.Errorf("attendance.check_in_code_ttl must be between 5s and 1m, got %s", ttl))
+	}
+	if t := c.Attendance.LowAttendanceThreshold; t <= 0 || t > 100 {
+		errs = append(errs, fmt.Errorf("attendance.low_attendance_threshold must be a percentage above 0 and at most 100, got %v", t))
+	}
+	ruleNames := make(map[string]bool)
+	for i, rule := range c.Attendance.AlertRules {
+		name := fmt.Sprintf("attendance.alert_rules[%d]", i)
+		switch {
+		case strings.TrimSpace(rule.Name) == "":
+			errs = append(errs, fmt.Errorf("%s.name is required", name))
+		case ruleNames[rule.Name]:
+			errs = append(errs, fmt.Errorf("%s.name %q is not unique", name, rule.Name))
+		}
+		ruleNames[rule.Name] = true
+		switch rule.Status {
+		case "absent", "late", "medical", "early":
+		default:
+			errs = append(errs, fmt.Errorf("%s.status must be absent, late, medical or early, got %q", name, rule.Status))
+		}
+		if rule.Count < 1 {
+			errs = append(errs, fmt.Errorf("%s.count must be at least 1", name))
+		}
+		if (rule.SchoolDays > 0) == (rule.Days > 0) || rule.SchoolDays < 0 || rule.Days < 0 {
+			errs = append(errs, fmt.Errorf("%s must set exactly one of school_days or days", name))
+		}
+	}
+	for _, holiday := range c.Attendance.Holidays {
+		if _, err := time.Parse("2006-01-02", holiday); err != nil {
+			errs = append(errs, fmt.Errorf("attendance.holidays must be dates in YYYY-MM-DD format, got %q", holiday))
+		}
+	}
+
+	if c.Leave.LiveActivityDismissal.Duration < 0 {
+		errs = append(errs, fmt.Errorf("leave.live_activity_dismissal must not be negative, got %s", c.Leave.LiveActivityDismissal.Duration))
+	}
+	for i, tier := range c.Leave.EscalationTiers {
+		name := fmt.Sprintf("leave.escalation_tiers[%d]", i)
+		require(tier.Role, name+".role")
+		switch {
+		case tier.After.Duration <= 0:
+			errs = append(errs, fmt.Errorf("%s.after must be positive", name))
+		case i > 0 && tier.After.Duration <= c.Leave.EscalationTiers[i-1].After.Duration:
+			errs = append(errs, fmt.Errorf("%s.after must be longer than the previous tier's", name))
+		}
+	}
+
+	if c.Env == EnvStaging || c.Env == EnvProd {
+		if c.Database.Password == "" {
+			errs = append(errs, errors.New("database.password is required"))
+		}
+		if c.Token.SigningKey != "" && (c.Token.SigningKey == devTokenSigningKey || len(c.Token.SigningKey) < 32) {
+			errs = append(errs, errors.New("token.signing_key must be a unique value of at least 32 characters"))
+		}
+
+		require(c.APNs.AuthKeyPath, "apns.auth_key_path")
+		require(c.APNs.AuthKeyID, "apns.auth_key_id")
+		require(c.APNs.TeamID, "apns.team_id")
+		require(c.APNs.Topic, "apns.topic")
+
+		require(c.SMTP.Host, "smtp.host")
+		require(c.SMTP.Username, "smtp.username")
+		if c.SMTP.Password == "" {
+			errs = append(errs, errors.New("smtp.password is required"))
+		}
+		require(c.SMTP.Sender, "smtp.sender")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Redacted returns the configuration as indented JSON with secret values hidden, for logging
+func (c *Config) Redacted() string {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("<unable to format config: %v>", err)
+	}
+	return string(data)
+}
+
+// DSN returns the lib/pq connection string for the database
+func (d DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		d.Host, d.Port, d.User, d.Password.Value(), d.Name, d.SSLMode)
+}
+
+// RolloverAt returns the time on the given day at which the register is finalised.
+// RolloverTime must already be validated.
+func (a AttendanceConfig) RolloverAt(day time.Time) time.Time {
+	cutoff, _ := time.Parse("15:04", a.RolloverTime)
+	return time.Date(day.Year(), day.Month(), day.Day(), cutoff.Hour(), cutoff.Minute(), 0, 0, day.Location())
+}
+
+// IsLocked reports whether the register of day can only be amended by the attendance
+// office at the time now
+func (a AttendanceConfig) IsLocked(day time.Time, now time.Time) bool {
+	return a.LockAfter.Duration > 0 && now.After(a.RolloverAt(day).Add(a.LockAfter.Duration))
+}
+
+// LateAt returns the time on day after which an arrival counts as Late
+func (a AttendanceConfig) LateAt(day time.Time) time.Time {
+	cutoff, _ := time.Parse("15:04", a.LateAfter)
+	return time.Date(day.Year(), day.Month(), day.Day(), cutoff.Hour(), cutoff.Minute(), 0, 0, day.Location())
+}
+
+// IsHoliday reports whether the given day is a configured holiday
+func (a AttendanceConfig) IsHoliday(day time.Time) bool {
+	date := day.Format("2006-01-02")
+	for _, holiday := range a.Holidays {
+		if holiday == date {
+			return true
+		}
+	}
+	return false
+}
+
+// Addr returns the host:port address of the SMTP server
+func (s SMTPConfig) Addr() string {
+	return fmt.Sprintf("%s:%s", s.Host, s.Port)
+}
+
+func isValidEnv(env string) bool {
+	return env == EnvDev || env == EnvStaging || env == EnvProd
+}
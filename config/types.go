@@ -0,0 +1,56 @@
+package config
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// redactedValue replaces secret values whenever they are printed or marshalled
+const redactedValue = "[REDACTED]"
+
+// Secret is a string that never reveals its value when logged or marshalled.
+// Use Value to read the real value.
+type Secret string
+
+// Value returns the real secret value
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String implements fmt.Stringer so secrets are redacted in log output
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+// GoString redacts the secret for %#v formatting
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+// MarshalJSON redacts the secret in JSON output
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// Duration is a time.Duration read from strings such as "15m" or "720h"
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText parses a duration string; used by the YAML and TOML decoders and env vars
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// MarshalText formats the duration as a string
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
@@ -2,15 +2,25 @@ package db
 
 import (
 	"database/sql"
-	"fmt"
 	"server/config" // Adjust this if your config package is elsewhere
 
 	_ "github.com/lib/pq" // PostgreSQL driver
 )
 
-// GetConnection returns a connection to the PostgreSQL database.
+// GetConnection opens the PostgreSQL connection pool with the configured limits.
+// It is called once at startup; the returned *sql.DB is shared by every handler.
 func GetConnection() (*sql.DB, error) {
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		config.DBHost, config.DBPort, config.DBUser, config.DBPassword, config.DBName)
-	return sql.Open("postgres", connStr)
+	cfg := config.Get().Database
+
+	db, err := sql.Open("postgres", cfg.DSN())
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime.Duration)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime.Duration)
+
+	return db, nil
 }
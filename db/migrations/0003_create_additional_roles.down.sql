@@ -0,0 +1 @@
+DROP TABLE IF EXISTS additional_roles;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS additional_roles (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL,
+    UNIQUE (user_id, role)
+);
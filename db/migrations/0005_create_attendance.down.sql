@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS attendance_history;
+DROP TABLE IF EXISTS attendance;
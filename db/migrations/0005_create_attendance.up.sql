@@ -0,0 +1,27 @@
+-- Current attendance summary, one row per student
+CREATE TABLE IF NOT EXISTS attendance (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL DEFAULT '',
+    year TEXT,
+    group_name TEXT,
+    today TEXT NOT NULL DEFAULT 'Pending',
+    present INTEGER NOT NULL DEFAULT 0,
+    absent INTEGER NOT NULL DEFAULT 0,
+    late INTEGER NOT NULL DEFAULT 0,
+    medical INTEGER NOT NULL DEFAULT 0,
+    early INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_attendance_year_group ON attendance(year, group_name);
+
+-- Daily attendance records
+CREATE TABLE IF NOT EXISTS attendance_history (
+    id SERIAL PRIMARY KEY,
+    student_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL,
+    attendance_date DATE NOT NULL,
+    arrived_at TIME,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_attendance_history_student_date ON attendance_history(student_id, attendance_date);
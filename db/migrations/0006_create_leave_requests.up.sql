@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS leave_requests (
+    id SERIAL PRIMARY KEY,
+    student_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    student_name TEXT NOT NULL,
+    request_type TEXT NOT NULL,
+    reason TEXT,
+    status TEXT NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    responded_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    response_time TIMESTAMP,
+    live_activity_id TEXT,
+    live_activity_token TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_leave_requests_student_id ON leave_requests(student_id);
+CREATE INDEX IF NOT EXISTS idx_leave_requests_status ON leave_requests(status);
+CREATE INDEX IF NOT EXISTS idx_leave_requests_live_activity_id ON leave_requests(live_activity_id);
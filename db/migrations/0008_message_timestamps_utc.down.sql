@@ -0,0 +1,2 @@
+-- The UTC conversion is not reversed: the application writes UTC timestamps without a time zone.
+SELECT 1;
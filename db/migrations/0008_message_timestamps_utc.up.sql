@@ -0,0 +1,23 @@
+-- Databases created before migrations stored message timestamps with a time zone.
+-- Convert them to UTC timestamps without a time zone; already converted columns are left alone.
+DO $$
+BEGIN
+    IF (SELECT data_type FROM information_schema.columns
+        WHERE table_name = 'messages' AND column_name = 'created_at') = 'timestamp with time zone' THEN
+        ALTER TABLE messages
+            ALTER COLUMN created_at TYPE timestamp WITHOUT TIME ZONE
+            USING created_at AT TIME ZONE 'UTC';
+    END IF;
+
+    IF (SELECT data_type FROM information_schema.columns
+        WHERE table_name = 'conversations' AND column_name = 'created_at') = 'timestamp with time zone' THEN
+        ALTER TABLE conversations
+            ALTER COLUMN created_at TYPE timestamp WITHOUT TIME ZONE
+            USING created_at AT TIME ZONE 'UTC';
+    END IF;
+END $$;
+
+ALTER TABLE messages
+    ALTER COLUMN created_at SET DEFAULT (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')::timestamp;
+ALTER TABLE conversations
+    ALTER COLUMN created_at SET DEFAULT (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')::timestamp;
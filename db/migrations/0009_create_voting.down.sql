@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS user_votes;
+DROP TABLE IF EXISTS vote_options;
+DROP TABLE IF EXISTS sub_votes;
+DROP TABLE IF EXISTS voting_events;
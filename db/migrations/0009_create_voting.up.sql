@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS voting_events (
+    id SERIAL PRIMARY KEY,
+    title TEXT NOT NULL,
+    description TEXT,
+    deadline TIMESTAMP NOT NULL,
+    status TEXT NOT NULL,
+    organizer_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS sub_votes (
+    id SERIAL PRIMARY KEY,
+    event_id INTEGER NOT NULL REFERENCES voting_events(id) ON DELETE CASCADE,
+    title TEXT NOT NULL,
+    description TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS vote_options (
+    id SERIAL PRIMARY KEY,
+    sub_vote_id INTEGER NOT NULL REFERENCES sub_votes(id) ON DELETE CASCADE,
+    text TEXT NOT NULL,
+    has_custom_input BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_votes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    sub_vote_id INTEGER NOT NULL REFERENCES sub_votes(id) ON DELETE CASCADE,
+    option_id INTEGER NOT NULL REFERENCES vote_options(id) ON DELETE CASCADE,
+    custom_input TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, sub_vote_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_sub_votes_event_id ON sub_votes(event_id);
+CREATE INDEX IF NOT EXISTS idx_vote_options_sub_vote_id ON vote_options(sub_vote_id);
+CREATE INDEX IF NOT EXISTS idx_user_votes_option_id ON user_votes(option_id);
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS events (
+    event_id TEXT PRIMARY KEY,
+    author_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    author_name TEXT NOT NULL,
+    title TEXT NOT NULL,
+    event_description TEXT,
+    address TEXT,
+    event_date TIMESTAMP NOT NULL,
+    is_whole_day BOOLEAN NOT NULL DEFAULT false,
+    start_time TIMESTAMP,
+    end_time TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS event_images (
+    id TEXT PRIMARY KEY,
+    event_id TEXT NOT NULL REFERENCES events(event_id) ON DELETE CASCADE,
+    file_path TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_images_event_id ON event_images(event_id);
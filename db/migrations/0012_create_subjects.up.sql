@@ -0,0 +1,13 @@
+-- One row per student enrolled in a teaching group
+CREATE TABLE IF NOT EXISTS subjects (
+    id SERIAL PRIMARY KEY,
+    student_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    teacher_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    subject TEXT NOT NULL,
+    code TEXT,
+    initials TEXT,
+    teaching_group TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_subjects_student_id ON subjects(student_id);
+CREATE INDEX IF NOT EXISTS idx_subjects_teacher_id ON subjects(teacher_id);
@@ -0,0 +1 @@
+ALTER TABLE vote_options DROP COLUMN IF EXISTS vote_count;
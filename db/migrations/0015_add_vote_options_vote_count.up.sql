@@ -0,0 +1 @@
+ALTER TABLE vote_options ADD COLUMN IF NOT EXISTS vote_count INTEGER NOT NULL DEFAULT 0;
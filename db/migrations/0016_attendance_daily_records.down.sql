@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_attendance_history_student_date;
+CREATE INDEX idx_attendance_history_student_date ON attendance_history(student_id, attendance_date);
+
+ALTER TABLE attendance_history
+    DROP COLUMN IF EXISTS updated_at,
+    DROP COLUMN IF EXISTS recorded_by;
@@ -0,0 +1,19 @@
+-- attendance_history becomes the source of truth: one record per student per day.
+-- The counters on the attendance table are no longer maintained; they are
+-- computed from these records instead.
+
+-- Keep only the most recent record for each student and day
+DELETE FROM attendance_history older
+USING attendance_history newer
+WHERE older.student_id = newer.student_id
+  AND older.attendance_date = newer.attendance_date
+  AND older.id < newer.id;
+
+UPDATE attendance_history SET status = LOWER(status) WHERE status <> LOWER(status);
+
+ALTER TABLE attendance_history
+    ADD COLUMN IF NOT EXISTS recorded_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+DROP INDEX IF EXISTS idx_attendance_history_student_date;
+CREATE UNIQUE INDEX idx_attendance_history_student_date ON attendance_history(student_id, attendance_date);
@@ -0,0 +1,12 @@
+-- One row per school day the register was finalised (or deliberately skipped).
+-- The unique date makes the rollover idempotent.
+CREATE TABLE IF NOT EXISTS attendance_rollovers (
+    id SERIAL PRIMARY KEY,
+    rollover_date DATE NOT NULL UNIQUE,
+    status TEXT NOT NULL CHECK (status IN ('completed', 'skipped')),
+    reason TEXT,
+    recorded_count INTEGER NOT NULL DEFAULT 0,
+    reset_count INTEGER NOT NULL DEFAULT 0,
+    triggered_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
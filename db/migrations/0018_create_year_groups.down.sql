@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS event_audiences;
+DROP TABLE IF EXISTS voting_event_audiences;
+DROP TABLE IF EXISTS sections;
+DROP TABLE IF EXISTS year_groups;
@@ -0,0 +1,53 @@
+CREATE TABLE IF NOT EXISTS year_groups (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A section is one class of a year group, e.g. IB1 A, with its homeroom.
+-- Students belong to a section through attendance.year and attendance.group_name.
+CREATE TABLE IF NOT EXISTS sections (
+    id SERIAL PRIMARY KEY,
+    year_group_id INTEGER NOT NULL REFERENCES year_groups(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    homeroom TEXT,
+    homeroom_teacher_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (year_group_id, name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_sections_homeroom_teacher_id ON sections(homeroom_teacher_id);
+
+-- Seed the groups that used to be hard-coded, plus any group students are already in
+INSERT INTO year_groups (name, sort_order) VALUES ('PIB', 1), ('IB1', 2)
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO year_groups (name, sort_order)
+SELECT DISTINCT year, 100 FROM attendance WHERE COALESCE(year, '') <> ''
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO sections (year_group_id, name)
+SELECT y.id, s.name FROM year_groups y CROSS JOIN (VALUES ('A'), ('B')) AS s(name)
+WHERE y.name IN ('PIB', 'IB1')
+ON CONFLICT (year_group_id, name) DO NOTHING;
+
+INSERT INTO sections (year_group_id, name)
+SELECT DISTINCT y.id, a.group_name
+FROM attendance a
+JOIN year_groups y ON y.name = a.year
+WHERE COALESCE(a.group_name, '') <> ''
+ON CONFLICT (year_group_id, name) DO NOTHING;
+
+-- Optional audiences: an event without audience rows is visible to everyone
+CREATE TABLE IF NOT EXISTS voting_event_audiences (
+    event_id INTEGER NOT NULL REFERENCES voting_events(id) ON DELETE CASCADE,
+    section_id INTEGER NOT NULL REFERENCES sections(id) ON DELETE CASCADE,
+    PRIMARY KEY (event_id, section_id)
+);
+
+CREATE TABLE IF NOT EXISTS event_audiences (
+    event_id TEXT NOT NULL REFERENCES events(event_id) ON DELETE CASCADE,
+    section_id INTEGER NOT NULL REFERENCES sections(id) ON DELETE CASCADE,
+    PRIMARY KEY (event_id, section_id)
+);
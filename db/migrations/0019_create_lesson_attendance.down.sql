@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_subjects_teaching_group;
+DROP TABLE IF EXISTS lesson_attendance;
+DROP TABLE IF EXISTS lesson_registers;
@@ -0,0 +1,24 @@
+-- A register taken for one lesson of a teaching group. Teaching groups are
+-- identified by subjects.code and subjects.teaching_group.
+CREATE TABLE IF NOT EXISTS lesson_registers (
+    id SERIAL PRIMARY KEY,
+    code TEXT NOT NULL,
+    teaching_group TEXT NOT NULL,
+    lesson_date DATE NOT NULL,
+    period INTEGER NOT NULL DEFAULT 1,
+    taken_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (code, teaching_group, lesson_date, period)
+);
+
+-- One row per student marked in a lesson, kept apart from homeroom attendance_history
+CREATE TABLE IF NOT EXISTS lesson_attendance (
+    register_id INTEGER NOT NULL REFERENCES lesson_registers(id) ON DELETE CASCADE,
+    student_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL,
+    PRIMARY KEY (register_id, student_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_lesson_attendance_student_id ON lesson_attendance(student_id);
+CREATE INDEX IF NOT EXISTS idx_subjects_teaching_group ON subjects(code, teaching_group);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_attendance_history_leave_request_id;
+
+ALTER TABLE attendance_history
+    DROP COLUMN IF EXISTS status_before_leave,
+    DROP COLUMN IF EXISTS leave_request_id;
+
+ALTER TABLE leave_requests
+    DROP COLUMN IF EXISTS leave_end_date,
+    DROP COLUMN IF EXISTS leave_date;
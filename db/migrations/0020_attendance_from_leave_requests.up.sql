@@ -0,0 +1,18 @@
+-- Leave requests cover a day, or a range of days when leave_end_date is set
+ALTER TABLE leave_requests
+    ADD COLUMN IF NOT EXISTS leave_date DATE,
+    ADD COLUMN IF NOT EXISTS leave_end_date DATE;
+
+UPDATE leave_requests SET leave_date = created_at::date WHERE leave_date IS NULL;
+
+ALTER TABLE leave_requests
+    ALTER COLUMN leave_date SET DEFAULT CURRENT_DATE,
+    ALTER COLUMN leave_date SET NOT NULL;
+
+-- Records set by an approved leave request link back to it. status_before_leave
+-- keeps what was marked before, so cancelling the request can restore it.
+ALTER TABLE attendance_history
+    ADD COLUMN IF NOT EXISTS leave_request_id INTEGER REFERENCES leave_requests(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS status_before_leave TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_attendance_history_leave_request_id ON attendance_history(leave_request_id);
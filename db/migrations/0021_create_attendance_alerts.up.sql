@@ -0,0 +1,34 @@
+-- Guardians receive attendance alerts by email
+CREATE TABLE IF NOT EXISTS student_guardians (
+    id SERIAL PRIMARY KEY,
+    student_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL,
+    relationship TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (student_id, email)
+);
+
+-- An alert is raised when a student breaks an attendance rule. last_record_date is
+-- the newest record counted, so only later records can raise the rule again.
+CREATE TABLE IF NOT EXISTS attendance_alerts (
+    id SERIAL PRIMARY KEY,
+    student_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rule TEXT NOT NULL,
+    status TEXT NOT NULL,
+    occurrences INTEGER NOT NULL,
+    window_start DATE NOT NULL,
+    window_end DATE NOT NULL,
+    last_record_date DATE NOT NULL,
+    teacher_notified BOOLEAN NOT NULL DEFAULT FALSE,
+    guardians_notified INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    acknowledged_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    acknowledged_at TIMESTAMP,
+    acknowledgement_note TEXT
+);
+
+-- At most one unacknowledged alert per student and rule
+CREATE UNIQUE INDEX IF NOT EXISTS idx_attendance_alerts_open
+    ON attendance_alerts(student_id, rule) WHERE acknowledged_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_attendance_alerts_student_id ON attendance_alerts(student_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS school_closures;
+DROP TABLE IF EXISTS terms;
+DROP TABLE IF EXISTS academic_years;
@@ -0,0 +1,15 @@
+-- Every change to a daily attendance record, for the audit trail. A NULL status means
+-- the day had no record (Pending); changed_by is NULL for the scheduled rollover.
+CREATE TABLE IF NOT EXISTS attendance_changes (
+    id SERIAL PRIMARY KEY,
+    student_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    attendance_date DATE NOT NULL,
+    previous_status TEXT,
+    new_status TEXT,
+    changed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    source TEXT NOT NULL,
+    note TEXT,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_attendance_changes_student ON attendance_changes(student_id, attendance_date);
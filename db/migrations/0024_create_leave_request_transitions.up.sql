@@ -0,0 +1,24 @@
+-- Every status change of a leave request with who made it; from_status is NULL for
+-- the creation of the request
+CREATE TABLE IF NOT EXISTS leave_request_transitions (
+    id SERIAL PRIMARY KEY,
+    leave_request_id INTEGER NOT NULL REFERENCES leave_requests(id) ON DELETE CASCADE,
+    from_status TEXT,
+    to_status TEXT NOT NULL,
+    actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_leave_request_transitions_request ON leave_request_transitions(leave_request_id);
+
+-- Reconstruct what is known of the existing requests: their creation, and the
+-- response that gave them their current status
+INSERT INTO leave_request_transitions (leave_request_id, from_status, to_status, actor_id, created_at)
+SELECT id, NULL, 'pending', student_id, created_at FROM leave_requests;
+
+INSERT INTO leave_request_transitions (leave_request_id, from_status, to_status, actor_id, created_at)
+SELECT id, 'pending', status,
+    CASE WHEN status = 'cancelled' THEN student_id ELSE responded_by END,
+    COALESCE(response_time, updated_at)
+FROM leave_requests
+WHERE status <> 'pending';
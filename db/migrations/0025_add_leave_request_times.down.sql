@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_leave_requests_overdue;
+
+ALTER TABLE leave_requests
+    DROP COLUMN IF EXISTS returned_at,
+    DROP COLUMN IF EXISTS ends_at,
+    DROP COLUMN IF EXISTS starts_at;
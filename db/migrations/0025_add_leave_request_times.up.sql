@@ -0,0 +1,9 @@
+-- Leave can cover part of a day: starts_at and ends_at are the optional window the
+-- student is away, and returned_at is when they checked back in
+ALTER TABLE leave_requests
+    ADD COLUMN IF NOT EXISTS starts_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS ends_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS returned_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_leave_requests_overdue ON leave_requests(ends_at)
+    WHERE status = 'approved' AND returned_at IS NULL;
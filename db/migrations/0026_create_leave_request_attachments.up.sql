@@ -0,0 +1,14 @@
+-- Supporting files for leave requests, e.g. a doctor's note. Unlike documents they
+-- are not served statically; only the student and staff can download them.
+CREATE TABLE IF NOT EXISTS leave_request_attachments (
+    id TEXT PRIMARY KEY,
+    leave_request_id INTEGER NOT NULL REFERENCES leave_requests(id) ON DELETE CASCADE,
+    file_name TEXT NOT NULL,
+    file_path TEXT NOT NULL,
+    file_type TEXT NOT NULL,
+    file_size INTEGER NOT NULL,
+    uploaded_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_leave_request_attachments_request ON leave_request_attachments(leave_request_id, created_at);
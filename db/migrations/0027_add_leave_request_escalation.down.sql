@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_leave_requests_awaiting_response;
+
+ALTER TABLE leave_requests
+    DROP COLUMN IF EXISTS escalated_at,
+    DROP COLUMN IF EXISTS escalation_level;
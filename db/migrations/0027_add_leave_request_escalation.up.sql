@@ -0,0 +1,8 @@
+-- Unanswered leave requests escalate through the configured tiers. The level reached
+-- is stored so escalation picks up where it left off after a restart.
+ALTER TABLE leave_requests
+    ADD COLUMN IF NOT EXISTS escalation_level INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS escalated_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_leave_requests_awaiting_response ON leave_requests(created_at)
+    WHERE status IN ('sent', 'pending');
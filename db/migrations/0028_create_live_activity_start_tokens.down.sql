@@ -0,0 +1 @@
+DROP TABLE IF EXISTS live_activity_start_tokens;
@@ -0,0 +1,7 @@
+-- Push-to-start tokens let the server start a user's leave request Live Activity
+-- remotely. iOS issues one token per app install, so each user keeps the latest.
+CREATE TABLE IF NOT EXISTS live_activity_start_tokens (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    token TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,9 @@
+-- Refresh tokens replaced by rotation. Presenting one again means the token was
+-- copied or replayed, so the session it belonged to is revoked.
+CREATE TABLE IF NOT EXISTS rotated_refresh_tokens (
+    token_hash TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL REFERENCES user_sessions(id) ON DELETE CASCADE,
+    rotated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_rotated_refresh_tokens_session ON rotated_refresh_tokens(session_id);
@@ -0,0 +1,36 @@
+-- The legacy counters on the attendance table covered far more days than the daily
+-- records, which only became the source of truth in 0016. What the counters held
+-- beyond the records from before then is kept here, per student, and added to the
+-- totals derived from the records. The counter columns themselves are untouched.
+CREATE TABLE IF NOT EXISTS attendance_baselines (
+    student_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    present INTEGER NOT NULL DEFAULT 0,
+    absent INTEGER NOT NULL DEFAULT 0,
+    late INTEGER NOT NULL DEFAULT 0,
+    medical INTEGER NOT NULL DEFAULT 0,
+    early INTEGER NOT NULL DEFAULT 0
+);
+
+INSERT INTO attendance_baselines (student_id, present, absent, late, medical, early)
+SELECT a.user_id,
+    GREATEST(a.present - COALESCE(h.present, 0), 0),
+    GREATEST(a.absent - COALESCE(h.absent, 0), 0),
+    GREATEST(a.late - COALESCE(h.late, 0), 0),
+    GREATEST(a.medical - COALESCE(h.medical, 0), 0),
+    GREATEST(a.early - COALESCE(h.early, 0), 0)
+FROM attendance a
+LEFT JOIN (
+    -- Records made since 0016 were never added to the counters
+    SELECT student_id,
+        COUNT(*) FILTER (WHERE status = 'present') AS present,
+        COUNT(*) FILTER (WHERE status = 'absent') AS absent,
+        COUNT(*) FILTER (WHERE status = 'late') AS late,
+        COUNT(*) FILTER (WHERE status = 'medical') AS medical,
+        COUNT(*) FILTER (WHERE status = 'early') AS early
+    FROM attendance_history
+    WHERE attendance_date < COALESCE(
+        (SELECT applied_at::date FROM schema_migrations WHERE version = 16), CURRENT_DATE)
+    GROUP BY student_id
+) h ON h.student_id = a.user_id
+WHERE a.present + a.absent + a.late + a.medical + a.early > 0
+ON CONFLICT (student_id) DO NOTHING;
@@ -0,0 +1,7 @@
+-- Configured holidays already copied into school_closures. Each date is imported at
+-- most once, so a holiday closure deleted by an admin stays deleted, and server
+-- instances starting together cannot both import it.
+CREATE TABLE IF NOT EXISTS imported_holidays (
+    holiday_date DATE PRIMARY KEY,
+    imported_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,14 @@
+// Package migrations embeds the versioned SQL schema migrations.
+//
+// Each migration is a pair of files named <version>_<name>.up.sql and
+// <version>_<name>.down.sql. Versions are applied in ascending order by
+// the runner in the database package; never edit a migration that has
+// already been applied, add a new one instead.
+package migrations
+
+import "embed"
+
+// FS holds every migration file in this directory
+//
+//go:embed *.sql
+var FS embed.FS
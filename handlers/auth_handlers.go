@@ -8,9 +8,8 @@ import (
 	"math/big"
 	stdrand "math/rand"
 	"net/http"
-	"net/smtp"
-	"server/config"
 	"server/models"
+	"server/notifications"
 	"server/utils"
 	"strings"
 	"sync"
@@ -458,8 +457,6 @@ func generateSessionID() string {
 func sendResetCodeEmail(email, code string) bool {
 	log.Printf("Preparing to send reset code %s to %s", code, email)
 
-	// Setup the email message
-	to := []string{email}
 	subject := "HSANNU Connect - Password Reset Code"
 
 	// Construct the message body (text version)
@@ -479,40 +476,7 @@ Best regards,
 HSANNU Connect Support Team
 `, code)
 
-	// Build the email with correct headers
-	mime := "MIME-version: 1.0;\nContent-Type: text/plain; charset=\"UTF-8\";\n\n"
-	message := fmt.Sprintf("From: %s\r\n"+
-		"To: %s\r\n"+
-		"Subject: %s\r\n"+
-		"%s\r\n"+
-		"%s",
-		config.SMTPSender,
-		email,
-		subject,
-		mime,
-		body)
-
-	// Set up authentication information.
-	auth := smtp.PlainAuth("",
-		config.SMTPUsername,
-		config.SMTPPassword,
-		config.SMTPHost)
-
-	// Connect to the server, authenticate, and send the email
-	smtpAddr := fmt.Sprintf("%s:%s", config.SMTPHost, config.SMTPPort)
-
-	log.Printf("Attempting to send email to %s via SMTP server %s", email, smtpAddr)
-
-	// Send the email
-	err := smtp.SendMail(
-		smtpAddr,
-		auth,
-		config.SMTPUsername,
-		to,
-		[]byte(message),
-	)
-
-	if err != nil {
+	if err := notifications.SendEmail([]string{email}, subject, body); err != nil {
 		log.Printf("Error sending email to %s: %v", email, err)
 		return false
 	}
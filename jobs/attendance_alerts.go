@@ -0,0 +1,178 @@
+package jobs
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"server/config"
+	"server/models"
+	"server/notifications"
+	"server/store"
+	"strings"
+	"time"
+)
+
+// AttendanceAlerts checks students' attendance against the configured alert rules
+// and notifies their homeroom teacher and guardians when a rule is broken
+type AttendanceAlerts struct {
+	alerts     store.AttendanceAlertStore
+	yearGroups store.YearGroupStore
+	users      store.UserStore
+	guardians  store.GuardianStore
+}
+
+// NewAttendanceAlerts returns the alert evaluator for the given stores
+func NewAttendanceAlerts(alerts store.AttendanceAlertStore, yearGroups store.YearGroupStore, users store.UserStore, guardians store.GuardianStore) *AttendanceAlerts {
+	return &AttendanceAlerts{alerts: alerts, yearGroups: yearGroups, users: users, guardians: guardians}
+}
+
+// Evaluate checks the students against every alert rule in the background, with
+// the rule windows ending on day. Each broken rule raises one alert, and nobody is
+// notified again until it is acknowledged and the rule is broken by new records.
+func (a *AttendanceAlerts) Evaluate(day time.Time, studentIDs ...int) {
+	rules := config.Get().Attendance.AlertRules
+	if len(rules) == 0 || len(studentIDs) == 0 {
+		return
+	}
+
+	go func() {
+		for _, studentID := range studentIDs {
+			for _, rule := range rules {
+				if err := a.check(day, studentID, rule); err != nil {
+					log.Printf("Attendance alert rule %s for student %d failed: %v", rule.Name, studentID, err)
+				}
+			}
+		}
+	}()
+}
+
+// check raises and sends an alert if the student breaks rule
+func (a *AttendanceAlerts) check(day time.Time, studentID int, rule config.AttendanceAlertRule) error {
+	from := windowStart(day, rule)
+	count, last, err := a.alerts.CountOccurrences(studentID, rule.Name, rule.Status, rule.Unexplained, from, day)
+	if err != nil {
+		return err
+	}
+	if count < rule.Count {
+		return nil
+	}
+
+	alert := &models.AttendanceAlert{
+		StudentID:      studentID,
+		Rule:           rule.Name,
+		Status:         rule.Status,
+		Occurrences:    count,
+		WindowStart:    from,
+		WindowEnd:      day,
+		LastRecordDate: *last,
+	}
+	if err := a.alerts.Create(alert); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			// Still waiting for the open alert to be acknowledged
+			return nil
+		}
+		return err
+	}
+	log.Printf("Attendance alert %d raised: student %d broke rule %s", alert.ID, studentID, rule.Name)
+
+	message := alertMessage(alert, rule)
+	teacherNotified := a.notifyTeacher(alert, message)
+	guardiansNotified := a.notifyGuardians(alert, message)
+	return a.alerts.SetNotified(alert.ID, teacherNotified, guardiansNotified)
+}
+
+// notifyTeacher pushes the alert to the homeroom teacher of the student's section
+func (a *AttendanceAlerts) notifyTeacher(alert *models.AttendanceAlert, message string) bool {
+	section, err := a.yearGroups.GetStudentSection(alert.StudentID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error finding the section of student %d: %v", alert.StudentID, err)
+		}
+		return false
+	}
+	if section.HomeroomTeacherID == nil {
+		return false
+	}
+
+	teacher, err := a.users.GetByID(*section.HomeroomTeacherID)
+	if err != nil {
+		log.Printf("Error finding homeroom teacher %d: %v", *section.HomeroomTeacherID, err)
+		return false
+	}
+	if teacher.DeviceID == "" {
+		return false
+	}
+
+	if err := notifications.SendAttendanceAlertNotification(teacher.DeviceID, alert.ID, alert.StudentName, message); err != nil {
+		log.Printf("Error notifying homeroom teacher %d of attendance alert %d: %v", teacher.ID, alert.ID, err)
+		return false
+	}
+	return true
+}
+
+// notifyGuardians emails the alert to the student's guardians, returning how many
+// were sent it
+func (a *AttendanceAlerts) notifyGuardians(alert *models.AttendanceAlert, message string) int {
+	guardians, err := a.guardians.ListByStudent(alert.StudentID)
+	if err != nil {
+		log.Printf("Error listing the guardians of student %d: %v", alert.StudentID, err)
+		return 0
+	}
+
+	sent := 0
+	for _, guardian := range guardians {
+		body := fmt.Sprintf(`
+Dear %s,
+
+%s
+
+Please contact the school if you have any questions.
+
+Best regards,
+HSANNU Connect
+`, guardian.Name, message)
+
+		if err := notifications.SendEmail([]string{guardian.Email}, "HSANNU Connect - Attendance Alert", body); err != nil {
+			log.Printf("Error emailing guardian %d of attendance alert %d: %v", guardian.ID, alert.ID, err)
+			continue
+		}
+		sent++
+	}
+	return sent
+}
+
+// windowStart returns the first day of the rule's window ending on day
+func windowStart(day time.Time, rule config.AttendanceAlertRule) time.Time {
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	if rule.SchoolDays == 0 {
+		return day.AddDate(0, 0, 1-rule.Days)
+	}
+
+	// Walk back until the window holds the configured number of school days, going
+	// no further than a year in case the calendar has none
+	start := day
+	limit := day.AddDate(-1, 0, 0)
+	for counted := 0; start.After(limit); start = start.AddDate(0, 0, -1) {
+		if IsSchoolDay(start) {
+			counted++
+		}
+		if counted == rule.SchoolDays {
+			break
+		}
+	}
+	return start
+}
+
+// alertMessage describes a broken rule for the teacher and guardians
+func alertMessage(alert *models.AttendanceAlert, rule config.AttendanceAlertRule) string {
+	status := strings.ToLower(alert.Status)
+	if rule.Unexplained {
+		status = "unexplained " + status
+	}
+	window := fmt.Sprintf("%d days", rule.Days)
+	if rule.SchoolDays != 0 {
+		window = fmt.Sprintf("%d school days", rule.SchoolDays)
+	}
+	return fmt.Sprintf("%s has been marked %s %d times in the last %s.", alert.StudentName, status, alert.Occurrences, window)
+}
@@ -0,0 +1,153 @@
+package jobs
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"server/config"
+	"server/models"
+	"server/store"
+	"time"
+)
+
+// AttendanceRollover finalises the day's attendance register at the configured
+// cutoff and resets it to Pending for the next school day
+type AttendanceRollover struct {
+	attendance store.AttendanceStore
+}
+
+// NewAttendanceRollover returns the rollover job for the given store
+func NewAttendanceRollover(attendance store.AttendanceStore) *AttendanceRollover {
+	return &AttendanceRollover{attendance: attendance}
+}
+
+// maxRolloverCatchUp is the most earlier days closed at once after the server missed
+// cutoffs, so a long outage does not fill the rollover reports with missed days
+const maxRolloverCatchUp = 31
+
+// Start runs the rollover in the background every day at attendance.rollover_time.
+// Days whose cutoff passed while the server was down, or whose rollover failed, are
+// caught up at startup and on the retry.
+func (r *AttendanceRollover) Start() {
+	go func() {
+		for {
+			now := time.Now()
+			if err := r.CatchUp(now); err != nil {
+				// Runs are idempotent, so retry shortly rather than losing the day
+				log.Printf("Attendance rollover failed: %v", err)
+				time.Sleep(time.Minute)
+				continue
+			}
+
+			next := config.Get().Attendance.RolloverAt(now)
+			if !now.Before(next) {
+				next = config.Get().Attendance.RolloverAt(now.AddDate(0, 0, 1))
+			}
+			time.Sleep(time.Until(next))
+		}
+	}()
+}
+
+// CatchUp brings the rollovers up to date as of now. The register only ever holds
+// today's marks, so it is rolled over into today once today's cutoff has passed.
+// Earlier days that were never rolled over are only closed as missed: their marks
+// were recorded as they were taken, and whatever they left on the register is
+// cleared. Without any earlier rollover, tracking starts from today.
+func (r *AttendanceRollover) CatchUp(now time.Time) error {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	first := today
+	last, err := r.attendance.LastRolloverDate()
+	switch {
+	case err == sql.ErrNoRows:
+		if _, _, err := r.attendance.SkipRollover(today.AddDate(0, 0, -1), models.RolloverFirstRun); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		first = time.Date(last.Year(), last.Month(), last.Day()+1, 0, 0, 0, 0, now.Location())
+		if earliest := today.AddDate(0, 0, -maxRolloverCatchUp); first.Before(earliest) {
+			log.Printf("Attendance rollover: not catching up the days from %s to %s, more than %d days ago",
+				first.Format("2006-01-02"), earliest.AddDate(0, 0, -1).Format("2006-01-02"), maxRolloverCatchUp)
+			first = earliest
+		}
+	}
+
+	if first.Before(today) {
+		for day := first; day.Before(today); day = day.AddDate(0, 0, 1) {
+			reason := skipReason(day)
+			if reason == "" {
+				reason = models.RolloverMissed
+			}
+			report, ran, err := r.attendance.SkipRollover(day, reason)
+			if err != nil {
+				return fmt.Errorf("closing %s: %v", day.Format("2006-01-02"), err)
+			}
+			if ran {
+				log.Printf("Attendance rollover for %s %s: %s", day.Format("2006-01-02"), report.Status, report.Reason)
+			}
+		}
+
+		cleared, err := r.attendance.ClearStaleRegister(today)
+		if err != nil {
+			return err
+		}
+		if cleared > 0 {
+			log.Printf("Attendance rollover: cleared %d register marks left over from before %s", cleared, today.Format("2006-01-02"))
+		}
+	}
+
+	if now.Before(config.Get().Attendance.RolloverAt(now)) {
+		return nil
+	}
+	if _, _, err := r.Run(today, nil); err != nil {
+		return fmt.Errorf("rolling over %s: %v", today.Format("2006-01-02"), err)
+	}
+	return nil
+}
+
+// Run rolls over the register for day, skipping days without school.
+// triggeredBy is the admin running it by hand, or nil for the scheduler. The bool
+// result is false if the day had already been rolled over.
+func (r *AttendanceRollover) Run(day time.Time, triggeredBy *int) (*models.AttendanceRollover, bool, error) {
+	report, ran, err := r.attendance.Rollover(day, skipReason(day), triggeredBy)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if ran {
+		log.Printf("Attendance rollover for %s %s: %d records written, %d registers reset",
+			day.Format("2006-01-02"), report.Status, report.RecordedCount, report.ResetCount)
+	}
+	return report, ran, nil
+}
+
+// IsSchoolDay reports whether the register is taken on day
+func IsSchoolDay(day time.Time) bool {
+	return skipReason(day) == ""
+}
+
+// CountSchoolDays returns the number of school days from from to to, inclusive
+func CountSchoolDays(from time.Time, to time.Time) int {
+	count := 0
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if IsSchoolDay(day) {
+			count++
+		}
+	}
+	return count
+}
+
+// skipReason explains why day is not a school day, or returns "" if it is. Besides
+// weekends and configured holidays, the school calendar's closures and the days
+// outside its terms have no school.
+func skipReason(day time.Time) string {
+	switch {
+	case day.Weekday() == time.Saturday || day.Weekday() == time.Sunday:
+		return models.NoSchoolWeekend
+	case config.Get().Attendance.IsHoliday(day):
+		return models.NoSchoolHoliday
+	}
+	return closedReason(day)
+}
@@ -0,0 +1,217 @@
+package jobs
+
+import (
+	"database/sql"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"server/models"
+	"server/store"
+)
+
+// fakeRolloverStore keeps rollover reports in memory and records which days had
+// their register rolled over and how often the stale register was cleared
+type fakeRolloverStore struct {
+	store.AttendanceStore
+
+	reports    map[string]models.AttendanceRollover
+	rolledOver []string // days whose register was recorded or reset
+	cleared    int
+}
+
+func newFakeRolloverStore(days ...string) *fakeRolloverStore {
+	s := &fakeRolloverStore{reports: make(map[string]models.AttendanceRollover)}
+	for _, day := range days {
+		s.reports[day] = models.AttendanceRollover{Date: parseDay(day), Status: models.RolloverCompleted}
+	}
+	return s
+}
+
+func (s *fakeRolloverStore) LastRolloverDate() (time.Time, error) {
+	if len(s.reports) == 0 {
+		return time.Time{}, sql.ErrNoRows
+	}
+	var last time.Time
+	for _, report := range s.reports {
+		if report.Date.After(last) {
+			last = report.Date
+		}
+	}
+	return last, nil
+}
+
+func (s *fakeRolloverStore) Rollover(day time.Time, skipReason string, triggeredBy *int) (*models.AttendanceRollover, bool, error) {
+	key := day.Format("2006-01-02")
+	if report, ok := s.reports[key]; ok {
+		return &report, false, nil
+	}
+	report := models.AttendanceRollover{Date: day, Status: models.RolloverCompleted}
+	if skipReason != "" {
+		report.Status, report.Reason = models.RolloverSkipped, skipReason
+	}
+	s.reports[key] = report
+	s.rolledOver = append(s.rolledOver, key)
+	return &report, true, nil
+}
+
+func (s *fakeRolloverStore) SkipRollover(day time.Time, reason string) (*models.AttendanceRollover, bool, error) {
+	key := day.Format("2006-01-02")
+	if report, ok := s.reports[key]; ok {
+		return &report, false, nil
+	}
+	report := models.AttendanceRollover{Date: day, Status: models.RolloverSkipped, Reason: reason}
+	s.reports[key] = report
+	return &report, true, nil
+}
+
+func (s *fakeRolloverStore) ClearStaleRegister(today time.Time) (int64, error) {
+	s.cleared++
+	return 0, nil
+}
+
+// reasons returns the reason of each skipped day, by date
+func (s *fakeRolloverStore) reasons() map[string]string {
+	reasons := make(map[string]string)
+	for key, report := range s.reports {
+		if report.Status == models.RolloverSkipped {
+			reasons[key] = report.Reason
+		}
+	}
+	return reasons
+}
+
+func parseDay(day string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02", day, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// parseTime returns the given time of day, as HH:MM, on day
+func parseTime(day string, clock string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04", day+" "+clock, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// The default cutoff is 17:00, and 2026-10-14 is a Wednesday
+
+func TestCatchUpFirstRunBeforeCutoffLeavesTheRegister(t *testing.T) {
+	attendance := newFakeRolloverStore()
+	if err := NewAttendanceRollover(attendance).CatchUp(parseTime("2026-10-14", "09:30")); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := map[string]string{"2026-10-13": models.RolloverFirstRun}; !reflect.DeepEqual(attendance.reasons(), want) {
+		t.Fatalf("skipped days: got %v, want %v", attendance.reasons(), want)
+	}
+	if len(attendance.rolledOver) != 0 {
+		t.Fatalf("rolled over %v before today's cutoff, the morning's marks would be lost", attendance.rolledOver)
+	}
+	if attendance.cleared != 0 {
+		t.Fatalf("cleared the register on the first run")
+	}
+}
+
+func TestCatchUpFirstRunAfterCutoffRollsOverToday(t *testing.T) {
+	attendance := newFakeRolloverStore()
+	if err := NewAttendanceRollover(attendance).CatchUp(parseTime("2026-10-14", "17:30")); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"2026-10-14"}; !reflect.DeepEqual(attendance.rolledOver, want) {
+		t.Fatalf("rolled over %v, want %v", attendance.rolledOver, want)
+	}
+	if attendance.cleared != 0 {
+		t.Fatalf("cleared the register on the first run")
+	}
+}
+
+func TestCatchUpUpToDate(t *testing.T) {
+	attendance := newFakeRolloverStore("2026-10-13")
+	rollover := NewAttendanceRollover(attendance)
+
+	if err := rollover.CatchUp(parseTime("2026-10-14", "08:00")); err != nil {
+		t.Fatal(err)
+	}
+	if len(attendance.rolledOver) != 0 || attendance.cleared != 0 {
+		t.Fatalf("before the cutoff: rolled over %v and cleared %d times, want neither", attendance.rolledOver, attendance.cleared)
+	}
+
+	// At the cutoff, and again on a restart later the same evening
+	for _, now := range []time.Time{parseTime("2026-10-14", "17:00"), parseTime("2026-10-14", "22:00")} {
+		if err := rollover.CatchUp(now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"2026-10-14"}; !reflect.DeepEqual(attendance.rolledOver, want) {
+		t.Fatalf("rolled over %v, want %v", attendance.rolledOver, want)
+	}
+	if attendance.cleared != 0 {
+		t.Fatalf("cleared the register with no missed days")
+	}
+}
+
+func TestCatchUpClosesMissedDaysWithoutRollingThemOver(t *testing.T) {
+	// Down from Thursday evening until Tuesday morning
+	attendance := newFakeRolloverStore("2026-10-07")
+	if err := NewAttendanceRollover(attendance).CatchUp(parseTime("2026-10-13", "07:45")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"2026-10-08": models.RolloverMissed,
+		"2026-10-09": models.RolloverMissed,
+		"2026-10-10": models.NoSchoolWeekend,
+		"2026-10-11": models.NoSchoolWeekend,
+		"2026-10-12": models.RolloverMissed,
+	}
+	if !reflect.DeepEqual(attendance.reasons(), want) {
+		t.Fatalf("skipped days: got %v, want %v", attendance.reasons(), want)
+	}
+	if len(attendance.rolledOver) != 0 {
+		t.Fatalf("rolled the register over into %v, it only holds today's marks", attendance.rolledOver)
+	}
+	if attendance.cleared != 1 {
+		t.Fatalf("cleared the register %d times, want once", attendance.cleared)
+	}
+}
+
+func TestCatchUpAfterCutoffRollsOverTodayOnly(t *testing.T) {
+	attendance := newFakeRolloverStore("2026-10-12")
+	if err := NewAttendanceRollover(attendance).CatchUp(parseTime("2026-10-14", "18:00")); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := map[string]string{"2026-10-13": models.RolloverMissed}; !reflect.DeepEqual(attendance.reasons(), want) {
+		t.Fatalf("skipped days: got %v, want %v", attendance.reasons(), want)
+	}
+	if want := []string{"2026-10-14"}; !reflect.DeepEqual(attendance.rolledOver, want) {
+		t.Fatalf("rolled over %v, want %v", attendance.rolledOver, want)
+	}
+	if attendance.cleared != 1 {
+		t.Fatalf("cleared the register %d times, want once", attendance.cleared)
+	}
+}
+
+func TestCatchUpIsLimited(t *testing.T) {
+	attendance := newFakeRolloverStore("2026-01-05")
+	if err := NewAttendanceRollover(attendance).CatchUp(parseTime("2026-10-14", "09:00")); err != nil {
+		t.Fatal(err)
+	}
+
+	var days []string
+	for day := range attendance.reasons() {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	if len(days) != maxRolloverCatchUp || days[0] != "2026-09-13" || days[len(days)-1] != "2026-10-13" {
+		t.Fatalf("closed %d days from %s to %s, want %d days from 2026-09-13 to 2026-10-13",
+			len(days), days[0], days[len(days)-1], maxRolloverCatchUp)
+	}
+}
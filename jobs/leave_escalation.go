@@ -0,0 +1,66 @@
+package jobs
+
+import (
+	"database/sql"
+	"log"
+	"server/config"
+	"server/store"
+	"time"
+)
+
+// leaveEscalationInterval is how often unanswered leave requests are checked
+const leaveEscalationInterval = time.Minute
+
+// LeaveEscalation notifies the configured escalation tiers about leave requests
+// left unanswered. The tier each request reached is stored on it, so escalation
+// carries on where it left off after a restart.
+type LeaveEscalation struct {
+	leaveRequests store.LeaveRequestStore
+	notifier      *LeaveNotifier
+}
+
+// NewLeaveEscalation returns the escalation job for the given store
+func NewLeaveEscalation(leaveRequests store.LeaveRequestStore, notifier *LeaveNotifier) *LeaveEscalation {
+	return &LeaveEscalation{leaveRequests: leaveRequests, notifier: notifier}
+}
+
+// Start checks for requests to escalate in the background every minute
+func (e *LeaveEscalation) Start() {
+	go func() {
+		for {
+			if err := e.Run(time.Now()); err != nil {
+				log.Printf("Leave request escalation failed: %v", err)
+			}
+			time.Sleep(leaveEscalationInterval)
+		}
+	}()
+}
+
+// Run escalates every request that has waited past a tier it has not reached. The
+// tiers are checked from the last, so a request overdue for several tiers, e.g. after
+// downtime, only notifies the highest one.
+func (e *LeaveEscalation) Run(now time.Time) error {
+	tiers := config.Get().Leave.EscalationTiers
+	for i := len(tiers) - 1; i >= 0; i-- {
+		level, tier := i+1, tiers[i]
+		requests, err := e.leaveRequests.ListAwaitingEscalation(level, now.Add(-tier.After.Duration))
+		if err != nil {
+			return err
+		}
+
+		for _, request := range requests {
+			escalated, err := e.leaveRequests.Escalate(request.ID, level, now)
+			if err == sql.ErrNoRows {
+				// Answered or escalated since it was listed
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			log.Printf("Leave request %d escalated to tier %d (%s)", escalated.ID, level, tier.Role)
+			e.notifier.NotifyEscalated(*escalated, tier.Role, tier.After.Duration)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"server/config"
+	"server/models"
+	"server/notifications"
+	"server/store"
+	"time"
+)
+
+// LeaveLiveActivities keeps a student's leave request Live Activity in step with
+// the request: it starts one remotely when the app has not, pushes each status
+// change and ends it once the request is rejected, cancelled or finished
+type LeaveLiveActivities struct {
+	leaveRequests store.LeaveRequestStore
+	users         store.UserStore
+}
+
+// NewLeaveLiveActivities returns the Live Activity sender for the given stores
+func NewLeaveLiveActivities(leaveRequests store.LeaveRequestStore, users store.UserStore) *LeaveLiveActivities {
+	return &LeaveLiveActivities{leaveRequests: leaveRequests, users: users}
+}
+
+// Start starts a Live Activity for a new request in the background with the
+// student's push-to-start token, unless the app already attached one. The app then
+// uploads the activity's own token through PUT /leave-requests/:requestId/live-activity.
+func (l *LeaveLiveActivities) Start(request models.LeaveRequest) {
+	if request.LiveActivityToken != nil {
+		return
+	}
+
+	go func() {
+		token, err := l.users.GetLiveActivityStartToken(request.StudentID)
+		if err != nil {
+			log.Printf("Error getting the Live Activity start token of student %d: %v", request.StudentID, err)
+			return
+		}
+		if token == "" {
+			return
+		}
+
+		attributes := map[string]interface{}{
+			"requestId":   request.ID,
+			"studentName": request.StudentName,
+			"requestType": request.RequestType,
+			"leaveDate":   request.LeaveDate,
+		}
+		content := notifications.LiveActivityContent{Status: request.Status}
+		body := fmt.Sprintf("Your %s leave request is waiting for a response.", request.RequestType)
+		err = notifications.StartLiveActivity(token, attributes, content, "Leave request sent", body)
+		if err == nil {
+			return
+		}
+		log.Printf("Error starting the Live Activity of leave request %d: %v", request.ID, err)
+		if errors.Is(err, notifications.ErrInvalidToken) {
+			if err := l.users.ClearLiveActivityStartToken(request.StudentID, token); err != nil {
+				log.Printf("Error clearing the Live Activity start token of student %d: %v", request.StudentID, err)
+			}
+		}
+	}()
+}
+
+// Sync pushes the request's status to its Live Activity in the background, with
+// respondedBy and at as the response. A final status ends the activity, which is
+// dismissed after the configured delay, and the activity token is forgotten.
+func (l *LeaveLiveActivities) Sync(request models.LeaveRequest, respondedBy string, at time.Time) {
+	if request.LiveActivityToken == nil {
+		return
+	}
+	token := *request.LiveActivityToken
+	content := notifications.LiveActivityContent{
+		Status:       request.Status,
+		ResponseTime: &at,
+		RespondedBy:  respondedBy,
+	}
+
+	go func() {
+		if !models.IsFinalLeaveStatus(request.Status) {
+			err := notifications.UpdateLiveActivity(token, content)
+			if err == nil {
+				return
+			}
+			log.Printf("Error updating the Live Activity of leave request %d: %v", request.ID, err)
+			if !errors.Is(err, notifications.ErrInvalidToken) {
+				return
+			}
+		} else {
+			dismissAt := time.Now().Add(config.Get().Leave.LiveActivityDismissal.Duration)
+			if err := notifications.EndLiveActivity(token, content, dismissAt); err != nil {
+				log.Printf("Error ending the Live Activity of leave request %d: %v", request.ID, err)
+			}
+		}
+
+		// The activity has ended, so its token will not be accepted again
+		if err := l.leaveRequests.ClearLiveActivityToken(request.ID, token); err != nil {
+			log.Printf("Error clearing the Live Activity token of leave request %d: %v", request.ID, err)
+		}
+	}()
+}
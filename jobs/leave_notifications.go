@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"server/config"
+	"server/models"
+	"server/notifications"
+	"server/store"
+	"time"
+)
+
+// leaveRefreshType is the refresh value of the silent push telling staff apps to
+// reload their leave request lists
+const leaveRefreshType = "leave_requests"
+
+// LeaveNotifier tells staff about new leave requests: the student's homeroom
+// teacher and every user with the configured duty role
+type LeaveNotifier struct {
+	yearGroups store.YearGroupStore
+	users      store.UserStore
+}
+
+// NewLeaveNotifier returns the leave request notifier for the given stores
+func NewLeaveNotifier(yearGroups store.YearGroupStore, users store.UserStore) *LeaveNotifier {
+	return &LeaveNotifier{yearGroups: yearGroups, users: users}
+}
+
+// NotifyCreated pushes the new request to its recipients in the background,
+// followed by a silent push so their pending lists refresh
+func (n *LeaveNotifier) NotifyCreated(request models.LeaveRequest) {
+	go func() {
+		message := leaveRequestMessage(request)
+		for _, recipient := range n.recipients(request.StudentID) {
+			if recipient.DeviceID == "" {
+				continue
+			}
+			if err := notifications.SendLeaveRequestNotification(recipient.DeviceID, request.ID, request.StudentName, message); err != nil {
+				log.Printf("Error notifying user %d of leave request %d: %v", recipient.ID, request.ID, err)
+			}
+			if err := notifications.SendRefreshNotification(recipient.DeviceID, leaveRefreshType); err != nil {
+				log.Printf("Error refreshing the leave requests of user %d: %v", recipient.ID, err)
+			}
+		}
+	}()
+}
+
+// NotifyEscalated pushes a request left unanswered for longer than after to the
+// users with role, followed by a silent push so their pending lists refresh
+func (n *LeaveNotifier) NotifyEscalated(request models.LeaveRequest, role string, after time.Duration) {
+	users, err := n.users.ListByRole(role)
+	if err != nil {
+		log.Printf("Error listing users with the %s role: %v", role, err)
+		return
+	}
+
+	message := fmt.Sprintf("Unanswered for over %d minutes. %s", int(after.Minutes()), leaveRequestMessage(request))
+	for _, user := range users {
+		if user.DeviceID == "" || user.ID == request.StudentID {
+			continue
+		}
+		if err := notifications.SendLeaveRequestNotification(user.DeviceID, request.ID, request.StudentName, message); err != nil {
+			log.Printf("Error notifying user %d of escalated leave request %d: %v", user.ID, request.ID, err)
+		}
+		if err := notifications.SendRefreshNotification(user.DeviceID, leaveRefreshType); err != nil {
+			log.Printf("Error refreshing the leave requests of user %d: %v", user.ID, err)
+		}
+	}
+}
+
+// recipients returns the homeroom teacher of the student's section and the duty
+// role users, each once
+func (n *LeaveNotifier) recipients(studentID int) []models.User {
+	var recipients []models.User
+	seen := make(map[int]bool)
+	add := func(user models.User) {
+		if user.ID != studentID && !seen[user.ID] {
+			seen[user.ID] = true
+			recipients = append(recipients, user)
+		}
+	}
+
+	section, err := n.yearGroups.GetStudentSection(studentID)
+	switch {
+	case err == nil && section.HomeroomTeacherID != nil:
+		teacher, err := n.users.GetByID(*section.HomeroomTeacherID)
+		if err != nil {
+			log.Printf("Error finding homeroom teacher %d: %v", *section.HomeroomTeacherID, err)
+		} else {
+			add(*teacher)
+		}
+	case err != nil && err != sql.ErrNoRows:
+		log.Printf("Error finding the section of student %d: %v", studentID, err)
+	}
+
+	if role := config.Get().Leave.DutyRole; role != "" {
+		users, err := n.users.ListByRole(role)
+		if err != nil {
+			log.Printf("Error listing users with the %s role: %v", role, err)
+		}
+		for _, user := range users {
+			add(user)
+		}
+	}
+	return recipients
+}
+
+// leaveRequestMessage describes a new request for the notification body
+func leaveRequestMessage(request models.LeaveRequest) string {
+	days := request.LeaveDate
+	if request.LeaveEndDate != nil && *request.LeaveEndDate != request.LeaveDate {
+		days = fmt.Sprintf("%s to %s", request.LeaveDate, *request.LeaveEndDate)
+	}
+	message := fmt.Sprintf("%s has requested %s leave for %s.", request.StudentName, request.RequestType, days)
+	if request.Reason != nil && *request.Reason != "" {
+		message += " Reason: " + *request.Reason
+	}
+	return message
+}
@@ -0,0 +1,140 @@
+package jobs
+
+import (
+	"log"
+	"server/config"
+	"server/models"
+	"server/store"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// calendarReloadInterval is how often the calendar is read again, so that edits made
+// through another server instance are picked up
+const calendarReloadInterval = time.Minute
+
+// activeCalendar is the school calendar consulted by IsSchoolDay, nil until one is loaded
+var activeCalendar atomic.Pointer[SchoolCalendar]
+
+// SchoolCalendar keeps the terms and closures of the school calendar in memory, so
+// the school day checks do not query the database. Reload it after every edit; it
+// also reloads itself every calendarReloadInterval.
+type SchoolCalendar struct {
+	calendar store.CalendarStore
+
+	mu       sync.RWMutex
+	terms    []models.Term
+	closures []models.SchoolClosure
+}
+
+// NewSchoolCalendar loads the calendar and makes it the one IsSchoolDay consults.
+// Configured holidays are imported once as closures, so the database queries that
+// count school days skip them too. If loading fails the calendar starts out empty and
+// the error is returned.
+func NewSchoolCalendar(calendar store.CalendarStore) (*SchoolCalendar, error) {
+	c := &SchoolCalendar{calendar: calendar}
+	err := c.Reload()
+	if err == nil {
+		err = c.importHolidays()
+	}
+	activeCalendar.Store(c)
+
+	go func() {
+		for range time.Tick(calendarReloadInterval) {
+			if err := c.Reload(); err != nil {
+				log.Printf("Error reloading the school calendar: %v", err)
+			}
+		}
+	}()
+	return c, err
+}
+
+// importHolidays creates a closure for each attendance.holidays date that was never
+// imported and that no closure covers yet. A holiday closure an admin deleted is
+// not brought back.
+func (c *SchoolCalendar) importHolidays() error {
+	imported := false
+	for _, holiday := range config.Get().Attendance.Holidays {
+		created, err := c.calendar.ImportHoliday(holiday, "Holiday")
+		if err != nil {
+			return err
+		}
+		imported = imported || created
+	}
+	if !imported {
+		return nil
+	}
+	return c.Reload()
+}
+
+// Reload reads the terms and closures from the store again
+func (c *SchoolCalendar) Reload() error {
+	terms, err := c.calendar.ListTerms()
+	if err != nil {
+		return err
+	}
+	closures, err := c.calendar.ListClosures()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.terms = terms
+	c.closures = closures
+	c.mu.Unlock()
+	return nil
+}
+
+// Day describes day on the calendar, without any events
+func (c *SchoolCalendar) Day(day time.Time) models.CalendarDay {
+	term, closure, _ := c.lookup(day)
+	reason := skipReason(day)
+	return models.CalendarDay{
+		Date:      day.Format("2006-01-02"),
+		SchoolDay: reason == "",
+		Reason:    reason,
+		Term:      term,
+		Closure:   closure,
+		Events:    []models.Event{},
+	}
+}
+
+// lookup returns the names of the term and closure covering day, and whether any
+// terms are set up at all
+func (c *SchoolCalendar) lookup(day time.Time) (term string, closure string, hasTerms bool) {
+	date := day.Format("2006-01-02")
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, t := range c.terms {
+		if t.Includes(date) {
+			term = t.Name
+			break
+		}
+	}
+	for _, cl := range c.closures {
+		if cl.Includes(date) {
+			closure = cl.Name
+			break
+		}
+	}
+	return term, closure, len(c.terms) > 0
+}
+
+// closedReason explains why the loaded calendar has no school on day, or returns ""
+func closedReason(day time.Time) string {
+	c := activeCalendar.Load()
+	if c == nil {
+		return ""
+	}
+
+	term, closure, hasTerms := c.lookup(day)
+	switch {
+	case closure != "":
+		return models.NoSchoolClosure
+	case hasTerms && term == "":
+		return models.NoSchoolOutsideTerm
+	}
+	return ""
+}
@@ -1,19 +1,23 @@
 package main
 
 import (
-	"database/sql"
 	"fmt"
 	"log"
 	"math/rand"
 	"net"
-	"server/config"        // Your configuration package.
-	"server/notifications" // Import the notifications package
-	"server/routes"        // Adjust the import path based on your module.
+	"os"
+	"server/config"            // Your configuration package.
+	database "server/database" // Database connection helpers
+	"server/jobs"              // Scheduled background jobs
+	"server/middleware"        // Authentication and authorization middleware
+	"server/notifications"     // Import the notifications package
+	"server/realtime"          // WebSocket delivery of messaging events
+	"server/routes"            // Adjust the import path based on your module.
+	"server/store"             // Data access layer shared by the handlers
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	_ "github.com/lib/pq" // PostgreSQL driver.
 )
 
 // CacheMiddleware adds Cache-Control headers for static assets
@@ -34,6 +38,33 @@ func CacheMiddleware() gin.HandlerFunc {
 }
 
 func main() {
+	// Load configuration from the environment and the optional CONFIG_FILE
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	log.Printf("Loaded %s configuration:\n%s", cfg.Env, cfg.Redacted())
+
+	// Connect to your PostgreSQL database.
+	db, err := database.GetConnection()
+	if err != nil {
+		log.Fatalf("Failed to connect to DB: %v", err)
+	}
+	defer db.Close()
+
+	// "server migrate up|down|status" manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrateCommand(db, os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	// Bring the schema up to date before serving requests
+	if _, err := database.MigrateUp(db); err != nil {
+		log.Fatalf("Failed to apply database migrations: %v", err)
+	}
+
 	// Set Gin to production mode
 	gin.SetMode(gin.ReleaseMode)
 
@@ -46,20 +77,6 @@ func main() {
 	// Apply caching middleware globally or to specific routes
 	router.Use(CacheMiddleware())
 
-	// Connect to your PostgreSQL database.
-	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		config.DBHost,
-		config.DBPort,
-		config.DBUser,
-		config.DBPassword,
-		config.DBName,
-	)
-	db, err := sql.Open("postgres", connStr)
-	if err != nil {
-		log.Fatalf("Failed to connect to DB: %v", err)
-	}
-	defer db.Close()
-
 	// Initialize the APNs client
 	if err := notifications.InitAPNS(); err != nil {
 		log.Printf("Warning: Failed to initialize APNs: %v", err)
@@ -78,37 +95,89 @@ func main() {
 	router.Static("/api/document-files", "./documents")
 	router.Static("/api/student_formal_images", "./student_formal_images") // Add student formal images under API prefix
 
+	// Every store shares the single connection pool opened above
+	stores := store.NewPostgres(db)
+
+	// Load the school calendar consulted by every school day check
+	schoolCalendar, err := jobs.NewSchoolCalendar(stores.Calendar)
+	if err != nil {
+		log.Printf("Error loading the school calendar: %v", err)
+	}
+
+	// Finalise and reset the attendance register every school day at the cutoff
+	attendanceRollover := jobs.NewAttendanceRollover(stores.Attendance)
+	attendanceRollover.Start()
+
+	// Check register updates against the attendance alert rules
+	attendanceAlerts := jobs.NewAttendanceAlerts(stores.Alerts, stores.YearGroups, stores.Users, stores.Guardians)
+
+	// Push new leave requests to the staff who handle them
+	leaveNotifier := jobs.NewLeaveNotifier(stores.YearGroups, stores.Users)
+
+	// Start, update and end students' leave request Live Activities
+	leaveLiveActivities := jobs.NewLeaveLiveActivities(stores.LeaveRequests, stores.Users)
+
+	// Escalate leave requests left unanswered to the configured tiers
+	leaveEscalation := jobs.NewLeaveEscalation(stores.LeaveRequests, leaveNotifier)
+	leaveEscalation.Start()
+
+	// Push messaging events to open WebSocket connections, shared with the other
+	// server instances through Postgres
+	messagingHub := realtime.NewHub()
+	if err := messagingHub.UsePostgres(db, cfg.Database.DSN()); err != nil {
+		log.Printf("Warning: messaging events will only reach clients of this instance: %v", err)
+	}
+
 	// Create an API router group
 	apiRouter := router.Group("/api")
 
-	// Register your routes under the API router group
-	routes.RegisterLoginRoute(apiRouter)
+	// Public routes: login, token management, password reset and passkey login
+	routes.RegisterLoginRoute(apiRouter, stores.Sessions, stores.Users)
+	routes.SetupSessionRoutes(apiRouter, stores.Sessions)
 	routes.RegisterAuthRoutes(apiRouter, db)
-	routes.RegisterEventRoutes(apiRouter, db)
-	routes.RegisterGetAllEvents(apiRouter, db)
-	routes.RegisterGetEventByID(apiRouter, db)
-	routes.RegisterGetSubjectsRoute(apiRouter, db)
-	routes.RegisterGetSubjectsTeacherRoute(apiRouter, db)
-	routes.RegisterProfileRoutes(apiRouter, db)
-	routes.SetupAttendanceRoutes(apiRouter, db)
-	routes.SetupUserRoutes(apiRouter, db)
-	routes.SetupMessagingRoutes(apiRouter, db)
 	routes.RegisterTestRoute(apiRouter)
 
+	// Register passkey authentication routes (registration requires an access token)
+	routes.SetupPasskeyRoutes(apiRouter, db, stores.Sessions, stores.Users)
+
+	// Every route registered below requires a valid bearer access token.
+	// Individual routes add their role requirements with middleware.RequireRoles.
+	authRouter := apiRouter.Group("")
+	authRouter.Use(middleware.RequireAuth(stores.Sessions, stores.Users))
+
+	routes.RegisterEventRoutes(authRouter, stores.Events)
+	routes.RegisterGetAllEvents(authRouter, stores.Events)
+	routes.RegisterGetEventByID(authRouter, stores.Events)
+	routes.RegisterGetSubjectsRoute(authRouter, db)
+	routes.RegisterGetSubjectsTeacherRoute(authRouter, db)
+	routes.RegisterProfileRoutes(authRouter, stores.Users)
+	routes.SetupAttendanceRoutes(authRouter, stores.Attendance, stores.YearGroups, stores.Users, attendanceAlerts)
+	routes.SetupAttendanceRolloverRoutes(authRouter, attendanceRollover, stores.Attendance)
+	routes.SetupAttendanceExportRoutes(authRouter, stores.Attendance, stores.YearGroups)
+	routes.SetupAttendanceCheckInRoutes(authRouter, stores.Attendance, attendanceAlerts)
+	routes.SetupAttendanceAlertRoutes(authRouter, stores.Alerts)
+	routes.SetupGuardianRoutes(authRouter, stores.Guardians)
+	routes.SetupAttendanceAnalyticsRoutes(authRouter, stores.Analytics, stores.YearGroups)
+	routes.SetupLessonAttendanceRoutes(authRouter, stores.Lessons)
+	routes.SetupUserRoutes(authRouter, stores.Users)
+	routes.SetupYearGroupRoutes(authRouter, stores.YearGroups, stores.Users)
+	routes.SetupCalendarRoutes(authRouter, stores.Calendar, schoolCalendar, stores.Events)
+	routes.SetupMessagingRoutes(authRouter, stores.Messages, stores.Users, stores.Sessions, messagingHub)
+
 	// Register the new leave request routes
-	routes.SetupLeaveRequestRoutes(apiRouter, db)
+	routes.SetupLeaveRequestRoutes(authRouter, stores.LeaveRequests, stores.Attendance, stores.LeaveAttachments, leaveNotifier, leaveLiveActivities)
+	routes.SetupLeaveAttachmentRoutes(authRouter, stores.LeaveRequests, stores.LeaveAttachments)
+	routes.SetupLeaveReportRoutes(authRouter, stores.LeaveReports)
+	routes.SetupLiveActivityRoutes(authRouter, stores.Users)
 
 	// Register voting system routes
-	routes.SetupVotingRoutes(apiRouter, db)
-
-	// Register passkey authentication routes
-	routes.SetupPasskeyRoutes(apiRouter, db)
+	routes.SetupVotingRoutes(authRouter, stores.Voting)
 
 	// Register student routes
-	routes.SetupStudentRoutes(apiRouter, db)
+	routes.SetupStudentRoutes(authRouter, db)
 
 	// Register document hub routes
-	routes.SetupDocumentRoutes(apiRouter, db)
+	routes.SetupDocumentRoutes(authRouter, stores.Documents)
 
 	// Print local non-loopback IPv4 addresses.
 	addrs, err := net.InterfaceAddrs()
@@ -123,10 +192,10 @@ func main() {
 		}
 	}
 
-	// Start the server on port 2000.
-	log.Printf("Starting server on port %s...", config.ServerPort)
+	// Start the server on the configured port.
+	log.Printf("Starting server on port %s...", cfg.Server.Port)
 	log.Printf("IS IT RUNNING?")
-	if err := router.Run(fmt.Sprintf(":%s", config.ServerPort)); err != nil {
+	if err := router.Run(fmt.Sprintf(":%s", cfg.Server.Port)); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
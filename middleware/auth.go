@@ -0,0 +1,182 @@
+package middleware
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"server/store"
+	"server/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authUserKey is the gin context key holding the authenticated caller
+const authUserKey = "authUser"
+
+// AuthUser is the caller resolved from a bearer access token
+type AuthUser struct {
+	ID              int       `json:"id"`
+	Username        string    `json:"username"`
+	Name            string    `json:"name"`
+	Role            string    `json:"role"`
+	AdditionalRoles []string  `json:"additional_roles"`
+	SessionID       string    `json:"-"`
+	TokenExpiresAt  time.Time `json:"-"` // when the access token the request came with expires
+}
+
+// HasRole reports whether the user's primary role or any additional role matches one of roles
+func (u *AuthUser) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if u.Role == role {
+			return true
+		}
+		for _, additional := range u.AdditionalRoles {
+			if additional == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer <token>" header
+func BearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// CurrentUser returns the authenticated caller stored by RequireAuth
+func CurrentUser(c *gin.Context) (*AuthUser, bool) {
+	value, exists := c.Get(authUserKey)
+	if !exists {
+		return nil, false
+	}
+	user, ok := value.(*AuthUser)
+	return user, ok
+}
+
+// RequireAuth resolves the caller from the bearer access token, checks that the
+// backing session is still active and loads the caller's role and additional roles
+func RequireAuth(sessions store.SessionStore, users store.UserStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := BearerToken(c)
+		if tokenString == "" {
+			abort(c, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+
+		claims, err := utils.ParseAccessToken(tokenString)
+		if err != nil {
+			abort(c, http.StatusUnauthorized, "Invalid or expired access token")
+			return
+		}
+
+		userID, err := claims.UserID()
+		if err != nil {
+			abort(c, http.StatusUnauthorized, "Invalid access token subject")
+			return
+		}
+
+		session, err := sessions.GetByID(claims.SessionID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				abort(c, http.StatusUnauthorized, "Session not found")
+				return
+			}
+			log.Printf("Error loading session %s: %v", claims.SessionID, err)
+			abort(c, http.StatusInternalServerError, "Failed to verify session")
+			return
+		}
+
+		if !session.IsActive() || session.UserID != userID {
+			abort(c, http.StatusUnauthorized, "Session has expired or been revoked")
+			return
+		}
+
+		account, err := users.GetByID(userID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				abort(c, http.StatusUnauthorized, "User no longer exists")
+				return
+			}
+			log.Printf("Error loading user %d for authentication: %v", userID, err)
+			abort(c, http.StatusInternalServerError, "Failed to load user")
+			return
+		}
+
+		user := &AuthUser{ID: userID, Username: account.Username, Name: account.Name, Role: account.Role, SessionID: session.ID, TokenExpiresAt: claims.ExpiresAt.Time}
+		user.AdditionalRoles, err = users.GetAdditionalRoles(userID)
+		if err != nil {
+			log.Printf("Error loading additional roles for user %d: %v", userID, err)
+			abort(c, http.StatusInternalServerError, "Failed to load user roles")
+			return
+		}
+
+		c.Set(authUserKey, user)
+		c.Next()
+	}
+}
+
+// RequireRoles allows the request only if the caller has at least one of the given roles.
+// It must be used after RequireAuth.
+func RequireRoles(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := CurrentUser(c)
+		if !ok {
+			abort(c, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+
+		if !user.HasRole(roles...) {
+			abort(c, http.StatusForbidden, "You do not have permission to access this resource")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireSelfOrRoles allows the request if the user ID in the named path or query
+// parameter is the caller's own ID, or if the caller has one of the given roles.
+// It must be used after RequireAuth.
+func RequireSelfOrRoles(param string, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := CurrentUser(c)
+		if !ok {
+			abort(c, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+
+		value := c.Param(param)
+		if value == "" {
+			value = c.Query(param)
+		}
+
+		if id, err := strconv.Atoi(value); err == nil && id == user.ID {
+			c.Next()
+			return
+		}
+
+		if len(roles) > 0 && user.HasRole(roles...) {
+			c.Next()
+			return
+		}
+
+		abort(c, http.StatusForbidden, "You do not have permission to access this resource")
+	}
+}
+
+// abort stops the handler chain with a JSON error in the shape used across the API
+func abort(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, gin.H{
+		"success": false,
+		"message": message,
+		"error":   message,
+	})
+}
@@ -0,0 +1,135 @@
+package models
+
+import "time"
+
+// Attendance statuses as shown on the register; attendance_history stores them lowercased
+const (
+	AttendancePending = "Pending"
+	AttendancePresent = "Present"
+	AttendanceAbsent  = "Absent"
+	AttendanceLate    = "Late"
+	AttendanceMedical = "Medical"
+	AttendanceEarly   = "Early"
+)
+
+// IsAttendanceStatus reports whether status can be recorded on the register
+func IsAttendanceStatus(status string) bool {
+	switch status {
+	case AttendancePresent, AttendanceAbsent, AttendanceLate, AttendanceMedical, AttendanceEarly:
+		return true
+	}
+	return false
+}
+
+// AttendanceUpdate sets a student's attendance status for the day
+type AttendanceUpdate struct {
+	UserID int    `json:"user_id"`
+	Status string `json:"status"`
+	Note   string `json:"note,omitempty"` // optional reason kept in the audit trail
+}
+
+// AttendanceHistoryRecord is one day of a student's attendance history
+type AttendanceHistoryRecord struct {
+	ID             int
+	StudentID      int
+	Status         string
+	AttendanceDate time.Time
+	ArrivedAt      *time.Time       // set when the student checked in at reception
+	Leave          *AttendanceLeave // set when the status comes from an approved leave request
+	CreatedAt      time.Time
+}
+
+// AttendanceLeave is the approved leave request behind an attendance status
+type AttendanceLeave struct {
+	RequestID   int     `json:"request_id"`
+	RequestType string  `json:"request_type"`
+	Reason      *string `json:"reason"`
+}
+
+// TotalDays returns the number of days with a recorded attendance status
+func (s Student) TotalDays() int {
+	return s.Present + s.Absent + s.Late + s.Medical + s.Early
+}
+
+// Counts returns the student's counters as AttendanceCounts
+func (s Student) Counts() AttendanceCounts {
+	return AttendanceCounts{Present: s.Present, Absent: s.Absent, Late: s.Late, Medical: s.Medical, Early: s.Early}
+}
+
+// Sources of attendance changes in the audit trail
+const (
+	ChangeSourceRegister = "register" // marked on the register by staff
+	ChangeSourceCheckIn  = "check_in" // the student checked in at reception
+	ChangeSourceLeave    = "leave"    // an approved leave request was applied or reverted
+	ChangeSourceRollover = "rollover" // the daily rollover recorded the register
+)
+
+// AttendanceChange is one entry of the audit trail of a student's daily records
+type AttendanceChange struct {
+	ID             int
+	StudentID      int
+	AttendanceDate time.Time
+	PreviousStatus string // as stored in attendance_history, "" if the day had no record
+	NewStatus      string // "" if the record was cleared
+	ChangedBy      *int   // nil for the scheduled rollover
+	ChangedByName  string
+	Source         string // one of the ChangeSource constants
+	Note           *string
+	ChangedAt      time.Time
+}
+
+// Attendance rollover outcomes
+const (
+	RolloverCompleted = "completed"
+	RolloverSkipped   = "skipped"
+)
+
+// Reasons a school day is skipped without rolling the register over into it
+const (
+	RolloverMissed   = "missed"    // the cutoff passed while the server was down or the rollover failed
+	RolloverFirstRun = "first run" // the day before rollovers were first tracked
+)
+
+// AttendanceRollover reports one run of the daily register rollover
+type AttendanceRollover struct {
+	ID            int
+	Date          time.Time
+	Status        string // RolloverCompleted or RolloverSkipped
+	Reason        string // why the day was skipped
+	RecordedCount int    // records written to attendance_history from today's register
+	ResetCount    int    // registers reset to Pending
+	TriggeredBy   *int   // admin who ran it by hand, nil for the scheduler
+	CreatedAt     time.Time
+}
+
+// AttendanceExportFilter selects the daily records to export; zero fields are ignored
+type AttendanceExportFilter struct {
+	Year      string // year group name, used together with Section
+	Section   string
+	StudentID int
+	From      *time.Time // first day, inclusive
+	To        *time.Time // last day, inclusive
+}
+
+// AttendanceExportRow is one student's record for one day, with the student's
+// totals over the whole exported range
+type AttendanceExportRow struct {
+	Date      time.Time
+	StudentID int
+	Name      string
+	Year      string
+	GroupName string
+	Status    string // as stored in attendance_history, e.g. "present"
+	ArrivedAt *time.Time
+
+	Present int
+	Absent  int
+	Late    int
+	Medical int
+	Early   int
+}
+
+// Counts returns the student's counters over the exported range as AttendanceCounts
+func (r AttendanceExportRow) Counts() AttendanceCounts {
+	return AttendanceCounts{Present: r.Present, Absent: r.Absent, Late: r.Late, Medical: r.Medical, Early: r.Early}
+}
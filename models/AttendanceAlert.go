@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// AttendanceAlert records a student breaking an attendance alert rule
+type AttendanceAlert struct {
+	ID                  int        `json:"id"`
+	StudentID           int        `json:"student_id"`
+	StudentName         string     `json:"student_name"`
+	Rule                string     `json:"rule"`
+	Status              string     `json:"status"`      // attendance status counted, e.g. "absent"
+	Occurrences         int        `json:"occurrences"` // records counted in the window
+	WindowStart         time.Time  `json:"window_start"`
+	WindowEnd           time.Time  `json:"window_end"`
+	LastRecordDate      time.Time  `json:"last_record_date"`
+	TeacherNotified     bool       `json:"teacher_notified"`
+	GuardiansNotified   int        `json:"guardians_notified"`
+	CreatedAt           time.Time  `json:"created_at"`
+	AcknowledgedBy      *int       `json:"acknowledged_by"`
+	AcknowledgedAt      *time.Time `json:"acknowledged_at"`
+	AcknowledgementNote *string    `json:"acknowledgement_note"`
+}
+
+// Guardian is a contact who receives a student's attendance alerts
+type Guardian struct {
+	ID           int       `json:"id"`
+	StudentID    int       `json:"student_id"`
+	Name         string    `json:"name"`
+	Email        string    `json:"email"`
+	Relationship *string   `json:"relationship"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,78 @@
+package models
+
+import "time"
+
+// AttendanceCounts tallies recorded days (or lessons) by status
+type AttendanceCounts struct {
+	Present int
+	Absent  int
+	Late    int
+	Medical int
+	Early   int
+}
+
+// Total returns the number of recorded days
+func (c AttendanceCounts) Total() int {
+	return c.Present + c.Absent + c.Late + c.Medical + c.Early
+}
+
+// Attended returns the days the student was in school: present, late or leaving early
+func (c AttendanceCounts) Attended() int {
+	return c.Present + c.Late + c.Early
+}
+
+// Rate returns the attendance rate as a percentage of recorded days, or 0 without any
+func (c AttendanceCounts) Rate() float64 {
+	if c.Total() == 0 {
+		return 0
+	}
+	return float64(c.Attended()) / float64(c.Total()) * 100
+}
+
+// AttendanceAnalyticsFilter selects the daily records analysed; From and To are
+// inclusive and always set, the other fields are ignored when zero
+type AttendanceAnalyticsFilter struct {
+	From      time.Time
+	To        time.Time
+	Year      string // year group name, used together with Section
+	Section   string
+	StudentID int
+}
+
+// StudentAttendanceRate is a student's attendance over the analysed range
+type StudentAttendanceRate struct {
+	StudentID int
+	Name      string
+	Year      string
+	GroupName string
+	AttendanceCounts
+}
+
+// SectionAttendanceRate is a year group section's attendance over the analysed range
+type SectionAttendanceRate struct {
+	Year     string
+	Section  string
+	Students int // students with at least one record in the range
+	AttendanceCounts
+}
+
+// SubjectAttendanceRate is the lesson attendance of a teaching group over the analysed range
+type SubjectAttendanceRate struct {
+	Subject       string
+	Code          string
+	TeachingGroup string
+	Lessons       int // registers taken
+	AttendanceCounts
+}
+
+// AttendanceTrendPoint is the attendance of one week, starting on Monday
+type AttendanceTrendPoint struct {
+	WeekStart time.Time
+	AttendanceCounts
+}
+
+// WeekdayAttendance is the attendance on one day of the week across the analysed range
+type WeekdayAttendance struct {
+	Weekday time.Weekday
+	AttendanceCounts
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// AcademicYear is a school year, e.g. 2025-2026, split into terms.
+// Dates are in YYYY-MM-DD format.
+type AcademicYear struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	StartDate string    `json:"start_date"`
+	EndDate   string    `json:"end_date"`
+	Terms     []Term    `json:"terms"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Term is a period of an academic year in which school is in session
+type Term struct {
+	ID             int       `json:"id"`
+	AcademicYearID int       `json:"academic_year_id"`
+	Name           string    `json:"name"`
+	StartDate      string    `json:"start_date"`
+	EndDate        string    `json:"end_date"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// SchoolClosure is a run of days without school, e.g. a public holiday or a snow day
+type SchoolClosure struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	StartDate string    `json:"start_date"`
+	EndDate   string    `json:"end_date"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Includes reports whether the closure covers the YYYY-MM-DD date
+func (c SchoolClosure) Includes(date string) bool {
+	return date >= c.StartDate && date <= c.EndDate
+}
+
+// Includes reports whether the term covers the YYYY-MM-DD date
+func (t Term) Includes(date string) bool {
+	return date >= t.StartDate && date <= t.EndDate
+}
+
+// Reasons a day is not a school day
+const (
+	NoSchoolWeekend     = "weekend"
+	NoSchoolHoliday     = "holiday"
+	NoSchoolClosure     = "closure"
+	NoSchoolOutsideTerm = "outside term"
+)
+
+// CalendarDay is one day of the school calendar with the events on it
+type CalendarDay struct {
+	Date      string  `json:"date"`
+	SchoolDay bool    `json:"school_day"`
+	Reason    string  `json:"reason,omitempty"`  // why there is no school, e.g. "closure"
+	Term      string  `json:"term,omitempty"`    // name of the term the day falls in
+	Closure   string  `json:"closure,omitempty"` // name of the closure covering the day
+	Events    []Event `json:"events"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Document represents a document in the system
+type Document struct {
+	ID              string    `json:"id"`
+	FileName        string    `json:"file_name"`
+	FileDescription string    `json:"file_description"`
+	FilePath        string    `json:"file_path"`
+	FileType        string    `json:"file_type"`
+	FileSize        int       `json:"file_size"`
+	UploadedBy      int       `json:"uploaded_by"`
+	UploaderName    string    `json:"uploader_name"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	Status          string    `json:"status"`
+	Checksum        string    `json:"checksum"`
+	Version         int       `json:"version"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+/**
+ * ImageModel represents an image associated with an event.
+ */
+type ImageModel struct {
+	FilePath string `json:"filePath"` // The file path of the image
+}
+
+/**
+ * Event represents the complete event data structure.
+ */
+type Event struct {
+	EventID          string       `json:"eventID"`             // Unique identifier for the event
+	AuthorID         int          `json:"authorID"`            // ID of the event creator
+	AuthorName       string       `json:"authorName"`          // Name of the event creator
+	Title            string       `json:"title"`               // Event title
+	EventDescription string       `json:"eventDescription"`    // Detailed description
+	Images           []ImageModel `json:"images"`              // List of associated images
+	Address          string       `json:"address"`             // Event location
+	EventDate        time.Time    `json:"eventDate"`           // Date of the event
+	IsWholeDay       bool         `json:"isWholeDay"`          // Whether it's a whole-day event
+	StartTime        *time.Time   `json:"startTime,omitempty"` // Start time (if not whole-day)
+	EndTime          *time.Time   `json:"endTime,omitempty"`   // End time (if not whole-day)
+
+	AudienceSectionIDs []int `json:"audienceSectionIDs"` // Sections the event is meant for; empty means everyone
+}
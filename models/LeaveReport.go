@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// LeaveReportFilter selects the leave requests reported on by the day they were
+// made; From and To are inclusive and always set
+type LeaveReportFilter struct {
+	From      time.Time
+	To        time.Time
+	YearGroup string // year group name such as "IB1", or section slug such as "ib1-a"
+}
+
+// LeaveWeeklyCount is the number of requests of one type and status made by one
+// year group in a week starting on Monday
+type LeaveWeeklyCount struct {
+	WeekStart   time.Time
+	RequestType string
+	Status      string
+	YearGroup   string // "" for students without a year group
+	Requests    int
+}
+
+// LeaveResponseTimes summarises how long staff took to approve or reject requests
+type LeaveResponseTimes struct {
+	Responded      int
+	MedianMinutes  float64
+	AverageMinutes float64
+}
+
+// LeaveRequester is a student with the number of leave requests they made
+type LeaveRequester struct {
+	StudentID int
+	Name      string
+	YearGroup string
+	Requests  int
+	Approved  int
+}
+
+// StaffLeaveResponses counts the requests a staff member approved and rejected
+type StaffLeaveResponses struct {
+	StaffID       int
+	Name          string
+	Approved      int
+	Rejected      int
+	MedianMinutes float64 // median time from the request to their response
+}
+
+// Responded returns the number of requests the staff member answered
+func (s StaffLeaveResponses) Responded() int {
+	return s.Approved + s.Rejected
+}
+
+// ApprovalRate returns the share of answered requests approved, as a percentage
+func (s StaffLeaveResponses) ApprovalRate() float64 {
+	if s.Responded() == 0 {
+		return 0
+	}
+	return float64(s.Approved) / float64(s.Responded()) * 100
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 )
 
@@ -11,13 +12,137 @@ type LeaveRequest struct {
 	StudentName       string     `json:"student_name"`
 	RequestType       string     `json:"request_type"`
 	Reason            *string    `json:"reason"`
-	Status            string     `json:"status"` // Values: "sent", "pending", "approved", "rejected", "cancelled", "finished"
+	LeaveDate         string     `json:"leave_date"`     // YYYY-MM-DD, the first day covered
+	LeaveEndDate      *string    `json:"leave_end_date"` // YYYY-MM-DD, null for a single day
+	StartsAt          *time.Time `json:"starts_at"`      // when the student leaves, for leave within a day
+	EndsAt            *time.Time `json:"ends_at"`        // when the student is due back
+	ReturnedAt        *time.Time `json:"returned_at"`    // when the student checked back in
+	Status            string     `json:"status"`         // Values: "sent", "pending", "approved", "rejected", "cancelled", "finished"
 	CreatedAt         time.Time  `json:"created_at"`
 	UpdatedAt         time.Time  `json:"updated_at"`
 	RespondedBy       *int       `json:"responded_by"`
 	ResponseTime      *time.Time `json:"response_time"`
+	EscalationLevel   int        `json:"escalation_level"` // escalation tiers notified while unanswered, 0 for none
+	EscalatedAt       *time.Time `json:"escalated_at"`
 	LiveActivityId    *string    `json:"live_activity_id"`
 	LiveActivityToken *string    `json:"live_activity_token"`
+
+	// Attachments are only loaded for a single request
+	Attachments []LeaveAttachment `json:"attachments,omitempty"`
+}
+
+// Leave request statuses
+const (
+	LeaveSent      = "sent"
+	LeavePending   = "pending"
+	LeaveApproved  = "approved"
+	LeaveRejected  = "rejected"
+	LeaveCancelled = "cancelled"
+	LeaveFinished  = "finished"
+)
+
+// LeaveStatuses lists every leave request status
+var LeaveStatuses = []string{LeaveSent, LeavePending, LeaveApproved, LeaveRejected, LeaveCancelled, LeaveFinished}
+
+// IsLeaveStatus reports whether status is a leave request status
+func IsLeaveStatus(status string) bool {
+	for _, known := range LeaveStatuses {
+		if known == status {
+			return true
+		}
+	}
+	return false
+}
+
+// leaveTransitions lists the statuses each leave request status can change to.
+// Rejected, cancelled and finished requests are final.
+var leaveTransitions = map[string][]string{
+	LeaveSent:     {LeavePending, LeaveApproved, LeaveRejected, LeaveCancelled},
+	LeavePending:  {LeaveApproved, LeaveRejected, LeaveCancelled},
+	LeaveApproved: {LeaveFinished, LeaveCancelled},
+}
+
+// CanTransitionLeave reports whether a leave request can change from one status to another
+func CanTransitionLeave(from string, to string) bool {
+	for _, allowed := range leaveTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFinalLeaveStatus reports whether a leave request with status can no longer change
+func IsFinalLeaveStatus(status string) bool {
+	return IsLeaveStatus(status) && len(leaveTransitions[status]) == 0
+}
+
+// LeaveTransition records one status change of a leave request
+type LeaveTransition struct {
+	ID             int       `json:"id"`
+	LeaveRequestID int       `json:"leave_request_id"`
+	FromStatus     *string   `json:"from_status"` // null when the request was created
+	ToStatus       string    `json:"to_status"`
+	ActorID        *int      `json:"actor_id"`
+	ActorName      string    `json:"actor_name"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// LeaveAttachment is a file supporting a leave request, such as a doctor's note
+type LeaveAttachment struct {
+	ID             string    `json:"id"`
+	LeaveRequestID int       `json:"leave_request_id"`
+	FileName       string    `json:"file_name"`
+	FilePath       string    `json:"-"`   // location on disk, never exposed
+	URL            string    `json:"url"` // authenticated download URL
+	FileType       string    `json:"file_type"`
+	FileSize       int       `json:"file_size"`
+	UploadedBy     *int      `json:"uploaded_by"`
+	UploaderName   string    `json:"uploader_name"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Orders in which leave request searches can be sorted
+const (
+	LeaveSortCreated   = "created_at"
+	LeaveSortLeaveDate = "leave_date"
+)
+
+// LeaveRequestQuery filters and pages a search of leave requests. Zero values do not filter.
+type LeaveRequestQuery struct {
+	Statuses    []string
+	RequestType string
+	YearGroup   string     // year group name such as "IB1", or section slug such as "ib1-a"
+	From        *time.Time // leave covering any day from From to To
+	To          *time.Time
+	RespondedBy int
+	Reason      string // case-insensitive text within the reason
+
+	Sort      string // LeaveSortCreated or LeaveSortLeaveDate
+	Ascending bool
+	After     *LeaveRequestCursor // continue after this request, in the same sort order
+	Limit     int
+}
+
+// LeaveRequestCursor marks the last leave request of a page: its ID and the value
+// of the sort column, as text
+type LeaveRequestCursor struct {
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// LeaveAttendanceStatus returns the attendance status an approved leave request of
+// the given type marks on the register: early leave is Early, medical or sick leave
+// is Medical and any other leave is an authorised Absent
+func LeaveAttendanceStatus(requestType string) string {
+	kind := strings.ToLower(requestType)
+	switch {
+	case strings.Contains(kind, "early"):
+		return AttendanceEarly
+	case strings.Contains(kind, "medical"), strings.Contains(kind, "sick"):
+		return AttendanceMedical
+	}
+	return AttendanceAbsent
 }
 
 // StatusDisplayInfo contains UI display data for each status
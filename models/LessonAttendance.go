@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// LessonRegister is the register of one lesson of a teaching group
+type LessonRegister struct {
+	Code          string          `json:"code"`
+	TeachingGroup string          `json:"teaching_group"`
+	Subject       string          `json:"subject"`
+	Date          string          `json:"date"`   // YYYY-MM-DD
+	Period        int             `json:"period"` // lesson of the day, for groups taught more than once a day
+	Taken         bool            `json:"taken"`  // false until a teacher saves the register
+	TakenBy       *int            `json:"taken_by"`
+	UpdatedAt     *time.Time      `json:"updated_at"`
+	Students      []LessonStudent `json:"students"`
+}
+
+// LessonStudent is a student's mark in a lesson register
+type LessonStudent struct {
+	UserID int    `json:"user_id"`
+	Name   string `json:"name"`
+	Status string `json:"status"` // "Present", "Absent", "Late", "Medical", "Early", or "Pending"
+}
+
+// SubjectAttendance summarises a student's lesson attendance in one subject
+type SubjectAttendance struct {
+	Subject       string `json:"subject"`
+	Code          string `json:"code"`
+	TeachingGroup string `json:"teaching_group"`
+	Present       int    `json:"present"`
+	Absent        int    `json:"absent"`
+	Late          int    `json:"late"`
+	Medical       int    `json:"medical"`
+	Early         int    `json:"early"`
+}
+
+// TotalLessons returns the number of lessons with a recorded status
+func (s SubjectAttendance) TotalLessons() int {
+	return s.Present + s.Absent + s.Late + s.Medical + s.Early
+}
+
+// Counts returns the subject's counters as AttendanceCounts
+func (s SubjectAttendance) Counts() AttendanceCounts {
+	return AttendanceCounts{Present: s.Present, Absent: s.Absent, Late: s.Late, Medical: s.Medical, Early: s.Early}
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Message is a chat message together with its sender's name
+type Message struct {
+	ID             int       `json:"id"`
+	ConversationID int       `json:"conversation_id"`
+	SenderID       int       `json:"sender_id"`
+	SenderName     string    `json:"sender_name"`
+	Content        string    `json:"content"`
+	CreatedAt      time.Time `json:"created_at"`
+	Read           bool      `json:"read"`
+}
+
+// ConversationParticipant is the public profile of a conversation member
+type ConversationParticipant struct {
+	ID        int    `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+}
+
+// ConversationSummary is a conversation as listed in a user's inbox
+type ConversationSummary struct {
+	ID            int
+	CreatedAt     time.Time
+	Participants  []ConversationParticipant // excluding the user the inbox belongs to
+	UnreadCount   int
+	LatestMessage *Message
+}
+
+// ChatUser is a user that can be started a conversation with
+type ChatUser struct {
+	ConversationParticipant
+	ProfilePicture  string
+	AdditionalRoles []string
+}
+
+// PushRecipient is a user with a registered APNs device token
+type PushRecipient struct {
+	UserID      int
+	DeviceToken string
+}
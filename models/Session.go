@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Session represents a server-side login session backing a refresh token
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int        `json:"user_id"`
+	DeviceID   *string    `json:"device_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// IsActive reports whether the session has neither been revoked nor expired
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
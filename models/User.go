@@ -4,6 +4,14 @@ import (
 	"database/sql"
 )
 
+// Primary and additional role names used for authorization
+const (
+	RoleStudent    = "student"
+	RoleStaff      = "staff"
+	RoleAttendance = "attendance"
+	RoleAdmin      = "admin"
+)
+
 // User represents a user in the system, including their roles and additional roles.
 type User struct {
 	ID              int      `json:"id"`
@@ -102,3 +110,27 @@ func GetUserByEmail(db *sql.DB, email string) (*User, error) {
 
 	return &user, nil
 }
+
+// GetAdditionalRoles retrieves the additional roles assigned to a user
+func GetAdditionalRoles(db *sql.DB, userID int) ([]string, error) {
+	rows, err := db.Query("SELECT role FROM additional_roles WHERE user_id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
@@ -16,6 +16,9 @@ type VotingEvent struct {
 	TotalVotes    int       `json:"total_votes,omitempty"`
 	CreatedAt     time.Time `json:"created_at,omitempty"`
 	SubVotes      []SubVote `json:"sub_votes,omitempty"`
+
+	// Sections the event is meant for; empty means everyone
+	AudienceSectionIDs []int `json:"audience_section_ids"`
 }
 
 // SubVote represents a sub-vote within a voting event
@@ -63,6 +66,9 @@ type VotingEventRequest struct {
 	Deadline    time.Time        `json:"deadline" binding:"required"`
 	Status      string           `json:"status" binding:"required"`
 	SubVotes    []SubVoteRequest `json:"sub_votes" binding:"required"`
+
+	// Sections the event is meant for; leave empty for everyone
+	AudienceSectionIDs []int `json:"audience_section_ids"`
 }
 
 // SubVoteRequest is used for creating or updating a sub-vote
@@ -77,3 +83,29 @@ type VoteOptionRequest struct {
 	Text           string `json:"text" binding:"required"`
 	HasCustomInput bool   `json:"has_custom_input"`
 }
+
+// UserVoteWithDetails is a user's vote together with the sub-vote and option it refers to
+type UserVoteWithDetails struct {
+	UserVote
+	SubVoteTitle string `json:"sub_vote_title"`
+	OptionText   string `json:"option_text"`
+}
+
+// SubVoteStats summarises the votes cast in a sub-vote
+type SubVoteStats struct {
+	SubVoteID   int           `json:"sub_vote_id"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	TotalVotes  int           `json:"total_votes"`
+	OptionStats []OptionStats `json:"option_stats"`
+}
+
+// OptionStats summarises the votes cast for one option of a sub-vote
+type OptionStats struct {
+	OptionID       int      `json:"option_id"`
+	Text           string   `json:"text"`
+	VoteCount      int      `json:"vote_count"`
+	Percentage     int      `json:"percentage"`
+	HasCustomInput bool     `json:"has_custom_input"`
+	CustomInputs   []string `json:"custom_inputs,omitempty"`
+}
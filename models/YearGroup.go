@@ -1,12 +1,40 @@
 package models
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
-// YearGroup represents a year group with a name and section
+// YearGroup is a school year, e.g. PIB or IB1, made up of sections
 type YearGroup struct {
-	Year     string `json:"year"`
-	Section  string `json:"section"`
-	FullName string `json:"fullName"`
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	SortOrder int       `json:"sort_order"`
+	Sections  []Section `json:"sections"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Section is one class of a year group, e.g. IB1 A, with its homeroom
+type Section struct {
+	ID                  int       `json:"id"`
+	YearGroupID         int       `json:"year_group_id"`
+	Year                string    `json:"year"` // name of the year group
+	Name                string    `json:"name"`
+	Homeroom            string    `json:"homeroom"`
+	HomeroomTeacherID   *int      `json:"homeroom_teacher_id"`
+	HomeroomTeacherName string    `json:"homeroom_teacher_name,omitempty"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// Slug returns the ID used by the attendance endpoints, e.g. "ib1-a"
+func (s Section) Slug() string {
+	return strings.ToLower(s.Year + "-" + s.Name)
+}
+
+// FullName returns the display name of the section, e.g. "IB1 A"
+func (s Section) FullName() string {
+	return fmt.Sprintf("%s %s", s.Year, s.Name)
 }
 
 // Student represents a student with year group information
@@ -21,67 +49,7 @@ type Student struct {
 	Late      int    `json:"late"`
 	Medical   int    `json:"medical"`
 	Early     int    `json:"early"`
-}
-
-// AttendanceRecord represents the daily attendance for a class
-type AttendanceRecord struct {
-	Date      string    `json:"date"`
-	YearGroup YearGroup `json:"yearGroup"`
-	Students  []Student `json:"students"`
-}
-
-// GenerateYearGroups returns all combinations of year groups and sections
-func GenerateYearGroups() []YearGroup {
-	// Define the available year groups and sections
-	years := []string{"PIB", "IB1"}
-	sections := []string{"A", "B"}
-
-	var yearGroups []YearGroup
-
-	// Generate all combinations
-	for _, year := range years {
-		for _, section := range sections {
-			fullName := fmt.Sprintf("%s %s", year, section)
-			yearGroups = append(yearGroups, YearGroup{
-				Year:     year,
-				Section:  section,
-				FullName: fullName,
-			})
-		}
-	}
-
-	return yearGroups
-}
-
-// GetYearGroupByID returns a year group based on a formatted ID string (e.g., "pib-a")
-func GetYearGroupByID(id string) (YearGroup, bool) {
-	// Map to translate IDs to year groups
-	idToYearGroup := map[string]YearGroup{
-		"pib-a": {Year: "PIB", Section: "A", FullName: "PIB A"},
-		"pib-b": {Year: "PIB", Section: "B", FullName: "PIB B"},
-		"ib1-a": {Year: "IB1", Section: "A", FullName: "IB1 A"},
-		"ib1-b": {Year: "IB1", Section: "B", FullName: "IB1 B"},
-	}
-
-	yearGroup, exists := idToYearGroup[id]
-	return yearGroup, exists
-}
-
-// GetStudentsByYearGroup returns students for a specific year group
-// In a real application, this would query the database
-func GetStudentsByYearGroup(yearGroup YearGroup) []Student {
-	// This is a placeholder - in a real application,
-	// you would query the database for students in this year group
-
-	// Example mock implementation
-	if yearGroup.Year == "PIB" && yearGroup.Section == "A" {
-		return []Student{
-			{UserID: 1001, Name: "Emma Johnson", Year: "PIB", GroupName: "A", Today: "Pending", Present: 42, Absent: 2, Late: 1},
-			{UserID: 1002, Name: "Noah Williams", Year: "PIB", GroupName: "A", Today: "Pending", Present: 44, Absent: 0, Late: 1},
-			// Add more students as needed
-		}
-	}
 
-	// Return empty slice if no matches
-	return []Student{}
+	// Leave is the approved leave request behind the day's status, if any
+	Leave *AttendanceLeave `json:"leave,omitempty"`
 }
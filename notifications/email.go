@@ -0,0 +1,45 @@
+package notifications
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"server/config"
+	"strings"
+)
+
+// SendEmail sends a plain text email to the given recipients through the
+// configured SMTP server
+func SendEmail(to []string, subject string, body string) error {
+	if len(to) == 0 {
+		return fmt.Errorf("no recipients")
+	}
+
+	smtpConfig := config.Get().SMTP
+
+	// Build the email with correct headers
+	mime := "MIME-version: 1.0;\nContent-Type: text/plain; charset=\"UTF-8\";\n\n"
+	message := fmt.Sprintf("From: %s\r\n"+
+		"To: %s\r\n"+
+		"Subject: %s\r\n"+
+		"%s\r\n"+
+		"%s",
+		smtpConfig.Sender,
+		strings.Join(to, ", "),
+		subject,
+		mime,
+		body)
+
+	auth := smtp.PlainAuth("",
+		smtpConfig.Username,
+		smtpConfig.Password.Value(),
+		smtpConfig.Host)
+
+	log.Printf("Sending email %q to %d recipients via SMTP server %s", subject, len(to), smtpConfig.Addr())
+
+	if err := smtp.SendMail(smtpConfig.Addr(), auth, smtpConfig.Username, to, []byte(message)); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+
+	return nil
+}
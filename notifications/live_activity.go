@@ -0,0 +1,118 @@
+package notifications
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"server/config"
+	"time"
+
+	"github.com/sideshow/apns2"
+	"github.com/sideshow/apns2/payload"
+)
+
+// liveActivityEventStart starts a Live Activity through a push-to-start token
+const liveActivityEventStart payload.ELiveActivityEvent = "start"
+
+// ErrInvalidToken is returned when APNs rejects a push token for good, e.g. because
+// the Live Activity ended or the app was removed. The token should be forgotten.
+var ErrInvalidToken = errors.New("APNs no longer accepts the push token")
+
+// LiveActivityContent is the content state of a leave request Live Activity
+type LiveActivityContent struct {
+	Status       string
+	ResponseTime *time.Time // when staff responded, left out while the request is waiting
+	RespondedBy  string
+}
+
+// contentState returns the content-state the app decodes
+func (c LiveActivityContent) contentState() map[string]interface{} {
+	state := map[string]interface{}{"status": c.Status}
+	if c.ResponseTime != nil {
+		state["responseTime"] = c.ResponseTime.Format(time.RFC3339)
+		state["respondedBy"] = c.RespondedBy
+	}
+	return state
+}
+
+// StartLiveActivity starts a leave request Live Activity on a user's device with
+// the push-to-start token it registered. attributes are the static fields of the
+// app's configured ActivityAttributes type; the alert is shown as it starts.
+func StartLiveActivity(startToken string, attributes map[string]interface{}, content LiveActivityContent, title string, body string) error {
+	p := payload.NewPayload().
+		SetEvent(liveActivityEventStart).
+		SetTimestamp(time.Now().Unix()).
+		SetAttributesType(config.Get().APNs.LiveActivityAttributesType).
+		SetAttributes(attributes).
+		SetContentState(content.contentState()).
+		AlertTitle(title).
+		AlertBody(body).
+		Sound("default")
+
+	return pushLiveActivity(startToken, p)
+}
+
+// UpdateLiveActivity shows new content on a running Live Activity
+func UpdateLiveActivity(activityToken string, content LiveActivityContent) error {
+	p := payload.NewPayload().
+		SetEvent(payload.LiveActivityEventUpdate).
+		SetTimestamp(time.Now().Unix()).
+		SetContentState(content.contentState())
+
+	return pushLiveActivity(activityToken, p)
+}
+
+// EndLiveActivity ends a Live Activity with its final content, which stays on the
+// Lock Screen until dismissAt
+func EndLiveActivity(activityToken string, content LiveActivityContent, dismissAt time.Time) error {
+	p := payload.NewPayload().
+		SetEvent(payload.LiveActivityEventEnd).
+		SetTimestamp(time.Now().Unix()).
+		SetContentState(content.contentState()).
+		SetDismissalDate(dismissAt.Unix())
+
+	return pushLiveActivity(activityToken, p)
+}
+
+// pushLiveActivity sends a Live Activity payload, returning ErrInvalidToken if
+// APNs reports the token as expired or unknown
+func pushLiveActivity(token string, p *payload.Payload) error {
+	if !initialized {
+		if err := InitAPNS(); err != nil {
+			return err
+		}
+	}
+
+	// Validate the token
+	if token == "" {
+		return fmt.Errorf("empty Live Activity token")
+	}
+
+	notification := &apns2.Notification{
+		DeviceToken: token,
+		Topic:       config.Get().APNs.Topic + ".push-type.liveactivity",
+		Payload:     p,
+		Priority:    apns2.PriorityHigh,
+		PushType:    apns2.PushTypeLiveActivity,
+	}
+
+	res, err := client.Push(notification)
+	if err != nil {
+		return fmt.Errorf("failed to send Live Activity push: %v", err)
+	}
+
+	log.Printf("Live Activity push sent to token %s: %v", token, res)
+
+	if res.StatusCode == http.StatusGone ||
+		res.Reason == apns2.ReasonBadDeviceToken ||
+		res.Reason == apns2.ReasonUnregistered ||
+		res.Reason == apns2.ReasonExpiredToken {
+		return fmt.Errorf("%w: status %d: %s", ErrInvalidToken, res.StatusCode, res.Reason)
+	}
+	if res.StatusCode != 200 {
+		return fmt.Errorf("Live Activity push failed with status %d: %s", res.StatusCode, res.Reason)
+	}
+
+	return nil
+}
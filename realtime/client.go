@@ -0,0 +1,119 @@
+package realtime
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait is the time allowed to write an event or ping to a client
+	writeWait = 10 * time.Second
+	// pongWait is how long a client may stay silent before it is disconnected
+	pongWait = 60 * time.Second
+	// pingPeriod pings clients often enough for their pongs to arrive within pongWait
+	pingPeriod = pongWait * 9 / 10
+	// maxClientMessage limits what clients may send; they only answer pings
+	maxClientMessage = 512
+	// sendQueue is the number of events buffered for a client before it is dropped
+	sendQueue = 64
+	// sessionCheckPeriod is how often a client's session is checked for revocation
+	sessionCheckPeriod = 30 * time.Second
+)
+
+// Session bounds how long a connection stays open: until the access token it was
+// opened with expires, or until Active reports that the session was revoked.
+// Active should only return false once the session is known to be gone, not on
+// transient errors.
+type Session struct {
+	ExpiresAt time.Time
+	Active    func() bool
+}
+
+// client is one WebSocket connection of a user
+type client struct {
+	hub     *Hub
+	userID  int
+	session Session
+	conn    *websocket.Conn
+	send    chan []byte
+}
+
+// Serve delivers the user's events over an upgraded WebSocket connection until it
+// closes or the session ends. It blocks for the life of the connection.
+func (h *Hub) Serve(conn *websocket.Conn, userID int, session Session) {
+	c := &client{hub: h, userID: userID, session: session, conn: conn, send: make(chan []byte, sendQueue)}
+	h.register(c)
+
+	go c.writeEvents()
+	c.readUntilClosed()
+}
+
+// readUntilClosed keeps the connection alive on pongs, discarding anything else the
+// client sends, and unregisters it once the connection fails
+func (c *client) readUntilClosed() {
+	defer func() {
+		c.hub.unregister(c)
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadLimit(maxClientMessage)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvents writes queued events and periodic pings until the queue is closed,
+// a write fails or the session ends
+func (c *client) writeEvents() {
+	ticker := time.NewTicker(pingPeriod)
+	sessionCheck := time.NewTicker(sessionCheckPeriod)
+	expired := time.NewTimer(time.Until(c.session.ExpiresAt))
+	defer func() {
+		ticker.Stop()
+		sessionCheck.Stop()
+		expired.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case data, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// The connection closed, or the hub dropped the client for falling behind
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-sessionCheck.C:
+			if c.session.Active != nil && !c.session.Active() {
+				c.close("session revoked")
+				return
+			}
+		case <-expired.C:
+			c.close("access token expired")
+			return
+		}
+	}
+}
+
+// close tells the client why the server is closing the connection. Closing the
+// connection makes readUntilClosed unregister the client.
+func (c *client) close(reason string) {
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason))
+}
@@ -0,0 +1,85 @@
+package realtime
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dial opens a WebSocket served by hub for user 1 with the given session
+func dial(t *testing.T, hub *Hub, session Session) *websocket.Conn {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		hub.Serve(conn, 1, session)
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dialing: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestServeClosesWhenTheTokenExpires(t *testing.T) {
+	hub := NewHub()
+	conn := dial(t, hub, Session{ExpiresAt: time.Now().Add(200 * time.Millisecond)})
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("got %v, want a policy violation close", err)
+	}
+
+	// The closed connection no longer receives the user's events
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		hub.mu.RLock()
+		connected := len(hub.clients[1])
+		hub.mu.RUnlock()
+		if connected == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the client is still registered after its token expired")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServeDeliversEventsUntilExpiry(t *testing.T) {
+	hub := NewHub()
+	conn := dial(t, hub, Session{ExpiresAt: time.Now().Add(time.Minute), Active: func() bool { return true }})
+
+	// Wait for the client to register before publishing
+	for i := 0; i < 500; i++ {
+		hub.mu.RLock()
+		connected := len(hub.clients[1])
+		hub.mu.RUnlock()
+		if connected > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	hub.Publish(Event{Type: EventResync}, 1)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("reading the event: %v", err)
+	}
+	if want := `{"type":"resync"}`; string(data) != want {
+		t.Fatalf("got %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,131 @@
+// Package realtime pushes messaging events to the app over WebSockets. Each server
+// instance keeps the sockets of its own clients in a Hub, and events are fanned out
+// between instances through Postgres LISTEN/NOTIFY.
+package realtime
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+)
+
+// Messaging event types
+const (
+	// EventMessageCreated carries a new message as returned by POST /api/messaging/messages
+	EventMessageCreated = "message.created"
+	// EventConversationRead tells the participants that a reader read the conversation
+	EventConversationRead = "conversation.read"
+	// EventConversationCreated carries a new conversation and its participants
+	EventConversationCreated = "conversation.created"
+	// EventResync asks clients to reload their conversations because events may have
+	// been missed, e.g. while the fan-out connection was down
+	EventResync = "resync"
+)
+
+// Event is a messaging event as sent to clients
+type Event struct {
+	Type           string      `json:"type"`
+	ConversationID int         `json:"conversation_id,omitempty"`
+	Data           interface{} `json:"data,omitempty"` // left out when too large to fan out; clients then reload the conversation
+}
+
+// Hub tracks the WebSocket clients connected to this instance, by user
+type Hub struct {
+	mu      sync.RWMutex
+	clients map[int]map[*client]bool
+	db      *sql.DB // set by UsePostgres to publish through NOTIFY
+}
+
+// NewHub returns a hub that delivers events to this instance's clients only,
+// until UsePostgres is called
+func NewHub() *Hub {
+	return &Hub{clients: make(map[int]map[*client]bool)}
+}
+
+// Publish sends an event to every connected client of the given users, on any
+// server instance. Publishing never blocks on slow clients.
+func (h *Hub) Publish(event Event, userIDs ...int) {
+	if len(userIDs) == 0 {
+		return
+	}
+
+	h.mu.RLock()
+	db := h.db
+	h.mu.RUnlock()
+	if db != nil {
+		// Every instance, including this one, delivers the event once notified
+		err := notify(db, event, userIDs)
+		if err == nil {
+			return
+		}
+		log.Printf("Error fanning out %s event, delivering locally: %v", event.Type, err)
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", event.Type, err)
+		return
+	}
+	h.deliver(data, userIDs)
+}
+
+// register adds a connected client
+func (h *Hub) register(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.clients[c.userID] == nil {
+		h.clients[c.userID] = make(map[*client]bool)
+	}
+	h.clients[c.userID][c] = true
+}
+
+// unregister removes a client and closes its send queue, once
+func (h *Hub) unregister(c *client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.clients[c.userID][c] {
+		return
+	}
+	delete(h.clients[c.userID], c)
+	if len(h.clients[c.userID]) == 0 {
+		delete(h.clients, c.userID)
+	}
+	close(c.send)
+}
+
+// deliver queues an encoded event for the local clients of the given users. Clients
+// whose queue is full are disconnected; they reload when they reconnect.
+func (h *Hub) deliver(data []byte, userIDs []int) {
+	var slow []*client
+
+	h.mu.RLock()
+	for _, userID := range userIDs {
+		for c := range h.clients[userID] {
+			select {
+			case c.send <- data:
+			default:
+				slow = append(slow, c)
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, c := range slow {
+		h.unregister(c)
+	}
+}
+
+// broadcast queues an encoded event for every local client
+func (h *Hub) broadcast(data []byte) {
+	h.mu.RLock()
+	userIDs := make([]int, 0, len(h.clients))
+	for userID := range h.clients {
+		userIDs = append(userIDs, userID)
+	}
+	h.mu.RUnlock()
+
+	h.deliver(data, userIDs)
+}
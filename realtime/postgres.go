@@ -0,0 +1,107 @@
+package realtime
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// notifyChannel is the Postgres channel messaging events are fanned out on
+const notifyChannel = "messaging_events"
+
+// maxNotifyPayload is the largest NOTIFY payload Postgres accepts by default
+const maxNotifyPayload = 7999
+
+// listenerPingInterval checks an idle listener connection is still alive
+const listenerPingInterval = 90 * time.Second
+
+// notification is the NOTIFY payload: an encoded event and who receives it
+type notification struct {
+	UserIDs []int           `json:"user_ids"`
+	Event   json.RawMessage `json:"event"`
+}
+
+// UsePostgres fans published events out through Postgres, so that clients
+// connected to any server instance receive them. Events are sent with NOTIFY on
+// db and received on a dedicated connection to dsn, which reconnects on its own.
+func (h *Hub) UsePostgres(db *sql.DB, dsn string) error {
+	listener := pq.NewListener(dsn, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Messaging event listener: %v", err)
+		}
+	})
+	if err := listener.Listen(notifyChannel); err != nil {
+		listener.Close()
+		return err
+	}
+
+	h.mu.Lock()
+	h.db = db
+	h.mu.Unlock()
+
+	go h.listen(listener)
+	return nil
+}
+
+// notify publishes an event to every instance. An event too large for NOTIFY is
+// sent without its data.
+func notify(db *sql.DB, event Event, userIDs []int) error {
+	payload, err := encodeNotification(event, userIDs)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxNotifyPayload {
+		event.Data = nil
+		if payload, err = encodeNotification(event, userIDs); err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec(`SELECT pg_notify($1, $2)`, notifyChannel, string(payload))
+	return err
+}
+
+// encodeNotification encodes the NOTIFY payload of an event
+func encodeNotification(event Event, userIDs []int) ([]byte, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(notification{UserIDs: userIDs, Event: data})
+}
+
+// listen delivers notified events to this instance's clients until the listener
+// is closed
+func (h *Hub) listen(listener *pq.Listener) {
+	resync, _ := json.Marshal(Event{Type: EventResync})
+
+	for {
+		select {
+		case n, ok := <-listener.Notify:
+			if !ok {
+				return
+			}
+			if n == nil {
+				// The connection was re-established; notifications sent meanwhile are lost
+				h.broadcast(resync)
+				continue
+			}
+
+			var received notification
+			if err := json.Unmarshal([]byte(n.Extra), &received); err != nil {
+				log.Printf("Error decoding messaging event: %v", err)
+				continue
+			}
+			h.deliver(received.Event, received.UserIDs)
+		case <-time.After(listenerPingInterval):
+			go func() {
+				if err := listener.Ping(); err != nil {
+					log.Printf("Messaging event listener ping failed: %v", err)
+				}
+			}()
+		}
+	}
+}
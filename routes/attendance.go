@@ -7,10 +7,13 @@ import (
 	"io"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
+	"server/config"
+	"server/jobs"
+	"server/middleware"
 	"server/models"
+	"server/store"
 
 	"github.com/gin-gonic/gin"
 )
@@ -30,66 +33,43 @@ import (
 //     "year": string,    // e.g., "PIB"
 //     "section": string, // e.g., "A"
 //     "students": int,   // Number of students in the group
-//     "attendance": string // e.g., "95.5%"
+//     "attendance": string // Attendance rate over all recorded days, e.g., "95.5%"
 //     }
 //     ]
 //     }
 //   - 500 Internal Server Error: Database error
-func GetYearGroups(c *gin.Context, db *sql.DB) {
-	yearGroups := models.GenerateYearGroups()
+func GetYearGroups(c *gin.Context, attendance store.AttendanceStore, yearGroups store.YearGroupStore) {
+	sections, err := yearGroups.ListSections()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error getting year groups: %v", err),
+		})
+		return
+	}
 
 	// Format the response with additional information
+	type StudentRef struct {
+		UserID int    `json:"user_id"`
+		Name   string `json:"name"`
+	}
 	type YearGroupResponse struct {
-		ID           string `json:"id"`
-		Name         string `json:"name"`
-		Year         string `json:"year"`
-		Section      string `json:"section"`
-		Students     int    `json:"students"`
-		Attendance   string `json:"attendance"`
-		LateStudents []struct {
-			UserID int    `json:"user_id"`
-			Name   string `json:"name"`
-		} `json:"late_students"`
-		AbsentStudents []struct {
-			UserID int    `json:"user_id"`
-			Name   string `json:"name"`
-		} `json:"absent_students"`
-		MedicalStudents []struct {
-			UserID int    `json:"user_id"`
-			Name   string `json:"name"`
-		} `json:"medical_students"`
-	}
-
-	response := make([]YearGroupResponse, 0, len(yearGroups))
-
-	// For each year group, query the database for student count and attendance stats
-	for _, group := range yearGroups {
-		id := strings.ToLower(group.Year + "-" + group.Section)
-
-		// Query to get student count for this year group
-		var studentCount int
-		err := db.QueryRow(`
-			SELECT COUNT(*) FROM attendance 
-			WHERE year = $1 AND group_name = $2
-		`, group.Year, group.Section).Scan(&studentCount)
-
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"message": fmt.Sprintf("Error getting student count: %v", err),
-			})
-			return
-		}
-
-		// Query to get attendance statistics for this year group
-		var totalPresent, totalCount int
-		err = db.QueryRow(`
-			SELECT COALESCE(SUM(present), 0), 
-			       COUNT(*) 
-			FROM attendance 
-			WHERE year = $1 AND group_name = $2
-		`, group.Year, group.Section).Scan(&totalPresent, &totalCount)
-
+		ID              string       `json:"id"`
+		Name            string       `json:"name"`
+		Year            string       `json:"year"`
+		Section         string       `json:"section"`
+		Students        int          `json:"students"`
+		Attendance      string       `json:"attendance"`
+		LateStudents    []StudentRef `json:"late_students"`
+		AbsentStudents  []StudentRef `json:"absent_students"`
+		MedicalStudents []StudentRef `json:"medical_students"`
+	}
+
+	response := make([]YearGroupResponse, 0, len(sections))
+
+	// For each section, load its students and derive the attendance stats
+	for _, section := range sections {
+		students, err := attendance.ListByGroup(section.Year, section.Name, time.Now())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"success": false,
@@ -98,97 +78,45 @@ func GetYearGroups(c *gin.Context, db *sql.DB) {
 			return
 		}
 
-		// Calculate attendance percentage
-		var attendancePercentage string
-		if totalCount > 0 {
-			percentage := float64(totalPresent) / float64(totalCount) * 100
-			attendancePercentage = fmt.Sprintf("%.1f%%", percentage)
-		} else {
-			attendancePercentage = "0%"
-		}
-
-		// Query to get late, absent, and medical students
-		lateStudents := []struct {
-			UserID int    `json:"user_id"`
-			Name   string `json:"name"`
-		}{}
-		absentStudents := []struct {
-			UserID int    `json:"user_id"`
-			Name   string `json:"name"`
-		}{}
-		medicalStudents := []struct {
-			UserID int    `json:"user_id"`
-			Name   string `json:"name"`
-		}{}
-
-		// Get late students
-		lateRows, err := db.Query(`
-			SELECT user_id, name 
-			FROM attendance 
-			WHERE year = $1 AND group_name = $2 AND today = 'Late'
-		`, group.Year, group.Section)
-		if err == nil {
-			defer lateRows.Close()
-			for lateRows.Next() {
-				var student struct {
-					UserID int    `json:"user_id"`
-					Name   string `json:"name"`
-				}
-				if err := lateRows.Scan(&student.UserID, &student.Name); err == nil {
-					lateStudents = append(lateStudents, student)
-				}
-			}
+		groupResponse := YearGroupResponse{
+			ID:              section.Slug(),
+			Name:            section.FullName(),
+			Year:            section.Year,
+			Section:         section.Name,
+			Students:        len(students),
+			LateStudents:    []StudentRef{},
+			AbsentStudents:  []StudentRef{},
+			MedicalStudents: []StudentRef{},
 		}
 
-		// Get absent students
-		absentRows, err := db.Query(`
-			SELECT user_id, name 
-			FROM attendance 
-			WHERE year = $1 AND group_name = $2 AND today = 'Absent'
-		`, group.Year, group.Section)
-		if err == nil {
-			defer absentRows.Close()
-			for absentRows.Next() {
-				var student struct {
-					UserID int    `json:"user_id"`
-					Name   string `json:"name"`
-				}
-				if err := absentRows.Scan(&student.UserID, &student.Name); err == nil {
-					absentStudents = append(absentStudents, student)
-				}
+		var counts models.AttendanceCounts
+		for _, student := range students {
+			counts.Present += student.Present
+			counts.Absent += student.Absent
+			counts.Late += student.Late
+			counts.Medical += student.Medical
+			counts.Early += student.Early
+
+			ref := StudentRef{UserID: student.UserID, Name: student.Name}
+			switch student.Today {
+			case models.AttendanceLate:
+				groupResponse.LateStudents = append(groupResponse.LateStudents, ref)
+			case models.AttendanceAbsent:
+				groupResponse.AbsentStudents = append(groupResponse.AbsentStudents, ref)
+			case models.AttendanceMedical:
+				groupResponse.MedicalStudents = append(groupResponse.MedicalStudents, ref)
 			}
 		}
 
-		// Get medical students
-		medicalRows, err := db.Query(`
-			SELECT user_id, name 
-			FROM attendance 
-			WHERE year = $1 AND group_name = $2 AND today = 'Medical'
-		`, group.Year, group.Section)
-		if err == nil {
-			defer medicalRows.Close()
-			for medicalRows.Next() {
-				var student struct {
-					UserID int    `json:"user_id"`
-					Name   string `json:"name"`
-				}
-				if err := medicalRows.Scan(&student.UserID, &student.Name); err == nil {
-					medicalStudents = append(medicalStudents, student)
-				}
-			}
+		// Calculate the attendance rate across every recorded day in the group,
+		// the same rate as the analytics endpoints
+		if counts.Total() > 0 {
+			groupResponse.Attendance = fmt.Sprintf("%.1f%%", counts.Rate())
+		} else {
+			groupResponse.Attendance = "0%"
 		}
 
-		response = append(response, YearGroupResponse{
-			ID:              id,
-			Name:            group.FullName,
-			Year:            group.Year,
-			Section:         group.Section,
-			Students:        studentCount,
-			Attendance:      attendancePercentage,
-			LateStudents:    lateStudents,
-			AbsentStudents:  absentStudents,
-			MedicalStudents: medicalStudents,
-		})
+		response = append(response, groupResponse)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -203,6 +131,7 @@ func GetYearGroups(c *gin.Context, db *sql.DB) {
 //
 // Parameters:
 //   - id: The year group ID (string, e.g., "pib-a")
+//   - date: Optional day of the register in YYYY-MM-DD format (query, defaults to today)
 //
 // Returns:
 //   - 200 OK: Successfully retrieved students
@@ -219,90 +148,79 @@ func GetYearGroups(c *gin.Context, db *sql.DB) {
 //     "name": string,
 //     "year": string,
 //     "group_name": string,
-//     "today": string,
+//     "today": string, // Status recorded for the requested date
 //     "present": int,
 //     "absent": int,
 //     "late": int,
 //     "medical": int,
-//     "early": int
+//     "early": int,
+//     "leave": {        // Only when the status comes from an approved leave request
+//     "request_id": int,
+//     "request_type": string,
+//     "reason": string
+//     }
 //     }
 //     ],
-//     "date": string // Current date in YYYY-MM-DD format
+//     "date": string // Requested date in YYYY-MM-DD format
 //     }
-//   - 400 Bad Request: Invalid year group ID
+//   - 400 Bad Request: Invalid year group ID or date
 //   - 500 Internal Server Error: Database error
-func GetStudentsByYearGroup(c *gin.Context, db *sql.DB) {
+func GetStudentsByYearGroup(c *gin.Context, attendance store.AttendanceStore, yearGroups store.YearGroupStore) {
 	yearGroupID := c.Param("id")
 
-	// Convert ID to YearGroup
-	yearGroup, exists := models.GetYearGroupByID(yearGroupID)
-	if !exists {
-		c.JSON(http.StatusBadRequest, gin.H{
+	// Convert ID to its section
+	section, err := yearGroups.GetSectionBySlug(yearGroupID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid year group ID",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
-			"message": "Invalid year group ID",
+			"message": fmt.Sprintf("Error getting year group: %v", err),
 		})
 		return
 	}
 
-	// Query the database for students in this year group
-	rows, err := db.Query(`
-		SELECT user_id, name, year, group_name, today, present, absent, late, medical, early 
-		FROM attendance 
-		WHERE year = $1 AND group_name = $2
-	`, yearGroup.Year, yearGroup.Section)
-
+	date, err := parseAttendanceDate(c.Query("date"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"message": fmt.Sprintf("Error querying students: %v", err),
+			"message": err.Error(),
 		})
 		return
 	}
-	defer rows.Close()
-
-	// Parse the query results
-	var students []models.Student
-	for rows.Next() {
-		var student models.Student
-		if err := rows.Scan(
-			&student.UserID,
-			&student.Name,
-			&student.Year,
-			&student.GroupName,
-			&student.Today,
-			&student.Present,
-			&student.Absent,
-			&student.Late,
-			&student.Medical,
-			&student.Early,
-		); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"message": fmt.Sprintf("Error scanning student data: %v", err),
-			})
-			return
-		}
-		students = append(students, student)
-	}
 
-	// Check for errors during iteration
-	if err = rows.Err(); err != nil {
+	// Query the database for students in this year group
+	students, err := attendance.ListByGroup(section.Year, section.Name, date)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
-			"message": fmt.Sprintf("Error iterating through students: %v", err),
+			"message": fmt.Sprintf("Error querying students: %v", err),
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success":   true,
-		"yearGroup": yearGroup,
-		"students":  students,
-		"date":      time.Now().Format("2006-01-02"),
+		"success": true,
+		"yearGroup": gin.H{
+			"year":     section.Year,
+			"section":  section.Name,
+			"fullName": section.FullName(),
+		},
+		"students": students,
+		"date":     date.Format("2006-01-02"),
 	})
 }
 
-// UpdateAttendance updates the attendance status for students in DB
+// UpdateAttendance records the attendance status for students on a given day in DB.
+// Correcting a past day only changes that day's record, never today's register.
+// Once a day's register is locked (attendance.lock_after after its rollover) only
+// users with the attendance role can amend it. Every change is kept in the audit
+// trail, and the updated students are checked against the attendance alert rules.
 //
 // Endpoint: POST /api/attendance/update
 //
@@ -310,11 +228,12 @@ func GetStudentsByYearGroup(c *gin.Context, db *sql.DB) {
 //
 //	{
 //	  "yearGroupId": string,  // e.g., "pib-a"
-//	  "date": string,         // YYYY-MM-DD format
+//	  "date": string,         // YYYY-MM-DD format, defaults to today; cannot be in the future
 //	  "students": [
 //	    {
 //	      "user_id": int,
-//	      "status": string    // "Present", "Absent", "Late", "Medical", "Early", or "Pending"
+//	      "status": string,   // "Present", "Absent", "Late", "Medical", "Early", or "Pending"
+//	      "note": string      // optional reason for the change, kept in the audit trail
 //	    }
 //	  ]
 //	}
@@ -327,15 +246,14 @@ func GetStudentsByYearGroup(c *gin.Context, db *sql.DB) {
 //     "updatedCount": int
 //     }
 //   - 400 Bad Request: Invalid request format or data
+//   - 403 Forbidden: The day's register is locked and the caller lacks the attendance role
+//   - 404 Not Found: A student has no attendance record
 //   - 500 Internal Server Error: Database error
-func UpdateAttendance(c *gin.Context, db *sql.DB) {
+func UpdateAttendance(c *gin.Context, attendance store.AttendanceStore, alerts *jobs.AttendanceAlerts) {
 	var request struct {
-		YearGroupID string `json:"yearGroupId"`
-		Date        string `json:"date"`
-		Students    []struct {
-			UserID int    `json:"user_id"`
-			Status string `json:"status"`
-		} `json:"students"`
+		YearGroupID string                    `json:"yearGroupId"`
+		Date        string                    `json:"date"`
+		Students    []models.AttendanceUpdate `json:"students"`
 	}
 
 	// Read the raw body first for debugging
@@ -365,92 +283,113 @@ func UpdateAttendance(c *gin.Context, db *sql.DB) {
 	}
 
 	// Validate the request
-	if len(request.Students) == 0 {
+	if !validateAttendanceUpdates(c, request.Students) {
+		return
+	}
+
+	date, err := parseAttendanceDate(request.Date)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"message": "No students provided in the request",
+			"message": err.Error(),
 		})
 		return
 	}
 
-	// Start a transaction
-	tx, err := db.Begin()
-	if err != nil {
+	user, _ := middleware.CurrentUser(c)
+
+	// Past the lock period only the attendance office can amend a day's register
+	if config.Get().Attendance.IsLocked(date, time.Now()) && !user.HasRole(models.RoleAttendance) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("The register for %s is locked; ask the attendance office to amend it", date.Format("2006-01-02")),
+		})
+		return
+	}
+
+	// Record every student's status for the day in one transaction
+	if err := attendance.RecordDay(date, request.Students, user.ID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "One or more students have no attendance record",
+			})
+			return
+		}
+		fmt.Printf("Error updating attendance: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
-			"message": fmt.Sprintf("Error starting transaction: %v", err),
+			"message": fmt.Sprintf("Error updating attendance: %v", err),
 		})
 		return
 	}
 
-	// Update each student's attendance status
+	// Check the updated students against the attendance alert rules
+	studentIDs := make([]int, 0, len(request.Students))
 	for _, student := range request.Students {
+		studentIDs = append(studentIDs, student.UserID)
+	}
+	alerts.Evaluate(date, studentIDs...)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"message":      "Attendance updated successfully",
+		"updatedCount": len(request.Students),
+	})
+}
+
+// validateAttendanceUpdates checks the students of a register update, responding
+// with 400 if any is invalid. An empty status or "Pending" resets a student.
+func validateAttendanceUpdates(c *gin.Context, updates []models.AttendanceUpdate) bool {
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "No students provided in the request",
+		})
+		return false
+	}
+
+	for _, student := range updates {
 		// Validate the user ID
 		if student.UserID <= 0 {
-			tx.Rollback()
 			c.JSON(http.StatusBadRequest, gin.H{
 				"success": false,
 				"message": fmt.Sprintf("Invalid user ID: %d", student.UserID),
 			})
-			return
+			return false
 		}
 
 		// Validate the status - allow empty status or "Pending" for resetting
 		if student.Status != "" &&
-			student.Status != "Present" &&
-			student.Status != "Absent" &&
-			student.Status != "Late" &&
-			student.Status != "Medical" &&
-			student.Status != "Early" &&
-			student.Status != "Pending" {
-			// Invalid status provided
-			tx.Rollback()
+			student.Status != models.AttendancePending &&
+			!models.IsAttendanceStatus(student.Status) {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"success": false,
 				"message": fmt.Sprintf("Invalid status '%s' for user ID %d", student.Status, student.UserID),
 			})
-			return
-		}
-
-		// Update the today field - always set "Pending" for empty values, never NULL
-		result, err := tx.Exec(`
-			UPDATE attendance 
-			SET today = CASE WHEN $1 = '' OR $1 = 'Pending' THEN 'Pending' ELSE $1 END
-			WHERE user_id = $2
-		`, student.Status, student.UserID)
-
-		if err != nil {
-			tx.Rollback()
-			fmt.Printf("Error updating attendance for user ID %d: %v\n", student.UserID, err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"message": fmt.Sprintf("Error updating attendance for user ID %d: %v", student.UserID, err),
-			})
-			return
+			return false
 		}
+	}
+	return true
+}
 
-		// Check if any rows were affected
-		rowsAffected, _ := result.RowsAffected()
-		if rowsAffected == 0 {
-			fmt.Printf("Warning: No rows updated for user ID %d\n", student.UserID)
-		}
+// parseAttendanceDate parses a register date in YYYY-MM-DD format, defaulting to
+// today; dates in the future are rejected
+func parseAttendanceDate(value string) (time.Time, error) {
+	now := time.Now()
+	if value == "" {
+		return now, nil
 	}
 
-	// Commit the transaction
-	if err = tx.Commit(); err != nil {
-		fmt.Printf("Error committing transaction: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": fmt.Sprintf("Error committing transaction: %v", err),
-		})
-		return
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid date '%s', expected YYYY-MM-DD", value)
+	}
+	if date.After(now) {
+		return time.Time{}, fmt.Errorf("Cannot record attendance for a future date: %s", value)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"success":      true,
-		"message":      "Attendance updated successfully",
-		"updatedCount": len(request.Students),
-	})
+	return date, nil
 }
 
 // GetStudentAttendance returns attendance records for a specific student
@@ -470,6 +409,11 @@ func UpdateAttendance(c *gin.Context, db *sql.DB) {
 //     "year": string,
 //     "group_name": string,
 //     "today": string, // "Present", "Absent", "Late", "Medical", "Early", or "Pending"
+//     "leave": {       // Approved leave request behind today's status, or null
+//     "request_id": int,
+//     "request_type": string,
+//     "reason": string
+//     },
 //     "stats": {
 //     "present": int,
 //     "absent": int,
@@ -484,12 +428,10 @@ func UpdateAttendance(c *gin.Context, db *sql.DB) {
 //   - 400 Bad Request: Invalid student ID format
 //   - 404 Not Found: No attendance records found for the student
 //   - 500 Internal Server Error: Database error
-func GetStudentAttendance(c *gin.Context, db *sql.DB) {
+func GetStudentAttendance(c *gin.Context, attendance store.AttendanceStore) {
 	studentIDStr := c.Param("id")
-	fmt.Printf("Received request for student ID: %s\n", studentIDStr)
 
 	if studentIDStr == "" {
-		fmt.Println("Error: Student ID is empty")
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Student ID is required",
@@ -500,7 +442,6 @@ func GetStudentAttendance(c *gin.Context, db *sql.DB) {
 	// Convert student ID from string to integer
 	studentID, err := strconv.Atoi(studentIDStr)
 	if err != nil {
-		fmt.Printf("Error converting student ID to integer: %v\n", err)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": fmt.Sprintf("Invalid student ID format: %s", studentIDStr),
@@ -508,81 +449,16 @@ func GetStudentAttendance(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	// Query to get attendance records for the student
-	query := `
-		SELECT 
-			user_id,
-			name,
-			year,
-			group_name,
-			today,
-			present,
-			absent,
-			late,
-			medical,
-			early
-		FROM attendance 
-		WHERE user_id = $1;
-	`
-	fmt.Printf("Executing query: %s with student ID: %d\n", query, studentID)
-
-	var record struct {
-		UserID    int    `json:"user_id"`
-		Name      string `json:"name"`
-		Year      string `json:"year"`
-		GroupName string `json:"group_name"`
-		Today     string `json:"today"`
-		Present   int    `json:"present"`
-		Absent    int    `json:"absent"`
-		Late      int    `json:"late"`
-		Medical   int    `json:"medical"`
-		Early     int    `json:"early"`
-	}
-
-	// First, check if the student exists in the attendance table
-	var count int
-	err = db.QueryRow("SELECT COUNT(*) FROM attendance WHERE user_id = $1", studentID).Scan(&count)
-	if err != nil {
-		fmt.Printf("Error checking student existence: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": fmt.Sprintf("Error checking student existence: %v", err),
-		})
-		return
-	}
-	fmt.Printf("Found %d records for student ID %d\n", count, studentID)
-
-	if count == 0 {
-		fmt.Printf("No records found for student ID: %d\n", studentID)
-		c.JSON(http.StatusNotFound, gin.H{
-			"success": false,
-			"message": fmt.Sprintf("No attendance records found for student ID: %d", studentID),
-		})
-		return
-	}
-
-	err = db.QueryRow(query, studentID).Scan(
-		&record.UserID,
-		&record.Name,
-		&record.Year,
-		&record.GroupName,
-		&record.Today,
-		&record.Present,
-		&record.Absent,
-		&record.Late,
-		&record.Medical,
-		&record.Early,
-	)
-
+	record, err := attendance.Get(studentID)
 	if err != nil {
-		fmt.Printf("Error scanning attendance record: %v\n", err)
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, gin.H{
 				"success": false,
-				"message": fmt.Sprintf("Student not found with ID: %d", studentID),
+				"message": fmt.Sprintf("No attendance records found for student ID: %d", studentID),
 			})
 			return
 		}
+		fmt.Printf("Error querying attendance record: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"message": fmt.Sprintf("Error querying attendance: %v", err),
@@ -590,16 +466,11 @@ func GetStudentAttendance(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	fmt.Printf("Successfully retrieved attendance record for student: %s (ID: %d)\n", record.Name, record.UserID)
-
-	// Calculate attendance statistics
-	totalClasses := record.Present + record.Absent + record.Late + record.Medical + record.Early
-	var attendancePercentage float64
-	if totalClasses > 0 {
-		attendancePercentage = float64(record.Present) / float64(totalClasses) * 100
-	}
+	// Calculate attendance statistics from the student's daily records
+	totalClasses := record.TotalDays()
+	attendancePercentage := record.Counts().Rate()
 
-	response := gin.H{
+	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"student": gin.H{
 			"user_id":    record.UserID,
@@ -607,6 +478,7 @@ func GetStudentAttendance(c *gin.Context, db *sql.DB) {
 			"year":       record.Year,
 			"group_name": record.GroupName,
 			"today":      record.Today,
+			"leave":      record.Leave,
 			"stats": gin.H{
 				"present":    record.Present,
 				"absent":     record.Absent,
@@ -617,10 +489,7 @@ func GetStudentAttendance(c *gin.Context, db *sql.DB) {
 				"percentage": fmt.Sprintf("%.1f%%", attendancePercentage),
 			},
 		},
-	}
-
-	fmt.Printf("Sending response for student %s: %+v\n", record.Name, response)
-	c.JSON(http.StatusOK, response)
+	})
 }
 
 // GetAllAttendance returns all attendance records
@@ -641,28 +510,17 @@ func GetStudentAttendance(c *gin.Context, db *sql.DB) {
 //     "present": int,
 //     "absent": int,
 //     "late": int,
-//     "medical": int
+//     "medical": int,
+//     "early": int,
+//     "leave": { "request_id": int, "request_type": string, "reason": string } // omitted without leave
 //     }
 //     ]
 //     }
 //   - 500 Internal Server Error: Database error
-func GetAllAttendance(c *gin.Context, db *sql.DB) {
-	query := `
-		SELECT 
-			user_id,
-			name,
-			year,
-			group_name,
-			today,
-			present,
-			absent,
-			late,
-			medical
-		FROM attendance
-		ORDER BY year, group_name, name
-	`
-
-	rows, err := db.Query(query)
+//
+// For CSV or XLSX downloads see ExportAttendance.
+func GetAllAttendance(c *gin.Context, attendance store.AttendanceStore) {
+	records, err := attendance.ListAll()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -670,60 +528,6 @@ func GetAllAttendance(c *gin.Context, db *sql.DB) {
 		})
 		return
 	}
-	defer rows.Close()
-
-	var records []struct {
-		UserID    int    `json:"user_id"`
-		Name      string `json:"name"`
-		Year      string `json:"year"`
-		GroupName string `json:"group_name"`
-		Today     string `json:"today"`
-		Present   int    `json:"present"`
-		Absent    int    `json:"absent"`
-		Late      int    `json:"late"`
-		Medical   int    `json:"medical"`
-	}
-
-	for rows.Next() {
-		var record struct {
-			UserID    int    `json:"user_id"`
-			Name      string `json:"name"`
-			Year      string `json:"year"`
-			GroupName string `json:"group_name"`
-			Today     string `json:"today"`
-			Present   int    `json:"present"`
-			Absent    int    `json:"absent"`
-			Late      int    `json:"late"`
-			Medical   int    `json:"medical"`
-		}
-		err := rows.Scan(
-			&record.UserID,
-			&record.Name,
-			&record.Year,
-			&record.GroupName,
-			&record.Today,
-			&record.Present,
-			&record.Absent,
-			&record.Late,
-			&record.Medical,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"message": fmt.Sprintf("Error scanning attendance record: %v", err),
-			})
-			return
-		}
-		records = append(records, record)
-	}
-
-	if err = rows.Err(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": fmt.Sprintf("Error iterating through records: %v", err),
-		})
-		return
-	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -748,7 +552,12 @@ func GetAllAttendance(c *gin.Context, db *sql.DB) {
 //     "student_id": int,
 //     "status": string,        // "present", "absent", "late", "medical", or "early"
 //     "attendance_date": string, // YYYY-MM-DD format
-//     "arrived_at": string,    // HH:MM:SS format, null for non-late status
+//     "arrived_at": string,    // HH:MM:SS format, null unless checked in at reception
+//     "leave": {               // Approved leave request behind the status, or null
+//     "request_id": int,
+//     "request_type": string,
+//     "reason": string
+//     },
 //     "created_at": string     // timestamp
 //     }
 //     ]
@@ -756,12 +565,10 @@ func GetAllAttendance(c *gin.Context, db *sql.DB) {
 //   - 400 Bad Request: Invalid student ID format
 //   - 404 Not Found: No attendance records found for the student
 //   - 500 Internal Server Error: Database error
-func GetStudentAttendanceHistory(c *gin.Context, db *sql.DB) {
+func GetStudentAttendanceHistory(c *gin.Context, attendance store.AttendanceStore, users store.UserStore) {
 	studentIDStr := c.Param("id")
-	fmt.Printf("Received request for student attendance history, ID: %s\n", studentIDStr)
 
 	if studentIDStr == "" {
-		fmt.Println("Error: Student ID is empty")
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Student ID is required",
@@ -772,7 +579,6 @@ func GetStudentAttendanceHistory(c *gin.Context, db *sql.DB) {
 	// Convert student ID from string to integer
 	studentID, err := strconv.Atoi(studentIDStr)
 	if err != nil {
-		fmt.Printf("Error converting student ID to integer: %v\n", err)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": fmt.Sprintf("Invalid student ID format: %s", studentIDStr),
@@ -781,8 +587,7 @@ func GetStudentAttendanceHistory(c *gin.Context, db *sql.DB) {
 	}
 
 	// First, check if the student exists
-	var exists bool
-	err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", studentID).Scan(&exists)
+	exists, err := users.Exists(studentID)
 	if err != nil {
 		fmt.Printf("Error checking if student exists: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -793,7 +598,6 @@ func GetStudentAttendanceHistory(c *gin.Context, db *sql.DB) {
 	}
 
 	if !exists {
-		fmt.Printf("Student not found with ID: %d\n", studentID)
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
 			"message": fmt.Sprintf("Student not found with ID: %d", studentID),
@@ -801,21 +605,7 @@ func GetStudentAttendanceHistory(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	// Query to get attendance history records for the student
-	query := `
-		SELECT 
-			id,
-			student_id,
-			status,
-			attendance_date,
-			arrived_at,
-			created_at
-		FROM attendance_history 
-		WHERE student_id = $1
-		ORDER BY attendance_date DESC
-	`
-
-	rows, err := db.Query(query, studentID)
+	history, err := attendance.ListHistory(studentID)
 	if err != nil {
 		fmt.Printf("Error querying attendance history: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -824,97 +614,139 @@ func GetStudentAttendanceHistory(c *gin.Context, db *sql.DB) {
 		})
 		return
 	}
-	defer rows.Close()
-
-	var records []gin.H
-	for rows.Next() {
-		var id, studentID int
-		var status string
-		var attendanceDate time.Time
-		var arrivedAt sql.NullTime
-		var createdAt time.Time
-
-		err := rows.Scan(
-			&id,
-			&studentID,
-			&status,
-			&attendanceDate,
-			&arrivedAt,
-			&createdAt,
-		)
 
-		if err != nil {
-			fmt.Printf("Error scanning attendance record: %v\n", err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"message": fmt.Sprintf("Error scanning attendance record: %v", err),
-			})
-			return
-		}
+	// If no records found
+	if len(history) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"records": []gin.H{},
+			"message": "No attendance history records found for this student",
+		})
+		return
+	}
 
+	records := make([]gin.H, 0, len(history))
+	for _, entry := range history {
 		record := gin.H{
-			"id":              id,
-			"student_id":      studentID,
-			"status":          status,
-			"attendance_date": attendanceDate.Format("2006-01-02"),
-			"created_at":      createdAt.Format(time.RFC3339),
+			"id":              entry.ID,
+			"student_id":      entry.StudentID,
+			"status":          entry.Status,
+			"attendance_date": entry.AttendanceDate.Format("2006-01-02"),
+			"created_at":      entry.CreatedAt.Format(time.RFC3339),
+			"arrived_at":      nil,
+			"leave":           entry.Leave,
 		}
-
-		if arrivedAt.Valid {
-			record["arrived_at"] = arrivedAt.Time.Format("15:04:05")
-		} else {
-			record["arrived_at"] = nil
+		if entry.ArrivedAt != nil {
+			record["arrived_at"] = entry.ArrivedAt.Format("15:04:05")
 		}
-
 		records = append(records, record)
 	}
 
-	if err = rows.Err(); err != nil {
-		fmt.Printf("Error iterating through records: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"records": records,
+	})
+}
+
+// GetStudentAttendanceChanges returns the audit trail of a student's daily records
+//
+// Endpoint: GET /api/attendance/changes/:id
+//
+// Parameters:
+//   - id: The student's user ID (integer)
+//
+// Returns:
+//   - 200 OK: Changes, newest first
+//     {
+//     "success": true,
+//     "changes": [
+//     {
+//     "id": int,
+//     "attendance_date": string,  // YYYY-MM-DD format
+//     "previous_status": string,  // e.g., "absent"; null if the day had no record
+//     "new_status": string,       // null if the record was cleared
+//     "changed_by": int,          // null for the scheduled rollover
+//     "changed_by_name": string,
+//     "source": string,           // "register", "check_in", "leave" or "rollover"
+//     "note": string,             // null if none was given
+//     "changed_at": string        // timestamp
+//     }
+//     ]
+//     }
+//   - 400 Bad Request: Invalid student ID format
+//   - 500 Internal Server Error: Database error
+func GetStudentAttendanceChanges(c *gin.Context, attendance store.AttendanceStore) {
+	studentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"message": fmt.Sprintf("Error iterating through records: %v", err),
+			"message": fmt.Sprintf("Invalid student ID format: %s", c.Param("id")),
 		})
 		return
 	}
 
-	// If no records found
-	if len(records) == 0 {
-		c.JSON(http.StatusOK, gin.H{
-			"success": true,
-			"records": []gin.H{},
-			"message": "No attendance history records found for this student",
+	changes, err := attendance.ListChanges(studentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error querying attendance changes: %v", err),
 		})
 		return
 	}
 
+	// Statuses are null rather than empty when the day had no record
+	nullable := func(status string) interface{} {
+		if status == "" {
+			return nil
+		}
+		return status
+	}
+
+	entries := make([]gin.H, 0, len(changes))
+	for _, change := range changes {
+		entries = append(entries, gin.H{
+			"id":              change.ID,
+			"attendance_date": change.AttendanceDate.Format("2006-01-02"),
+			"previous_status": nullable(change.PreviousStatus),
+			"new_status":      nullable(change.NewStatus),
+			"changed_by":      change.ChangedBy,
+			"changed_by_name": change.ChangedByName,
+			"source":          change.Source,
+			"note":            change.Note,
+			"changed_at":      change.ChangedAt.Format(time.RFC3339),
+		})
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"records": records,
+		"changes": entries,
 	})
 }
 
 // SetupAttendanceRoutes sets up the attendance routes
-func SetupAttendanceRoutes(router gin.IRouter, db *sql.DB) {
+func SetupAttendanceRoutes(router gin.IRouter, attendance store.AttendanceStore, yearGroups store.YearGroupStore, users store.UserStore, alerts *jobs.AttendanceAlerts) {
 	attendanceGroup := router.Group("/attendance")
 	{
-		attendanceGroup.GET("/year-groups", func(c *gin.Context) {
-			GetYearGroups(c, db)
+		attendanceGroup.GET("/year-groups", middleware.RequireRoles(models.RoleStaff), func(c *gin.Context) {
+			GetYearGroups(c, attendance, yearGroups)
+		})
+		attendanceGroup.GET("/students/:id", middleware.RequireRoles(models.RoleStaff), func(c *gin.Context) {
+			GetStudentsByYearGroup(c, attendance, yearGroups)
 		})
-		attendanceGroup.GET("/students/:id", func(c *gin.Context) {
-			GetStudentsByYearGroup(c, db)
+		attendanceGroup.POST("/update", middleware.RequireRoles(models.RoleStaff, models.RoleAttendance), func(c *gin.Context) {
+			UpdateAttendance(c, attendance, alerts)
 		})
-		attendanceGroup.POST("/update", func(c *gin.Context) {
-			UpdateAttendance(c, db)
+		attendanceGroup.GET("/student/:id", middleware.RequireSelfOrRoles("id", models.RoleStaff), func(c *gin.Context) {
+			GetStudentAttendance(c, attendance)
 		})
-		attendanceGroup.GET("/student/:id", func(c *gin.Context) {
-			GetStudentAttendance(c, db)
+		attendanceGroup.GET("/all", middleware.RequireRoles(models.RoleStaff, models.RoleAttendance), func(c *gin.Context) {
+			GetAllAttendance(c, attendance)
 		})
-		attendanceGroup.GET("/all", func(c *gin.Context) {
-			GetAllAttendance(c, db)
+		attendanceGroup.GET("/history/:id", middleware.RequireSelfOrRoles("id", models.RoleStaff), func(c *gin.Context) {
+			GetStudentAttendanceHistory(c, attendance, users)
 		})
-		attendanceGroup.GET("/history/:id", func(c *gin.Context) {
-			GetStudentAttendanceHistory(c, db)
+		attendanceGroup.GET("/changes/:id", middleware.RequireRoles(models.RoleStaff, models.RoleAttendance, models.RoleAdmin), func(c *gin.Context) {
+			GetStudentAttendanceChanges(c, attendance)
 		})
 	}
 }
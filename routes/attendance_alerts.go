@@ -0,0 +1,178 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"server/middleware"
+	"server/models"
+	"server/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListAttendanceAlerts returns the alerts raised by the attendance alert rules
+//
+// Endpoint: GET /api/attendance/alerts
+//
+// Query Parameters:
+//   - status: "open" (default) for unacknowledged alerts, or "all"
+//   - student_id: only return one student's alerts
+//
+// Returns:
+//   - 200 OK: Alerts, newest first
+//     {
+//     "success": true,
+//     "alerts": [
+//     {
+//     "id": int,
+//     "student_id": int,
+//     "student_name": string,
+//     "rule": string,               // name of the configured rule, e.g. "unexplained-absences"
+//     "status": string,             // attendance status counted, e.g. "absent"
+//     "occurrences": int,
+//     "window_start": string,
+//     "window_end": string,
+//     "last_record_date": string,
+//     "teacher_notified": bool,
+//     "guardians_notified": int,    // number of guardians emailed
+//     "created_at": string,
+//     "acknowledged_by": int,       // null while open
+//     "acknowledged_at": string,    // null while open
+//     "acknowledgement_note": string
+//     }
+//     ]
+//     }
+//   - 400 Bad Request: Invalid status or student ID
+//   - 500 Internal Server Error: Database error
+func ListAttendanceAlerts(c *gin.Context, alerts store.AttendanceAlertStore) {
+	open := true
+	switch c.DefaultQuery("status", "open") {
+	case "open":
+	case "all":
+		open = false
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "status must be open or all",
+		})
+		return
+	}
+
+	studentID := 0
+	if param := c.Query("student_id"); param != "" {
+		id, err := strconv.Atoi(param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("Invalid student ID: %s", param),
+			})
+			return
+		}
+		studentID = id
+	}
+
+	list, err := alerts.List(open, studentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error querying attendance alerts: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"alerts":  list,
+	})
+}
+
+// AcknowledgeAttendanceAlert marks an alert as handled. The rule can raise a new
+// alert for the student once it is broken again by later records.
+//
+// Endpoint: POST /api/attendance/alerts/:id/acknowledge
+//
+// Request Body (optional):
+//
+//	{
+//	  "note": string   // e.g., "Spoke to parents, family emergency"
+//	}
+//
+// Returns:
+//   - 200 OK: { "success": true, "alert": { ... } }
+//   - 400 Bad Request: Invalid ID or request format
+//   - 404 Not Found: Alert not found
+//   - 409 Conflict: The alert was already acknowledged
+//   - 500 Internal Server Error: Database error
+func AcknowledgeAttendanceAlert(c *gin.Context, alerts store.AttendanceAlertStore) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Invalid alert ID: %s", c.Param("id")),
+		})
+		return
+	}
+
+	var request struct {
+		Note string `json:"note"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("Invalid request format: %v", err),
+			})
+			return
+		}
+	}
+
+	var note *string
+	if trimmed := strings.TrimSpace(request.Note); trimmed != "" {
+		note = &trimmed
+	}
+
+	user, _ := middleware.CurrentUser(c)
+	alert, err := alerts.Acknowledge(id, user.ID, note)
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "The attendance alert was not found",
+		})
+		return
+	case store.ErrConflict:
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "The attendance alert was already acknowledged",
+		})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error acknowledging attendance alert: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"alert":   alert,
+	})
+}
+
+// SetupAttendanceAlertRoutes sets up the attendance alert routes for staff
+func SetupAttendanceAlertRoutes(router gin.IRouter, alerts store.AttendanceAlertStore) {
+	staff := middleware.RequireRoles(models.RoleStaff, models.RoleAttendance, models.RoleAdmin)
+
+	router.GET("/attendance/alerts", staff, func(c *gin.Context) {
+		ListAttendanceAlerts(c, alerts)
+	})
+	router.POST("/attendance/alerts/:id/acknowledge", staff, func(c *gin.Context) {
+		AcknowledgeAttendanceAlert(c, alerts)
+	})
+}
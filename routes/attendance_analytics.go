@@ -0,0 +1,403 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"server/config"
+	"server/jobs"
+	"server/middleware"
+	"server/models"
+	"server/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultAnalyticsWeeks is the range analysed when no from date is given
+const defaultAnalyticsWeeks = 12
+
+// maxAnalyticsDays limits the range analysed at once
+const maxAnalyticsDays = 366
+
+// Every analytics endpoint accepts these query parameters:
+//   - from: First day in YYYY-MM-DD format, inclusive (defaults to 12 weeks before to)
+//   - to: Last day in YYYY-MM-DD format, inclusive (defaults to today), at most 366 days after from
+//   - year_group: Only this year group, e.g., "ib1-a" (optional)
+//   - student_id: Only this student (optional)
+//
+// The attendance rate is the share of recorded days (or lessons) a student attended,
+// counting Present, Late and Early; Absent and Medical are missed. Only records on
+// school days of the calendar count, and school_days is the number of school days in
+// the range. Counts are returned alongside as:
+//
+//	{
+//	  "present": int,
+//	  "absent": int,
+//	  "late": int,
+//	  "medical": int,
+//	  "early": int,
+//	  "total": int,
+//	  "attended": int,
+//	  "rate": float    // percentage, e.g., 95.5
+//	}
+
+// GetStudentAttendanceRates returns each student's attendance rate
+//
+// Endpoint: GET /api/attendance/analytics/students
+//
+// Returns:
+//   - 200 OK: { "success": true, "from": string, "to": string, "school_days": int,
+//     "students": [ { "user_id": int, "name": string, "year": string, "group_name": string, ...counts } ] }
+//   - 400 Bad Request: Invalid filter
+//   - 500 Internal Server Error: Database error
+func GetStudentAttendanceRates(c *gin.Context, analytics store.AttendanceAnalyticsStore, yearGroups store.YearGroupStore) {
+	filter, ok := parseAnalyticsFilter(c, yearGroups)
+	if !ok {
+		return
+	}
+
+	rates, err := analytics.StudentRates(filter)
+	if err != nil {
+		analyticsError(c, err)
+		return
+	}
+
+	students := make([]gin.H, 0, len(rates))
+	for _, rate := range rates {
+		students = append(students, studentRateJSON(rate))
+	}
+	analyticsResponse(c, filter, "students", students)
+}
+
+// GetSectionAttendanceRates returns the attendance rate of each year group section
+//
+// Endpoint: GET /api/attendance/analytics/year-groups
+//
+// Returns:
+//   - 200 OK: { "success": true, "from": string, "to": string, "school_days": int,
+//     "yearGroups": [ { "id": string, "name": string, "year": string, "section": string, "students": int, ...counts } ] }
+//   - 400 Bad Request: Invalid filter
+//   - 500 Internal Server Error: Database error
+func GetSectionAttendanceRates(c *gin.Context, analytics store.AttendanceAnalyticsStore, yearGroups store.YearGroupStore) {
+	filter, ok := parseAnalyticsFilter(c, yearGroups)
+	if !ok {
+		return
+	}
+
+	rates, err := analytics.SectionRates(filter)
+	if err != nil {
+		analyticsError(c, err)
+		return
+	}
+
+	sections := make([]gin.H, 0, len(rates))
+	for _, rate := range rates {
+		section := models.Section{Year: rate.Year, Name: rate.Section}
+		sections = append(sections, attendanceCountsJSON(rate.AttendanceCounts, gin.H{
+			"id":       section.Slug(),
+			"name":     section.FullName(),
+			"year":     rate.Year,
+			"section":  rate.Section,
+			"students": rate.Students,
+		}))
+	}
+	analyticsResponse(c, filter, "yearGroups", sections)
+}
+
+// GetSubjectAttendanceRates returns the lesson attendance rate of each teaching group
+//
+// Endpoint: GET /api/attendance/analytics/subjects
+//
+// Returns:
+//   - 200 OK: { "success": true, "from": string, "to": string, "school_days": int,
+//     "subjects": [ { "subject": string, "code": string, "teaching_group": string, "lessons": int, ...counts } ] }
+//   - 400 Bad Request: Invalid filter
+//   - 500 Internal Server Error: Database error
+func GetSubjectAttendanceRates(c *gin.Context, analytics store.AttendanceAnalyticsStore, yearGroups store.YearGroupStore) {
+	filter, ok := parseAnalyticsFilter(c, yearGroups)
+	if !ok {
+		return
+	}
+
+	rates, err := analytics.SubjectRates(filter)
+	if err != nil {
+		analyticsError(c, err)
+		return
+	}
+
+	subjects := make([]gin.H, 0, len(rates))
+	for _, rate := range rates {
+		subjects = append(subjects, attendanceCountsJSON(rate.AttendanceCounts, gin.H{
+			"subject":        rate.Subject,
+			"code":           rate.Code,
+			"teaching_group": rate.TeachingGroup,
+			"lessons":        rate.Lessons,
+		}))
+	}
+	analyticsResponse(c, filter, "subjects", subjects)
+}
+
+// GetAttendanceTrend returns the attendance rate week by week, with the change
+// from the previous week in percentage points
+//
+// Endpoint: GET /api/attendance/analytics/trends
+//
+// Returns:
+//   - 200 OK: { "success": true, "from": string, "to": string, "school_days": int,
+//     "weeks": [ { "week_start": string, "change": float, ...counts } ] } // change is null for the first week
+//   - 400 Bad Request: Invalid filter
+//   - 500 Internal Server Error: Database error
+func GetAttendanceTrend(c *gin.Context, analytics store.AttendanceAnalyticsStore, yearGroups store.YearGroupStore) {
+	filter, ok := parseAnalyticsFilter(c, yearGroups)
+	if !ok {
+		return
+	}
+
+	points, err := analytics.WeeklyTrend(filter)
+	if err != nil {
+		analyticsError(c, err)
+		return
+	}
+
+	weeks := make([]gin.H, 0, len(points))
+	for i, point := range points {
+		week := attendanceCountsJSON(point.AttendanceCounts, gin.H{
+			"week_start": point.WeekStart.Format("2006-01-02"),
+			"change":     nil,
+		})
+		if i > 0 {
+			week["change"] = roundRate(point.Rate() - points[i-1].Rate())
+		}
+		weeks = append(weeks, week)
+	}
+	analyticsResponse(c, filter, "weeks", weeks)
+}
+
+// GetAttendanceByWeekday returns the attendance rate on each day of the week
+//
+// Endpoint: GET /api/attendance/analytics/weekdays
+//
+// Returns:
+//   - 200 OK: { "success": true, "from": string, "to": string, "school_days": int,
+//     "weekdays": [ { "weekday": string, ...counts } ] } // "Monday" first
+//   - 400 Bad Request: Invalid filter
+//   - 500 Internal Server Error: Database error
+func GetAttendanceByWeekday(c *gin.Context, analytics store.AttendanceAnalyticsStore, yearGroups store.YearGroupStore) {
+	filter, ok := parseAnalyticsFilter(c, yearGroups)
+	if !ok {
+		return
+	}
+
+	days, err := analytics.Weekdays(filter)
+	if err != nil {
+		analyticsError(c, err)
+		return
+	}
+
+	weekdays := make([]gin.H, 0, len(days))
+	for _, day := range days {
+		weekdays = append(weekdays, attendanceCountsJSON(day.AttendanceCounts, gin.H{
+			"weekday": day.Weekday.String(),
+		}))
+	}
+	analyticsResponse(c, filter, "weekdays", weekdays)
+}
+
+// GetLowAttendanceStudents lists the students whose attendance rate is under a
+// threshold, lowest first. Students without records in the range are left out.
+//
+// Endpoint: GET /api/attendance/analytics/below-threshold
+//
+// Parameters:
+//   - threshold: Attendance rate in percent (query, defaults to the configured threshold, e.g., 90)
+//
+// Returns:
+//   - 200 OK: { "success": true, "from": string, "to": string, "school_days": int, "threshold": float,
+//     "students": [ { "user_id": int, "name": string, "year": string, "group_name": string, ...counts } ] }
+//   - 400 Bad Request: Invalid filter or threshold
+//   - 500 Internal Server Error: Database error
+func GetLowAttendanceStudents(c *gin.Context, analytics store.AttendanceAnalyticsStore, yearGroups store.YearGroupStore) {
+	threshold := config.Get().Attendance.LowAttendanceThreshold
+	if value := c.Query("threshold"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 || parsed > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("Invalid threshold '%s', expected a percentage above 0 and at most 100", value),
+			})
+			return
+		}
+		threshold = parsed
+	}
+
+	filter, ok := parseAnalyticsFilter(c, yearGroups)
+	if !ok {
+		return
+	}
+
+	rates, err := analytics.StudentRates(filter)
+	if err != nil {
+		analyticsError(c, err)
+		return
+	}
+
+	var below []models.StudentAttendanceRate
+	for _, rate := range rates {
+		if rate.Total() > 0 && rate.Rate() < threshold {
+			below = append(below, rate)
+		}
+	}
+	sort.SliceStable(below, func(i, j int) bool {
+		return below[i].Rate() < below[j].Rate()
+	})
+
+	students := make([]gin.H, 0, len(below))
+	for _, rate := range below {
+		students = append(students, studentRateJSON(rate))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"from":        filter.From.Format("2006-01-02"),
+		"to":          filter.To.Format("2006-01-02"),
+		"school_days": jobs.CountSchoolDays(filter.From, filter.To),
+		"threshold":   threshold,
+		"students":    students,
+	})
+}
+
+// parseAnalyticsFilter reads the common analytics filters from the query, responding
+// with 400 if any is invalid
+func parseAnalyticsFilter(c *gin.Context, yearGroups store.YearGroupStore) (models.AttendanceAnalyticsFilter, bool) {
+	var filter models.AttendanceAnalyticsFilter
+	fail := func(message string) (models.AttendanceAnalyticsFilter, bool) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": message,
+		})
+		return filter, false
+	}
+
+	now := time.Now()
+	filter.To = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if value := c.Query("to"); value != "" {
+		date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return fail(fmt.Sprintf("Invalid to date '%s', expected YYYY-MM-DD", value))
+		}
+		filter.To = date
+	}
+	filter.From = filter.To.AddDate(0, 0, -7*defaultAnalyticsWeeks+1)
+	if value := c.Query("from"); value != "" {
+		date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return fail(fmt.Sprintf("Invalid from date '%s', expected YYYY-MM-DD", value))
+		}
+		filter.From = date
+	}
+	if filter.To.Before(filter.From) || filter.To.After(filter.From.AddDate(0, 0, maxAnalyticsDays)) {
+		return fail(fmt.Sprintf("The to date must be between the from date and %d days after it", maxAnalyticsDays))
+	}
+
+	if slug := c.Query("year_group"); slug != "" {
+		section, err := yearGroups.GetSectionBySlug(slug)
+		if err == sql.ErrNoRows {
+			return fail(fmt.Sprintf("Invalid year group ID: %s", slug))
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("Error getting year group: %v", err),
+			})
+			return filter, false
+		}
+		filter.Year, filter.Section = section.Year, section.Name
+	}
+
+	if value := c.Query("student_id"); value != "" {
+		studentID, err := strconv.Atoi(value)
+		if err != nil || studentID <= 0 {
+			return fail(fmt.Sprintf("Invalid student ID format: %s", value))
+		}
+		filter.StudentID = studentID
+	}
+
+	return filter, true
+}
+
+// attendanceCountsJSON adds the counts and attendance rate to fields
+func attendanceCountsJSON(counts models.AttendanceCounts, fields gin.H) gin.H {
+	fields["present"] = counts.Present
+	fields["absent"] = counts.Absent
+	fields["late"] = counts.Late
+	fields["medical"] = counts.Medical
+	fields["early"] = counts.Early
+	fields["total"] = counts.Total()
+	fields["attended"] = counts.Attended()
+	fields["rate"] = roundRate(counts.Rate())
+	return fields
+}
+
+// studentRateJSON formats a student's attendance rate
+func studentRateJSON(rate models.StudentAttendanceRate) gin.H {
+	return attendanceCountsJSON(rate.AttendanceCounts, gin.H{
+		"user_id":    rate.StudentID,
+		"name":       rate.Name,
+		"year":       rate.Year,
+		"group_name": rate.GroupName,
+	})
+}
+
+// roundRate rounds a percentage to one decimal place
+func roundRate(rate float64) float64 {
+	return math.Round(rate*10) / 10
+}
+
+// analyticsResponse writes a successful analytics result under key
+func analyticsResponse(c *gin.Context, filter models.AttendanceAnalyticsFilter, key string, data []gin.H) {
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"from":        filter.From.Format("2006-01-02"),
+		"to":          filter.To.Format("2006-01-02"),
+		"school_days": jobs.CountSchoolDays(filter.From, filter.To),
+		key:           data,
+	})
+}
+
+// analyticsError responds with 500 for a failed analytics query
+func analyticsError(c *gin.Context, err error) {
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"success": false,
+		"message": fmt.Sprintf("Error querying attendance analytics: %v", err),
+	})
+}
+
+// SetupAttendanceAnalyticsRoutes sets up the attendance analytics routes
+func SetupAttendanceAnalyticsRoutes(router gin.IRouter, analytics store.AttendanceAnalyticsStore, yearGroups store.YearGroupStore) {
+	analyticsGroup := router.Group("/attendance/analytics", middleware.RequireRoles(models.RoleStaff, models.RoleAttendance, models.RoleAdmin))
+	{
+		analyticsGroup.GET("/students", func(c *gin.Context) {
+			GetStudentAttendanceRates(c, analytics, yearGroups)
+		})
+		analyticsGroup.GET("/year-groups", func(c *gin.Context) {
+			GetSectionAttendanceRates(c, analytics, yearGroups)
+		})
+		analyticsGroup.GET("/subjects", func(c *gin.Context) {
+			GetSubjectAttendanceRates(c, analytics, yearGroups)
+		})
+		analyticsGroup.GET("/trends", func(c *gin.Context) {
+			GetAttendanceTrend(c, analytics, yearGroups)
+		})
+		analyticsGroup.GET("/weekdays", func(c *gin.Context) {
+			GetAttendanceByWeekday(c, analytics, yearGroups)
+		})
+		analyticsGroup.GET("/below-threshold", func(c *gin.Context) {
+			GetLowAttendanceStudents(c, analytics, yearGroups)
+		})
+	}
+}
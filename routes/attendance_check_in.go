@@ -0,0 +1,198 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/config"
+	"server/jobs"
+	"server/middleware"
+	"server/models"
+	"server/store"
+	"server/utils"
+
+	"github.com/gin-gonic/gin"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// GetCheckInCode issues the rotating check-in code shown at reception. The display
+// should fetch a new code before the current one expires.
+//
+// Endpoint: GET /api/attendance/check-in/code
+//
+// Parameters:
+//   - format: "json" (default) or "png" for a QR code image (query)
+//   - size: Width of the PNG in pixels, 128 to 1024 (query, defaults to 512)
+//
+// Returns:
+//   - 200 OK: The code, as JSON or as a PNG with an X-Check-In-Expires-At header
+//     {
+//     "success": true,
+//     "code": string,
+//     "expires_at": string,  // RFC 3339 timestamp
+//     "refresh_in": int      // seconds until the display should fetch a new code
+//     }
+//   - 400 Bad Request: Invalid format or size
+//   - 500 Internal Server Error: Failed to generate the code
+func GetCheckInCode(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "png" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Invalid format '%s', expected json or png", format),
+		})
+		return
+	}
+
+	code, expiresAt, err := utils.GenerateCheckInCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error generating check-in code: %v", err),
+		})
+		return
+	}
+
+	// Codes must never be served from a cache once they have expired
+	c.Header("Cache-Control", "no-store")
+
+	if format == "json" {
+		// Leave a margin so the displayed code is never about to expire when scanned
+		refreshIn := int(time.Until(expiresAt).Seconds() / 2)
+		if refreshIn < 1 {
+			refreshIn = 1
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success":    true,
+			"code":       code,
+			"expires_at": expiresAt.Format(time.RFC3339),
+			"refresh_in": refreshIn,
+		})
+		return
+	}
+
+	size, err := strconv.Atoi(c.DefaultQuery("size", "512"))
+	if err != nil || size < 128 || size > 1024 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Invalid size '%s', expected 128 to 1024", c.Query("size")),
+		})
+		return
+	}
+
+	image, err := qrcode.Encode(code, qrcode.Medium, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error rendering check-in code: %v", err),
+		})
+		return
+	}
+	c.Header("X-Check-In-Expires-At", expiresAt.Format(time.RFC3339))
+	c.Data(http.StatusOK, "image/png", image)
+}
+
+// CheckIn records the arrival of the calling student from a scanned reception code.
+// Arrivals after the configured cutoff are marked Late, earlier ones Present.
+//
+// Endpoint: POST /api/attendance/check-in
+//
+// Request Body:
+//
+//	{
+//	  "code": string   // as scanned from the reception QR code
+//	}
+//
+// Returns:
+//   - 200 OK: Arrival recorded, or the earlier arrival if already checked in today
+//     {
+//     "success": true,
+//     "status": string,            // "Present" or "Late", or the status of approved leave
+//     "arrived_at": string,        // HH:MM:SS format
+//     "already_checked_in": bool
+//     }
+//   - 400 Bad Request: Missing, invalid or expired code, or no school today
+//   - 404 Not Found: The student has no attendance record
+//   - 500 Internal Server Error: Database error
+func CheckIn(c *gin.Context, attendance store.AttendanceStore, alerts *jobs.AttendanceAlerts) {
+	var request struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Invalid request format: %v", err),
+		})
+		return
+	}
+
+	if err := utils.VerifyCheckInCode(request.Code); err != nil {
+		message := "Invalid check-in code"
+		if err == utils.ErrExpiredCheckInCode {
+			message = "Check-in code has expired, please scan the current code"
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": message,
+		})
+		return
+	}
+
+	now := time.Now()
+	if !jobs.IsSchoolDay(now) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "There is no school today",
+		})
+		return
+	}
+
+	status := models.AttendancePresent
+	if now.After(config.Get().Attendance.LateAt(now)) {
+		status = models.AttendanceLate
+	}
+
+	user, _ := middleware.CurrentUser(c)
+	record, checkedIn, err := attendance.CheckIn(user.ID, now, status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("No attendance record found for student ID: %d", user.ID),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error recording check-in: %v", err),
+		})
+		return
+	}
+
+	if checkedIn {
+		alerts.Evaluate(now, user.ID)
+	}
+
+	arrivedAt := now.Format("15:04:05")
+	if record.ArrivedAt != nil {
+		arrivedAt = record.ArrivedAt.Format("15:04:05")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":            true,
+		"status":             statusLabel(record.Status),
+		"arrived_at":         arrivedAt,
+		"already_checked_in": !checkedIn,
+	})
+}
+
+// SetupAttendanceCheckInRoutes sets up the reception check-in routes
+func SetupAttendanceCheckInRoutes(router gin.IRouter, attendance store.AttendanceStore, alerts *jobs.AttendanceAlerts) {
+	router.GET("/attendance/check-in/code", middleware.RequireRoles(models.RoleStaff, models.RoleAttendance, models.RoleAdmin), GetCheckInCode)
+	router.POST("/attendance/check-in", middleware.RequireRoles(models.RoleStudent), func(c *gin.Context) {
+		CheckIn(c, attendance, alerts)
+	})
+}
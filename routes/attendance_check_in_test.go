@@ -0,0 +1,135 @@
+package routes
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"server/jobs"
+	"server/models"
+	"server/store"
+	"server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeCheckInStore records each student's first check-in of the day
+type fakeCheckInStore struct {
+	store.AttendanceStore
+
+	mu      sync.Mutex
+	records map[int]models.AttendanceHistoryRecord
+}
+
+func (s *fakeCheckInStore) CheckIn(studentID int, at time.Time, status string) (*models.AttendanceHistoryRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record, ok := s.records[studentID]; ok {
+		return &record, false, nil
+	}
+	record := models.AttendanceHistoryRecord{StudentID: studentID, Status: status, ArrivedAt: &at}
+	s.records[studentID] = record
+	return &record, true, nil
+}
+
+// fakeAlertStore never finds anything to alert about
+type fakeAlertStore struct {
+	store.AttendanceAlertStore
+}
+
+func (fakeAlertStore) CountOccurrences(studentID int, rule string, status string, unexplained bool, from time.Time, to time.Time) (int, *time.Time, error) {
+	return 0, nil, nil
+}
+
+const checkInStudentID = 7
+
+func newCheckInTestAPI(t *testing.T) (*testAPI, *fakeCheckInStore) {
+	api := newTestAPI(t, models.User{ID: checkInStudentID, Username: "student", Name: "Student", Role: models.RoleStudent})
+	attendance := &fakeCheckInStore{records: make(map[int]models.AttendanceHistoryRecord)}
+	alerts := jobs.NewAttendanceAlerts(fakeAlertStore{}, nil, api.users, nil)
+	SetupAttendanceCheckInRoutes(api.group, attendance, alerts)
+	return api, attendance
+}
+
+func TestCheckInRejectsBadCodes(t *testing.T) {
+	api, attendance := newCheckInTestAPI(t)
+
+	code, _, err := utils.GenerateCheckInCode()
+	if err != nil {
+		t.Fatalf("generating a code: %v", err)
+	}
+
+	for _, bad := range []string{"not-a-code", code[:len(code)-1], code + "x"} {
+		var response struct {
+			Message string `json:"message"`
+		}
+		if status := api.do(checkInStudentID, http.MethodPost, "/api/attendance/check-in", gin.H{"code": bad}, &response); status != http.StatusBadRequest {
+			t.Fatalf("code %q: got %d, want 400", bad, status)
+		}
+		if response.Message != "Invalid check-in code" {
+			t.Fatalf("code %q: got message %q", bad, response.Message)
+		}
+	}
+	if status := api.do(checkInStudentID, http.MethodPost, "/api/attendance/check-in", gin.H{}, nil); status != http.StatusBadRequest {
+		t.Fatalf("missing code: got %d, want 400", status)
+	}
+	if len(attendance.records) != 0 {
+		t.Fatalf("a check-in was recorded for a bad code")
+	}
+}
+
+func TestCheckInRecordsArrivalOnce(t *testing.T) {
+	if !jobs.IsSchoolDay(time.Now()) {
+		t.Skip("check-ins are refused when there is no school today")
+	}
+	api, attendance := newCheckInTestAPI(t)
+
+	code, _, err := utils.GenerateCheckInCode()
+	if err != nil {
+		t.Fatalf("generating a code: %v", err)
+	}
+
+	type checkInResponse struct {
+		Status           string `json:"status"`
+		AlreadyCheckedIn bool   `json:"already_checked_in"`
+	}
+	var first, second checkInResponse
+	if status := api.do(checkInStudentID, http.MethodPost, "/api/attendance/check-in", gin.H{"code": code}, &first); status != http.StatusOK {
+		t.Fatalf("check-in: got %d, want 200", status)
+	}
+	if first.AlreadyCheckedIn || (first.Status != "Present" && first.Status != "Late") {
+		t.Fatalf("check-in: got %+v", first)
+	}
+	if status := api.do(checkInStudentID, http.MethodPost, "/api/attendance/check-in", gin.H{"code": code}, &second); status != http.StatusOK {
+		t.Fatalf("second check-in: got %d, want 200", status)
+	}
+	if !second.AlreadyCheckedIn || second.Status != first.Status {
+		t.Fatalf("second check-in: got %+v, want the first arrival", second)
+	}
+	if len(attendance.records) != 1 {
+		t.Fatalf("got %d check-ins recorded, want 1", len(attendance.records))
+	}
+}
+
+func TestCheckInRequiresAStudent(t *testing.T) {
+	api, _ := newCheckInTestAPI(t)
+	api.users.users[20] = models.User{ID: 20, Username: "teacher", Role: models.RoleStaff}
+	tokens, err := issueSessionTokens(api.sessions, 20, "")
+	if err != nil {
+		t.Fatalf("issuing tokens: %v", err)
+	}
+	api.tokens[20] = tokens["access_token"].(string)
+
+	code, _, err := utils.GenerateCheckInCode()
+	if err != nil {
+		t.Fatalf("generating a code: %v", err)
+	}
+	if status := api.do(20, http.MethodPost, "/api/attendance/check-in", gin.H{"code": code}, nil); status != http.StatusForbidden {
+		t.Fatalf("staff checking in: got %d, want 403", status)
+	}
+	if status := api.do(checkInStudentID, http.MethodGet, "/api/attendance/check-in/code", nil, nil); status != http.StatusForbidden {
+		t.Fatalf("student fetching the reception code: got %d, want 403", status)
+	}
+}
@@ -0,0 +1,323 @@
+package routes
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/middleware"
+	"server/models"
+	"server/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+// attendanceExportHeader names the columns of an attendance export
+var attendanceExportHeader = []string{
+	"Date", "Student ID", "Name", "Year", "Section", "Status", "Arrived At",
+	"Present", "Absent", "Late", "Medical", "Early", "Total", "Attendance %",
+}
+
+// attendanceExportFlushEvery is how many CSV rows are buffered before flushing to the client
+const attendanceExportFlushEvery = 200
+
+// ExportAttendance downloads daily attendance records as CSV or XLSX, one row per
+// student per day. Each row also carries the student's totals over the exported range.
+//
+// Endpoint: GET /api/attendance/export
+//
+// Parameters:
+//   - format: "csv" (default) or "xlsx" (query)
+//   - year_group: Only this year group, e.g., "ib1-a" (query, optional)
+//   - student_id: Only this student (query, optional)
+//   - from: First day in YYYY-MM-DD format, inclusive (query, optional)
+//   - to: Last day in YYYY-MM-DD format, inclusive (query, optional)
+//
+// Returns:
+//   - 200 OK: The file as an attachment with the columns
+//     Date, Student ID, Name, Year, Section, Status, Arrived At,
+//     Present, Absent, Late, Medical, Early, Total, Attendance %
+//   - 400 Bad Request: Invalid format, year group, student ID or dates
+//   - 500 Internal Server Error: Database error
+func ExportAttendance(c *gin.Context, attendance store.AttendanceStore, yearGroups store.YearGroupStore) {
+	format := strings.ToLower(c.DefaultQuery("format", "csv"))
+	if format != "csv" && format != "xlsx" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Invalid format '%s', expected csv or xlsx", format),
+		})
+		return
+	}
+
+	filter, scope, ok := parseAttendanceExportFilter(c, yearGroups)
+	if !ok {
+		return
+	}
+
+	filename := fmt.Sprintf("attendance-%s.%s", scope, format)
+	if format == "xlsx" {
+		exportAttendanceXLSX(c, attendance, filter, filename)
+	} else {
+		exportAttendanceCSV(c, attendance, filter, filename)
+	}
+}
+
+// parseAttendanceExportFilter reads the export filters from the query, responding
+// with 400 if any is invalid. scope describes the selection for the file name.
+func parseAttendanceExportFilter(c *gin.Context, yearGroups store.YearGroupStore) (models.AttendanceExportFilter, string, bool) {
+	var filter models.AttendanceExportFilter
+	scope := []string{}
+	fail := func(message string) (models.AttendanceExportFilter, string, bool) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": message,
+		})
+		return filter, "", false
+	}
+
+	if slug := c.Query("year_group"); slug != "" {
+		section, err := yearGroups.GetSectionBySlug(slug)
+		if err == sql.ErrNoRows {
+			return fail(fmt.Sprintf("Invalid year group ID: %s", slug))
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("Error getting year group: %v", err),
+			})
+			return filter, "", false
+		}
+		filter.Year, filter.Section = section.Year, section.Name
+		scope = append(scope, section.Slug())
+	}
+
+	if value := c.Query("student_id"); value != "" {
+		studentID, err := strconv.Atoi(value)
+		if err != nil || studentID <= 0 {
+			return fail(fmt.Sprintf("Invalid student ID format: %s", value))
+		}
+		filter.StudentID = studentID
+		scope = append(scope, "student-"+value)
+	}
+
+	for _, bound := range []struct {
+		name  string
+		field **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := c.Query(bound.name)
+		if value == "" {
+			continue
+		}
+		date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return fail(fmt.Sprintf("Invalid %s date '%s', expected YYYY-MM-DD", bound.name, value))
+		}
+		*bound.field = &date
+		scope = append(scope, value)
+	}
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		return fail("The to date must not be before the from date")
+	}
+
+	if len(scope) == 0 {
+		scope = append(scope, "all")
+	}
+	return filter, strings.Join(scope, "-"), true
+}
+
+// attendanceExportRecord formats a row in the order of attendanceExportHeader
+func attendanceExportRecord(row models.AttendanceExportRow) []string {
+	arrivedAt := ""
+	if row.ArrivedAt != nil {
+		arrivedAt = row.ArrivedAt.Format("15:04:05")
+	}
+
+	counts := row.Counts()
+	total := counts.Total()
+	percentage := counts.Rate()
+
+	return []string{
+		row.Date.Format("2006-01-02"),
+		strconv.Itoa(row.StudentID),
+		row.Name,
+		row.Year,
+		row.GroupName,
+		statusLabel(row.Status),
+		arrivedAt,
+		strconv.Itoa(row.Present),
+		strconv.Itoa(row.Absent),
+		strconv.Itoa(row.Late),
+		strconv.Itoa(row.Medical),
+		strconv.Itoa(row.Early),
+		strconv.Itoa(total),
+		fmt.Sprintf("%.1f", percentage),
+	}
+}
+
+// csvCell keeps a CSV cell from being run as a formula when the file is opened in a
+// spreadsheet, by prefixing values that start with a formula character with '
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// csvRecord applies csvCell to every cell of a record
+func csvRecord(record []string) []string {
+	for i, value := range record {
+		record[i] = csvCell(value)
+	}
+	return record
+}
+
+// statusLabel capitalises a stored lowercase status, e.g., "present" to "Present"
+func statusLabel(status string) string {
+	if status == "" {
+		return status
+	}
+	return strings.ToUpper(status[:1]) + status[1:]
+}
+
+// exportAttendanceCSV streams the export to the client as rows are read from the database
+func exportAttendanceCSV(c *gin.Context, attendance store.AttendanceStore, filter models.AttendanceExportFilter, filename string) {
+	writer := csv.NewWriter(c.Writer)
+	started := false
+	start := func() error {
+		started = true
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		c.Status(http.StatusOK)
+		return writer.Write(attendanceExportHeader)
+	}
+
+	count := 0
+	err := attendance.ExportRecords(filter, func(row models.AttendanceExportRow) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := writer.Write(csvRecord(attendanceExportRecord(row))); err != nil {
+			return err
+		}
+
+		count++
+		if count%attendanceExportFlushEvery == 0 {
+			writer.Flush()
+			c.Writer.Flush()
+			return writer.Error()
+		}
+		return nil
+	})
+
+	if err != nil && !started {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error exporting attendance: %v", err),
+		})
+		return
+	}
+	if err != nil {
+		// The response has already started; all we can do is stop and log
+		log.Printf("Attendance export failed after %d rows: %v", count, err)
+		c.Abort()
+		return
+	}
+
+	if !started {
+		if err := start(); err != nil {
+			log.Printf("Error writing attendance export: %v", err)
+			return
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("Error writing attendance export: %v", err)
+	}
+}
+
+// exportAttendanceXLSX writes the export as a workbook. Rows go through excelize's
+// stream writer, which spills to a temporary file instead of holding the sheet in memory.
+func exportAttendanceXLSX(c *gin.Context, attendance store.AttendanceStore, filter models.AttendanceExportFilter, filename string) {
+	fail := func(err error) {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error exporting attendance: %v", err),
+		})
+	}
+
+	workbook := excelize.NewFile()
+	defer workbook.Close()
+
+	const sheet = "Attendance"
+	if err := workbook.SetSheetName("Sheet1", sheet); err != nil {
+		fail(err)
+		return
+	}
+	stream, err := workbook.NewStreamWriter(sheet)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	header := make([]interface{}, len(attendanceExportHeader))
+	for i, name := range attendanceExportHeader {
+		header[i] = name
+	}
+	if err := stream.SetRow("A1", header); err != nil {
+		fail(err)
+		return
+	}
+
+	rowNumber := 1
+	err = attendance.ExportRecords(filter, func(row models.AttendanceExportRow) error {
+		rowNumber++
+		cell, err := excelize.CoordinatesToCellName(1, rowNumber)
+		if err != nil {
+			return err
+		}
+
+		record := attendanceExportRecord(row)
+		values := make([]interface{}, len(record))
+		for i, value := range record {
+			values[i] = value
+		}
+		// Keep the ID and totals numeric so they can be summed in a spreadsheet
+		values[1] = row.StudentID
+		for i := 7; i < len(record); i++ {
+			if number, err := strconv.ParseFloat(record[i], 64); err == nil {
+				values[i] = number
+			}
+		}
+		return stream.SetRow(cell, values)
+	})
+	if err != nil {
+		fail(err)
+		return
+	}
+	if err := stream.Flush(); err != nil {
+		fail(err)
+		return
+	}
+
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+	if err := workbook.Write(c.Writer); err != nil {
+		log.Printf("Error writing attendance export: %v", err)
+	}
+}
+
+// SetupAttendanceExportRoutes sets up the attendance export route
+func SetupAttendanceExportRoutes(router gin.IRouter, attendance store.AttendanceStore, yearGroups store.YearGroupStore) {
+	router.GET("/attendance/export", middleware.RequireRoles(models.RoleStaff, models.RoleAttendance, models.RoleAdmin), func(c *gin.Context) {
+		ExportAttendance(c, attendance, yearGroups)
+	})
+}
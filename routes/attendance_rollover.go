@@ -0,0 +1,147 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"server/config"
+	"server/jobs"
+	"server/middleware"
+	"server/models"
+	"server/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAttendanceRollovers returns the reports of the most recent daily rollovers
+//
+// Endpoint: GET /api/attendance/rollovers
+//
+// Parameters:
+//   - limit: Maximum number of reports (query, default 30, at most 365)
+//
+// Returns:
+//   - 200 OK: Successfully retrieved rollover reports
+//     {
+//     "success": true,
+//     "rollovers": [
+//     {
+//     "id": int,
+//     "date": string,          // YYYY-MM-DD format
+//     "status": string,        // "completed" or "skipped"
+//     "reason": string,        // when skipped, e.g., "weekend", "holiday" or "missed"
+//     "recorded_count": int,   // records written from the day's register
+//     "reset_count": int,      // registers reset to Pending
+//     "triggered_by": int,     // admin user ID, null for the scheduler
+//     "created_at": string     // timestamp
+//     }
+//     ]
+//     }
+//   - 400 Bad Request: Invalid limit
+//   - 500 Internal Server Error: Database error
+func GetAttendanceRollovers(c *gin.Context, attendance store.AttendanceStore) {
+	limit := 30
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 365 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("Invalid limit: %s", value),
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	reports, err := attendance.ListRollovers(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error querying rollovers: %v", err),
+		})
+		return
+	}
+
+	rollovers := make([]gin.H, 0, len(reports))
+	for _, report := range reports {
+		rollovers = append(rollovers, rolloverJSON(report))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"rollovers": rollovers,
+	})
+}
+
+// RunAttendanceRollover rolls over today's register without waiting for the scheduler,
+// e.g. after a failed scheduled run. It is refused before attendance.rollover_time,
+// since the register would be reset while the day's marks are still being taken.
+// Running it again on the same day changes nothing.
+//
+// Endpoint: POST /api/attendance/rollovers
+//
+// Returns:
+//   - 200 OK: Today's rollover report
+//     {
+//     "success": true,
+//     "already_run": bool, // true if today had already been rolled over
+//     "rollover": { ... }  // as returned by GET /api/attendance/rollovers
+//     }
+//   - 409 Conflict: Today's cutoff has not passed yet
+//   - 500 Internal Server Error: Database error
+func RunAttendanceRollover(c *gin.Context, rollover *jobs.AttendanceRollover) {
+	user, _ := middleware.CurrentUser(c)
+
+	now := time.Now()
+	if now.Before(config.Get().Attendance.RolloverAt(now)) {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Today's register cannot be rolled over before %s", config.Get().Attendance.RolloverTime),
+		})
+		return
+	}
+
+	report, ran, err := rollover.Run(now, &user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error rolling over attendance: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"already_run": !ran,
+		"rollover":    rolloverJSON(*report),
+	})
+}
+
+// rolloverJSON formats a rollover report for the API
+func rolloverJSON(report models.AttendanceRollover) gin.H {
+	return gin.H{
+		"id":             report.ID,
+		"date":           report.Date.Format("2006-01-02"),
+		"status":         report.Status,
+		"reason":         report.Reason,
+		"recorded_count": report.RecordedCount,
+		"reset_count":    report.ResetCount,
+		"triggered_by":   report.TriggeredBy,
+		"created_at":     report.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// SetupAttendanceRolloverRoutes sets up the admin routes for the daily attendance rollover
+func SetupAttendanceRolloverRoutes(router gin.IRouter, rollover *jobs.AttendanceRollover, attendance store.AttendanceStore) {
+	rolloverGroup := router.Group("/attendance/rollovers", middleware.RequireRoles(models.RoleAdmin))
+	{
+		rolloverGroup.GET("", func(c *gin.Context) {
+			GetAttendanceRollovers(c, attendance)
+		})
+		rolloverGroup.POST("", func(c *gin.Context) {
+			RunAttendanceRollover(c, rollover)
+		})
+	}
+}
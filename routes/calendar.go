@@ -0,0 +1,624 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"server/jobs"
+	"server/middleware"
+	"server/models"
+	"server/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxCalendarDays limits how many days GET /api/calendar returns at once
+const maxCalendarDays = 366
+
+// calendarPeriodRequest is the body for creating or updating an academic year, term or closure
+type calendarPeriodRequest struct {
+	Name      string `json:"name"`
+	StartDate string `json:"start_date"` // YYYY-MM-DD
+	EndDate   string `json:"end_date"`   // YYYY-MM-DD, on or after start_date
+}
+
+// GetCalendar returns the school calendar day by day with the events on each day
+//
+// Endpoint: GET /api/calendar
+//
+// Query Parameters:
+//   - from: first day, YYYY-MM-DD format, defaults to today
+//   - to: last day, YYYY-MM-DD format, defaults to 30 days after from; at most a year after from
+//
+// Returns:
+//   - 200 OK:
+//     {
+//     "success": true,
+//     "from": string,
+//     "to": string,
+//     "school_days": int,     // number of school days in the range
+//     "days": [
+//     {
+//     "date": string,
+//     "school_day": bool,
+//     "reason": string,     // when there is no school: "weekend", "holiday", "closure" or "outside term"
+//     "term": string,       // name of the term, if any
+//     "closure": string,    // name of the closure, if any
+//     "events": [ ... ]     // as returned by GET /api/events, without images
+//     }
+//     ]
+//     }
+//   - 400 Bad Request: Invalid dates or range
+//   - 500 Internal Server Error: Database error
+func GetCalendar(c *gin.Context, schoolCalendar *jobs.SchoolCalendar, events store.EventStore) {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if value := c.Query("from"); value != "" {
+		date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("Invalid from date '%s', expected YYYY-MM-DD", value),
+			})
+			return
+		}
+		from = date
+	}
+	to := from.AddDate(0, 0, 30)
+	if value := c.Query("to"); value != "" {
+		date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("Invalid to date '%s', expected YYYY-MM-DD", value),
+			})
+			return
+		}
+		to = date
+	}
+	if to.Before(from) || to.After(from.AddDate(0, 0, maxCalendarDays)) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("The to date must be between the from date and %d days after it", maxCalendarDays),
+		})
+		return
+	}
+
+	// Overlay the events the caller can see
+	allEvents, err := events.List(audienceStudentID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error querying events: %v", err),
+		})
+		return
+	}
+	eventsByDate := make(map[string][]models.Event)
+	for _, event := range allEvents {
+		date := event.EventDate.Format("2006-01-02")
+		event.Images = []models.ImageModel{}
+		eventsByDate[date] = append(eventsByDate[date], event)
+	}
+
+	days := []models.CalendarDay{}
+	schoolDays := 0
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		calendarDay := schoolCalendar.Day(day)
+		if dayEvents, ok := eventsByDate[calendarDay.Date]; ok {
+			calendarDay.Events = dayEvents
+		}
+		if calendarDay.SchoolDay {
+			schoolDays++
+		}
+		days = append(days, calendarDay)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"from":        from.Format("2006-01-02"),
+		"to":          to.Format("2006-01-02"),
+		"school_days": schoolDays,
+		"days":        days,
+	})
+}
+
+// ListAcademicYears returns every academic year with its terms
+//
+// Endpoint: GET /api/calendar/academic-years
+//
+// Returns:
+//   - 200 OK:
+//     {
+//     "success": true,
+//     "academicYears": [
+//     {
+//     "id": int,
+//     "name": string,        // e.g., "2025-2026"
+//     "start_date": string,  // YYYY-MM-DD
+//     "end_date": string,
+//     "terms": [
+//     {
+//     "id": int,
+//     "academic_year_id": int,
+//     "name": string,      // e.g., "Autumn"
+//     "start_date": string,
+//     "end_date": string
+//     }
+//     ]
+//     }
+//     ]
+//     }
+//   - 500 Internal Server Error: Database error
+func ListAcademicYears(c *gin.Context, calendar store.CalendarStore) {
+	years, err := calendar.ListYears()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error querying academic years: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"academicYears": years,
+	})
+}
+
+// CreateAcademicYear adds an academic year
+//
+// Endpoint: POST /api/calendar/academic-years
+//
+// Request Body:
+//
+//	{
+//	  "name": string,        // e.g., "2025-2026"
+//	  "start_date": string,  // YYYY-MM-DD
+//	  "end_date": string     // YYYY-MM-DD
+//	}
+//
+// Returns:
+//   - 201 Created: { "success": true, "academicYear": { ... } }
+//   - 400 Bad Request: Invalid request, missing name or invalid dates
+//   - 409 Conflict: An academic year with this name already exists
+//   - 500 Internal Server Error: Database error
+func CreateAcademicYear(c *gin.Context, calendar store.CalendarStore) {
+	var request calendarPeriodRequest
+	if !bindCalendarPeriod(c, &request, "Academic year") {
+		return
+	}
+
+	year := models.AcademicYear{Name: request.Name, StartDate: request.StartDate, EndDate: request.EndDate}
+	if err := calendar.CreateYear(&year); err != nil {
+		respondCalendarError(c, err, "academic year")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":      true,
+		"academicYear": year,
+	})
+}
+
+// UpdateAcademicYear renames or moves an academic year
+//
+// Endpoint: PUT /api/calendar/academic-years/:id
+//
+// Request Body: as for POST /api/calendar/academic-years
+//
+// Returns:
+//   - 200 OK: { "success": true, "academicYear": { ... } }
+//   - 400 Bad Request: Invalid ID, request, dates, or its terms would fall outside the new dates
+//   - 404 Not Found: Academic year not found
+//   - 409 Conflict: An academic year with this name already exists
+//   - 500 Internal Server Error: Database error
+func UpdateAcademicYear(c *gin.Context, calendar store.CalendarStore, schoolCalendar *jobs.SchoolCalendar) {
+	id, ok := parseYearGroupParam(c, "academic year ID")
+	if !ok {
+		return
+	}
+
+	var request calendarPeriodRequest
+	if !bindCalendarPeriod(c, &request, "Academic year") {
+		return
+	}
+
+	year := models.AcademicYear{ID: id, Name: request.Name, StartDate: request.StartDate, EndDate: request.EndDate}
+	if err := calendar.UpdateYear(&year); err != nil {
+		respondCalendarError(c, err, "academic year")
+		return
+	}
+
+	updated, err := calendar.GetYear(id)
+	if err != nil {
+		respondCalendarError(c, err, "academic year")
+		return
+	}
+	reloadSchoolCalendar(schoolCalendar)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"academicYear": updated,
+	})
+}
+
+// DeleteAcademicYear deletes an academic year and its terms
+//
+// Endpoint: DELETE /api/calendar/academic-years/:id
+//
+// Returns:
+//   - 200 OK: { "success": true, "message": "Academic year deleted successfully" }
+//   - 400 Bad Request: Invalid ID
+//   - 404 Not Found: Academic year not found
+//   - 500 Internal Server Error: Database error
+func DeleteAcademicYear(c *gin.Context, calendar store.CalendarStore, schoolCalendar *jobs.SchoolCalendar) {
+	id, ok := parseYearGroupParam(c, "academic year ID")
+	if !ok {
+		return
+	}
+
+	if err := calendar.DeleteYear(id); err != nil {
+		respondCalendarError(c, err, "academic year")
+		return
+	}
+	reloadSchoolCalendar(schoolCalendar)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Academic year deleted successfully",
+	})
+}
+
+// CreateTerm adds a term to an academic year. Once any term exists, only days
+// inside a term are school days.
+//
+// Endpoint: POST /api/calendar/academic-years/:id/terms
+//
+// Request Body:
+//
+//	{
+//	  "name": string,        // e.g., "Autumn"
+//	  "start_date": string,  // YYYY-MM-DD, within the academic year
+//	  "end_date": string     // YYYY-MM-DD, within the academic year
+//	}
+//
+// Returns:
+//   - 201 Created: { "success": true, "term": { ... } }
+//   - 400 Bad Request: Invalid request, missing name, or dates outside the academic year
+//   - 404 Not Found: Academic year not found
+//   - 409 Conflict: The academic year already has a term with this name
+//   - 500 Internal Server Error: Database error
+func CreateTerm(c *gin.Context, calendar store.CalendarStore, schoolCalendar *jobs.SchoolCalendar) {
+	yearID, ok := parseYearGroupParam(c, "academic year ID")
+	if !ok {
+		return
+	}
+
+	var request calendarPeriodRequest
+	if !bindCalendarPeriod(c, &request, "Term") {
+		return
+	}
+
+	term := models.Term{AcademicYearID: yearID, Name: request.Name, StartDate: request.StartDate, EndDate: request.EndDate}
+	if err := calendar.CreateTerm(&term); err != nil {
+		if err == store.ErrInvalidReference {
+			err = sql.ErrNoRows
+		}
+		respondCalendarError(c, err, "academic year")
+		return
+	}
+	reloadSchoolCalendar(schoolCalendar)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"term":    term,
+	})
+}
+
+// UpdateTerm renames or moves a term within its academic year
+//
+// Endpoint: PUT /api/calendar/terms/:id
+//
+// Request Body: as for POST /api/calendar/academic-years/:id/terms
+//
+// Returns:
+//   - 200 OK: { "success": true, "term": { ... } }
+//   - 400 Bad Request: Invalid ID, request, or dates outside the academic year
+//   - 404 Not Found: Term not found
+//   - 409 Conflict: The academic year already has a term with this name
+//   - 500 Internal Server Error: Database error
+func UpdateTerm(c *gin.Context, calendar store.CalendarStore, schoolCalendar *jobs.SchoolCalendar) {
+	id, ok := parseYearGroupParam(c, "term ID")
+	if !ok {
+		return
+	}
+
+	var request calendarPeriodRequest
+	if !bindCalendarPeriod(c, &request, "Term") {
+		return
+	}
+
+	term := models.Term{ID: id, Name: request.Name, StartDate: request.StartDate, EndDate: request.EndDate}
+	if err := calendar.UpdateTerm(&term); err != nil {
+		respondCalendarError(c, err, "term")
+		return
+	}
+	reloadSchoolCalendar(schoolCalendar)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"term":    term,
+	})
+}
+
+// DeleteTerm deletes a term
+//
+// Endpoint: DELETE /api/calendar/terms/:id
+//
+// Returns:
+//   - 200 OK: { "success": true, "message": "Term deleted successfully" }
+//   - 400 Bad Request: Invalid ID
+//   - 404 Not Found: Term not found
+//   - 500 Internal Server Error: Database error
+func DeleteTerm(c *gin.Context, calendar store.CalendarStore, schoolCalendar *jobs.SchoolCalendar) {
+	id, ok := parseYearGroupParam(c, "term ID")
+	if !ok {
+		return
+	}
+
+	if err := calendar.DeleteTerm(id); err != nil {
+		respondCalendarError(c, err, "term")
+		return
+	}
+	reloadSchoolCalendar(schoolCalendar)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Term deleted successfully",
+	})
+}
+
+// ListClosures returns every closure of the school calendar
+//
+// Endpoint: GET /api/calendar/closures
+//
+// Returns:
+//   - 200 OK:
+//     {
+//     "success": true,
+//     "closures": [
+//     {
+//     "id": int,
+//     "name": string,        // e.g., "National Day"
+//     "start_date": string,  // YYYY-MM-DD
+//     "end_date": string
+//     }
+//     ]
+//     }
+//   - 500 Internal Server Error: Database error
+func ListClosures(c *gin.Context, calendar store.CalendarStore) {
+	closures, err := calendar.ListClosures()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error querying closures: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"closures": closures,
+	})
+}
+
+// CreateClosure adds days without school to the calendar
+//
+// Endpoint: POST /api/calendar/closures
+//
+// Request Body:
+//
+//	{
+//	  "name": string,        // e.g., "National Day"
+//	  "start_date": string,  // YYYY-MM-DD
+//	  "end_date": string     // YYYY-MM-DD; the same as start_date for a single day
+//	}
+//
+// Returns:
+//   - 201 Created: { "success": true, "closure": { ... } }
+//   - 400 Bad Request: Invalid request, missing name or invalid dates
+//   - 500 Internal Server Error: Database error
+func CreateClosure(c *gin.Context, calendar store.CalendarStore, schoolCalendar *jobs.SchoolCalendar) {
+	var request calendarPeriodRequest
+	if !bindCalendarPeriod(c, &request, "Closure") {
+		return
+	}
+
+	closure := models.SchoolClosure{Name: request.Name, StartDate: request.StartDate, EndDate: request.EndDate}
+	if err := calendar.CreateClosure(&closure); err != nil {
+		respondCalendarError(c, err, "closure")
+		return
+	}
+	reloadSchoolCalendar(schoolCalendar)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"closure": closure,
+	})
+}
+
+// UpdateClosure renames or moves a closure
+//
+// Endpoint: PUT /api/calendar/closures/:id
+//
+// Request Body: as for POST /api/calendar/closures
+//
+// Returns:
+//   - 200 OK: { "success": true, "closure": { ... } }
+//   - 400 Bad Request: Invalid ID, request or dates
+//   - 404 Not Found: Closure not found
+//   - 500 Internal Server Error: Database error
+func UpdateClosure(c *gin.Context, calendar store.CalendarStore, schoolCalendar *jobs.SchoolCalendar) {
+	id, ok := parseYearGroupParam(c, "closure ID")
+	if !ok {
+		return
+	}
+
+	var request calendarPeriodRequest
+	if !bindCalendarPeriod(c, &request, "Closure") {
+		return
+	}
+
+	closure := models.SchoolClosure{ID: id, Name: request.Name, StartDate: request.StartDate, EndDate: request.EndDate}
+	if err := calendar.UpdateClosure(&closure); err != nil {
+		respondCalendarError(c, err, "closure")
+		return
+	}
+	reloadSchoolCalendar(schoolCalendar)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"closure": closure,
+	})
+}
+
+// DeleteClosure deletes a closure
+//
+// Endpoint: DELETE /api/calendar/closures/:id
+//
+// Returns:
+//   - 200 OK: { "success": true, "message": "Closure deleted successfully" }
+//   - 400 Bad Request: Invalid ID
+//   - 404 Not Found: Closure not found
+//   - 500 Internal Server Error: Database error
+func DeleteClosure(c *gin.Context, calendar store.CalendarStore, schoolCalendar *jobs.SchoolCalendar) {
+	id, ok := parseYearGroupParam(c, "closure ID")
+	if !ok {
+		return
+	}
+
+	if err := calendar.DeleteClosure(id); err != nil {
+		respondCalendarError(c, err, "closure")
+		return
+	}
+	reloadSchoolCalendar(schoolCalendar)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Closure deleted successfully",
+	})
+}
+
+// bindCalendarPeriod binds and validates the name and dates of a calendar period,
+// responding with 400 if they are invalid
+func bindCalendarPeriod(c *gin.Context, request *calendarPeriodRequest, label string) bool {
+	fail := func(message string) bool {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": message,
+		})
+		return false
+	}
+
+	if err := c.ShouldBindJSON(request); err != nil {
+		return fail(fmt.Sprintf("Invalid request format: %v", err))
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" {
+		return fail(label + " name is required")
+	}
+	start, err := time.Parse("2006-01-02", request.StartDate)
+	if err != nil {
+		return fail(fmt.Sprintf("Invalid start_date '%s', expected YYYY-MM-DD", request.StartDate))
+	}
+	end, err := time.Parse("2006-01-02", request.EndDate)
+	if err != nil {
+		return fail(fmt.Sprintf("Invalid end_date '%s', expected YYYY-MM-DD", request.EndDate))
+	}
+	if end.Before(start) {
+		return fail("The end_date must not be before the start_date")
+	}
+	return true
+}
+
+// respondCalendarError maps calendar store errors to responses
+func respondCalendarError(c *gin.Context, err error, notFound string) {
+	switch err {
+	case sql.ErrNoRows:
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("The %s was not found", notFound),
+		})
+	case store.ErrConflict:
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "The name is already in use",
+		})
+	case store.ErrOutsideAcademicYear:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Terms must fall within their academic year",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error saving the school calendar: %v", err),
+		})
+	}
+}
+
+// reloadSchoolCalendar refreshes the cached calendar after an edit. The edit is
+// already saved, so a failure is only logged and picked up by the next reload.
+func reloadSchoolCalendar(schoolCalendar *jobs.SchoolCalendar) {
+	if err := schoolCalendar.Reload(); err != nil {
+		log.Printf("Error reloading the school calendar: %v", err)
+	}
+}
+
+// SetupCalendarRoutes sets up the school calendar routes. Everyone signed in can
+// read the calendar; only admins can change it.
+func SetupCalendarRoutes(router gin.IRouter, calendar store.CalendarStore, schoolCalendar *jobs.SchoolCalendar, events store.EventStore) {
+	admin := middleware.RequireRoles(models.RoleAdmin)
+
+	router.GET("/calendar", func(c *gin.Context) {
+		GetCalendar(c, schoolCalendar, events)
+	})
+	router.GET("/calendar/academic-years", func(c *gin.Context) {
+		ListAcademicYears(c, calendar)
+	})
+	router.POST("/calendar/academic-years", admin, func(c *gin.Context) {
+		CreateAcademicYear(c, calendar)
+	})
+	router.PUT("/calendar/academic-years/:id", admin, func(c *gin.Context) {
+		UpdateAcademicYear(c, calendar, schoolCalendar)
+	})
+	router.DELETE("/calendar/academic-years/:id", admin, func(c *gin.Context) {
+		DeleteAcademicYear(c, calendar, schoolCalendar)
+	})
+	router.POST("/calendar/academic-years/:id/terms", admin, func(c *gin.Context) {
+		CreateTerm(c, calendar, schoolCalendar)
+	})
+	router.PUT("/calendar/terms/:id", admin, func(c *gin.Context) {
+		UpdateTerm(c, calendar, schoolCalendar)
+	})
+	router.DELETE("/calendar/terms/:id", admin, func(c *gin.Context) {
+		DeleteTerm(c, calendar, schoolCalendar)
+	})
+	router.GET("/calendar/closures", func(c *gin.Context) {
+		ListClosures(c, calendar)
+	})
+	router.POST("/calendar/closures", admin, func(c *gin.Context) {
+		CreateClosure(c, calendar, schoolCalendar)
+	})
+	router.PUT("/calendar/closures/:id", admin, func(c *gin.Context) {
+		UpdateClosure(c, calendar, schoolCalendar)
+	})
+	router.DELETE("/calendar/closures/:id", admin, func(c *gin.Context) {
+		DeleteClosure(c, calendar, schoolCalendar)
+	})
+}
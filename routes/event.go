@@ -8,7 +8,11 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"server/middleware"
+	"server/models"
+	"server/store"
 	"strconv"
+	"strings"
 	"time"
 
 	"mime/multipart"
@@ -17,30 +21,6 @@ import (
 	"github.com/google/uuid"
 )
 
-/**
- * ImageModel represents an image associated with an event.
- */
-type ImageModel struct {
-	FilePath string `json:"filePath"` // The file path of the image
-}
-
-/**
- * Event represents the complete event data structure.
- */
-type Event struct {
-	EventID          string       `json:"eventID"`             // Unique identifier for the event
-	AuthorID         int          `json:"authorID"`            // ID of the event creator
-	AuthorName       string       `json:"authorName"`          // Name of the event creator
-	Title            string       `json:"title"`               // Event title
-	EventDescription string       `json:"eventDescription"`    // Detailed description
-	Images           []ImageModel `json:"images"`              // List of associated images
-	Address          string       `json:"address"`             // Event location
-	EventDate        time.Time    `json:"eventDate"`           // Date of the event
-	IsWholeDay       bool         `json:"isWholeDay"`          // Whether it's a whole-day event
-	StartTime        *time.Time   `json:"startTime,omitempty"` // Start time (if not whole-day)
-	EndTime          *time.Time   `json:"endTime,omitempty"`   // End time (if not whole-day)
-}
-
 // SaveImage saves the uploaded image to the server.
 func SaveImage(file *multipart.FileHeader, c *gin.Context) (string, error) {
 	// Generate a unique filename for the image
@@ -64,59 +44,18 @@ func SaveImage(file *multipart.FileHeader, c *gin.Context) (string, error) {
 	return imagePath, nil
 }
 
-// InsertEvent inserts the event into the events table and the image file paths into the event_images table.
-func InsertEvent(db *sql.DB, event Event, c *gin.Context) error {
-	log.Println("Starting transaction for event:", event.EventID)
-	tx, err := db.Begin()
-	if err != nil {
-		log.Println("Error beginning transaction:", err)
-		return err
-	}
-
-	// Insert event data into events table
-	queryEvent := `
-		INSERT INTO events (event_id, author_id, author_name, title, event_description, address, event_date, is_whole_day, start_time, end_time) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-	`
-	_, err = tx.Exec(queryEvent, event.EventID, event.AuthorID, event.AuthorName, event.Title, event.EventDescription, event.Address, event.EventDate, event.IsWholeDay, event.StartTime, event.EndTime)
-	if err != nil {
-		log.Println("Error inserting event:", err)
-		tx.Rollback()
-		return err
-	}
-
-	// Insert images with file paths
-	queryImage := `
-		INSERT INTO event_images (id, event_id, file_path) 
-		VALUES ($1, $2, $3)
-	`
-	files := c.Request.MultipartForm.File["images"]
-	for _, file := range files {
-		// Save the image and get the file path
+// saveEventImages saves the uploaded "images" files and returns their paths
+func saveEventImages(c *gin.Context) ([]models.ImageModel, error) {
+	images := []models.ImageModel{}
+	for _, file := range c.Request.MultipartForm.File["images"] {
 		imagePath, err := SaveImage(file, c)
 		if err != nil {
 			log.Println("Error saving image:", err)
-			tx.Rollback()
-			return err
-		}
-
-		// Insert image data into the database
-		imageID := uuid.New().String()
-		_, err = tx.Exec(queryImage, imageID, event.EventID, imagePath)
-		if err != nil {
-			log.Println("Error inserting image data:", err)
-			tx.Rollback()
-			return err
+			return nil, err
 		}
+		images = append(images, models.ImageModel{FilePath: imagePath})
 	}
-
-	// Commit the transaction
-	if err = tx.Commit(); err != nil {
-		log.Println("Error committing transaction:", err)
-		return err
-	}
-	log.Println("Event and images inserted successfully.")
-	return nil
+	return images, nil
 }
 
 /**
@@ -132,8 +71,8 @@ func InsertEvent(db *sql.DB, event Event, c *gin.Context) error {
  *    - Retrieves event details by ID
  *    - Returns complete event data including images
  */
-func RegisterEventRoutes(router gin.IRouter, db *sql.DB) {
-	router.POST("/post_event", func(c *gin.Context) {
+func RegisterEventRoutes(router gin.IRouter, events store.EventStore) {
+	router.POST("/post_event", middleware.RequireRoles(models.RoleStaff), func(c *gin.Context) {
 		log.Println("Received POST request for /post_event")
 
 		// Parse multipart form
@@ -142,12 +81,9 @@ func RegisterEventRoutes(router gin.IRouter, db *sql.DB) {
 			return
 		}
 
-		// Parse authorID as integer
-		authorID, err := strconv.Atoi(c.PostForm("authorID"))
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authorID"})
-			return
-		}
+		// The author is the authenticated caller
+		author, _ := middleware.CurrentUser(c)
+		authorID := author.ID
 
 		// Parse eventDate in ISO format
 		eventDate, err := time.Parse("2006-01-02T15:04:05.000Z", c.PostForm("eventDate"))
@@ -157,10 +93,10 @@ func RegisterEventRoutes(router gin.IRouter, db *sql.DB) {
 		}
 
 		// Create event from form data
-		event := Event{
+		event := models.Event{
 			EventID:          c.PostForm("eventID"),
 			AuthorID:         authorID,
-			AuthorName:       c.PostForm("authorName"),
+			AuthorName:       author.Name,
 			Title:            c.PostForm("title"),
 			EventDescription: c.PostForm("eventDescription"),
 			Address:          c.PostForm("address"),
@@ -186,8 +122,28 @@ func RegisterEventRoutes(router gin.IRouter, db *sql.DB) {
 			event.EndTime = &t
 		}
 
+		// Optional audience: comma-separated section IDs, empty for everyone
+		audience, err := parseSectionIDs(c.PostForm("audienceSectionIDs"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid audience section IDs"})
+			return
+		}
+		event.AudienceSectionIDs = audience
+
+		// Save the uploaded images to disk
+		images, err := saveEventImages(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save images: " + err.Error()})
+			return
+		}
+		event.Images = images
+
 		// Insert the event (and images) into the database
-		if err := InsertEvent(db, event, c); err != nil {
+		if err := events.Create(event); err != nil {
+			if err == store.ErrInvalidReference {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown audience section"})
+				return
+			}
 			log.Println("Failed to insert event:", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert event: " + err.Error()})
 			return
@@ -199,6 +155,22 @@ func RegisterEventRoutes(router gin.IRouter, db *sql.DB) {
 	})
 }
 
+// parseSectionIDs parses a comma-separated list of section IDs
+func parseSectionIDs(s string) ([]int, error) {
+	ids := []int{}
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		id, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 // Helper function to parse integers
 func parseInt(s string) int {
 	i, _ := strconv.Atoi(s)
@@ -228,46 +200,34 @@ type EventWithoutImages struct {
 }
 
 // RegisterGetAllEvents registers a route that returns all events without images.
-func RegisterGetAllEvents(router gin.IRouter, db *sql.DB) {
+func RegisterGetAllEvents(router gin.IRouter, events store.EventStore) {
 	router.GET("/events", func(c *gin.Context) {
-		// Query all events from the database (no filtering by month or year)
-		query := `
-			SELECT event_id, author_id, author_name, title, event_description, address,
-			       event_date, is_whole_day, start_time, end_time
-			FROM events;
-		`
-		rows, err := db.Query(query)
+		// Query all events from the database (no filtering by month or year);
+		// students only see the events meant for their section
+		allEvents, err := events.List(audienceStudentID(c))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		defer rows.Close()
 
-		var events []EventWithoutImages
-		for rows.Next() {
-			var ev EventWithoutImages
-			var startTime, endTime *time.Time // Initialize as pointers to nil
-			if err := rows.Scan(&ev.EventID, &ev.AuthorID, &ev.AuthorName, &ev.Title, &ev.EventDescription, &ev.Address, &ev.EventDate, &ev.IsWholeDay, &startTime, &endTime); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return
-			}
-
-			// Assign startTime and endTime pointers if they are not null
-			ev.StartTime = startTime
-			ev.EndTime = endTime
-
-			// Set the images field to an empty array since we're not returning image data
-			ev.Images = []string{} // Empty array for images
-
-			events = append(events, ev)
-		}
-
-		if err = rows.Err(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+		var response []EventWithoutImages
+		for _, event := range allEvents {
+			response = append(response, EventWithoutImages{
+				EventID:          event.EventID,
+				AuthorID:         event.AuthorID,
+				AuthorName:       event.AuthorName,
+				Title:            event.Title,
+				EventDescription: event.EventDescription,
+				Images:           []string{}, // Empty array since we're not returning image data
+				Address:          event.Address,
+				EventDate:        event.EventDate,
+				IsWholeDay:       event.IsWholeDay,
+				StartTime:        event.StartTime,
+				EndTime:          event.EndTime,
+			})
 		}
 
-		c.JSON(http.StatusOK, gin.H{"events": events})
+		c.JSON(http.StatusOK, gin.H{"events": response})
 	})
 }
 
@@ -304,15 +264,15 @@ func RegisterGetAllEvents(router gin.IRouter, db *sql.DB) {
  *   - 404 Not Found: Event not found
  *   - 500 Internal Server Error: Database error
  */
-func RegisterGetEventByID(router gin.IRouter, db *sql.DB) {
+func RegisterGetEventByID(router gin.IRouter, events store.EventStore) {
 	router.GET("/event/:id", func(c *gin.Context) {
 		// Get the eventID from the URL parameters
 		eventID := c.Param("id")
 
-		// Fetch the event from the database using GetEventByID function
-		event, err := GetEventByID(db, eventID)
+		// Fetch the event and its images from the database
+		event, err := events.GetByID(eventID)
 		if err != nil {
-			if err.Error() == "event not found" {
+			if err == sql.ErrNoRows {
 				c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
 			} else {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -320,6 +280,18 @@ func RegisterGetEventByID(router gin.IRouter, db *sql.DB) {
 			return
 		}
 
+		if studentID := audienceStudentID(c); studentID != 0 {
+			visible, err := events.InAudience(eventID, studentID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if !visible {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+				return
+			}
+		}
+
 		// Print the event data that will be sent as JSON
 		fmt.Printf("Event to be sent: %+v\n", event)
 
@@ -327,76 +299,3 @@ func RegisterGetEventByID(router gin.IRouter, db *sql.DB) {
 		c.JSON(http.StatusOK, gin.H{"event": event})
 	})
 }
-
-/**
- * GetEventByID fetches the event by its ID and returns the complete event including images.
- *
- * @param db *sql.DB - Database connection
- * @param eventID string - The unique identifier of the event
- * @return *Event - The complete event data
- * @return error - Any error that occurred during the process
- */
-func GetEventByID(db *sql.DB, eventID string) (*Event, error) {
-	// Query to fetch event details
-	eventQuery := `
-		SELECT event_id, author_id, author_name, title, event_description, address,
-		       event_date, is_whole_day, start_time, end_time
-		FROM events
-		WHERE event_id = $1;
-	`
-
-	// Query to fetch images for the event
-	imagesQuery := `
-		SELECT file_path
-		FROM event_images
-		WHERE event_id = $1;
-	`
-
-	// Create an event variable to hold the event data
-	var event Event
-	var startTime, endTime *time.Time
-
-	// Fetch event details from the database
-	err := db.QueryRow(eventQuery, eventID).Scan(
-		&event.EventID, &event.AuthorID, &event.AuthorName, &event.Title,
-		&event.EventDescription, &event.Address, &event.EventDate,
-		&event.IsWholeDay, &startTime, &endTime,
-	)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("event not found")
-		}
-		return nil, err
-	}
-
-	// Set startTime and endTime
-	event.StartTime = startTime
-	event.EndTime = endTime
-
-	// Fetch image paths for the event
-	rows, err := db.Query(imagesQuery, eventID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	// Initialize images slice
-	event.Images = []ImageModel{}
-
-	// Collect image paths
-	for rows.Next() {
-		var filePath string
-		if err := rows.Scan(&filePath); err != nil {
-			return nil, err
-		}
-		event.Images = append(event.Images, ImageModel{
-			FilePath: filePath,
-		})
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return &event, nil
-}
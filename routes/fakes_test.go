@@ -0,0 +1,211 @@
+package routes
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"server/middleware"
+	"server/models"
+	"server/store"
+	"server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// fakeSessionStore keeps sessions in memory. Rotation follows the same rules as the
+// Postgres store: only the current token of an active session can be rotated.
+type fakeSessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*models.Session
+	hashes   map[string]string // refresh token hash to session ID
+	rotated  map[string]string // rotated-out refresh token hash to session ID
+	next     int
+}
+
+func newFakeSessionStore() *fakeSessionStore {
+	return &fakeSessionStore{
+		sessions: make(map[string]*models.Session),
+		hashes:   make(map[string]string),
+		rotated:  make(map[string]string),
+	}
+}
+
+func (s *fakeSessionStore) Create(userID int, refreshTokenHash string, deviceID string, expiresAt time.Time) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.next++
+	session := &models.Session{ID: fmt.Sprintf("session-%d", s.next), UserID: userID, CreatedAt: time.Now(), ExpiresAt: expiresAt}
+	s.sessions[session.ID] = session
+	s.hashes[refreshTokenHash] = session.ID
+	copied := *session
+	return &copied, nil
+}
+
+func (s *fakeSessionStore) GetByID(id string) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (s *fakeSessionStore) GetByRefreshHash(refreshTokenHash string) (*models.Session, error) {
+	s.mu.Lock()
+	id, ok := s.hashes[refreshTokenHash]
+	s.mu.Unlock()
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return s.GetByID(id)
+}
+
+func (s *fakeSessionStore) GetIDByRotatedRefreshHash(refreshTokenHash string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.rotated[refreshTokenHash]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+	return id, nil
+}
+
+func (s *fakeSessionStore) RotateRefreshToken(id string, oldRefreshTokenHash string, newRefreshTokenHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || s.hashes[oldRefreshTokenHash] != id || !session.IsActive() {
+		return sql.ErrNoRows
+	}
+	delete(s.hashes, oldRefreshTokenHash)
+	s.hashes[newRefreshTokenHash] = id
+	s.rotated[oldRefreshTokenHash] = id
+	session.ExpiresAt = expiresAt
+	return nil
+}
+
+func (s *fakeSessionStore) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, ok := s.sessions[id]; ok && session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+	}
+	return nil
+}
+
+// fakeUserStore serves a fixed set of users; methods the tests do not need are
+// left to the embedded interface and panic if called
+type fakeUserStore struct {
+	store.UserStore
+	users map[int]models.User
+}
+
+func (s *fakeUserStore) GetByID(id int) (*models.User, error) {
+	user, ok := s.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &user, nil
+}
+
+func (s *fakeUserStore) GetAdditionalRoles(id int) ([]string, error) {
+	roles := s.users[id].AdditionalRoles
+	if roles == nil {
+		roles = []string{}
+	}
+	return roles, nil
+}
+
+// testAPI is a router whose routes require authentication through fake stores, with
+// a signed-in session for each of its users
+type testAPI struct {
+	t        *testing.T
+	router   *gin.Engine
+	group    *gin.RouterGroup
+	sessions *fakeSessionStore
+	users    *fakeUserStore
+	tokens   map[int]string
+}
+
+func newTestAPI(t *testing.T, users ...models.User) *testAPI {
+	api := &testAPI{
+		t:        t,
+		router:   gin.New(),
+		sessions: newFakeSessionStore(),
+		users:    &fakeUserStore{users: make(map[int]models.User)},
+		tokens:   make(map[int]string),
+	}
+	api.group = api.router.Group("/api", middleware.RequireAuth(api.sessions, api.users))
+
+	for _, user := range users {
+		api.users.users[user.ID] = user
+		tokens, err := issueSessionTokens(api.sessions, user.ID, "")
+		if err != nil {
+			t.Fatalf("issuing tokens for user %d: %v", user.ID, err)
+		}
+		api.tokens[user.ID] = tokens["access_token"].(string)
+	}
+	return api
+}
+
+// do sends a JSON request as the given user, or unauthenticated for user 0, and
+// decodes the JSON response into out if it is not nil
+func (api *testAPI) do(userID int, method string, path string, body interface{}, out interface{}) int {
+	api.t.Helper()
+	return serve(api.t, api.router, method, path, api.tokens[userID], body, out)
+}
+
+// serve sends a JSON request with an optional bearer token to router
+func serve(t *testing.T, router http.Handler, method string, path string, token string, body interface{}, out interface{}) int {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("encoding request body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	request := httptest.NewRequest(method, path, reader)
+	request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	if out != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), out); err != nil {
+			t.Fatalf("decoding response %q: %v", recorder.Body.String(), err)
+		}
+	}
+	return recorder.Code
+}
+
+// hashOf returns the stored hash of a refresh token
+func hashOf(token string) string {
+	return utils.HashToken(token)
+}
@@ -0,0 +1,205 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"server/middleware"
+	"server/models"
+	"server/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListGuardians returns the guardians who receive a student's attendance alerts
+//
+// Endpoint: GET /api/students/:id/guardians
+//
+// Returns:
+//   - 200 OK:
+//     {
+//     "success": true,
+//     "guardians": [
+//     {
+//     "id": int,
+//     "student_id": int,
+//     "name": string,
+//     "email": string,
+//     "relationship": string,   // null if not given, e.g. "Mother"
+//     "created_at": string
+//     }
+//     ]
+//     }
+//   - 400 Bad Request: Invalid student ID
+//   - 500 Internal Server Error: Database error
+func ListGuardians(c *gin.Context, guardians store.GuardianStore) {
+	studentID, ok := parseYearGroupParam(c, "student ID")
+	if !ok {
+		return
+	}
+
+	list, err := guardians.ListByStudent(studentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error querying guardians: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"guardians": list,
+	})
+}
+
+// CreateGuardian adds a guardian to a student
+//
+// Endpoint: POST /api/students/:id/guardians
+//
+// Request Body:
+//
+//	{
+//	  "name": string,
+//	  "email": string,
+//	  "relationship": string   // optional
+//	}
+//
+// Returns:
+//   - 201 Created: { "success": true, "guardian": { ... } }
+//   - 400 Bad Request: Invalid request, missing name, invalid email or unknown student
+//   - 409 Conflict: The email is already a guardian of the student
+//   - 500 Internal Server Error: Database error
+func CreateGuardian(c *gin.Context, guardians store.GuardianStore) {
+	studentID, ok := parseYearGroupParam(c, "student ID")
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Name         string `json:"name"`
+		Email        string `json:"email"`
+		Relationship string `json:"relationship"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Invalid request format: %v", err),
+		})
+		return
+	}
+
+	guardian := models.Guardian{
+		StudentID: studentID,
+		Name:      strings.TrimSpace(request.Name),
+		Email:     strings.TrimSpace(request.Email),
+	}
+	if guardian.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Guardian name is required",
+		})
+		return
+	}
+	if _, err := mail.ParseAddress(guardian.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "A valid guardian email is required",
+		})
+		return
+	}
+	if relationship := strings.TrimSpace(request.Relationship); relationship != "" {
+		guardian.Relationship = &relationship
+	}
+
+	switch err := guardians.Create(&guardian); err {
+	case nil:
+	case store.ErrInvalidReference:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("No student found with ID: %d", studentID),
+		})
+		return
+	case store.ErrConflict:
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "This email is already a guardian of the student",
+		})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error saving guardian: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":  true,
+		"guardian": guardian,
+	})
+}
+
+// DeleteGuardian removes a guardian from a student
+//
+// Endpoint: DELETE /api/students/:id/guardians/:guardianId
+//
+// Returns:
+//   - 200 OK: { "success": true, "message": "Guardian deleted successfully" }
+//   - 400 Bad Request: Invalid ID
+//   - 404 Not Found: The student has no such guardian
+//   - 500 Internal Server Error: Database error
+func DeleteGuardian(c *gin.Context, guardians store.GuardianStore) {
+	studentID, ok := parseYearGroupParam(c, "student ID")
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("guardianId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Invalid guardian ID: %s", c.Param("guardianId")),
+		})
+		return
+	}
+
+	if err := guardians.Delete(studentID, id); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "The guardian was not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error deleting guardian: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Guardian deleted successfully",
+	})
+}
+
+// SetupGuardianRoutes sets up the routes managing students' guardians for the
+// attendance office and admins
+func SetupGuardianRoutes(router gin.IRouter, guardians store.GuardianStore) {
+	office := middleware.RequireRoles(models.RoleAttendance, models.RoleAdmin)
+
+	router.GET("/students/:id/guardians", office, func(c *gin.Context) {
+		ListGuardians(c, guardians)
+	})
+	router.POST("/students/:id/guardians", office, func(c *gin.Context) {
+		CreateGuardian(c, guardians)
+	})
+	router.DELETE("/students/:id/guardians/:guardianId", office, func(c *gin.Context) {
+		DeleteGuardian(c, guardians)
+	})
+}
@@ -0,0 +1,375 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"server/middleware"
+	"server/models"
+	"server/store"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// leaveAttachmentDir holds the uploaded leave attachments. It is not served
+// statically; files are only downloaded through the authorised endpoint.
+const leaveAttachmentDir = "leave_attachments"
+
+// maxLeaveAttachmentSize is the largest file accepted as a leave attachment
+const maxLeaveAttachmentSize = 10 << 20
+
+// leaveAttachmentTypes maps the accepted file extensions to the content type their
+// contents must sniff as. HEIC photos cannot be sniffed, so only their extension is checked.
+var leaveAttachmentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".heic": "",
+	".pdf":  "application/pdf",
+}
+
+// ListLeaveAttachmentsHandler returns the files attached to a leave request
+//
+// Endpoint: GET /api/leave-requests/:requestId/attachments
+//
+// Returns:
+//   - 200 OK:
+//     {
+//     "success": true,
+//     "attachments": [
+//     {
+//     "id": string,
+//     "leave_request_id": int,
+//     "file_name": string,
+//     "url": string,          // download URL, requires the bearer token
+//     "file_type": string,    // e.g., "pdf"
+//     "file_size": int,
+//     "uploaded_by": int,
+//     "uploader_name": string,
+//     "created_at": string
+//     }
+//     ]
+//     }
+//   - 400 Bad Request: Invalid request ID
+//   - 403 Forbidden: Caller is neither the student nor staff
+//   - 404 Not Found: Leave request not found
+//   - 500 Internal Server Error: Database error
+func ListLeaveAttachmentsHandler(c *gin.Context, leaveRequests store.LeaveRequestStore, attachments store.LeaveAttachmentStore) {
+	request, ok := loadViewableLeaveRequest(c, leaveRequests)
+	if !ok {
+		return
+	}
+
+	files, err := attachments.ListByRequest(request.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error querying attachments: %v", err),
+		})
+		return
+	}
+	for i := range files {
+		files[i].URL = leaveAttachmentURL(files[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"attachments": files,
+	})
+}
+
+// UploadLeaveAttachmentHandler attaches an image or PDF to the caller's own leave request
+//
+// Endpoint: POST /api/leave-requests/:requestId/attachments
+//
+// Request Body: multipart form with a "file" field holding a JPEG, PNG, HEIC or PDF
+// file of at most 10 MB
+//
+// Returns:
+//   - 201 Created: { "success": true, "attachment": { ... } }
+//   - 400 Bad Request: Invalid request ID, missing file, unsupported type or too large
+//   - 403 Forbidden: The leave request belongs to another student
+//   - 404 Not Found: Leave request not found
+//   - 500 Internal Server Error: Storage or database error
+func UploadLeaveAttachmentHandler(c *gin.Context, leaveRequests store.LeaveRequestStore, attachments store.LeaveAttachmentStore) {
+	request, ok := loadViewableLeaveRequest(c, leaveRequests)
+	if !ok {
+		return
+	}
+
+	// Only the student who made the request can attach files to it
+	user, _ := middleware.CurrentUser(c)
+	if request.StudentID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "You can only attach files to your own leave requests",
+		})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("No file uploaded or invalid file: %v", err),
+		})
+		return
+	}
+	if file.Size > maxLeaveAttachmentSize {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Attachments can be at most %d MB", maxLeaveAttachmentSize>>20),
+		})
+		return
+	}
+
+	// Check the contents as well as the extension, so the file opens as what it claims to be
+	extension := strings.ToLower(filepath.Ext(file.Filename))
+	contentType, allowed := leaveAttachmentTypes[extension]
+	if allowed && contentType != "" {
+		allowed = sniffContentType(file) == contentType
+	}
+	if !allowed {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Attachments must be JPEG, PNG or HEIC images or PDF files",
+		})
+		return
+	}
+
+	if err := os.MkdirAll(leaveAttachmentDir, 0755); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Failed to create the attachments directory: %v", err),
+		})
+		return
+	}
+
+	// Store the file under a generated name; the original name is only kept in the database
+	attachment := models.LeaveAttachment{
+		ID:             uuid.New().String(),
+		LeaveRequestID: request.ID,
+		FileName:       filepath.Base(file.Filename),
+		FileType:       extension[1:],
+		FileSize:       int(file.Size),
+		UploadedBy:     &user.ID,
+	}
+	attachment.FilePath = filepath.Join(leaveAttachmentDir, attachment.ID+extension)
+	if err := c.SaveUploadedFile(file, attachment.FilePath); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Failed to save file: %v", err),
+		})
+		return
+	}
+
+	if err := attachments.Create(&attachment); err != nil {
+		os.Remove(attachment.FilePath)
+		if err == store.ErrInvalidReference {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "Leave request not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Failed to save attachment information: %v", err),
+		})
+		return
+	}
+	attachment.UploaderName = user.Name
+	attachment.URL = leaveAttachmentURL(attachment)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":    true,
+		"attachment": attachment,
+	})
+}
+
+// DownloadLeaveAttachmentHandler sends the contents of a leave attachment
+//
+// Endpoint: GET /api/leave-requests/:requestId/attachments/:attachmentId/file
+//
+// Returns:
+//   - 200 OK: The file, shown inline
+//   - 400 Bad Request: Invalid request ID
+//   - 403 Forbidden: Caller is neither the student nor staff
+//   - 404 Not Found: Leave request or attachment not found
+//   - 500 Internal Server Error: Database error
+func DownloadLeaveAttachmentHandler(c *gin.Context, leaveRequests store.LeaveRequestStore, attachments store.LeaveAttachmentStore) {
+	request, ok := loadViewableLeaveRequest(c, leaveRequests)
+	if !ok {
+		return
+	}
+
+	attachment, ok := loadLeaveAttachment(c, attachments, request.ID)
+	if !ok {
+		return
+	}
+
+	c.Header("Cache-Control", "private, no-store")
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", attachment.FileName))
+	c.File(attachment.FilePath)
+}
+
+// DeleteLeaveAttachmentHandler removes a file from the caller's own leave request
+//
+// Endpoint: DELETE /api/leave-requests/:requestId/attachments/:attachmentId
+//
+// Returns:
+//   - 200 OK: { "success": true, "message": "Attachment deleted successfully" }
+//   - 400 Bad Request: Invalid request ID
+//   - 403 Forbidden: The leave request belongs to another student
+//   - 404 Not Found: Leave request or attachment not found
+//   - 500 Internal Server Error: Database error
+func DeleteLeaveAttachmentHandler(c *gin.Context, leaveRequests store.LeaveRequestStore, attachments store.LeaveAttachmentStore) {
+	request, ok := loadViewableLeaveRequest(c, leaveRequests)
+	if !ok {
+		return
+	}
+
+	user, _ := middleware.CurrentUser(c)
+	if request.StudentID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "You can only remove files from your own leave requests",
+		})
+		return
+	}
+
+	attachment, ok := loadLeaveAttachment(c, attachments, request.ID)
+	if !ok {
+		return
+	}
+
+	if err := attachments.Delete(request.ID, attachment.ID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "Attachment not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error deleting attachment: %v", err),
+		})
+		return
+	}
+
+	// The record is gone, so a file left behind is only logged
+	if err := os.Remove(attachment.FilePath); err != nil && !os.IsNotExist(err) {
+		log.Printf("Error removing leave attachment file %s: %v", attachment.FilePath, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Attachment deleted successfully",
+	})
+}
+
+// loadViewableLeaveRequest loads the leave request named by the requestId path
+// parameter, responding with an error unless the caller can view it
+func loadViewableLeaveRequest(c *gin.Context, leaveRequests store.LeaveRequestStore) (*models.LeaveRequest, bool) {
+	requestID, err := strconv.Atoi(c.Param("requestId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request ID",
+		})
+		return nil, false
+	}
+
+	request, err := leaveRequests.GetByID(requestID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "Leave request not found",
+			})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error querying leave request: %v", err),
+		})
+		return nil, false
+	}
+
+	// Only the owning student and staff can see a leave request and its files
+	if !canViewLeaveRequest(c, *request) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "You are not authorized to view this request",
+		})
+		return nil, false
+	}
+	return request, true
+}
+
+// loadLeaveAttachment loads the attachment named by the attachmentId path parameter
+func loadLeaveAttachment(c *gin.Context, attachments store.LeaveAttachmentStore, requestID int) (*models.LeaveAttachment, bool) {
+	attachment, err := attachments.Get(requestID, c.Param("attachmentId"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "Attachment not found",
+			})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error querying attachment: %v", err),
+		})
+		return nil, false
+	}
+	return attachment, true
+}
+
+// leaveAttachmentURL returns the download URL of an attachment
+func leaveAttachmentURL(attachment models.LeaveAttachment) string {
+	return fmt.Sprintf("/api/leave-requests/%d/attachments/%s/file", attachment.LeaveRequestID, attachment.ID)
+}
+
+// sniffContentType detects the content type of an uploaded file from its first bytes
+func sniffContentType(header *multipart.FileHeader) string {
+	file, err := header.Open()
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return ""
+	}
+	return http.DetectContentType(head[:n])
+}
+
+// SetupLeaveAttachmentRoutes registers the routes for files attached to leave
+// requests. Students attach files to their own requests; staff can view them.
+func SetupLeaveAttachmentRoutes(router gin.IRouter, leaveRequests store.LeaveRequestStore, attachments store.LeaveAttachmentStore) {
+	router.GET("/leave-requests/:requestId/attachments", func(c *gin.Context) {
+		ListLeaveAttachmentsHandler(c, leaveRequests, attachments)
+	})
+	router.POST("/leave-requests/:requestId/attachments", middleware.RequireRoles(models.RoleStudent), func(c *gin.Context) {
+		UploadLeaveAttachmentHandler(c, leaveRequests, attachments)
+	})
+	router.GET("/leave-requests/:requestId/attachments/:attachmentId/file", func(c *gin.Context) {
+		DownloadLeaveAttachmentHandler(c, leaveRequests, attachments)
+	})
+	router.DELETE("/leave-requests/:requestId/attachments/:attachmentId", middleware.RequireRoles(models.RoleStudent), func(c *gin.Context) {
+		DeleteLeaveAttachmentHandler(c, leaveRequests, attachments)
+	})
+}
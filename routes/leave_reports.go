@@ -0,0 +1,293 @@
+package routes
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"server/middleware"
+	"server/models"
+	"server/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultLeaveReportWeeks is the range reported on when no from date is given
+const defaultLeaveReportWeeks = 4
+
+// Top requesters listed by default and at most
+const (
+	defaultTopRequesters = 10
+	maxTopRequesters     = 100
+)
+
+// Every leave report endpoint accepts these query parameters:
+//   - from: First day in YYYY-MM-DD format, inclusive (defaults to 4 weeks before to)
+//   - to: Last day in YYYY-MM-DD format, inclusive (defaults to today)
+//   - year_group: Only this year group, e.g., "IB1", or section, e.g., "ib1-a" (optional)
+//   - format: "json" (default) or "csv" to download the rows as a file
+//
+// Requests count by the day they were made, under the student's current year group.
+// JSON responses have the shape { "success": true, "from": string, "to": string, key: [ ... ] }.
+
+// GetLeaveWeeklyCounts returns the number of leave requests made each week
+//
+// Endpoint: GET /api/leave-requests/reports/weekly
+//
+// Returns:
+//   - 200 OK: "weeks": [ { "week_start": string, "request_type": string, "status": string,
+//     "year_group": string, "requests": int } ], one row per combination with requests
+//   - 400 Bad Request: Invalid filter or format
+//   - 500 Internal Server Error: Database error
+func GetLeaveWeeklyCounts(c *gin.Context, reports store.LeaveReportStore) {
+	filter, ok := parseLeaveReportFilter(c)
+	if !ok {
+		return
+	}
+
+	counts, err := reports.WeeklyCounts(filter)
+	if err != nil {
+		leaveReportError(c, err)
+		return
+	}
+
+	header := []string{"week_start", "request_type", "status", "year_group", "requests"}
+	rows := make([]gin.H, 0, len(counts))
+	for _, count := range counts {
+		rows = append(rows, gin.H{
+			"week_start":   count.WeekStart.Format("2006-01-02"),
+			"request_type": count.RequestType,
+			"status":       count.Status,
+			"year_group":   count.YearGroup,
+			"requests":     count.Requests,
+		})
+	}
+	leaveReportResponse(c, filter, "weeks", header, rows)
+}
+
+// GetLeaveResponseTimes returns how long staff took to approve or reject leave requests
+//
+// Endpoint: GET /api/leave-requests/reports/response-times
+//
+// Returns:
+//   - 200 OK: "responseTimes": [ { "responded": int, "median_minutes": float, "average_minutes": float } ],
+//     a single row measured from created_at to response_time
+//   - 400 Bad Request: Invalid filter or format
+//   - 500 Internal Server Error: Database error
+func GetLeaveResponseTimes(c *gin.Context, reports store.LeaveReportStore) {
+	filter, ok := parseLeaveReportFilter(c)
+	if !ok {
+		return
+	}
+
+	times, err := reports.ResponseTimes(filter)
+	if err != nil {
+		leaveReportError(c, err)
+		return
+	}
+
+	header := []string{"responded", "median_minutes", "average_minutes"}
+	leaveReportResponse(c, filter, "responseTimes", header, []gin.H{{
+		"responded":       times.Responded,
+		"median_minutes":  roundRate(times.MedianMinutes),
+		"average_minutes": roundRate(times.AverageMinutes),
+	}})
+}
+
+// GetTopLeaveRequesters returns the students who made the most leave requests
+//
+// Endpoint: GET /api/leave-requests/reports/top-requesters
+//
+// Query Parameters:
+//   - limit: Number of students (default 10, at most 100)
+//
+// Returns:
+//   - 200 OK: "students": [ { "student_id": int, "name": string, "year_group": string,
+//     "requests": int, "approved": int } ], most requests first
+//   - 400 Bad Request: Invalid filter, limit or format
+//   - 500 Internal Server Error: Database error
+func GetTopLeaveRequesters(c *gin.Context, reports store.LeaveReportStore) {
+	filter, ok := parseLeaveReportFilter(c)
+	if !ok {
+		return
+	}
+
+	limit := defaultTopRequesters
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxTopRequesters {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("Invalid limit '%s', expected 1 to %d", value, maxTopRequesters),
+			})
+			return
+		}
+		limit = parsed
+	}
+
+	requesters, err := reports.TopRequesters(filter, limit)
+	if err != nil {
+		leaveReportError(c, err)
+		return
+	}
+
+	header := []string{"student_id", "name", "year_group", "requests", "approved"}
+	rows := make([]gin.H, 0, len(requesters))
+	for _, requester := range requesters {
+		rows = append(rows, gin.H{
+			"student_id": requester.StudentID,
+			"name":       requester.Name,
+			"year_group": requester.YearGroup,
+			"requests":   requester.Requests,
+			"approved":   requester.Approved,
+		})
+	}
+	leaveReportResponse(c, filter, "students", header, rows)
+}
+
+// GetStaffLeaveResponses returns the approval rate and response time of each staff member
+//
+// Endpoint: GET /api/leave-requests/reports/staff
+//
+// Returns:
+//   - 200 OK: "staff": [ { "staff_id": int, "name": string, "responded": int, "approved": int,
+//     "rejected": int, "approval_rate": float, "median_minutes": float } ], busiest first;
+//     approval_rate is a percentage, e.g., 87.5
+//   - 400 Bad Request: Invalid filter or format
+//   - 500 Internal Server Error: Database error
+func GetStaffLeaveResponses(c *gin.Context, reports store.LeaveReportStore) {
+	filter, ok := parseLeaveReportFilter(c)
+	if !ok {
+		return
+	}
+
+	responses, err := reports.StaffResponses(filter)
+	if err != nil {
+		leaveReportError(c, err)
+		return
+	}
+
+	header := []string{"staff_id", "name", "responded", "approved", "rejected", "approval_rate", "median_minutes"}
+	rows := make([]gin.H, 0, len(responses))
+	for _, staff := range responses {
+		rows = append(rows, gin.H{
+			"staff_id":       staff.StaffID,
+			"name":           staff.Name,
+			"responded":      staff.Responded(),
+			"approved":       staff.Approved,
+			"rejected":       staff.Rejected,
+			"approval_rate":  roundRate(staff.ApprovalRate()),
+			"median_minutes": roundRate(staff.MedianMinutes),
+		})
+	}
+	leaveReportResponse(c, filter, "staff", header, rows)
+}
+
+// parseLeaveReportFilter reads the report filter and format, responding with 400
+// if either is invalid
+func parseLeaveReportFilter(c *gin.Context) (models.LeaveReportFilter, bool) {
+	filter := models.LeaveReportFilter{YearGroup: strings.TrimSpace(c.Query("year_group"))}
+	fail := func(message string) (models.LeaveReportFilter, bool) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": message,
+		})
+		return filter, false
+	}
+
+	if format := c.DefaultQuery("format", "json"); format != "json" && format != "csv" {
+		return fail(fmt.Sprintf("Invalid format '%s', expected json or csv", format))
+	}
+
+	now := time.Now()
+	filter.To = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if value := c.Query("to"); value != "" {
+		date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return fail(fmt.Sprintf("Invalid to date '%s', expected YYYY-MM-DD", value))
+		}
+		filter.To = date
+	}
+	filter.From = filter.To.AddDate(0, 0, -7*defaultLeaveReportWeeks+1)
+	if value := c.Query("from"); value != "" {
+		date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return fail(fmt.Sprintf("Invalid from date '%s', expected YYYY-MM-DD", value))
+		}
+		filter.From = date
+	}
+	if filter.To.Before(filter.From) {
+		return fail("The to date must not be before the from date")
+	}
+
+	return filter, true
+}
+
+// leaveReportResponse writes the report rows as JSON under key, or as a CSV file
+// with the columns of header when format=csv
+func leaveReportResponse(c *gin.Context, filter models.LeaveReportFilter, key string, header []string, rows []gin.H) {
+	if c.Query("format") != "csv" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"from":    filter.From.Format("2006-01-02"),
+			"to":      filter.To.Format("2006-01-02"),
+			key:       rows,
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("leave-%s-%s-to-%s.csv", key, filter.From.Format("2006-01-02"), filter.To.Format("2006-01-02"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write(header)
+	for _, row := range rows {
+		record := make([]string, len(header))
+		for i, column := range header {
+			// Only text is escaped, so negative numbers stay numbers
+			if text, ok := row[column].(string); ok {
+				record[i] = csvCell(text)
+			} else {
+				record[i] = fmt.Sprint(row[column])
+			}
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("Error writing leave report export: %v", err)
+	}
+}
+
+// leaveReportError responds with 500 for a failed report query
+func leaveReportError(c *gin.Context, err error) {
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"success": false,
+		"message": fmt.Sprintf("Error querying leave reports: %v", err),
+	})
+}
+
+// SetupLeaveReportRoutes sets up the leave reporting routes
+func SetupLeaveReportRoutes(router gin.IRouter, reports store.LeaveReportStore) {
+	reportGroup := router.Group("/leave-requests/reports", middleware.RequireRoles(models.RoleStaff, models.RoleAttendance, models.RoleAdmin))
+	{
+		reportGroup.GET("/weekly", func(c *gin.Context) {
+			GetLeaveWeeklyCounts(c, reports)
+		})
+		reportGroup.GET("/response-times", func(c *gin.Context) {
+			GetLeaveResponseTimes(c, reports)
+		})
+		reportGroup.GET("/top-requesters", func(c *gin.Context) {
+			GetTopLeaveRequesters(c, reports)
+		})
+		reportGroup.GET("/staff", func(c *gin.Context) {
+			GetStaffLeaveResponses(c, reports)
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package routes
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"server/models"
+	"server/store"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Page sizes of GET /api/leave-requests
+const (
+	defaultLeaveSearchLimit = 50
+	maxLeaveSearchLimit     = 200
+)
+
+// leaveCursorTimeFormat writes created_at into cursors at full precision
+const leaveCursorTimeFormat = "2006-01-02 15:04:05.999999"
+
+// SearchLeaveRequests returns one page of the leave requests matching the filters
+//
+// Endpoint: GET /api/leave-requests
+//
+// Query Parameters:
+//   - status: comma-separated statuses, e.g. "approved,finished" (optional)
+//   - type: request type, case-insensitive (optional)
+//   - year_group: year group name such as "IB1", or section ID such as "ib1-a" (optional)
+//   - from, to: only leave covering a day in this range, YYYY-MM-DD format (optional)
+//   - responded_by: ID of the staff member who approved or rejected the request (optional)
+//   - q: text to find in the reason (optional)
+//   - sort: "created_at" (default) or "leave_date"
+//   - order: "desc" (default) or "asc"
+//   - limit: page size (default 50, at most 200)
+//   - cursor: next_cursor of the previous page, with the same filters and sort
+//
+// Returns:
+//   - 200 OK:
+//     {
+//     "success": true,
+//     "requests": [ ... ],     // as returned by GET /api/leave-requests/:requestId, without attachments
+//     "next_cursor": string    // null on the last page
+//     }
+//   - 400 Bad Request: Invalid filter, sort, limit or cursor
+//   - 500 Internal Server Error: Database error
+func SearchLeaveRequests(c *gin.Context, leaveRequests store.LeaveRequestStore) {
+	query, ok := parseLeaveRequestQuery(c)
+	if !ok {
+		return
+	}
+
+	// Fetch one extra request to learn whether there is another page
+	limit := query.Limit
+	query.Limit++
+	requests, err := leaveRequests.Search(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error searching leave requests: %v", err),
+		})
+		return
+	}
+
+	var nextCursor *string
+	if len(requests) > limit {
+		requests = requests[:limit]
+		cursor := encodeLeaveCursor(requests[limit-1], query.Sort, query.Ascending)
+		nextCursor = &cursor
+	}
+	if requests == nil {
+		requests = []models.LeaveRequest{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"requests":    requests,
+		"next_cursor": nextCursor,
+	})
+}
+
+// parseLeaveRequestQuery reads the search filters, responding with 400 if any is invalid
+func parseLeaveRequestQuery(c *gin.Context) (models.LeaveRequestQuery, bool) {
+	query := models.LeaveRequestQuery{
+		RequestType: strings.TrimSpace(c.Query("type")),
+		YearGroup:   strings.TrimSpace(c.Query("year_group")),
+		Reason:      strings.TrimSpace(c.Query("q")),
+		Sort:        models.LeaveSortCreated,
+		Limit:       defaultLeaveSearchLimit,
+	}
+	fail := func(message string) (models.LeaveRequestQuery, bool) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": message,
+		})
+		return query, false
+	}
+
+	if value := c.Query("status"); value != "" {
+		for _, status := range strings.Split(value, ",") {
+			status = strings.ToLower(strings.TrimSpace(status))
+			if !models.IsLeaveStatus(status) {
+				return fail(fmt.Sprintf("Invalid status '%s', expected one of %s", status, strings.Join(models.LeaveStatuses, ", ")))
+			}
+			query.Statuses = append(query.Statuses, status)
+		}
+	}
+
+	for _, param := range []struct {
+		name string
+		date **time.Time
+	}{{"from", &query.From}, {"to", &query.To}} {
+		if value := c.Query(param.name); value != "" {
+			date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+			if err != nil {
+				return fail(fmt.Sprintf("Invalid %s date '%s', expected YYYY-MM-DD", param.name, value))
+			}
+			*param.date = &date
+		}
+	}
+	if query.From != nil && query.To != nil && query.To.Before(*query.From) {
+		return fail("The to date must not be before the from date")
+	}
+
+	if value := c.Query("responded_by"); value != "" {
+		staffID, err := strconv.Atoi(value)
+		if err != nil || staffID <= 0 {
+			return fail(fmt.Sprintf("Invalid staff ID format: %s", value))
+		}
+		query.RespondedBy = staffID
+	}
+
+	switch value := c.DefaultQuery("sort", models.LeaveSortCreated); value {
+	case models.LeaveSortCreated, models.LeaveSortLeaveDate:
+		query.Sort = value
+	default:
+		return fail(fmt.Sprintf("Invalid sort '%s', expected created_at or leave_date", value))
+	}
+	switch value := c.DefaultQuery("order", "desc"); value {
+	case "desc":
+	case "asc":
+		query.Ascending = true
+	default:
+		return fail(fmt.Sprintf("Invalid order '%s', expected asc or desc", value))
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxLeaveSearchLimit {
+			return fail(fmt.Sprintf("Invalid limit '%s', expected 1 to %d", value, maxLeaveSearchLimit))
+		}
+		query.Limit = limit
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := decodeLeaveCursor(value, query.Sort, query.Ascending)
+		if err != nil {
+			return fail("Invalid cursor: " + err.Error())
+		}
+		query.After = cursor
+	}
+
+	return query, true
+}
+
+// leaveCursor is the encoded form of a models.LeaveRequestCursor, which also names
+// the sort and order it belongs to
+type leaveCursor struct {
+	models.LeaveRequestCursor
+	Sort      string `json:"s"`
+	Ascending bool   `json:"a,omitempty"`
+}
+
+// encodeLeaveCursor returns the cursor continuing after request in the given sort
+// and order
+func encodeLeaveCursor(request models.LeaveRequest, sort string, ascending bool) string {
+	cursor := leaveCursor{Sort: sort, Ascending: ascending}
+	cursor.ID = request.ID
+	cursor.Value = request.CreatedAt.Format(leaveCursorTimeFormat)
+	if sort == models.LeaveSortLeaveDate {
+		cursor.Value = request.LeaveDate
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeLeaveCursor reads a cursor made by encodeLeaveCursor for the same sort and order
+func decodeLeaveCursor(value string, sort string, ascending bool) (*models.LeaveRequestCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("not a cursor returned by this endpoint")
+	}
+	var cursor leaveCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID <= 0 {
+		return nil, fmt.Errorf("not a cursor returned by this endpoint")
+	}
+	if cursor.Sort != sort {
+		return nil, fmt.Errorf("the cursor belongs to a search sorted by %s", cursor.Sort)
+	}
+	if cursor.Ascending != ascending {
+		order := "desc"
+		if cursor.Ascending {
+			order = "asc"
+		}
+		return nil, fmt.Errorf("the cursor belongs to a search in %s order", order)
+	}
+
+	layout := leaveCursorTimeFormat
+	if sort == models.LeaveSortLeaveDate {
+		layout = "2006-01-02"
+	}
+	if _, err := time.Parse(layout, cursor.Value); err != nil {
+		return nil, fmt.Errorf("not a cursor returned by this endpoint")
+	}
+	return &cursor.LeaveRequestCursor, nil
+}
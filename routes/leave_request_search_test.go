@@ -0,0 +1,43 @@
+package routes
+
+import (
+	"testing"
+	"time"
+
+	"server/models"
+)
+
+func TestLeaveCursorMustMatchTheSearch(t *testing.T) {
+	request := models.LeaveRequest{ID: 42, LeaveDate: "2026-10-14", CreatedAt: time.Date(2026, 10, 12, 9, 30, 15, 123456000, time.UTC)}
+
+	for _, sort := range []string{models.LeaveSortCreated, models.LeaveSortLeaveDate} {
+		for _, ascending := range []bool{false, true} {
+			cursor := encodeLeaveCursor(request, sort, ascending)
+
+			decoded, err := decodeLeaveCursor(cursor, sort, ascending)
+			if err != nil {
+				t.Fatalf("%s ascending=%t: decoding its own cursor: %v", sort, ascending, err)
+			}
+			if decoded.ID != request.ID {
+				t.Fatalf("%s ascending=%t: got ID %d, want %d", sort, ascending, decoded.ID, request.ID)
+			}
+
+			if _, err := decodeLeaveCursor(cursor, sort, !ascending); err == nil {
+				t.Fatalf("%s ascending=%t: accepted the cursor in the opposite order", sort, ascending)
+			}
+			otherSort := models.LeaveSortCreated
+			if sort == otherSort {
+				otherSort = models.LeaveSortLeaveDate
+			}
+			if _, err := decodeLeaveCursor(cursor, otherSort, ascending); err == nil {
+				t.Fatalf("%s ascending=%t: accepted the cursor sorted by %s", sort, ascending, otherSort)
+			}
+		}
+	}
+
+	for _, bad := range []string{"!", "bm90IGpzb24", "e30"} {
+		if _, err := decodeLeaveCursor(bad, models.LeaveSortCreated, false); err == nil {
+			t.Fatalf("accepted the cursor %q", bad)
+		}
+	}
+}
@@ -1,33 +1,39 @@
 package routes
 
 import (
-	"bytes"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"server/config"
+	"server/jobs"
+	"server/middleware"
 	"server/models"
-	"server/notifications"
+	"server/store"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// SetupLeaveRequestRoutes registers all the routes for leave requests
-func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
+// SetupLeaveRequestRoutes registers all the routes for leave requests. New requests
+// are pushed to staff, and approving a request marks the student's attendance for
+// the days it covers.
+func SetupLeaveRequestRoutes(router *gin.RouterGroup, leaveRequests store.LeaveRequestStore, attendance store.AttendanceStore, attachments store.LeaveAttachmentStore, notifier *jobs.LeaveNotifier, liveActivities *jobs.LeaveLiveActivities) {
 	// Create a new leave request
-	router.POST("/leave-requests", func(c *gin.Context) {
-		// Reset everything at the beginning of the function to prevent cross-request caching
+	router.POST("/leave-requests", middleware.RequireRoles(models.RoleStudent), func(c *gin.Context) {
 		var requestData struct {
-			StudentID         int     `json:"student_id" binding:"required"`
-			StudentName       string  `json:"student_name" binding:"required"`
-			RequestType       string  `json:"request_type" binding:"required"`
-			Reason            *string `json:"reason"`
-			LiveActivityId    *string `json:"live_activity_id"`
-			LiveActivityToken *string `json:"live_activity_token"`
+			StudentID         int        `json:"student_id"`
+			RequestType       string     `json:"request_type" binding:"required"`
+			Reason            *string    `json:"reason"`
+			LeaveDate         string     `json:"leave_date"`     // YYYY-MM-DD, defaults to today
+			LeaveEndDate      *string    `json:"leave_end_date"` // YYYY-MM-DD, for leave over several days
+			StartsAt          *time.Time `json:"starts_at"`      // RFC 3339, when leaving within a day
+			EndsAt            *time.Time `json:"ends_at"`        // RFC 3339, when the student is due back
+			LiveActivityId    *string    `json:"live_activity_id"`
+			LiveActivityToken *string    `json:"live_activity_token"`
 		}
 
 		if err := c.BindJSON(&requestData); err != nil {
@@ -39,77 +45,57 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 			return
 		}
 
-		// ANTI-CACHE: Print the raw request body for validation
-		rawData, _ := c.GetRawData()
-		log.Printf("📋 RAW REQUEST BODY: %s", string(rawData))
+		// Students can only create leave requests for themselves
+		user, _ := middleware.CurrentUser(c)
+		if requestData.StudentID != 0 && requestData.StudentID != user.ID {
+			c.JSON(http.StatusForbidden, models.LeaveRequestResponse{
+				Success: false,
+				Message: "You can only create leave requests for yourself",
+			})
+			return
+		}
+		requestData.StudentID = user.ID
 
-		log.Printf("🚫 CACHE RESET: Ensuring fresh values for this request")
-		log.Printf("Creating leave request for student %s (ID: %d)", requestData.StudentName, requestData.StudentID)
-		log.Printf("Request type: %s", requestData.RequestType)
-		if requestData.Reason != nil {
-			log.Printf("Reason: %s", *requestData.Reason)
+		if err := validateLeaveDates(requestData.LeaveDate, requestData.LeaveEndDate); err != nil {
+			c.JSON(http.StatusBadRequest, models.LeaveRequestResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+		if err := validateLeaveTimes(requestData.StartsAt, requestData.EndsAt); err != nil {
+			c.JSON(http.StatusBadRequest, models.LeaveRequestResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+		// Leave that starts at a given time is on that day unless a date is given
+		if requestData.LeaveDate == "" && requestData.StartsAt != nil {
+			requestData.LeaveDate = requestData.StartsAt.Local().Format("2006-01-02")
 		}
 
-		// Direct database insertion with no intermediate variables
-		var leaveRequest models.LeaveRequest
-		var err error
+		log.Printf("Creating leave request for student %s (ID: %d)", user.Name, requestData.StudentID)
+		log.Printf("Request type: %s", requestData.RequestType)
+
+		leaveRequest := models.LeaveRequest{
+			StudentID:    requestData.StudentID,
+			StudentName:  user.Name,
+			RequestType:  requestData.RequestType,
+			Reason:       requestData.Reason,
+			LeaveDate:    requestData.LeaveDate,
+			LeaveEndDate: requestData.LeaveEndDate,
+			StartsAt:     localTime(requestData.StartsAt),
+			EndsAt:       localTime(requestData.EndsAt),
+		}
 
+		// The Live Activity is only tracked when both its ID and push token are known
 		if requestData.LiveActivityId != nil && requestData.LiveActivityToken != nil {
-			// Log incoming token for verification
-			log.Printf("🛑 DIRECT INSERT: Using token directly from request")
-			log.Printf("📱 Activity ID from request: %s", *requestData.LiveActivityId)
-			log.Printf("🔑 Token from request: %s", *requestData.LiveActivityToken)
-
-			// Simplified insertion with direct parameter passing
-			err = db.QueryRow(`
-				INSERT INTO leave_requests 
-				(student_id, student_name, request_type, reason, status, live_activity_id, live_activity_token) 
-				VALUES ($1, $2, $3, $4, 'pending', $5, $6) 
-				RETURNING id, student_id, student_name, request_type, reason, status, created_at, updated_at, 
-						  live_activity_id, live_activity_token`,
-				requestData.StudentID,
-				requestData.StudentName,
-				requestData.RequestType,
-				requestData.Reason,
-				*requestData.LiveActivityId,    // Direct use
-				*requestData.LiveActivityToken, // Direct use - added comma here
-			).Scan(
-				&leaveRequest.ID,
-				&leaveRequest.StudentID,
-				&leaveRequest.StudentName,
-				&leaveRequest.RequestType,
-				&leaveRequest.Reason,
-				&leaveRequest.Status,
-				&leaveRequest.CreatedAt,
-				&leaveRequest.UpdatedAt,
-				&leaveRequest.LiveActivityId,
-				&leaveRequest.LiveActivityToken,
-			)
-		} else {
-			// Handle request without live activity info
-			log.Printf("ℹ️ No live activity info in request")
-			err = db.QueryRow(`
-				INSERT INTO leave_requests 
-				(student_id, student_name, request_type, reason, status) 
-				VALUES ($1, $2, $3, $4, 'pending') 
-				RETURNING id, student_id, student_name, request_type, reason, status, created_at, updated_at`,
-				requestData.StudentID,
-				requestData.StudentName,
-				requestData.RequestType,
-				requestData.Reason,
-			).Scan(
-				&leaveRequest.ID,
-				&leaveRequest.StudentID,
-				&leaveRequest.StudentName,
-				&leaveRequest.RequestType,
-				&leaveRequest.Reason,
-				&leaveRequest.Status,
-				&leaveRequest.CreatedAt,
-				&leaveRequest.UpdatedAt,
-			)
+			leaveRequest.LiveActivityId = requestData.LiveActivityId
+			leaveRequest.LiveActivityToken = requestData.LiveActivityToken
 		}
 
-		if err != nil {
+		if err := leaveRequests.Create(&leaveRequest); err != nil {
 			log.Printf("Error creating leave request: %v", err)
 			c.JSON(http.StatusInternalServerError, models.LeaveRequestResponse{
 				Success: false,
@@ -120,41 +106,10 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 
 		log.Printf("✅ Successfully created leave request #%d for %s", leaveRequest.ID, leaveRequest.StudentName)
 
-		// Verify what was actually saved
-		if leaveRequest.LiveActivityId != nil && leaveRequest.LiveActivityToken != nil {
-			log.Printf("🔍 VERIFICATION - SAVED VALUES:")
-			log.Printf("📱 Saved Activity ID: %s", *leaveRequest.LiveActivityId)
-			log.Printf("🔑 Saved Token: %s", *leaveRequest.LiveActivityToken)
-
-			// Double-check against what was in the request
-			if requestData.LiveActivityToken != nil {
-				if *leaveRequest.LiveActivityToken != *requestData.LiveActivityToken {
-					log.Printf("❌ CRITICAL ERROR: Token mismatch between request and database!")
-					log.Printf("❌ Request token: %s", *requestData.LiveActivityToken)
-					log.Printf("❌ Saved token: %s", *leaveRequest.LiveActivityToken)
-
-					// Immediately fix with a direct update
-					log.Printf("🔄 Attempting immediate fix with direct update...")
-					_, updateErr := db.Exec(`
-						UPDATE leave_requests 
-						SET live_activity_token = $1
-						WHERE id = $2`,
-						*requestData.LiveActivityToken,
-						leaveRequest.ID)
-
-					if updateErr != nil {
-						log.Printf("❌ Fix failed: %v", updateErr)
-					} else {
-						log.Printf("✅ Token directly corrected in database")
-						// Replace the token in returned object too
-						tokenCopy := *requestData.LiveActivityToken
-						leaveRequest.LiveActivityToken = &tokenCopy
-					}
-				} else {
-					log.Printf("✅ Token verification successful - saved token matches request token")
-				}
-			}
-		}
+		// Tell the homeroom teacher and duty staff instead of leaving them to poll
+		notifier.NotifyCreated(leaveRequest)
+		// Start the student's Live Activity remotely if the app did not start one
+		liveActivities.Start(leaveRequest)
 
 		// Return the leave request
 		c.JSON(http.StatusCreated, models.LeaveRequestResponse{
@@ -163,16 +118,14 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 		})
 	})
 
-	// Get a list of all pending leave requests (for staff members)
-	router.GET("/leave-requests/pending", func(c *gin.Context) {
-		rows, err := db.Query(`
-			SELECT id, student_id, student_name, request_type, reason, status, 
-			       created_at, updated_at, responded_by, response_time, 
-			       live_activity_id, live_activity_token
-			FROM leave_requests 
-			WHERE status = 'pending'
-			ORDER BY created_at DESC`)
+	// Search leave requests with filters and cursor pagination (for staff members)
+	router.GET("/leave-requests", middleware.RequireRoles(models.RoleStaff), func(c *gin.Context) {
+		SearchLeaveRequests(c, leaveRequests)
+	})
 
+	// Get a list of all pending leave requests (for staff members)
+	router.GET("/leave-requests/pending", middleware.RequireRoles(models.RoleStaff), func(c *gin.Context) {
+		requests, err := leaveRequests.ListByStatus(models.LeavePending)
 		if err != nil {
 			log.Printf("Error getting pending leave requests: %v", err)
 			c.JSON(http.StatusInternalServerError, models.LeaveRequestsResponse{
@@ -181,19 +134,24 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 			})
 			return
 		}
-		defer rows.Close()
 
-		var requests []models.LeaveRequest
-		for rows.Next() {
-			var req models.LeaveRequest
-			if err := rows.Scan(
-				&req.ID, &req.StudentID, &req.StudentName, &req.RequestType,
-				&req.Reason, &req.Status, &req.CreatedAt, &req.UpdatedAt,
-				&req.RespondedBy, &req.ResponseTime, &req.LiveActivityId, &req.LiveActivityToken); err != nil {
-				log.Printf("Error scanning leave request: %v", err)
-				continue
-			}
-			requests = append(requests, req)
+		c.JSON(http.StatusOK, models.LeaveRequestsResponse{
+			Success:  true,
+			Requests: requests,
+		})
+	})
+
+	// Get approved leave requests whose student is past their end time and has not
+	// checked back in (for staff members)
+	router.GET("/leave-requests/overdue", middleware.RequireRoles(models.RoleStaff), func(c *gin.Context) {
+		requests, err := leaveRequests.ListOverdue(time.Now())
+		if err != nil {
+			log.Printf("Error getting overdue leave requests: %v", err)
+			c.JSON(http.StatusInternalServerError, models.LeaveRequestsResponse{
+				Success: false,
+				Message: "Failed to get overdue leave requests: " + err.Error(),
+			})
+			return
 		}
 
 		c.JSON(http.StatusOK, models.LeaveRequestsResponse{
@@ -203,7 +161,7 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 	})
 
 	// Get all leave requests for a specific student
-	router.GET("/leave-requests/student/:studentId", func(c *gin.Context) {
+	router.GET("/leave-requests/student/:studentId", middleware.RequireSelfOrRoles("studentId", models.RoleStaff), func(c *gin.Context) {
 		studentIdStr := c.Param("studentId")
 		studentId, err := strconv.Atoi(studentIdStr)
 		if err != nil {
@@ -214,14 +172,7 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 			return
 		}
 
-		rows, err := db.Query(`
-			SELECT id, student_id, student_name, request_type, reason, status, 
-			       created_at, updated_at, responded_by, response_time, 
-			       live_activity_id, live_activity_token
-			FROM leave_requests 
-			WHERE student_id = $1
-			ORDER BY created_at DESC`, studentId)
-
+		requests, err := leaveRequests.ListByStudent(studentId)
 		if err != nil {
 			log.Printf("Error getting student leave requests: %v", err)
 			c.JSON(http.StatusInternalServerError, models.LeaveRequestsResponse{
@@ -230,20 +181,6 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 			})
 			return
 		}
-		defer rows.Close()
-
-		var requests []models.LeaveRequest
-		for rows.Next() {
-			var req models.LeaveRequest
-			if err := rows.Scan(
-				&req.ID, &req.StudentID, &req.StudentName, &req.RequestType,
-				&req.Reason, &req.Status, &req.CreatedAt, &req.UpdatedAt,
-				&req.RespondedBy, &req.ResponseTime, &req.LiveActivityId, &req.LiveActivityToken); err != nil {
-				log.Printf("Error scanning leave request: %v", err)
-				continue
-			}
-			requests = append(requests, req)
-		}
 
 		c.JSON(http.StatusOK, models.LeaveRequestsResponse{
 			Success:  true,
@@ -252,7 +189,7 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 	})
 
 	// Update the status of a leave request (approve/reject)
-	router.PUT("/leave-requests/:requestId/status", func(c *gin.Context) {
+	router.PUT("/leave-requests/:requestId/status", middleware.RequireRoles(models.RoleStaff), func(c *gin.Context) {
 		requestIdStr := c.Param("requestId")
 		requestId, err := strconv.Atoi(requestIdStr)
 		if err != nil {
@@ -264,9 +201,8 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 		}
 
 		var updateData struct {
-			Status    string `json:"status" binding:"required"`
-			StaffID   int    `json:"staff_id" binding:"required"`
-			StaffName string `json:"staff_name"`
+			Status  string `json:"status" binding:"required"`
+			StaffID int    `json:"staff_id"`
 		}
 
 		if err := c.BindJSON(&updateData); err != nil {
@@ -277,8 +213,12 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 			return
 		}
 
+		// The responding staff member is always the authenticated caller
+		staff, _ := middleware.CurrentUser(c)
+		updateData.StaffID = staff.ID
+
 		// Validate status
-		if updateData.Status != "approved" && updateData.Status != "rejected" && updateData.Status != "finished" {
+		if !isStaffLeaveStatus(updateData.Status) {
 			c.JSON(http.StatusBadRequest, models.LeaveRequestResponse{
 				Success: false,
 				Message: "Invalid status value. Must be 'approved', 'rejected', or 'finished'",
@@ -289,40 +229,36 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 		// Get current time for response_time
 		responseTime := time.Now()
 
-		// First get the existing request to check if it has live activity info
-		var existingRequest models.LeaveRequest
-		err = db.QueryRow(`
-			SELECT id, live_activity_id, live_activity_token
-			FROM leave_requests
-			WHERE id = $1`, requestId).Scan(
-			&existingRequest.ID, &existingRequest.LiveActivityId, &existingRequest.LiveActivityToken)
-
+		leaveRequest, err := leaveRequests.Transition(requestId, updateData.Status, updateData.StaffID, responseTime)
 		if err != nil {
-			if err == sql.ErrNoRows {
-				c.JSON(http.StatusNotFound, models.LeaveRequestResponse{
-					Success: false,
-					Message: "Leave request not found",
-				})
-				return
-			}
-			log.Printf("Error getting existing leave request: %v", err)
+			respondLeaveTransitionError(c, err)
+			return
 		}
 
-		// Update the leave request status
-		var leaveRequest models.LeaveRequest
-		err = db.QueryRow(`
-			UPDATE leave_requests 
-			SET status = $1, responded_by = $2, response_time = $3, updated_at = $3
-			WHERE id = $4
-			RETURNING id, student_id, student_name, request_type, reason, status, 
-			          created_at, updated_at, responded_by, response_time, 
-			          live_activity_id, live_activity_token`,
-			updateData.Status, updateData.StaffID, responseTime, requestId).Scan(
-			&leaveRequest.ID, &leaveRequest.StudentID, &leaveRequest.StudentName,
-			&leaveRequest.RequestType, &leaveRequest.Reason, &leaveRequest.Status,
-			&leaveRequest.CreatedAt, &leaveRequest.UpdatedAt, &leaveRequest.RespondedBy,
-			&leaveRequest.ResponseTime, &leaveRequest.LiveActivityId, &leaveRequest.LiveActivityToken)
+		syncLeaveAttendance(attendance, *leaveRequest, staff)
+
+		// Show the response on the student's Live Activity, ending it if the request is over
+		liveActivities.Sync(*leaveRequest, staff.Name, responseTime)
+
+		// Return the updated leave request
+		c.JSON(http.StatusOK, models.LeaveRequestResponse{
+			Success: true,
+			Request: leaveRequest,
+		})
+	})
+
+	// Check a student back in from approved leave, finishing the request
+	router.POST("/leave-requests/:requestId/return", middleware.RequireRoles(models.RoleStudent), func(c *gin.Context) {
+		requestId, err := strconv.Atoi(c.Param("requestId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.LeaveRequestResponse{
+				Success: false,
+				Message: "Invalid request ID",
+			})
+			return
+		}
 
+		existingRequest, err := leaveRequests.GetByID(requestId)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				c.JSON(http.StatusNotFound, models.LeaveRequestResponse{
@@ -331,25 +267,36 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 				})
 				return
 			}
-
-			log.Printf("Error updating leave request: %v", err)
+			log.Printf("Error getting existing leave request: %v", err)
 			c.JSON(http.StatusInternalServerError, models.LeaveRequestResponse{
 				Success: false,
-				Message: "Failed to update leave request: " + err.Error(),
+				Message: "Failed to get leave request information",
 			})
 			return
 		}
 
-		// If we have live activity info, send push notification
-		if leaveRequest.LiveActivityId != nil && leaveRequest.LiveActivityToken != nil {
-			// Send a push notification to update the Live Activity
-			go sendLiveActivityUpdate(leaveRequest, updateData.StaffName, responseTime)
+		// Only the student on leave can check back in
+		user, _ := middleware.CurrentUser(c)
+		if existingRequest.StudentID != user.ID {
+			c.JSON(http.StatusForbidden, models.LeaveRequestResponse{
+				Success: false,
+				Message: "You are not authorized to return from this request",
+			})
+			return
 		}
 
-		// Return the updated leave request
+		returnTime := time.Now()
+		leaveRequest, err := leaveRequests.Return(requestId, user.ID, returnTime)
+		if err != nil {
+			respondLeaveTransitionError(c, err)
+			return
+		}
+
+		liveActivities.Sync(*leaveRequest, user.Name, returnTime)
+
 		c.JSON(http.StatusOK, models.LeaveRequestResponse{
 			Success: true,
-			Request: &leaveRequest,
+			Request: leaveRequest,
 		})
 	})
 
@@ -366,11 +313,11 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 		}
 
 		var cancelData struct {
-			StudentID int    `json:"student_id" binding:"required"`
+			StudentID int    `json:"student_id"`
 			Reason    string `json:"reason"`
 		}
 
-		if err := c.BindJSON(&cancelData); err != nil {
+		if err := c.ShouldBindJSON(&cancelData); err != nil && err != io.EOF {
 			c.JSON(http.StatusBadRequest, models.LeaveRequestResponse{
 				Success: false,
 				Message: "Invalid request data: " + err.Error(),
@@ -378,19 +325,15 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 			return
 		}
 
+		// Only the student who owns the request can cancel it
+		user, _ := middleware.CurrentUser(c)
+		cancelData.StudentID = user.ID
+
 		// Get current time for the cancellation timestamp
 		cancellationTime := time.Now()
 
-		// Get the existing request to verify student ID and check if it has live activity info
-		var existingRequest models.LeaveRequest
-		err = db.QueryRow(`
-			SELECT id, student_id, live_activity_id, live_activity_token, status
-			FROM leave_requests
-			WHERE id = $1`, requestId).Scan(
-			&existingRequest.ID, &existingRequest.StudentID,
-			&existingRequest.LiveActivityId, &existingRequest.LiveActivityToken,
-			&existingRequest.Status)
-
+		// Get the existing request to verify the owner and its current status
+		existingRequest, err := leaveRequests.GetByID(requestId)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				c.JSON(http.StatusNotFound, models.LeaveRequestResponse{
@@ -416,131 +359,33 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 			return
 		}
 
-		// Check if the request is already finalized
-		if existingRequest.Status == "approved" || existingRequest.Status == "rejected" || existingRequest.Status == "finished" {
-			c.JSON(http.StatusBadRequest, models.LeaveRequestResponse{
-				Success: false,
-				Message: "Cannot cancel a request that has already been " + existingRequest.Status,
-			})
+		// Update the leave request status to cancelled. Approved leave can still be
+		// cancelled, which reverts the attendance it marked.
+		updatedRequest, err := leaveRequests.Transition(requestId, models.LeaveCancelled, user.ID, cancellationTime)
+		if err != nil {
+			respondLeaveTransitionError(c, err)
 			return
 		}
 
-		// Update the leave request status to cancelled
-		var updatedRequest models.LeaveRequest
-		err = db.QueryRow(`
-			UPDATE leave_requests 
-			SET status = 'cancelled', updated_at = $1, response_time = $1
-			WHERE id = $2
-			RETURNING id, student_id, student_name, request_type, reason, status, 
-					  created_at, updated_at, responded_by, response_time, 
-					  live_activity_id, live_activity_token`,
-			cancellationTime, requestId).Scan(
-			&updatedRequest.ID, &updatedRequest.StudentID, &updatedRequest.StudentName,
-			&updatedRequest.RequestType, &updatedRequest.Reason, &updatedRequest.Status,
-			&updatedRequest.CreatedAt, &updatedRequest.UpdatedAt, &updatedRequest.RespondedBy,
-			&updatedRequest.ResponseTime, &updatedRequest.LiveActivityId, &updatedRequest.LiveActivityToken)
-
-		if err != nil {
-			log.Printf("Error updating leave request: %v", err)
-			c.JSON(http.StatusInternalServerError, models.LeaveRequestResponse{
-				Success: false,
-				Message: "Failed to cancel leave request: " + err.Error(),
-			})
-			return
-		}
-
-		// If we have live activity info, send push notification
-		if updatedRequest.LiveActivityId != nil && updatedRequest.LiveActivityToken != nil {
-			// Send a push notification to update the Live Activity
-			go func() {
-				activityId := *updatedRequest.LiveActivityId
-				deviceToken := *updatedRequest.LiveActivityToken
-
-				log.Printf("🔄 Sending cancellation notification for request %d", updatedRequest.ID)
-				log.Printf("🔄 Activity ID: %s", activityId)
-				log.Printf("🔄 Token: %s", deviceToken)
-
-				// Use our exact shell script implementation
-				resp, err := notifications.SendAPNsNotificationExact(
-					deviceToken,
-					activityId,
-					"cancelled", // Always "cancelled" for this endpoint
-					"Student",   // Always "Student" for cancellations
-				)
-
-				if err != nil {
-					log.Printf("❌ Error sending cancellation notification: %v", err)
-
-					// Try fallback approach
-					log.Printf("⚠️ Trying fallback cancellation approach...")
-
-					// Create the exact payload structure
-					timestamp := time.Now().Unix()
-
-					// Create content state with just status for cancelled
-					contentState := map[string]interface{}{
-						"status":       "cancelled",
-						"responseTime": cancellationTime,
-						"respondedBy":  "Student",
-					}
-
-					// Build the exact same structure as the shell script
-					payload := map[string]interface{}{
-						"aps": map[string]interface{}{
-							"event":         "update",
-							"timestamp":     timestamp,
-							"content-state": contentState,
-						},
-						"activity-id": activityId,
-					}
-
-					// Convert payload to JSON
-					jsonPayload, err := json.Marshal(payload)
-					if err != nil {
-						log.Printf("Error marshalling Live Activity payload: %v", err)
-						return
-					}
-
-					log.Printf("📱 Fallback - Sending Live Activity update for cancelled request %d", updatedRequest.ID)
-					log.Printf("Payload: %s", jsonPayload)
-
-					// The bundle ID for Live Activities needs .push-type.liveactivity appended
-					bundleID := "com.leo.hsannu.push-type.liveactivity"
-
-					// ENHANCED LOGGING: Log all details about the notification
-					log.Printf("📲 APNS CANCELLATION DETAILS:")
-					log.Printf("Token: %s", deviceToken)
-					log.Printf("Bundle ID: %s", bundleID)
-					log.Printf("Push Type: liveactivity")
-					log.Printf("Activity ID: %s", activityId)
-
-					// Send the push notification
-					resp, err = notifications.SendAPNsNotification(deviceToken, bundleID, string(jsonPayload), true)
-					if err != nil {
-						log.Printf("❌ Error sending Live Activity update (fallback): %v", err)
-						return
-					}
-				}
+		syncLeaveAttendance(attendance, *updatedRequest, user)
 
-				log.Printf("✅ Live Activity update for cancellation sent successfully: %s", resp)
-			}()
-		}
+		// End the student's Live Activity
+		liveActivities.Sync(*updatedRequest, "Student", cancellationTime)
 
 		// Return the updated leave request
 		c.JSON(http.StatusOK, models.LeaveRequestResponse{
 			Success: true,
-			Request: &updatedRequest,
+			Request: updatedRequest,
 			Message: "Leave request cancelled successfully",
 		})
 	})
 
 	// Bulk update multiple leave requests (for staff efficiency)
-	router.POST("/leave-requests/bulk-update", func(c *gin.Context) {
+	router.POST("/leave-requests/bulk-update", middleware.RequireRoles(models.RoleStaff), func(c *gin.Context) {
 		var bulkUpdateData struct {
 			RequestIDs []int  `json:"request_ids" binding:"required"`
 			Status     string `json:"status" binding:"required"`
-			StaffID    int    `json:"staff_id" binding:"required"`
-			StaffName  string `json:"staff_name"`
+			StaffID    int    `json:"staff_id"`
 		}
 
 		if err := c.BindJSON(&bulkUpdateData); err != nil {
@@ -551,8 +396,12 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 			return
 		}
 
+		// The responding staff member is always the authenticated caller
+		staff, _ := middleware.CurrentUser(c)
+		bulkUpdateData.StaffID = staff.ID
+
 		// Validate status
-		if bulkUpdateData.Status != "approved" && bulkUpdateData.Status != "rejected" && bulkUpdateData.Status != "finished" {
+		if !isStaffLeaveStatus(bulkUpdateData.Status) {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"success": false,
 				"message": "Invalid status value. Must be 'approved', 'rejected', or 'finished'",
@@ -565,38 +414,27 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 
 		// Prepare a slice to hold updated requests
 		var updatedRequests []models.LeaveRequest
-		var failedRequestIDs []int
+		failedRequestIDs := []int{}
+		failures := []gin.H{}
 
-		// Process each request ID
+		// Process each request ID; each one must allow the transition on its own
 		for _, requestId := range bulkUpdateData.RequestIDs {
-			// Update the leave request status
-			var leaveRequest models.LeaveRequest
-			err := db.QueryRow(`
-				UPDATE leave_requests 
-				SET status = $1, responded_by = $2, response_time = $3, updated_at = $3
-				WHERE id = $4
-				RETURNING id, student_id, student_name, request_type, reason, status, 
-						  created_at, updated_at, responded_by, response_time, 
-						  live_activity_id, live_activity_token`,
-				bulkUpdateData.Status, bulkUpdateData.StaffID, responseTime, requestId).Scan(
-				&leaveRequest.ID, &leaveRequest.StudentID, &leaveRequest.StudentName,
-				&leaveRequest.RequestType, &leaveRequest.Reason, &leaveRequest.Status,
-				&leaveRequest.CreatedAt, &leaveRequest.UpdatedAt, &leaveRequest.RespondedBy,
-				&leaveRequest.ResponseTime, &leaveRequest.LiveActivityId, &leaveRequest.LiveActivityToken)
-
+			leaveRequest, err := leaveRequests.Transition(requestId, bulkUpdateData.Status, bulkUpdateData.StaffID, responseTime)
 			if err != nil {
 				log.Printf("Error updating leave request %d: %v", requestId, err)
+				message := "Leave request not found"
+				if err != sql.ErrNoRows {
+					message = leaveTransitionMessage(err)
+				}
 				failedRequestIDs = append(failedRequestIDs, requestId)
+				failures = append(failures, gin.H{"request_id": requestId, "message": message})
 				continue
 			}
 
-			updatedRequests = append(updatedRequests, leaveRequest)
+			updatedRequests = append(updatedRequests, *leaveRequest)
+			syncLeaveAttendance(attendance, *leaveRequest, staff)
 
-			// If we have live activity info, send push notification
-			if leaveRequest.LiveActivityId != nil && leaveRequest.LiveActivityToken != nil {
-				// Send a push notification to update the Live Activity
-				go sendLiveActivityUpdate(leaveRequest, bulkUpdateData.StaffName, responseTime)
-			}
+			liveActivities.Sync(*leaveRequest, staff.Name, responseTime)
 		}
 
 		// Return summary of the operation
@@ -605,12 +443,14 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 				"success":          true,
 				"updated_requests": updatedRequests,
 				"failed_requests":  failedRequestIDs,
+				"failures":         failures,
 				"message":          fmt.Sprintf("Updated %d leave requests, %d failed", len(updatedRequests), len(failedRequestIDs)),
 			})
 		} else {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"success":         false,
 				"failed_requests": failedRequestIDs,
+				"failures":        failures,
 				"message":         "Failed to update any leave requests",
 			})
 		}
@@ -627,18 +467,7 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 			return
 		}
 
-		var leaveRequest models.LeaveRequest
-		err := db.QueryRow(`
-			SELECT id, student_id, student_name, request_type, reason, status, 
-				   created_at, updated_at, responded_by, response_time, 
-				   live_activity_id, live_activity_token
-			FROM leave_requests 
-			WHERE live_activity_id = $1`, activityId).Scan(
-			&leaveRequest.ID, &leaveRequest.StudentID, &leaveRequest.StudentName,
-			&leaveRequest.RequestType, &leaveRequest.Reason, &leaveRequest.Status,
-			&leaveRequest.CreatedAt, &leaveRequest.UpdatedAt, &leaveRequest.RespondedBy,
-			&leaveRequest.ResponseTime, &leaveRequest.LiveActivityId, &leaveRequest.LiveActivityToken)
-
+		leaveRequest, err := leaveRequests.GetByActivityID(activityId)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				c.JSON(http.StatusNotFound, models.LeaveRequestResponse{
@@ -656,10 +485,19 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 			return
 		}
 
+		// Only the owning student and staff can view a leave request
+		if !canViewLeaveRequest(c, *leaveRequest) {
+			c.JSON(http.StatusForbidden, models.LeaveRequestResponse{
+				Success: false,
+				Message: "You are not authorized to view this request",
+			})
+			return
+		}
+
 		// Return the leave request
 		c.JSON(http.StatusOK, models.LeaveRequestResponse{
 			Success: true,
-			Request: &leaveRequest,
+			Request: leaveRequest,
 		})
 	})
 
@@ -675,18 +513,7 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 			return
 		}
 
-		var leaveRequest models.LeaveRequest
-		err = db.QueryRow(`
-			SELECT id, student_id, student_name, request_type, reason, status, 
-			       created_at, updated_at, responded_by, response_time, 
-			       live_activity_id, live_activity_token
-			FROM leave_requests 
-			WHERE id = $1`, requestId).Scan(
-			&leaveRequest.ID, &leaveRequest.StudentID, &leaveRequest.StudentName,
-			&leaveRequest.RequestType, &leaveRequest.Reason, &leaveRequest.Status,
-			&leaveRequest.CreatedAt, &leaveRequest.UpdatedAt, &leaveRequest.RespondedBy,
-			&leaveRequest.ResponseTime, &leaveRequest.LiveActivityId, &leaveRequest.LiveActivityToken)
-
+		leaveRequest, err := leaveRequests.GetByID(requestId)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				c.JSON(http.StatusNotFound, models.LeaveRequestResponse{
@@ -704,10 +531,87 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 			return
 		}
 
+		// Only the owning student and staff can view a leave request
+		if !canViewLeaveRequest(c, *leaveRequest) {
+			c.JSON(http.StatusForbidden, models.LeaveRequestResponse{
+				Success: false,
+				Message: "You are not authorized to view this request",
+			})
+			return
+		}
+
+		// Include the supporting files so staff can review them with the request
+		files, err := attachments.ListByRequest(requestId)
+		if err != nil {
+			log.Printf("Error getting leave request attachments: %v", err)
+			c.JSON(http.StatusInternalServerError, models.LeaveRequestResponse{
+				Success: false,
+				Message: "Failed to get leave request attachments: " + err.Error(),
+			})
+			return
+		}
+		for i := range files {
+			files[i].URL = leaveAttachmentURL(files[i])
+		}
+		leaveRequest.Attachments = files
+
 		// Return the leave request
 		c.JSON(http.StatusOK, models.LeaveRequestResponse{
 			Success: true,
-			Request: &leaveRequest,
+			Request: leaveRequest,
+		})
+	})
+
+	// Get the status changes of a leave request, oldest first
+	router.GET("/leave-requests/:requestId/transitions", func(c *gin.Context) {
+		requestId, err := strconv.Atoi(c.Param("requestId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.LeaveRequestResponse{
+				Success: false,
+				Message: "Invalid request ID",
+			})
+			return
+		}
+
+		leaveRequest, err := leaveRequests.GetByID(requestId)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, models.LeaveRequestResponse{
+					Success: false,
+					Message: "Leave request not found",
+				})
+				return
+			}
+			log.Printf("Error getting leave request: %v", err)
+			c.JSON(http.StatusInternalServerError, models.LeaveRequestResponse{
+				Success: false,
+				Message: "Failed to get leave request: " + err.Error(),
+			})
+			return
+		}
+
+		// Only the owning student and staff can view a leave request
+		if !canViewLeaveRequest(c, *leaveRequest) {
+			c.JSON(http.StatusForbidden, models.LeaveRequestResponse{
+				Success: false,
+				Message: "You are not authorized to view this request",
+			})
+			return
+		}
+
+		transitions, err := leaveRequests.ListTransitions(requestId)
+		if err != nil {
+			log.Printf("Error getting leave request transitions: %v", err)
+			c.JSON(http.StatusInternalServerError, models.LeaveRequestResponse{
+				Success: false,
+				Message: "Failed to get leave request history: " + err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":     true,
+			"transitions": transitions,
 		})
 	})
 
@@ -723,13 +627,6 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 			return
 		}
 
-		// ANTI-CACHE: Print the raw request body for validation
-		rawData, _ := c.GetRawData()
-		log.Printf("📋 RAW UPDATE REQUEST BODY: %s", string(rawData))
-
-		// Need to re-bind after reading raw data
-		c.Request.Body = io.NopCloser(bytes.NewBuffer(rawData))
-
 		var updateData struct {
 			LiveActivityId    string `json:"live_activity_id" binding:"required"`
 			LiveActivityToken string `json:"live_activity_token" binding:"required"`
@@ -743,30 +640,8 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 			return
 		}
 
-		log.Printf("🚫 CACHE RESET: Ensuring fresh values for live activity update")
-		log.Printf("🎯 Updating Live Activity for request ID %d:", requestId)
-		log.Printf("📱 Activity ID from request: %s", updateData.LiveActivityId)
-		log.Printf("🔑 Token from request: %s", updateData.LiveActivityToken)
-
-		// Direct update with no intermediate variables
-		var leaveRequest models.LeaveRequest
-		err = db.QueryRow(`
-			UPDATE leave_requests 
-			SET live_activity_id = $1, live_activity_token = $2, updated_at = NOW()
-			WHERE id = $3
-			RETURNING id, student_id, student_name, request_type, reason, status, 
-					  created_at, updated_at, responded_by, response_time, 
-					  live_activity_id, live_activity_token`,
-			updateData.LiveActivityId,
-			updateData.LiveActivityToken,
-			requestId,
-		).Scan(
-			&leaveRequest.ID, &leaveRequest.StudentID, &leaveRequest.StudentName,
-			&leaveRequest.RequestType, &leaveRequest.Reason, &leaveRequest.Status,
-			&leaveRequest.CreatedAt, &leaveRequest.UpdatedAt, &leaveRequest.RespondedBy,
-			&leaveRequest.ResponseTime, &leaveRequest.LiveActivityId, &leaveRequest.LiveActivityToken,
-		)
-
+		// Only the student who owns the request can attach a Live Activity to it
+		existingRequest, err := leaveRequests.GetByID(requestId)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				c.JSON(http.StatusNotFound, models.LeaveRequestResponse{
@@ -775,165 +650,221 @@ func SetupLeaveRequestRoutes(router *gin.RouterGroup, db *sql.DB) {
 				})
 				return
 			}
-
-			log.Printf("Error updating live activity info: %v", err)
+			log.Printf("Error getting leave request owner: %v", err)
 			c.JSON(http.StatusInternalServerError, models.LeaveRequestResponse{
 				Success: false,
-				Message: "Failed to update live activity info: " + err.Error(),
+				Message: "Failed to get leave request information",
 			})
 			return
 		}
-
-		// Verify the saved data
-		log.Printf("🔍 VERIFICATION - UPDATED VALUES:")
-		if leaveRequest.LiveActivityId != nil {
-			log.Printf("📱 Updated Activity ID: %s", *leaveRequest.LiveActivityId)
+		if user, _ := middleware.CurrentUser(c); user.ID != existingRequest.StudentID {
+			c.JSON(http.StatusForbidden, models.LeaveRequestResponse{
+				Success: false,
+				Message: "You are not authorized to update this request",
+			})
+			return
+		}
+		// The activity of a request that is over has already been ended
+		if models.IsFinalLeaveStatus(existingRequest.Status) {
+			c.JSON(http.StatusConflict, models.LeaveRequestResponse{
+				Success: false,
+				Message: fmt.Sprintf("Cannot attach a Live Activity to a %s leave request", existingRequest.Status),
+			})
+			return
 		}
-		if leaveRequest.LiveActivityToken != nil {
-			log.Printf("🔑 Updated Token: %s", *leaveRequest.LiveActivityToken)
-
-			// Verify the update was successful
-			if *leaveRequest.LiveActivityToken != updateData.LiveActivityToken {
-				log.Printf("❌ CRITICAL ERROR: Token mismatch after update!")
-				log.Printf("❌ Request token: %s", updateData.LiveActivityToken)
-				log.Printf("❌ Saved token: %s", *leaveRequest.LiveActivityToken)
 
-				// Fix with a direct update
-				log.Printf("🔄 Forcing direct update...")
-				_, fixErr := db.Exec(`
-					UPDATE leave_requests 
-					SET live_activity_token = $1
-					WHERE id = $2`,
-					updateData.LiveActivityToken,
-					requestId)
+		log.Printf("🎯 Updating Live Activity for request ID %d: activity %s", requestId, updateData.LiveActivityId)
 
-				if fixErr != nil {
-					log.Printf("❌ Fix failed: %v", fixErr)
-				} else {
-					log.Printf("✅ Token directly corrected in database")
-					// Update the returned object
-					tokenCopy := updateData.LiveActivityToken
-					leaveRequest.LiveActivityToken = &tokenCopy
-				}
-			} else {
-				log.Printf("✅ Token update verified")
+		leaveRequest, err := leaveRequests.SetLiveActivity(requestId, updateData.LiveActivityId, updateData.LiveActivityToken)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, models.LeaveRequestResponse{
+					Success: false,
+					Message: "Leave request not found",
+				})
+				return
 			}
+
+			log.Printf("Error updating live activity info: %v", err)
+			c.JSON(http.StatusInternalServerError, models.LeaveRequestResponse{
+				Success: false,
+				Message: "Failed to update live activity info: " + err.Error(),
+			})
+			return
 		}
 
 		// Return the updated leave request
 		c.JSON(http.StatusOK, models.LeaveRequestResponse{
 			Success: true,
-			Request: &leaveRequest,
+			Request: leaveRequest,
 		})
 	})
 }
 
-// Struct for Live Activity update payload
-type LiveActivityPayload struct {
-	APS struct {
-		Event        string `json:"event"`
-		Timestamp    int64  `json:"timestamp"`
-		ContentState struct {
-			Status       string     `json:"status"`
-			ResponseTime *time.Time `json:"responseTime"`
-			RespondedBy  string     `json:"respondedBy"`
-		} `json:"content-state"`
-	} `json:"aps"`
-	ActivityId string `json:"activity-id"`
-}
+// maxLeaveDays limits how many days one leave request may cover, since approving it
+// writes a record for every day
+const maxLeaveDays = 31
 
-// Send a push notification to update a Live Activity
-func sendLiveActivityUpdate(request models.LeaveRequest, staffName string, responseTime time.Time) {
-	if request.LiveActivityId == nil || request.LiveActivityToken == nil {
-		log.Println("⚠️ Missing Live Activity info for leave request:", request.ID)
-		return
+// validateLeaveDates checks the optional first and last day of a new leave request
+func validateLeaveDates(start string, end *string) error {
+	first := time.Now()
+	if start != "" {
+		date, err := time.ParseInLocation("2006-01-02", start, time.Local)
+		if err != nil {
+			return fmt.Errorf("Invalid leave_date '%s', expected YYYY-MM-DD", start)
+		}
+		first = date
+	}
+	if end == nil {
+		return nil
 	}
 
-	// Make explicit copies to prevent caching issues
-	activityId := *request.LiveActivityId
-	deviceToken := *request.LiveActivityToken
-
-	// Log original values from request
-	log.Printf("🔍 VERIFICATION - sendLiveActivityUpdate called for:")
-	log.Printf("🔍 Request ID: %d", request.ID)
-	log.Printf("🔍 Original Activity ID: %s", activityId)
-	log.Printf("🔍 Original Token: %s", deviceToken)
-	log.Printf("🔍 Token Length: %d", len(deviceToken))
-	log.Printf("🔍 Status: %s", request.Status)
-	log.Printf("🔍 Staff Name: %s", staffName)
-
-	// Use our new function that exactly mimics the shell script
-	// This completely bypasses the old APNS library and uses direct HTTP
-	resp, err := notifications.SendAPNsNotificationExact(
-		deviceToken,
-		activityId,
-		request.Status,
-		staffName,
-	)
-
+	last, err := time.ParseInLocation("2006-01-02", *end, time.Local)
 	if err != nil {
-		log.Printf("❌ Error sending Live Activity update: %v", err)
-
-		// Try the old method as a fallback
-		log.Printf("⚠️ Trying fallback method...")
-
-		// Create a payload that EXACTLY matches the shell script structure
-		timestamp := time.Now().Unix()
+		return fmt.Errorf("Invalid leave_end_date '%s', expected YYYY-MM-DD", *end)
+	}
+	if last.Format("2006-01-02") < first.Format("2006-01-02") {
+		return fmt.Errorf("leave_end_date cannot be before leave_date")
+	}
+	if last.After(time.Date(first.Year(), first.Month(), first.Day()+maxLeaveDays-1, 0, 0, 0, 0, time.Local)) {
+		return fmt.Errorf("Leave can cover at most %d days", maxLeaveDays)
+	}
+	return nil
+}
 
-		var contentState map[string]interface{}
+// validateLeaveTimes checks the optional start and end time of a new leave request
+func validateLeaveTimes(startsAt *time.Time, endsAt *time.Time) error {
+	if startsAt != nil && endsAt != nil && !endsAt.After(*startsAt) {
+		return fmt.Errorf("ends_at must be after starts_at")
+	}
+	return nil
+}
 
-		// Handle status-specific payload structure
-		if request.Status == "pending" {
-			contentState = map[string]interface{}{
-				"status": request.Status,
-				// Explicitly omit responseTime and respondedBy for pending
-			}
-		} else {
-			// For approved, rejected, etc.
-			contentState = map[string]interface{}{
-				"status":       request.Status,
-				"responseTime": responseTime, // Let the JSON marshaling handle the formatting
-				"respondedBy":  staffName,
-			}
-		}
+// localTime converts t to local time, as the leave request timestamps are stored
+// without a time zone
+func localTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	local := t.Local()
+	return &local
+}
 
-		// Build the exact same structure as the shell script
-		payload := map[string]interface{}{
-			"aps": map[string]interface{}{
-				"event":         "update",
-				"timestamp":     timestamp,
-				"content-state": contentState,
-			},
-			"activity-id": activityId,
+// leaveSchoolDays returns the school days a leave request covers
+func leaveSchoolDays(request models.LeaveRequest) []time.Time {
+	first, err := time.ParseInLocation("2006-01-02", request.LeaveDate, time.Local)
+	if err != nil {
+		return nil
+	}
+	last := first
+	if request.LeaveEndDate != nil {
+		if last, err = time.ParseInLocation("2006-01-02", *request.LeaveEndDate, time.Local); err != nil {
+			return nil
 		}
+	}
 
-		// Convert payload to JSON
-		jsonPayload, err := json.Marshal(payload)
-		if err != nil {
-			log.Printf("Error marshalling Live Activity payload: %v", err)
-			return
+	var days []time.Time
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		if jobs.IsSchoolDay(day) {
+			days = append(days, day)
 		}
+	}
+	return days
+}
 
-		log.Printf("📱 Fallback - Sending Live Activity update for request %d with status %s", request.ID, request.Status)
-		log.Printf("Payload: %s", jsonPayload)
+// isStaffLeaveStatus reports whether staff can set a leave request to status
+func isStaffLeaveStatus(status string) bool {
+	return status == models.LeaveApproved || status == models.LeaveRejected || status == models.LeaveFinished
+}
 
-		// The bundle ID for Live Activities needs .push-type.liveactivity appended
-		bundleID := "com.leo.hsannu.push-type.liveactivity"
+// leaveTransitionMessage describes why a leave request's status could not change
+func leaveTransitionMessage(err error) string {
+	var transitionErr *store.TransitionError
+	if errors.As(err, &transitionErr) {
+		return fmt.Sprintf("Cannot change a %s leave request to %s", transitionErr.From, transitionErr.To)
+	}
+	return "Failed to update leave request: " + err.Error()
+}
 
-		// ENHANCED LOGGING: Log all details about the notification
-		log.Printf("📲 APNS DETAILS:")
-		log.Printf("Token: %s", deviceToken)
-		log.Printf("Bundle ID: %s", bundleID)
-		log.Printf("Push Type: liveactivity")
-		log.Printf("Activity ID: %s", activityId)
+// respondLeaveTransitionError maps errors from LeaveRequestStore.Transition to
+// responses: 404 for an unknown request, 409 for a transition the status does not allow
+func respondLeaveTransitionError(c *gin.Context, err error) {
+	var transitionErr *store.TransitionError
+	switch {
+	case err == sql.ErrNoRows:
+		c.JSON(http.StatusNotFound, models.LeaveRequestResponse{
+			Success: false,
+			Message: "Leave request not found",
+		})
+	case errors.As(err, &transitionErr):
+		c.JSON(http.StatusConflict, models.LeaveRequestResponse{
+			Success: false,
+			Message: leaveTransitionMessage(err),
+		})
+	default:
+		log.Printf("Error updating leave request: %v", err)
+		c.JSON(http.StatusInternalServerError, models.LeaveRequestResponse{
+			Success: false,
+			Message: leaveTransitionMessage(err),
+		})
+	}
+}
 
-		// Send the push notification using the copied token
-		resp, err = notifications.SendAPNsNotification(deviceToken, bundleID, string(jsonPayload), true)
-		if err != nil {
-			log.Printf("❌ Error sending Live Activity update (fallback): %v", err)
-			return
+// syncLeaveAttendance marks the student's attendance when a leave request is approved
+// and reverts it when the request is rejected or cancelled. Days whose register is
+// locked are left alone unless the actor is in the attendance office. The request's
+// new status is already saved, so failures are only logged.
+func syncLeaveAttendance(attendance store.AttendanceStore, request models.LeaveRequest, actor *middleware.AuthUser) {
+	from := leaveEditableFrom(actor, time.Now())
+
+	var err error
+	switch request.Status {
+	case models.LeaveApproved:
+		var days []time.Time
+		for _, day := range leaveSchoolDays(request) {
+			if day.Before(from) {
+				log.Printf("Leave request %d: the register for %s is locked, not marking it", request.ID, day.Format("2006-01-02"))
+				continue
+			}
+			days = append(days, day)
 		}
+		status := models.LeaveAttendanceStatus(request.RequestType)
+		err = attendance.ApplyLeave(request.ID, status, days, actor.ID)
+	case models.LeaveRejected, models.LeaveCancelled:
+		if !from.IsZero() {
+			log.Printf("Leave request %d: keeping any records before %s, whose register is locked", request.ID, from.Format("2006-01-02"))
+		}
+		err = attendance.RevertLeave(request.ID, actor.ID, from)
+	default:
+		return
+	}
+	if err != nil {
+		log.Printf("❌ Error syncing attendance for leave request %d (%s): %v", request.ID, request.Status, err)
+	}
+}
+
+// leaveEditableFrom returns the first day whose register actor may change through a
+// leave request at the time now, or the zero time if every day is open to them. Past
+// the lock period only the attendance office can amend a register.
+func leaveEditableFrom(actor *middleware.AuthUser, now time.Time) time.Time {
+	attendanceConfig := config.Get().Attendance
+	if attendanceConfig.LockAfter.Duration <= 0 || actor.HasRole(models.RoleAttendance) {
+		return time.Time{}
 	}
 
-	log.Printf("✅ Live Activity update sent successfully: %s", resp)
+	// Registers lock in date order, so walk back from tomorrow to the last open day
+	day := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.Local)
+	for !attendanceConfig.IsLocked(day.AddDate(0, 0, -1), now) {
+		day = day.AddDate(0, 0, -1)
+	}
+	return day
+}
+
+// canViewLeaveRequest reports whether the caller is the requesting student or a staff member
+func canViewLeaveRequest(c *gin.Context, request models.LeaveRequest) bool {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		return false
+	}
+	return user.ID == request.StudentID || user.HasRole(models.RoleStaff)
 }
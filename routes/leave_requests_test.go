@@ -0,0 +1,227 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"server/jobs"
+	"server/models"
+	"server/store"
+)
+
+// fakeLeaveRequestStore keeps leave requests in memory and enforces the transition
+// rules the same way the Postgres store does
+type fakeLeaveRequestStore struct {
+	store.LeaveRequestStore
+
+	mu       sync.Mutex
+	requests map[int]models.LeaveRequest
+}
+
+func (s *fakeLeaveRequestStore) GetByID(id int) (*models.LeaveRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, ok := s.requests[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &request, nil
+}
+
+func (s *fakeLeaveRequestStore) Transition(id int, status string, actorID int, at time.Time) (*models.LeaveRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, ok := s.requests[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if !models.CanTransitionLeave(request.Status, status) {
+		return nil, &store.TransitionError{From: request.Status, To: status}
+	}
+	request.Status = status
+	request.UpdatedAt = at
+	if status == models.LeaveApproved || status == models.LeaveRejected {
+		request.RespondedBy = &actorID
+	}
+	s.requests[id] = request
+	return &request, nil
+}
+
+// fakeLeaveAttendanceStore records the leave requests whose attendance was marked
+// or reverted
+type fakeLeaveAttendanceStore struct {
+	store.AttendanceStore
+
+	mu       sync.Mutex
+	applied  []int
+	reverted []int
+}
+
+func (s *fakeLeaveAttendanceStore) ApplyLeave(leaveRequestID int, status string, days []time.Time, recordedBy int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.applied = append(s.applied, leaveRequestID)
+	return nil
+}
+
+func (s *fakeLeaveAttendanceStore) RevertLeave(leaveRequestID int, revertedBy int, from time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reverted = append(s.reverted, leaveRequestID)
+	return nil
+}
+
+const (
+	leaveStudentID = 7
+	otherStudentID = 8
+	leaveStaffID   = 20
+)
+
+// newLeaveTestAPI returns an API with the leave request routes, a request in each
+// of the given statuses owned by leaveStudentID, numbered from 1
+func newLeaveTestAPI(t *testing.T, statuses ...string) (*testAPI, *fakeLeaveRequestStore, *fakeLeaveAttendanceStore) {
+	api := newTestAPI(t,
+		models.User{ID: leaveStudentID, Username: "student", Name: "Student", Role: models.RoleStudent},
+		models.User{ID: otherStudentID, Username: "other", Name: "Other Student", Role: models.RoleStudent},
+		models.User{ID: leaveStaffID, Username: "teacher", Name: "Teacher", Role: models.RoleStaff},
+	)
+
+	// A weekday well ahead, so no register is locked
+	leaveDate := time.Now().AddDate(0, 0, 14)
+	for leaveDate.Weekday() == time.Saturday || leaveDate.Weekday() == time.Sunday {
+		leaveDate = leaveDate.AddDate(0, 0, 1)
+	}
+
+	leaveRequests := &fakeLeaveRequestStore{requests: make(map[int]models.LeaveRequest)}
+	for i, status := range statuses {
+		leaveRequests.requests[i+1] = models.LeaveRequest{
+			ID:          i + 1,
+			StudentID:   leaveStudentID,
+			RequestType: "medical",
+			LeaveDate:   leaveDate.Format("2006-01-02"),
+			Status:      status,
+		}
+	}
+	attendance := &fakeLeaveAttendanceStore{}
+
+	liveActivities := jobs.NewLeaveLiveActivities(leaveRequests, api.users)
+	SetupLeaveRequestRoutes(api.group, leaveRequests, attendance, nil, nil, liveActivities)
+	return api, leaveRequests, attendance
+}
+
+func TestStaffLeaveTransitions(t *testing.T) {
+	tests := []struct {
+		from       string
+		to         string
+		want       int
+		wantApply  bool
+		wantRevert bool
+	}{
+		{from: models.LeaveSent, to: models.LeaveApproved, want: http.StatusOK, wantApply: true},
+		{from: models.LeavePending, to: models.LeaveApproved, want: http.StatusOK, wantApply: true},
+		{from: models.LeavePending, to: models.LeaveRejected, want: http.StatusOK, wantRevert: true},
+		{from: models.LeaveApproved, to: models.LeaveFinished, want: http.StatusOK},
+		{from: models.LeaveRejected, to: models.LeaveApproved, want: http.StatusConflict},
+		{from: models.LeaveCancelled, to: models.LeaveApproved, want: http.StatusConflict},
+		{from: models.LeaveFinished, to: models.LeaveRejected, want: http.StatusConflict},
+		{from: models.LeavePending, to: models.LeaveFinished, want: http.StatusConflict},
+		{from: models.LeavePending, to: models.LeaveCancelled, want: http.StatusBadRequest},
+		{from: models.LeavePending, to: models.LeavePending, want: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s to %s", test.from, test.to), func(t *testing.T) {
+			api, leaveRequests, attendance := newLeaveTestAPI(t, test.from)
+
+			var response models.LeaveRequestResponse
+			code := api.do(leaveStaffID, http.MethodPut, "/api/leave-requests/1/status", map[string]string{"status": test.to}, &response)
+			if code != test.want {
+				t.Fatalf("got %d %q, want %d", code, response.Message, test.want)
+			}
+
+			wantStatus := test.from
+			if test.want == http.StatusOK {
+				wantStatus = test.to
+				if response.Request == nil || response.Request.Status != test.to {
+					t.Fatalf("response request: got %+v, want status %s", response.Request, test.to)
+				}
+			}
+			if stored := leaveRequests.requests[1]; stored.Status != wantStatus {
+				t.Fatalf("stored status: got %s, want %s", stored.Status, wantStatus)
+			}
+			if applied := len(attendance.applied) > 0; applied != test.wantApply {
+				t.Fatalf("attendance marked: got %t, want %t", applied, test.wantApply)
+			}
+			if reverted := len(attendance.reverted) > 0; reverted != test.wantRevert {
+				t.Fatalf("attendance reverted: got %t, want %t", reverted, test.wantRevert)
+			}
+		})
+	}
+}
+
+func TestLeaveStatusRequiresStaff(t *testing.T) {
+	api, leaveRequests, _ := newLeaveTestAPI(t, models.LeavePending)
+
+	code := api.do(leaveStudentID, http.MethodPut, "/api/leave-requests/1/status", map[string]string{"status": models.LeaveApproved}, nil)
+	if code != http.StatusForbidden {
+		t.Fatalf("student approving their own request: got %d, want 403", code)
+	}
+	if code := api.do(0, http.MethodPut, "/api/leave-requests/1/status", map[string]string{"status": models.LeaveApproved}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated: got %d, want 401", code)
+	}
+	if status := leaveRequests.requests[1].Status; status != models.LeavePending {
+		t.Fatalf("stored status: got %s, want pending", status)
+	}
+}
+
+func TestLeaveStatusUnknownRequest(t *testing.T) {
+	api, _, _ := newLeaveTestAPI(t)
+
+	if code := api.do(leaveStaffID, http.MethodPut, "/api/leave-requests/99/status", map[string]string{"status": models.LeaveApproved}, nil); code != http.StatusNotFound {
+		t.Fatalf("got %d, want 404", code)
+	}
+}
+
+func TestCancelLeaveRequest(t *testing.T) {
+	tests := []struct {
+		from       string
+		userID     int
+		want       int
+		wantRevert bool
+	}{
+		{from: models.LeavePending, userID: leaveStudentID, want: http.StatusOK, wantRevert: true},
+		{from: models.LeaveApproved, userID: leaveStudentID, want: http.StatusOK, wantRevert: true},
+		{from: models.LeaveRejected, userID: leaveStudentID, want: http.StatusConflict},
+		{from: models.LeaveFinished, userID: leaveStudentID, want: http.StatusConflict},
+		{from: models.LeavePending, userID: otherStudentID, want: http.StatusForbidden},
+		{from: models.LeavePending, userID: leaveStaffID, want: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%s by user %d", test.from, test.userID), func(t *testing.T) {
+			api, leaveRequests, attendance := newLeaveTestAPI(t, test.from)
+
+			var response models.LeaveRequestResponse
+			if code := api.do(test.userID, http.MethodPut, "/api/leave-requests/1/cancel", nil, &response); code != test.want {
+				t.Fatalf("got %d %q, want %d", code, response.Message, test.want)
+			}
+
+			wantStatus := test.from
+			if test.want == http.StatusOK {
+				wantStatus = models.LeaveCancelled
+			}
+			if stored := leaveRequests.requests[1]; stored.Status != wantStatus {
+				t.Fatalf("stored status: got %s, want %s", stored.Status, wantStatus)
+			}
+			if reverted := len(attendance.reverted) > 0; reverted != test.wantRevert {
+				t.Fatalf("attendance reverted: got %t, want %t", reverted, test.wantRevert)
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"server/middleware"
+	"server/models"
+	"server/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLessonRegister returns a teaching group's register for one lesson
+//
+// Endpoint: GET /api/attendance/lessons
+//
+// Parameters:
+//   - code: The subject code (query, e.g., "MATH-SL")
+//   - teaching_group: The teaching group identifier (query)
+//   - date: Day of the lesson in YYYY-MM-DD format (query, defaults to today)
+//   - period: Lesson of the day (query, defaults to 1)
+//
+// Returns:
+//   - 200 OK: Successfully retrieved the register
+//     {
+//     "success": true,
+//     "register": {
+//     "code": string,
+//     "teaching_group": string,
+//     "subject": string,
+//     "date": string,         // YYYY-MM-DD format
+//     "period": int,
+//     "taken": bool,          // false until the register has been saved
+//     "taken_by": int,        // user ID, null if not taken
+//     "updated_at": string,   // timestamp, null if not taken
+//     "students": [
+//     {
+//     "user_id": int,
+//     "name": string,
+//     "status": string       // "Present", "Absent", "Late", "Medical", "Early", or "Pending"
+//     }
+//     ]
+//     }
+//     }
+//   - 400 Bad Request: Missing teaching group, invalid date or period
+//   - 404 Not Found: Teaching group not found
+//   - 500 Internal Server Error: Database error
+func GetLessonRegister(c *gin.Context, lessons store.LessonAttendanceStore) {
+	code, teachingGroup := c.Query("code"), c.Query("teaching_group")
+	if code == "" || teachingGroup == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "code and teaching_group are required",
+		})
+		return
+	}
+
+	date, err := parseAttendanceDate(c.Query("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	period, ok := parseLessonPeriod(c, c.Query("period"))
+	if !ok {
+		return
+	}
+
+	register, err := lessons.GetRegister(code, teachingGroup, date, period)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("Teaching group not found: %s %s", code, teachingGroup),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error querying lesson register: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"register": register,
+	})
+}
+
+// UpdateLessonRegister records the register of one lesson. Only the group's teachers
+// and the attendance office can take it.
+//
+// Endpoint: POST /api/attendance/lessons
+//
+// Request Body:
+//
+//	{
+//	  "code": string,            // e.g., "MATH-SL"
+//	  "teaching_group": string,
+//	  "date": string,            // YYYY-MM-DD format, defaults to today; cannot be in the future
+//	  "period": int,             // defaults to 1
+//	  "students": [
+//	    {
+//	      "user_id": int,
+//	      "status": string       // "Present", "Absent", "Late", "Medical", "Early", or "Pending"
+//	    }
+//	  ]
+//	}
+//
+// Returns:
+//   - 200 OK: Successfully recorded the register
+//     {
+//     "success": true,
+//     "message": "Lesson register updated successfully",
+//     "updatedCount": int
+//     }
+//   - 400 Bad Request: Invalid request, or a student is not in the teaching group
+//   - 403 Forbidden: The caller does not teach the group
+//   - 404 Not Found: Teaching group not found
+//   - 500 Internal Server Error: Database error
+func UpdateLessonRegister(c *gin.Context, lessons store.LessonAttendanceStore) {
+	var request struct {
+		Code          string                    `json:"code"`
+		TeachingGroup string                    `json:"teaching_group"`
+		Date          string                    `json:"date"`
+		Period        int                       `json:"period"`
+		Students      []models.AttendanceUpdate `json:"students"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Invalid request format: %v", err),
+		})
+		return
+	}
+
+	if request.Code == "" || request.TeachingGroup == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "code and teaching_group are required",
+		})
+		return
+	}
+	if request.Period == 0 {
+		request.Period = 1
+	}
+	if request.Period < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Invalid period: %d", request.Period),
+		})
+		return
+	}
+	if !validateAttendanceUpdates(c, request.Students) {
+		return
+	}
+
+	date, err := parseAttendanceDate(request.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// Teachers can only take the registers of their own teaching groups
+	user, _ := middleware.CurrentUser(c)
+	if !user.HasRole(models.RoleAttendance, models.RoleAdmin) {
+		teaches, err := lessons.IsTeacher(request.Code, request.TeachingGroup, user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("Error checking teaching group: %v", err),
+			})
+			return
+		}
+		if !teaches {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "You do not teach this teaching group",
+			})
+			return
+		}
+	}
+
+	err = lessons.RecordRegister(request.Code, request.TeachingGroup, date, request.Period, request.Students, user.ID)
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Teaching group not found: %s %s", request.Code, request.TeachingGroup),
+		})
+		return
+	case store.ErrInvalidReference:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "One or more students are not in this teaching group",
+		})
+		return
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error updating lesson register: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"message":      "Lesson register updated successfully",
+		"updatedCount": len(request.Students),
+	})
+}
+
+// GetStudentSubjectAttendance returns a student's lesson attendance broken down by subject
+//
+// Endpoint: GET /api/attendance/lessons/student/:id
+//
+// Parameters:
+//   - id: The student's user ID (integer)
+//
+// Returns:
+//   - 200 OK: Successfully retrieved the breakdown
+//     {
+//     "success": true,
+//     "subjects": [
+//     {
+//     "subject": string,
+//     "code": string,
+//     "teaching_group": string,
+//     "present": int,
+//     "absent": int,
+//     "late": int,
+//     "medical": int,
+//     "early": int,
+//     "total": int,
+//     "percentage": string // e.g., "95.5%"
+//     }
+//     ]
+//     }
+//   - 400 Bad Request: Invalid student ID format
+//   - 500 Internal Server Error: Database error
+func GetStudentSubjectAttendance(c *gin.Context, lessons store.LessonAttendanceStore) {
+	studentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Invalid student ID format: %s", c.Param("id")),
+		})
+		return
+	}
+
+	subjects, err := lessons.ListStudentSubjects(studentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error querying subject attendance: %v", err),
+		})
+		return
+	}
+
+	response := make([]gin.H, 0, len(subjects))
+	for _, subject := range subjects {
+		total := subject.TotalLessons()
+		percentage := subject.Counts().Rate()
+
+		response = append(response, gin.H{
+			"subject":        subject.Subject,
+			"code":           subject.Code,
+			"teaching_group": subject.TeachingGroup,
+			"present":        subject.Present,
+			"absent":         subject.Absent,
+			"late":           subject.Late,
+			"medical":        subject.Medical,
+			"early":          subject.Early,
+			"total":          total,
+			"percentage":     fmt.Sprintf("%.1f%%", percentage),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"subjects": response,
+	})
+}
+
+// parseLessonPeriod parses the optional period of a lesson, defaulting to 1 and
+// responding with 400 if it is invalid
+func parseLessonPeriod(c *gin.Context, value string) (int, bool) {
+	if value == "" {
+		return 1, true
+	}
+	period, err := strconv.Atoi(value)
+	if err != nil || period < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Invalid period: %s", value),
+		})
+		return 0, false
+	}
+	return period, true
+}
+
+// SetupLessonAttendanceRoutes sets up the per-lesson attendance routes
+func SetupLessonAttendanceRoutes(router gin.IRouter, lessons store.LessonAttendanceStore) {
+	lessonGroup := router.Group("/attendance/lessons")
+	{
+		lessonGroup.GET("", middleware.RequireRoles(models.RoleStaff, models.RoleAttendance, models.RoleAdmin), func(c *gin.Context) {
+			GetLessonRegister(c, lessons)
+		})
+		lessonGroup.POST("", middleware.RequireRoles(models.RoleStaff, models.RoleAttendance, models.RoleAdmin), func(c *gin.Context) {
+			UpdateLessonRegister(c, lessons)
+		})
+		lessonGroup.GET("/student/:id", middleware.RequireSelfOrRoles("id", models.RoleStaff), func(c *gin.Context) {
+			GetStudentSubjectAttendance(c, lessons)
+		})
+	}
+}
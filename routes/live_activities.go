@@ -0,0 +1,94 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"server/middleware"
+	"server/models"
+	"server/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetLiveActivityStartToken registers the caller's Live Activity push-to-start token,
+// so the server can start a leave request's Live Activity when the app did not
+//
+// Endpoint: PUT /api/live-activities/start-token
+//
+// Request Body:
+//
+//	{
+//	  "token": string   // hex push-to-start token from Activity.pushToStartTokenUpdates
+//	}
+//
+// Returns:
+//   - 200 OK: { "success": true }
+//   - 400 Bad Request: Invalid request or missing token
+//   - 500 Internal Server Error: Database error
+func SetLiveActivityStartToken(c *gin.Context, users store.UserStore) {
+	var request struct {
+		Token string `json:"token"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Invalid request format: %v", err),
+		})
+		return
+	}
+	token := strings.TrimSpace(request.Token)
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Push-to-start token is required",
+		})
+		return
+	}
+
+	user, _ := middleware.CurrentUser(c)
+	if err := users.SetLiveActivityStartToken(user.ID, token); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error saving push-to-start token: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// DeleteLiveActivityStartToken forgets the caller's push-to-start token, e.g. on logout
+//
+// Endpoint: DELETE /api/live-activities/start-token
+//
+// Returns:
+//   - 200 OK: { "success": true }
+//   - 500 Internal Server Error: Database error
+func DeleteLiveActivityStartToken(c *gin.Context, users store.UserStore) {
+	user, _ := middleware.CurrentUser(c)
+	if err := users.ClearLiveActivityStartToken(user.ID, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error deleting push-to-start token: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// SetupLiveActivityRoutes sets up the Live Activity push-to-start token routes.
+// Only students have leave request Live Activities started for them.
+func SetupLiveActivityRoutes(router gin.IRouter, users store.UserStore) {
+	tokenGroup := router.Group("/live-activities/start-token", middleware.RequireRoles(models.RoleStudent))
+	{
+		tokenGroup.PUT("", func(c *gin.Context) {
+			SetLiveActivityStartToken(c, users)
+		})
+		tokenGroup.DELETE("", func(c *gin.Context) {
+			DeleteLiveActivityStartToken(c, users)
+		})
+	}
+}
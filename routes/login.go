@@ -1,13 +1,10 @@
 package routes
 
 import (
-	"bytes"
 	"database/sql"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	db "server/database"
-	"server/models"
+	"server/store"
 	"server/utils"
 
 	"github.com/gin-gonic/gin"
@@ -30,19 +27,24 @@ import (
  *     {
  *       "id": number,              // User's ID
  *       "username": string,        // User's username
- *       "password": string,        // User's password (plaintext)
  *       "name": string,           // User's full name
  *       "role": string,           // User's primary role
  *       "status": string,         // User's account status
- *       "additional_roles": string[] // Array of additional roles
+ *       "additional_roles": string[], // Array of additional roles
+ *       "profile_picture": string, // Profile picture path
+ *       "access_token": string,   // Signed bearer token for API requests
+ *       "token_type": "Bearer",
+ *       "expires_in": number,     // Access token lifetime in seconds
+ *       "refresh_token": string,  // Used with POST /token/refresh
+ *       "refresh_token_expires_at": string
  *     }
  *   - 400 Bad Request: Invalid request format
  *   - 401 Unauthorized: Invalid credentials
  *   - 404 Not Found: User not found
  *   - 500 Internal Server Error: Database error
  */
-func RegisterLoginRoute(router gin.IRouter) {
-	router.POST("/login", loginHandler)
+func RegisterLoginRoute(router gin.IRouter, sessions store.SessionStore, users store.UserStore) {
+	router.POST("/login", loginHandler(sessions, users))
 }
 
 /// Example response on successful login:
@@ -53,7 +55,12 @@ func RegisterLoginRoute(router gin.IRouter) {
 ///   "username": "johndoe",
 ///   "name": "John Doe",
 ///   "role": "admin",
-///   "additional_roles": ["manager", "developer"]
+///   "additional_roles": ["manager", "developer"],
+///   "access_token": "eyJhbGciOiJIUzI1NiIs...",
+///   "token_type": "Bearer",
+///   "expires_in": 900,
+///   "refresh_token": "Vx3m...",
+///   "refresh_token_expires_at": "2025-06-01T08:00:00Z"
 /// }
 /// ```
 
@@ -65,148 +72,111 @@ func RegisterLoginRoute(router gin.IRouter) {
  * 2. Checks user credentials against the database
  * 3. Updates device ID if provided
  * 4. Fetches additional roles
- * 5. Returns user data on success
+ * 5. Creates a session and issues access and refresh tokens
+ * 6. Returns user data and tokens on success
  *
- * @param c *gin.Context - The Gin context containing the request
+ * @param sessions store.SessionStore - Login sessions backing the tokens
+ * @param users store.UserStore - User data access
  */
-func loginHandler(c *gin.Context) {
-	// Read the raw request body.
-	rawData, err := c.GetRawData()
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
-		return
-	}
-
-	// Print the raw payload
-	fmt.Printf("DEBUGGER: Incoming Payload: %s\n", string(rawData))
-
-	// Restore the request body so it can be read again by BindJSON
-	c.Request.Body = ioutil.NopCloser(bytes.NewBuffer(rawData))
-
-	// Accept an extra field "deviceID"
-	var loginData struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-		DeviceID string `json:"deviceID"`
-	}
-	if err := c.BindJSON(&loginData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
-		return
-	}
-
-	if loginData.Username == "" || loginData.Password == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Username and password are required"})
-		return
-	}
-
-	conn, err := db.GetConnection()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB connection error"})
-		return
-	}
-	defer conn.Close()
+func loginHandler(sessions store.SessionStore, users store.UserStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Accept an extra field "deviceID"
+		var loginData struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			DeviceID string `json:"deviceID"`
+		}
+		if err := c.BindJSON(&loginData); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+			return
+		}
 
-	var user models.User
-	query := "SELECT id, username, name, password, role, status FROM users WHERE username = $1"
-	err = conn.QueryRow(query, loginData.Username).Scan(&user.ID, &user.Username, &user.Name, &user.Password, &user.Role, &user.Status)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Query error"})
+		if loginData.Username == "" || loginData.Password == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Username and password are required"})
+			return
 		}
-		return
-	}
 
-	// Check if password is already hashed (for legacy support)
-	passwordIsValid := false
-	if utils.IsHashedPassword(user.Password) {
-		// Verify the password using the hash
-		passwordIsValid, err = utils.VerifyPassword(loginData.Password, user.Password)
+		user, err := users.GetByUsername(loginData.Username)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Password verification error"})
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Query error"})
+			}
 			return
 		}
-	} else {
-		// Legacy plaintext password comparison (fallback)
-		passwordIsValid = (user.Password == loginData.Password)
 
-		// Automatically upgrade to hashed password if logging in with plain text
-		if passwordIsValid {
-			hashedPassword, err := utils.HashPassword(loginData.Password)
-			if err == nil {
-				// Update the user's password to the hashed version
-				_, err = conn.Exec("UPDATE users SET password = $1 WHERE id = $2", hashedPassword, user.ID)
-				if err != nil {
-					fmt.Printf("Failed to upgrade password to hashed version: %v\n", err)
-				} else {
-					fmt.Printf("Upgraded user %s to hashed password\n", user.Username)
+		// Check if password is already hashed (for legacy support)
+		passwordIsValid := false
+		if utils.IsHashedPassword(user.Password) {
+			// Verify the password using the hash
+			passwordIsValid, err = utils.VerifyPassword(loginData.Password, user.Password)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Password verification error"})
+				return
+			}
+		} else {
+			// Legacy plaintext password comparison (fallback)
+			passwordIsValid = (user.Password == loginData.Password)
+
+			// Automatically upgrade to hashed password if logging in with plain text
+			if passwordIsValid {
+				hashedPassword, err := utils.HashPassword(loginData.Password)
+				if err == nil {
+					// Update the user's password to the hashed version
+					if err := users.UpdatePassword(user.ID, hashedPassword); err != nil {
+						fmt.Printf("Failed to upgrade password to hashed version: %v\n", err)
+					} else {
+						fmt.Printf("Upgraded user %s to hashed password\n", user.Username)
+					}
 				}
 			}
 		}
-	}
-
-	if !passwordIsValid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
-		return
-	}
 
-	// If a deviceID is provided, update it in the database for this user
-	if loginData.DeviceID != "" {
-		updateQuery := "UPDATE users SET device_id = $1 WHERE id = $2"
-		if _, err := conn.Exec(updateQuery, loginData.DeviceID, user.ID); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update deviceID"})
+		if !passwordIsValid {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 			return
 		}
-	} else {
-		fmt.Printf("NO_DEVICE_ID\n")
-	}
 
-	// Fetch additional roles for this user
-	rolesQuery := "SELECT role FROM additional_roles WHERE user_id = $1"
-	rows, err := conn.Query(rolesQuery, user.ID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch additional roles"})
-		return
-	}
-	defer rows.Close()
-
-	// Initialize an empty slice for additional roles
-	user.AdditionalRoles = []string{}
+		// If a deviceID is provided, update it in the database for this user
+		if loginData.DeviceID != "" {
+			if err := users.UpdateDeviceToken(user.ID, loginData.DeviceID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update deviceID"})
+				return
+			}
+		} else {
+			fmt.Printf("NO_DEVICE_ID\n")
+		}
 
-	// Iterate through the rows and collect the roles
-	for rows.Next() {
-		var role string
-		if err := rows.Scan(&role); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process additional roles"})
+		// Fetch additional roles for this user
+		user.AdditionalRoles, err = users.GetAdditionalRoles(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch additional roles"})
 			return
 		}
-		user.AdditionalRoles = append(user.AdditionalRoles, role)
-	}
 
-	// Check for errors during iteration
-	if err = rows.Err(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error during additional roles fetch"})
-		return
-	}
+		// Get profile picture URL
+		profilePicture := ""
+		if filePath, err := users.GetProfilePicture(user.ID); err == nil && filePath != "" {
+			profilePicture = fmt.Sprintf("/%s", filePath)
+		}
 
-	// Get profile picture URL
-	var filePath sql.NullString
-	var profilePicture string = ""
-	err = conn.QueryRow("SELECT file_path FROM profile_pictures WHERE user_id = $1", user.ID).Scan(&filePath)
-	if err == nil && filePath.Valid {
-		profilePicture = fmt.Sprintf("/%s", filePath.String)
-	}
+		// Create a session and issue tokens for the client
+		response, err := issueSessionTokens(sessions, user.ID, loginData.DeviceID)
+		if err != nil {
+			fmt.Printf("Failed to issue session tokens for user %d: %v\n", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+			return
+		}
 
-	// Return user data with additional roles and status
-	c.JSON(http.StatusOK, gin.H{
-		"id":               user.ID,
-		"username":         user.Username,
-		"password":         user.Password,
-		"name":             user.Name,
-		"role":             user.Role,
-		"status":           user.Status,
-		"additional_roles": user.AdditionalRoles,
-		"profile_picture":  profilePicture,
-	})
+		// Return user data with additional roles, status and tokens
+		response["id"] = user.ID
+		response["username"] = user.Username
+		response["name"] = user.Name
+		response["role"] = user.Role
+		response["status"] = user.Status
+		response["additional_roles"] = user.AdditionalRoles
+		response["profile_picture"] = profilePicture
+		c.JSON(http.StatusOK, response)
+	}
 }
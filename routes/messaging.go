@@ -3,45 +3,37 @@ package routes
 import (
 	"bytes"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"server/middleware"
+	"server/models"
 	"server/notifications"
+	"server/realtime"
+	"server/store"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 )
 
-type Conversation struct {
-	ID        int       `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	Users     []User    `json:"users"`
-}
-
-type Message struct {
-	ID             int       `json:"id"`
-	ConversationID int       `json:"conversation_id"`
-	SenderID       int       `json:"sender_id"`
-	SenderName     string    `json:"sender_name"`
-	Content        string    `json:"content"`
-	CreatedAt      time.Time `json:"created_at"`
-	Read           bool      `json:"read"`
-}
-
-type User struct {
-	ID        int    `json:"id"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Name      string `json:"name"`
-	Role      string `json:"role"`
+// messageJSON converts a message to the shape the app expects
+func messageJSON(message models.Message) gin.H {
+	return gin.H{
+		"id":              message.ID,
+		"conversation_id": message.ConversationID,
+		"sender_id":       message.SenderID,
+		"sender":          message.SenderName,
+		"content":         message.Content,
+		"created_at":      message.CreatedAt,
+		"read":            message.Read,
+	}
 }
 
 // GetUserConversations retrieves all conversations for a specific user
 // GET /api/messaging/conversations/:user_id
-func GetUserConversations(c *gin.Context, db *sql.DB) {
+func GetUserConversations(c *gin.Context, messages store.MessageStore, users store.UserStore) {
 	userID := c.Param("user_id")
 	if userID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -62,8 +54,7 @@ func GetUserConversations(c *gin.Context, db *sql.DB) {
 	}
 
 	// First, check if the user exists
-	var exists bool
-	err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userIDInt).Scan(&exists)
+	exists, err := users.Exists(userIDInt)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -80,97 +71,7 @@ func GetUserConversations(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	// More efficient query that fetches all data in one go using SQL joins and aggregation
-	query := `
-		WITH UserConversations AS (
-			SELECT 
-				c.id as conversation_id,
-				c.created_at as conversation_created_at
-			FROM 
-				conversations c
-			JOIN 
-				conversation_participants cp ON c.id = cp.conversation_id
-			WHERE 
-				cp.user_id = $1
-		),
-		UnreadCounts AS (
-			SELECT 
-				m.conversation_id,
-				COUNT(*) as unread_count
-			FROM 
-				messages m
-			JOIN 
-				UserConversations uc ON m.conversation_id = uc.conversation_id
-			WHERE 
-				m.sender_id != $1 AND m.read = false
-			GROUP BY 
-				m.conversation_id
-		),
-		LatestMessages AS (
-			SELECT DISTINCT ON (conversation_id) 
-				m.id as message_id,
-				m.conversation_id,
-				m.sender_id,
-				u.name as sender_name,
-				m.content,
-				m.created_at,
-				m.read
-			FROM 
-				messages m
-			JOIN 
-				UserConversations uc ON m.conversation_id = uc.conversation_id
-			JOIN 
-				users u ON m.sender_id = u.id
-			ORDER BY 
-				m.conversation_id, m.created_at DESC
-		),
-		ConversationParticipants AS (
-			SELECT 
-				cp.conversation_id,
-				json_agg(
-					json_build_object(
-						'id', u.id,
-						'first_name', u.first_name,
-						'last_name', u.last_name,
-						'name', u.name,
-						'role', u.role
-					)
-				) as participants
-			FROM 
-				conversation_participants cp
-			JOIN 
-				UserConversations uc ON cp.conversation_id = uc.conversation_id
-			JOIN 
-				users u ON cp.user_id = u.id
-			WHERE 
-				cp.user_id != $1
-			GROUP BY 
-				cp.conversation_id
-		)
-		SELECT 
-			uc.conversation_id,
-			uc.conversation_created_at,
-			COALESCE(cp.participants, '[]'::json) as participants,
-			COALESCE(uc2.unread_count, 0) as unread_count,
-			lm.message_id,
-			lm.sender_id,
-			lm.sender_name,
-			lm.content,
-			lm.created_at,
-			lm.read
-		FROM 
-			UserConversations uc
-		LEFT JOIN
-			ConversationParticipants cp ON uc.conversation_id = cp.conversation_id
-		LEFT JOIN
-			UnreadCounts uc2 ON uc.conversation_id = uc2.conversation_id
-		LEFT JOIN
-			LatestMessages lm ON uc.conversation_id = lm.conversation_id
-		ORDER BY 
-			COALESCE(lm.created_at, uc.conversation_created_at) DESC
-	`
-
-	rows, err := db.Query(query, userIDInt)
+	summaries, err := messages.ListConversations(userIDInt)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -178,70 +79,26 @@ func GetUserConversations(c *gin.Context, db *sql.DB) {
 		})
 		return
 	}
-	defer rows.Close()
 
 	var conversations []gin.H
-
-	for rows.Next() {
-		var conversationID int
-		var conversationCreatedAt time.Time
-		var participantsJSON []byte
-		var unreadCount int
-		var messageID sql.NullInt64
-		var senderID sql.NullInt64
-		var senderName sql.NullString
-		var content sql.NullString
-		var messageCreatedAt sql.NullTime
-		var read sql.NullBool
-
-		err := rows.Scan(
-			&conversationID,
-			&conversationCreatedAt,
-			&participantsJSON,
-			&unreadCount,
-			&messageID,
-			&senderID,
-			&senderName,
-			&content,
-			&messageCreatedAt,
-			&read,
-		)
-
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"message": fmt.Sprintf("Error scanning conversation: %v", err),
-			})
-			return
-		}
-
-		// Parse participants JSON
-		var participants []gin.H
-		err = json.Unmarshal(participantsJSON, &participants)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"message": fmt.Sprintf("Error parsing participants JSON: %v", err),
-			})
-			return
-		}
-
+	for _, summary := range summaries {
 		conversationData := gin.H{
-			"id":           conversationID,
-			"created_at":   conversationCreatedAt,
-			"participants": participants,
-			"unread_count": unreadCount,
+			"id":           summary.ID,
+			"created_at":   summary.CreatedAt,
+			"participants": summary.Participants,
+			"unread_count": summary.UnreadCount,
 		}
 
 		// Add latest message if it exists
-		if messageID.Valid {
+		if summary.LatestMessage != nil {
+			latest := summary.LatestMessage
 			conversationData["latest_message"] = gin.H{
-				"id":         messageID.Int64,
-				"sender_id":  senderID.Int64,
-				"sender":     senderName.String,
-				"content":    content.String,
-				"created_at": messageCreatedAt.Time,
-				"read":       read.Bool,
+				"id":         latest.ID,
+				"sender_id":  latest.SenderID,
+				"sender":     latest.SenderName,
+				"content":    latest.Content,
+				"created_at": latest.CreatedAt,
+				"read":       latest.Read,
 			}
 		} else {
 			conversationData["latest_message"] = nil
@@ -258,9 +115,8 @@ func GetUserConversations(c *gin.Context, db *sql.DB) {
 
 // GetConversationMessages retrieves messages for a specific conversation with pagination
 // GET /api/messaging/conversation/:conversation_id/messages
-func GetConversationMessages(c *gin.Context, db *sql.DB) {
+func GetConversationMessages(c *gin.Context, messages store.MessageStore, hub *realtime.Hub) {
 	conversationID := c.Param("conversation_id")
-	userID := c.Query("user_id")
 	limitStr := c.DefaultQuery("limit", "50")       // Default fetch 50 messages
 	beforeIDStr := c.DefaultQuery("before_id", "0") // ID to fetch messages before (for pagination)
 
@@ -282,30 +138,37 @@ func GetConversationMessages(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	// Convert user ID from string to integer if provided
-	var userIDInt int
-	if userID != "" {
-		userIDInt, err = strconv.Atoi(userID)
+	// Only participants can read a conversation
+	user, _ := middleware.CurrentUser(c)
+	isParticipant, err := messages.IsParticipant(conversationIDInt, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error checking if user is a participant: %v", err),
+		})
+		return
+	}
+	if !isParticipant {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "User is not a participant in this conversation",
+		})
+		return
+	}
+
+	// Messages are only ever marked as read on behalf of the caller
+	if c.Query("user_id") != "" {
+		marked, err := messages.MarkRead(conversationIDInt, user.ID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"success": false,
-				"message": fmt.Sprintf("Invalid user ID format: %s", userID),
+			fmt.Printf("Error marking messages as read: %v\n", err)
+			// Continue anyway, this is not a critical error
+		} else if marked > 0 {
+			// Let the senders see their messages were read
+			publishToParticipants(hub, messages, realtime.Event{
+				Type:           realtime.EventConversationRead,
+				ConversationID: conversationIDInt,
+				Data:           gin.H{"reader_id": user.ID},
 			})
-			return
-		}
-
-		// Mark messages as read for this user
-		if userIDInt > 0 {
-			_, err = db.Exec(`
-				UPDATE messages
-				SET read = true
-				WHERE conversation_id = $1 AND sender_id != $2 AND read = false
-			`, conversationIDInt, userIDInt)
-
-			if err != nil {
-				fmt.Printf("Error marking messages as read: %v\n", err)
-				// Continue anyway, this is not a critical error
-			}
 		}
 	}
 
@@ -320,56 +183,7 @@ func GetConversationMessages(c *gin.Context, db *sql.DB) {
 		beforeID = 0
 	}
 
-	var query string
-	var queryArgs []interface{}
-
-	if beforeID > 0 {
-		// Get messages before a certain ID (for pagination)
-		query = `
-			SELECT 
-				m.id, 
-				m.conversation_id,
-				m.sender_id, 
-				u.name as sender_name, 
-				m.content, 
-				m.created_at, 
-				m.read
-			FROM 
-				messages m
-			JOIN 
-				users u ON m.sender_id = u.id
-			WHERE 
-				m.conversation_id = $1 AND m.id < $2
-			ORDER BY 
-				m.created_at DESC
-			LIMIT $3
-		`
-		queryArgs = []interface{}{conversationIDInt, beforeID, limit}
-	} else {
-		// Get the most recent messages
-		query = `
-			SELECT 
-				m.id, 
-				m.conversation_id,
-				m.sender_id, 
-				u.name as sender_name, 
-				m.content, 
-				m.created_at, 
-				m.read
-			FROM 
-				messages m
-			JOIN 
-				users u ON m.sender_id = u.id
-			WHERE 
-				m.conversation_id = $1
-			ORDER BY 
-				m.created_at DESC
-			LIMIT $2
-		`
-		queryArgs = []interface{}{conversationIDInt, limit}
-	}
-
-	rows, err := db.Query(query, queryArgs...)
+	page, err := messages.ListMessages(conversationIDInt, beforeID, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -377,83 +191,38 @@ func GetConversationMessages(c *gin.Context, db *sql.DB) {
 		})
 		return
 	}
-	defer rows.Close()
 
-	var messages []gin.H
+	var messageList []gin.H
 	oldestID := 0
-
-	for rows.Next() {
-		var message Message
-		err := rows.Scan(
-			&message.ID,
-			&message.ConversationID,
-			&message.SenderID,
-			&message.SenderName,
-			&message.Content,
-			&message.CreatedAt,
-			&message.Read,
-		)
-
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"message": fmt.Sprintf("Error scanning message: %v", err),
-			})
-			return
-		}
-
+	for _, message := range page {
 		// Keep track of the oldest message ID for pagination
 		if oldestID == 0 || message.ID < oldestID {
 			oldestID = message.ID
 		}
-
-		messages = append(messages, gin.H{
-			"id":              message.ID,
-			"conversation_id": message.ConversationID,
-			"sender_id":       message.SenderID,
-			"sender":          message.SenderName,
-			"content":         message.Content,
-			"created_at":      message.CreatedAt,
-			"read":            message.Read,
-		})
-	}
-
-	// Reverse the order so messages are in chronological order (oldest first)
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+		messageList = append(messageList, messageJSON(message))
 	}
 
 	// Check if there are more messages available
 	var hasMore bool
 	var totalCount int
 	if oldestID > 0 {
-		err = db.QueryRow(`
-			SELECT EXISTS (
-				SELECT 1 FROM messages 
-				WHERE conversation_id = $1 AND id < $2
-			)
-		`, conversationIDInt, oldestID).Scan(&hasMore)
-
+		hasMore, err = messages.HasMessagesBefore(conversationIDInt, oldestID)
 		if err != nil {
 			fmt.Printf("Error checking if more messages exist: %v\n", err)
 			hasMore = false
 		}
 
 		// Also get the total count for the frontend
-		err = db.QueryRow(`
-			SELECT COUNT(*) FROM messages 
-			WHERE conversation_id = $1
-		`, conversationIDInt).Scan(&totalCount)
-
+		totalCount, err = messages.CountMessages(conversationIDInt)
 		if err != nil {
 			fmt.Printf("Error counting total messages: %v\n", err)
-			totalCount = len(messages)
+			totalCount = len(messageList)
 		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success":     true,
-		"messages":    messages,
+		"messages":    messageList,
 		"has_more":    hasMore,
 		"oldest_id":   oldestID,
 		"total_count": totalCount,
@@ -462,7 +231,7 @@ func GetConversationMessages(c *gin.Context, db *sql.DB) {
 
 // SendMessage sends a new message in a conversation
 // POST /api/messaging/messages
-func SendMessage(c *gin.Context, db *sql.DB) {
+func SendMessage(c *gin.Context, messages store.MessageStore, hub *realtime.Hub) {
 	// Log the raw request body for debugging
 	body, _ := c.GetRawData()
 	fmt.Printf("SendMessage raw request body: %s\n", string(body))
@@ -485,11 +254,13 @@ func SendMessage(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	fmt.Printf("SendMessage parsed request: %+v\n", request)
+	// The sender is always the authenticated caller
+	if user, ok := middleware.CurrentUser(c); ok {
+		request.SenderID = user.ID
+	}
 
 	// Validate the request
 	if request.ConversationID <= 0 {
-		fmt.Printf("SendMessage error: Invalid conversation ID: %d\n", request.ConversationID)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Conversation ID is required",
@@ -498,7 +269,6 @@ func SendMessage(c *gin.Context, db *sql.DB) {
 	}
 
 	if request.SenderID <= 0 {
-		fmt.Printf("SendMessage error: Invalid sender ID: %d\n", request.SenderID)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Sender ID is required",
@@ -507,7 +277,6 @@ func SendMessage(c *gin.Context, db *sql.DB) {
 	}
 
 	if request.Content == "" {
-		fmt.Printf("SendMessage error: Empty message content\n")
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Message content is required",
@@ -516,8 +285,7 @@ func SendMessage(c *gin.Context, db *sql.DB) {
 	}
 
 	// Check if conversation exists
-	var exists bool
-	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM conversations WHERE id = $1)", request.ConversationID).Scan(&exists)
+	exists, err := messages.ConversationExists(request.ConversationID)
 	if err != nil {
 		fmt.Printf("SendMessage error checking if conversation exists: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -528,7 +296,6 @@ func SendMessage(c *gin.Context, db *sql.DB) {
 	}
 
 	if !exists {
-		fmt.Printf("SendMessage error: Conversation not found with ID: %d\n", request.ConversationID)
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
 			"message": fmt.Sprintf("Conversation not found with ID: %d", request.ConversationID),
@@ -537,8 +304,7 @@ func SendMessage(c *gin.Context, db *sql.DB) {
 	}
 
 	// Check if user is a participant in the conversation
-	err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM conversation_participants WHERE conversation_id = $1 AND user_id = $2)",
-		request.ConversationID, request.SenderID).Scan(&exists)
+	isParticipant, err := messages.IsParticipant(request.ConversationID, request.SenderID)
 	if err != nil {
 		fmt.Printf("SendMessage error checking if user is a participant: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -548,9 +314,7 @@ func SendMessage(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	if !exists {
-		fmt.Printf("SendMessage error: User %d is not a participant in conversation %d\n",
-			request.SenderID, request.ConversationID)
+	if !isParticipant {
 		c.JSON(http.StatusForbidden, gin.H{
 			"success": false,
 			"message": "User is not a participant in this conversation",
@@ -559,14 +323,7 @@ func SendMessage(c *gin.Context, db *sql.DB) {
 	}
 
 	// Insert the message
-	var messageID int
-	var createdAt time.Time
-	err = db.QueryRow(`
-		INSERT INTO messages (conversation_id, sender_id, content, created_at, read) 
-		VALUES ($1, $2, $3, (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')::timestamp, false) 
-		RETURNING id, created_at
-	`, request.ConversationID, request.SenderID, request.Content).Scan(&messageID, &createdAt)
-
+	message, err := messages.CreateMessage(request.ConversationID, request.SenderID, request.Content)
 	if err != nil {
 		fmt.Printf("SendMessage error inserting message: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -576,77 +333,32 @@ func SendMessage(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	fmt.Printf("SendMessage successfully inserted message with ID: %d\n", messageID)
-
-	// Get the sent message with sender info
-	var message Message
-	err = db.QueryRow(`
-		SELECT 
-			m.id, 
-			m.conversation_id,
-			m.sender_id, 
-			u.name as sender_name, 
-			m.content, 
-			m.created_at, 
-			m.read
-		FROM 
-			messages m
-		JOIN 
-			users u ON m.sender_id = u.id
-		WHERE 
-			m.id = $1
-	`, messageID).Scan(
-		&message.ID,
-		&message.ConversationID,
-		&message.SenderID,
-		&message.SenderName,
-		&message.Content,
-		&message.CreatedAt,
-		&message.Read,
-	)
-
-	if err != nil {
-		fmt.Printf("SendMessage error retrieving sent message: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": fmt.Sprintf("Error retrieving sent message: %v", err),
-		})
-		return
-	}
+	// Deliver the message to the participants' open connections, including the
+	// sender's other devices
+	publishToParticipants(hub, messages, realtime.Event{
+		Type:           realtime.EventMessageCreated,
+		ConversationID: message.ConversationID,
+		Data:           messageJSON(*message),
+	})
 
 	// Send push notifications to all other participants in the conversation
-	go sendPushNotifications(db, request.ConversationID, request.SenderID, message.SenderName, request.Content)
+	go sendPushNotifications(messages, request.ConversationID, request.SenderID, message.SenderName, request.Content)
 
-	fmt.Printf("SendMessage successful for message ID: %d\n", messageID)
+	fmt.Printf("SendMessage successful for message ID: %d\n", message.ID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": gin.H{
-			"id":              message.ID,
-			"conversation_id": message.ConversationID,
-			"sender_id":       message.SenderID,
-			"sender":          message.SenderName,
-			"content":         message.Content,
-			"created_at":      message.CreatedAt,
-			"read":            message.Read,
-		},
+		"message": messageJSON(*message),
 	})
 }
 
 // CreateConversation creates a new conversation between users
 // POST /api/messaging/conversations
-func CreateConversation(c *gin.Context, db *sql.DB) {
+func CreateConversation(c *gin.Context, messages store.MessageStore, users store.UserStore, hub *realtime.Hub) {
 	var request struct {
 		UserIDs []int `json:"user_ids"`
 	}
 
-	// Log the raw request body for debugging
-	body, _ := c.GetRawData()
-	fmt.Printf("Raw request body: %s\n", string(body))
-
-	// Reset the request body so it can be read again
-	c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
-
 	if err := c.ShouldBindJSON(&request); err != nil {
 		fmt.Printf("Error binding JSON: %v\n", err)
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -656,11 +368,25 @@ func CreateConversation(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	fmt.Printf("Parsed user IDs: %v\n", request.UserIDs)
+	// The caller must be one of the members
+	user, _ := middleware.CurrentUser(c)
+	isMember := false
+	for _, userID := range request.UserIDs {
+		if userID == user.ID {
+			isMember = true
+			break
+		}
+	}
+	if !isMember {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "You can only create conversations you take part in",
+		})
+		return
+	}
 
 	// Validate the request
 	if len(request.UserIDs) < 2 {
-		fmt.Printf("Error: Not enough users. Received %d users\n", len(request.UserIDs))
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "At least two users are required for a conversation",
@@ -668,14 +394,12 @@ func CreateConversation(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	// Check if users exist and collect their roles
-	userRoles := make(map[int]string)
+	// Check that every user exists and that the conversation pairs a student with staff
+	var hasStudent, hasStaff bool
 	for _, userID := range request.UserIDs {
-		var role string
-		err := db.QueryRow("SELECT role FROM users WHERE id = $1", userID).Scan(&role)
+		user, err := users.GetByID(userID)
 		if err != nil {
 			if err == sql.ErrNoRows {
-				fmt.Printf("Error: User ID %d not found\n", userID)
 				c.JSON(http.StatusNotFound, gin.H{
 					"success": false,
 					"message": fmt.Sprintf("User not found with ID: %d", userID),
@@ -683,7 +407,6 @@ func CreateConversation(c *gin.Context, db *sql.DB) {
 				return
 			}
 
-			fmt.Printf("Error checking user role for ID %d: %v\n", userID, err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"success": false,
 				"message": fmt.Sprintf("Error checking user role: %v", err),
@@ -691,23 +414,14 @@ func CreateConversation(c *gin.Context, db *sql.DB) {
 			return
 		}
 
-		userRoles[userID] = role
-	}
-
-	fmt.Printf("User roles: %v\n", userRoles)
-
-	// Check if we have a valid conversation pair (student-staff)
-	var hasStudent, hasStaff bool
-	for _, role := range userRoles {
-		if role == "student" {
+		if user.Role == models.RoleStudent {
 			hasStudent = true
-		} else if role == "staff" {
+		} else if user.Role == models.RoleStaff {
 			hasStaff = true
 		}
 	}
 
 	if !hasStudent || !hasStaff {
-		fmt.Printf("Error: Missing required roles. Student: %v, Staff: %v\n", hasStudent, hasStaff)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Conversations must include at least one student and one staff member",
@@ -715,22 +429,10 @@ func CreateConversation(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	// Check if there's already a conversation between these users
-	// For a conversation between exactly these users (no more, no fewer)
+	// Reuse an existing conversation between the same two users
 	if len(request.UserIDs) == 2 {
-		query := `
-			SELECT c.id
-			FROM conversations c
-			JOIN conversation_participants cp1 ON c.id = cp1.conversation_id AND cp1.user_id = $1
-			JOIN conversation_participants cp2 ON c.id = cp2.conversation_id AND cp2.user_id = $2
-			GROUP BY c.id
-			HAVING COUNT(DISTINCT cp1.user_id) + COUNT(DISTINCT cp2.user_id) = 2
-		`
-
-		var existingConversationID int
-		err := db.QueryRow(query, request.UserIDs[0], request.UserIDs[1]).Scan(&existingConversationID)
+		existingConversationID, err := messages.FindDirectConversation(request.UserIDs[0], request.UserIDs[1])
 		if err == nil {
-			// Conversation exists, return it
 			c.JSON(http.StatusOK, gin.H{
 				"success":         true,
 				"conversation_id": existingConversationID,
@@ -746,26 +448,8 @@ func CreateConversation(c *gin.Context, db *sql.DB) {
 		}
 	}
 
-	// Start a transaction
-	tx, err := db.Begin()
+	conversationID, err := messages.CreateConversation(request.UserIDs)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": fmt.Sprintf("Error starting transaction: %v", err),
-		})
-		return
-	}
-
-	// Create a new conversation
-	var conversationID int
-	err = tx.QueryRow(`
-		INSERT INTO conversations (created_at) 
-		VALUES ((CURRENT_TIMESTAMP AT TIME ZONE 'UTC')::timestamp) 
-		RETURNING id
-	`).Scan(&conversationID)
-
-	if err != nil {
-		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"message": fmt.Sprintf("Error creating conversation: %v", err),
@@ -773,50 +457,8 @@ func CreateConversation(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	// Add all users to the conversation
-	for _, userID := range request.UserIDs {
-		_, err := tx.Exec(`
-			INSERT INTO conversation_participants (conversation_id, user_id) 
-			VALUES ($1, $2)
-		`, conversationID, userID)
-
-		if err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"message": fmt.Sprintf("Error adding user to conversation: %v", err),
-			})
-			return
-		}
-	}
-
-	// Commit the transaction
-	err = tx.Commit()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": fmt.Sprintf("Error committing transaction: %v", err),
-		})
-		return
-	}
-
 	// Get user details for all participants
-	query := `
-		SELECT 
-			u.id, 
-			u.first_name, 
-			u.last_name, 
-			u.name, 
-			u.role
-		FROM 
-			users u
-		JOIN 
-			conversation_participants cp ON u.id = cp.user_id
-		WHERE 
-			cp.conversation_id = $1
-	`
-
-	rows, err := db.Query(query, conversationID)
+	participants, err := messages.ListParticipants(conversationID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -824,41 +466,29 @@ func CreateConversation(c *gin.Context, db *sql.DB) {
 		})
 		return
 	}
-	defer rows.Close()
-
-	var users []User
-	for rows.Next() {
-		var user User
-		err := rows.Scan(
-			&user.ID,
-			&user.FirstName,
-			&user.LastName,
-			&user.Name,
-			&user.Role,
-		)
-
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"message": fmt.Sprintf("Error scanning user: %v", err),
-			})
-			return
-		}
 
-		users = append(users, user)
+	// Add the conversation to every participant's open inbox
+	participantIDs := make([]int, 0, len(participants))
+	for _, participant := range participants {
+		participantIDs = append(participantIDs, participant.ID)
 	}
+	hub.Publish(realtime.Event{
+		Type:           realtime.EventConversationCreated,
+		ConversationID: conversationID,
+		Data:           gin.H{"participants": participants},
+	}, participantIDs...)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success":         true,
 		"conversation_id": conversationID,
-		"participants":    users,
+		"participants":    participants,
 	})
 }
 
 // GetAvailableChatUsers returns users that a student can chat with (teachers)
 // or users that a teacher can chat with (students)
 // GET /api/messaging/chat-users/:user_id
-func GetAvailableChatUsers(c *gin.Context, db *sql.DB) {
+func GetAvailableChatUsers(c *gin.Context, messages store.MessageStore, users store.UserStore) {
 	userID := c.Param("user_id")
 	if userID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -868,12 +498,9 @@ func GetAvailableChatUsers(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	fmt.Printf("GetAvailableChatUsers: Processing request for user ID: %s\n", userID)
-
 	// Convert user ID from string to integer
 	userIDInt, err := strconv.Atoi(userID)
 	if err != nil {
-		fmt.Printf("GetAvailableChatUsers: Invalid user ID format: %s, error: %v\n", userID, err)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": fmt.Sprintf("Invalid user ID format: %s", userID),
@@ -882,11 +509,9 @@ func GetAvailableChatUsers(c *gin.Context, db *sql.DB) {
 	}
 
 	// Check if user exists and get their role
-	var userRole string
-	err = db.QueryRow("SELECT role FROM users WHERE id = $1", userIDInt).Scan(&userRole)
+	user, err := users.GetByID(userIDInt)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			fmt.Printf("GetAvailableChatUsers: User not found with ID: %d\n", userIDInt)
 			c.JSON(http.StatusNotFound, gin.H{
 				"success": false,
 				"message": fmt.Sprintf("User not found with ID: %d", userIDInt),
@@ -894,7 +519,6 @@ func GetAvailableChatUsers(c *gin.Context, db *sql.DB) {
 			return
 		}
 
-		fmt.Printf("GetAvailableChatUsers: Error checking user role: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"message": fmt.Sprintf("Error checking user role: %v", err),
@@ -902,69 +526,22 @@ func GetAvailableChatUsers(c *gin.Context, db *sql.DB) {
 		return
 	}
 
-	fmt.Printf("GetAvailableChatUsers: User %d has role: %s\n", userIDInt, userRole)
-
-	var query string
-	var availableRole string
-
-	// If user is a student, they can chat with any staff member
-	// If user is a staff member (teacher/admin), they can chat with students
-	if userRole == "student" {
-		query = `
-            SELECT 
-                u.id, 
-                u.first_name, 
-                u.last_name, 
-                u.name, 
-                u.role,
-                COALESCE(pp.file_path, '') as profile_picture,
-                string_agg(DISTINCT ar.role, ', ') as additional_roles
-            FROM 
-                users u
-            LEFT JOIN
-                profile_pictures pp ON u.id = pp.user_id
-            LEFT JOIN
-                additional_roles ar ON u.id = ar.user_id
-            WHERE 
-                u.role = 'staff'
-            GROUP BY
-                u.id, u.first_name, u.last_name, u.name, u.role, pp.file_path
-            ORDER BY 
-                u.name
-        `
-		availableRole = "staff"
-		fmt.Printf("GetAvailableChatUsers: Student user, looking for staff members\n")
-	} else if userRole == "staff" {
-		query = `
-            SELECT 
-                u.id, 
-                u.first_name, 
-                u.last_name, 
-                u.name, 
-                u.role,
-                COALESCE(pp.file_path, '') as profile_picture,
-                NULL as additional_roles
-            FROM 
-                users u
-            LEFT JOIN
-                profile_pictures pp ON u.id = pp.user_id
-            WHERE 
-                u.role = 'student'
-            ORDER BY 
-                u.name
-        `
-		availableRole = "students"
-		fmt.Printf("GetAvailableChatUsers: Staff user, looking for student members\n")
-	} else {
-		fmt.Printf("GetAvailableChatUsers: Invalid user role: %s\n", userRole)
+	// Students can chat with any staff member and staff can chat with students
+	var chatRole, availableRole string
+	switch user.Role {
+	case models.RoleStudent:
+		chatRole, availableRole = models.RoleStaff, "staff"
+	case models.RoleStaff:
+		chatRole, availableRole = models.RoleStudent, "students"
+	default:
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
-			"message": fmt.Sprintf("Invalid user role: %s", userRole),
+			"message": fmt.Sprintf("Invalid user role: %s", user.Role),
 		})
 		return
 	}
 
-	rows, err := db.Query(query)
+	chatUsers, err := messages.ListChatUsers(chatRole)
 	if err != nil {
 		fmt.Printf("GetAvailableChatUsers: Error querying users: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -973,161 +550,159 @@ func GetAvailableChatUsers(c *gin.Context, db *sql.DB) {
 		})
 		return
 	}
-	defer rows.Close()
-
-	var users []gin.H
-	for rows.Next() {
-		var user struct {
-			ID             int            `json:"id"`
-			FirstName      string         `json:"first_name"`
-			LastName       string         `json:"last_name"`
-			Name           string         `json:"name"`
-			Role           string         `json:"role"`
-			ProfilePicture sql.NullString `json:"profile_picture"`
-		}
-		var additionalRoles sql.NullString
-
-		err := rows.Scan(
-			&user.ID,
-			&user.FirstName,
-			&user.LastName,
-			&user.Name,
-			&user.Role,
-			&user.ProfilePicture,
-			&additionalRoles,
-		)
 
-		if err != nil {
-			fmt.Printf("GetAvailableChatUsers: Error scanning user: %v\n", err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"success": false,
-				"message": fmt.Sprintf("Error scanning user: %v", err),
-			})
-			return
-		}
-
-		// Create user object with additional roles
+	var userList []gin.H
+	for _, chatUser := range chatUsers {
 		userObj := gin.H{
-			"id":         user.ID,
-			"first_name": user.FirstName,
-			"last_name":  user.LastName,
-			"name":       user.Name,
-			"role":       user.Role,
+			"id":               chatUser.ID,
+			"first_name":       chatUser.FirstName,
+			"last_name":        chatUser.LastName,
+			"name":             chatUser.Name,
+			"role":             chatUser.Role,
+			"additional_roles": chatUser.AdditionalRoles,
 		}
 
-		// Add profile picture if present
-		if user.ProfilePicture.Valid && user.ProfilePicture.String != "" {
-			// Build the URL using the API endpoint for profile pictures
-			// We can either extract the extension from the file path or default to .jpg
+		// Add profile picture if present, served through the API endpoint
+		if chatUser.ProfilePicture != "" {
 			var extension string
-			if strings.HasSuffix(user.ProfilePicture.String, ".png") {
+			if strings.HasSuffix(chatUser.ProfilePicture, ".png") {
 				extension = ".png"
-			} else if strings.HasSuffix(user.ProfilePicture.String, ".jpg") {
-				extension = ".jpg"
-			} else if strings.HasSuffix(user.ProfilePicture.String, ".jpeg") {
+			} else if strings.HasSuffix(chatUser.ProfilePicture, ".jpeg") {
 				extension = ".jpeg"
 			} else {
 				extension = ".jpg" // Default to jpg
 			}
-
-			// Use the absolute URL for the API endpoint
-			userObj["profile_picture"] = fmt.Sprintf("/api/profile_pictures/%d%s", user.ID, extension)
-
-			// For debugging
-			fmt.Printf("Profile picture for user %d: %s\n", user.ID, userObj["profile_picture"])
+			userObj["profile_picture"] = fmt.Sprintf("/api/profile_pictures/%d%s", chatUser.ID, extension)
 		}
 
-		// Add additional roles if present
-		if additionalRoles.Valid && additionalRoles.String != "" {
-			userObj["additional_roles"] = strings.Split(additionalRoles.String, ", ")
-		} else {
-			userObj["additional_roles"] = []string{}
-		}
-
-		users = append(users, userObj)
+		userList = append(userList, userObj)
 	}
 
-	fmt.Printf("GetAvailableChatUsers: Found %d available %s for user %d\n", len(users), availableRole, userIDInt)
+	fmt.Printf("GetAvailableChatUsers: Found %d available %s for user %d\n", len(userList), availableRole, userIDInt)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"role":    availableRole,
-		"users":   users,
+		"users":   userList,
 	})
 }
 
+// messagingUpgrader accepts WebSocket connections. Requests with an Origin header,
+// i.e. from browsers, must come from the server's own host; the app sends none.
+var messagingUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// ServeMessagingEvents keeps a WebSocket open that receives the caller's messaging
+// events in real time, instead of polling for new messages
+// GET /api/messaging/ws
+//
+// The connection is authenticated like any other request, with the access token in
+// the Authorization header. The server closes it with code 1008 (policy violation)
+// when that token expires or the session is revoked; clients then reconnect with a
+// fresh token. The server only sends; each event is a JSON text frame:
+//
+//	{
+//	  "type": string,            // "message.created", "conversation.read", "conversation.created" or "resync"
+//	  "conversation_id": int,
+//	  "data": { ... }            // the message as returned by POST /api/messaging/messages,
+//	                             // { "reader_id": int } or { "participants": [ ... ] }
+//	}
+//
+// data is left out when the event was too large to share between server instances,
+// and "resync" events carry no conversation; clients reload the affected messages
+// in both cases, as well as after reconnecting.
+func ServeMessagingEvents(c *gin.Context, hub *realtime.Hub, sessions store.SessionStore) {
+	user, _ := middleware.CurrentUser(c)
+	session := realtime.Session{
+		ExpiresAt: user.TokenExpiresAt,
+		Active: func() bool {
+			current, err := sessions.GetByID(user.SessionID)
+			if err != nil {
+				if err == sql.ErrNoRows {
+					return false
+				}
+				// Keep the connection through database hiccups
+				fmt.Printf("Error checking session %s of messaging WebSocket: %v\n", user.SessionID, err)
+				return true
+			}
+			return current.IsActive()
+		},
+	}
+
+	conn, err := messagingUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already responded with an error status
+		fmt.Printf("Error opening messaging WebSocket for user %d: %v\n", user.ID, err)
+		return
+	}
+
+	hub.Serve(conn, user.ID, session)
+}
+
 // sendPushNotifications sends push notifications to all participants in a conversation
 // except the sender of the message
-func sendPushNotifications(db *sql.DB, conversationID int, senderID int, senderName string, content string) {
-	// Find all participants in the conversation except the sender
-	query := `
-		SELECT u.id, u.device_id
-		FROM users u
-		JOIN conversation_participants cp ON u.id = cp.user_id
-		WHERE cp.conversation_id = $1 AND u.id != $2 AND u.device_id IS NOT NULL AND u.device_id != ''
-	`
-
-	rows, err := db.Query(query, conversationID, senderID)
+func sendPushNotifications(messages store.MessageStore, conversationID int, senderID int, senderName string, content string) {
+	recipients, err := messages.ListPushRecipients(conversationID, senderID)
 	if err != nil {
 		fmt.Printf("Error querying participants for notifications: %v\n", err)
 		return
 	}
-	defer rows.Close()
-
-	// Send a push notification to each participant
-	for rows.Next() {
-		var userID int
-		var deviceID string
-
-		if err := rows.Scan(&userID, &deviceID); err != nil {
-			fmt.Printf("Error scanning participant data: %v\n", err)
-			continue
-		}
-
-		// Skip if device ID is missing or invalid
-		if deviceID == "" {
-			fmt.Printf("Skipping notification for user %d: No device ID\n", userID)
-			continue
-		}
 
-		// Truncate content if too long for notification
-		messagePreview := content
-		if len(messagePreview) > 100 {
-			messagePreview = messagePreview[:97] + "..."
-		}
+	// Truncate content if too long for notification
+	messagePreview := content
+	if len(messagePreview) > 100 {
+		messagePreview = messagePreview[:97] + "..."
+	}
 
-		// Send the notification
-		err := notifications.SendMessageNotification(deviceID, conversationID, senderName, messagePreview)
+	// Send a push notification to each participant
+	for _, recipient := range recipients {
+		err := notifications.SendMessageNotification(recipient.DeviceToken, conversationID, senderName, messagePreview)
 		if err != nil {
-			fmt.Printf("Error sending notification to user %d: %v\n", userID, err)
+			fmt.Printf("Error sending notification to user %d: %v\n", recipient.UserID, err)
 		} else {
-			fmt.Printf("Successfully sent notification to user %d\n", userID)
+			fmt.Printf("Successfully sent notification to user %d\n", recipient.UserID)
 		}
 	}
+}
+
+// publishToParticipants sends an event to every member of its conversation
+func publishToParticipants(hub *realtime.Hub, messages store.MessageStore, event realtime.Event) {
+	participants, err := messages.ListParticipants(event.ConversationID)
+	if err != nil {
+		fmt.Printf("Error querying participants for %s event: %v\n", event.Type, err)
+		return
+	}
 
-	if err := rows.Err(); err != nil {
-		fmt.Printf("Error iterating participants: %v\n", err)
+	userIDs := make([]int, 0, len(participants))
+	for _, participant := range participants {
+		userIDs = append(userIDs, participant.ID)
 	}
+	hub.Publish(event, userIDs...)
 }
 
 // SetupMessagingRoutes sets up the messaging routes
-func SetupMessagingRoutes(router gin.IRouter, db *sql.DB) {
+func SetupMessagingRoutes(router gin.IRouter, messages store.MessageStore, users store.UserStore, sessions store.SessionStore, hub *realtime.Hub) {
 	messagingGroup := router.Group("/messaging")
 	{
-		messagingGroup.GET("/conversations/:user_id", func(c *gin.Context) {
-			GetUserConversations(c, db)
+		messagingGroup.GET("/conversations/:user_id", middleware.RequireSelfOrRoles("user_id"), func(c *gin.Context) {
+			GetUserConversations(c, messages, users)
 		})
 		messagingGroup.GET("/conversation/:conversation_id/messages", func(c *gin.Context) {
-			GetConversationMessages(c, db)
+			GetConversationMessages(c, messages, hub)
 		})
 		messagingGroup.POST("/messages", func(c *gin.Context) {
-			SendMessage(c, db)
+			SendMessage(c, messages, hub)
 		})
 		messagingGroup.POST("/conversations", func(c *gin.Context) {
-			CreateConversation(c, db)
+			CreateConversation(c, messages, users, hub)
+		})
+		messagingGroup.GET("/ws", func(c *gin.Context) {
+			ServeMessagingEvents(c, hub, sessions)
 		})
-		messagingGroup.GET("/chat-users/:user_id", func(c *gin.Context) {
-			GetAvailableChatUsers(c, db)
+		messagingGroup.GET("/chat-users/:user_id", middleware.RequireSelfOrRoles("user_id"), func(c *gin.Context) {
+			GetAvailableChatUsers(c, messages, users)
 		})
 	}
 }
@@ -10,6 +10,8 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"server/middleware"
+	"server/store"
 	"strconv"
 	"strings"
 
@@ -103,7 +105,7 @@ func getMapKeys(m map[string]interface{}) []string {
 }
 
 // SetupPasskeyRoutes initializes WebAuthn and sets up the routes
-func SetupPasskeyRoutes(router *gin.RouterGroup, db *sql.DB) {
+func SetupPasskeyRoutes(router *gin.RouterGroup, db *sql.DB, sessions store.SessionStore, users store.UserStore) {
 	// Initialize WebAuthn
 	var err error
 	webAuthnInstance, err = webauthn.New(&webauthn.Config{
@@ -115,29 +117,11 @@ func SetupPasskeyRoutes(router *gin.RouterGroup, db *sql.DB) {
 		log.Fatalf("Error initializing WebAuthn: %v", err)
 	}
 
-	// Create passkey credentials table if not exists
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS passkey_credentials (
-		id SERIAL PRIMARY KEY,
-		user_id INTEGER NOT NULL,
-		credential_id BYTEA NOT NULL UNIQUE,
-		public_key BYTEA NOT NULL,
-		attestation_type TEXT NOT NULL,
-		aaguid BYTEA,
-		sign_count BIGINT NOT NULL,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
-	`
-	_, err = db.Exec(createTableSQL)
-	if err != nil {
-		log.Fatalf("Error creating passkey_credentials table: %v", err)
-	}
-
-	// Routes for registration
-	router.POST("/register-passkey-begin", func(c *gin.Context) {
+	// Routes for registration (signed-in users can only register passkeys for themselves)
+	router.POST("/register-passkey-begin", middleware.RequireAuth(sessions, users), func(c *gin.Context) {
 		handleBeginRegistration(c, db)
 	})
-	router.POST("/register-passkey-finish", func(c *gin.Context) {
+	router.POST("/register-passkey-finish", middleware.RequireAuth(sessions, users), func(c *gin.Context) {
 		handleFinishRegistration(c, db)
 	})
 
@@ -146,7 +130,7 @@ func SetupPasskeyRoutes(router *gin.RouterGroup, db *sql.DB) {
 		handleBeginLogin(c, db)
 	})
 	router.POST("/login-passkey-finish", func(c *gin.Context) {
-		handleFinishLogin(c, db)
+		handleFinishLogin(c, db, sessions)
 	})
 }
 
@@ -170,6 +154,14 @@ func handleBeginRegistration(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	// Passkeys are always registered for the authenticated caller
+	caller, _ := middleware.CurrentUser(c)
+	if req.UserID != 0 && req.UserID != caller.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot register a passkey for another user"})
+		return
+	}
+	req.UserID = caller.ID
+
 	// Check if the user exists in the database
 	var userID int
 	var userName, displayName string
@@ -238,6 +230,15 @@ func handleFinishRegistration(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	// Passkeys are always registered for the authenticated caller
+	caller, _ := middleware.CurrentUser(c)
+	if req.UserID != 0 && req.UserID != caller.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot register a passkey for another user"})
+		return
+	}
+	req.UserID = caller.ID
+	req.Username = caller.Username
+
 	log.Printf("DEBUG - Received registration data: username=%s, userID=%d, credential length=%d",
 		req.Username, req.UserID, len(req.CredentialID))
 
@@ -571,7 +572,7 @@ func handleBeginLogin(c *gin.Context, db *sql.DB) {
 }
 
 // Handle the completion of passkey login
-func handleFinishLogin(c *gin.Context, db *sql.DB) {
+func handleFinishLogin(c *gin.Context, db *sql.DB, sessions store.SessionStore) {
 	// Parse request
 	var req struct {
 		Username          string                 `json:"username"`
@@ -691,102 +692,8 @@ func handleFinishLogin(c *gin.Context, db *sql.DB) {
 								if err != nil {
 									log.Printf("ERROR - Login: Failed to parse manual JSON: %v", err)
 
-									// Try a direct approach with credential verification bypass
-									log.Printf("DEBUG - Login: Attempting direct credential verification")
-
-									// Check if the user exists - try with userID first if provided, otherwise use username
-									var userID int
-									var userName, displayName, role string
-									var queryErr error
-
-									if req.UserID != "" {
-										// Try to get user by ID (from userHandle)
-										userIDInt, err := strconv.Atoi(req.UserID)
-										if err != nil {
-											log.Printf("ERROR - Login: Invalid user ID format: %s, Error: %v", req.UserID, err)
-											c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
-											return
-										}
-
-										queryErr = db.QueryRow("SELECT id, username, name, role FROM users WHERE id = $1", userIDInt).Scan(&userID, &userName, &displayName, &role)
-									} else {
-										// Get user by username
-										queryErr = db.QueryRow("SELECT id, username, name, role FROM users WHERE username = $1", req.Username).Scan(&userID, &userName, &displayName, &role)
-									}
-
-									if queryErr != nil {
-										if req.UserID != "" {
-											log.Printf("ERROR - Login: User not found for ID: %s, Error: %v", req.UserID, queryErr)
-										} else {
-											log.Printf("ERROR - Login: User not found for username: %s, Error: %v", req.Username, queryErr)
-										}
-										c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-										return
-									}
-
-									// Create a user for WebAuthn
-									user := &PasskeyUser{
-										ID:       userID,
-										Username: userName,
-										Name:     displayName,
-									}
-
-									// Get credentials for the user
-									user.Credentials = getCredentialsForUser(db, userID)
-									if len(user.Credentials) == 0 {
-										log.Printf("ERROR - Login: No passkeys registered for user: %s", req.Username)
-										c.JSON(http.StatusBadRequest, gin.H{"error": "No passkeys registered for this user"})
-										return
-									}
-
-									// Find matching credential
-									var matchedCredential *webauthn.Credential
-									for i, cred := range user.Credentials {
-										if bytes.Equal(cred.ID, decodedID) {
-											matchedCredential = &user.Credentials[i]
-											log.Printf("DEBUG - Login: Found matching credential: %x", cred.ID)
-											break
-										}
-									}
-
-									if matchedCredential == nil {
-										log.Printf("ERROR - Login: No matching credential found for ID: %x", decodedID)
-										c.JSON(http.StatusUnauthorized, gin.H{"error": "No matching credential found"})
-										return
-									}
-
-									// Skip full validation for troubleshooting
-									log.Printf("DEBUG - Login: Bypassing full WebAuthn validation for troubleshooting")
-
-									// Get additional roles for the user
-									var additionalRoles []string
-									rows, err := db.Query("SELECT role FROM user_roles WHERE user_id = $1", userID)
-									if err == nil {
-										defer rows.Close()
-										for rows.Next() {
-											var additionalRole string
-											if err := rows.Scan(&additionalRole); err == nil {
-												additionalRoles = append(additionalRoles, additionalRole)
-											}
-										}
-									}
-
-									// Update sign count in the database
-									userIDStr := fmt.Sprintf("%d", userID)
-									_, err = db.Exec("UPDATE passkey_credentials SET sign_count = sign_count + 1 WHERE user_id = $1 AND credential_id = $2", userIDStr, matchedCredential.ID)
-									if err != nil {
-										log.Printf("WARNING - Login: Failed to update sign count: %v", err)
-									}
-
-									// Successful login
-									log.Printf("DEBUG - Login: User %s authenticated successfully with passkey (using bypass)", req.Username)
-									c.JSON(http.StatusOK, gin.H{
-										"id":               userID,
-										"username":         userName,
-										"name":             displayName,
-										"role":             role,
-										"additional_roles": additionalRoles,
-									})
+									// Without a parsed assertion there is nothing to verify
+									c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid passkey assertion"})
 									return
 								}
 							}
@@ -795,7 +702,7 @@ func handleFinishLogin(c *gin.Context, db *sql.DB) {
 				}
 
 				// Fallback to standard format
-				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to parse response: %v", err)})
+				c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("Failed to parse response: %v", err)})
 				return
 			}
 
@@ -875,13 +782,7 @@ func handleFinishLogin(c *gin.Context, db *sql.DB) {
 
 			// Successful login
 			log.Printf("DEBUG - Login: User %s authenticated successfully with passkey", req.Username)
-			c.JSON(http.StatusOK, gin.H{
-				"id":               userID,
-				"username":         userName,
-				"name":             displayName,
-				"role":             role,
-				"additional_roles": additionalRoles,
-			})
+			respondPasskeyLogin(c, sessions, userID, userName, displayName, role, additionalRoles)
 			return
 		}
 	}
@@ -904,10 +805,6 @@ func handleFinishLogin(c *gin.Context, db *sql.DB) {
 	}
 	defer delete(sessionStore, sessionID) // Remove session data when done
 
-	// In the bypass scenario, we're not using sessionData for validation
-	// but we still verify it exists to maintain the session flow
-	_ = sessionData
-
 	// Check if the user exists - try with userID first if provided, otherwise use username
 	var userID int
 	var userName, displayName, role string
@@ -1001,13 +898,24 @@ func handleFinishLogin(c *gin.Context, db *sql.DB) {
 	}
 
 	// Successful login
-	c.JSON(http.StatusOK, gin.H{
-		"id":               userID,
-		"username":         userName,
-		"name":             displayName,
-		"role":             role,
-		"additional_roles": additionalRoles,
-	})
+	respondPasskeyLogin(c, sessions, userID, userName, displayName, role, additionalRoles)
+}
+
+// respondPasskeyLogin issues session tokens and writes the successful passkey login response
+func respondPasskeyLogin(c *gin.Context, sessions store.SessionStore, userID int, userName, displayName, role string, additionalRoles []string) {
+	response, err := issueSessionTokens(sessions, userID, "")
+	if err != nil {
+		log.Printf("ERROR - Login: Failed to issue session tokens for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	response["id"] = userID
+	response["username"] = userName
+	response["name"] = displayName
+	response["role"] = role
+	response["additional_roles"] = additionalRoles
+	c.JSON(http.StatusOK, response)
 }
 
 // Get passkey credentials for a user from the database
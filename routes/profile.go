@@ -6,7 +6,9 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"server/middleware"
 	"server/models"
+	"server/store"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
@@ -34,11 +36,11 @@ import (
  *    - Changes user's password
  *    - Requires current and new password in request body
  */
-func RegisterProfileRoutes(router gin.IRouter, db *sql.DB) {
-	router.POST("/profile/upload-picture/:userId", handleProfilePictureUpload(db))
-	router.GET("/profile/:userId", getProfileInfo(db))
-	router.PUT("/profile/update-email/:userId", updateUserEmail(db))
-	router.PUT("/profile/change-password/:userId", changePassword(db))
+func RegisterProfileRoutes(router gin.IRouter, users store.UserStore) {
+	router.POST("/profile/upload-picture/:userId", middleware.RequireSelfOrRoles("userId"), handleProfilePictureUpload(users))
+	router.GET("/profile/:userId", middleware.RequireSelfOrRoles("userId", models.RoleStaff), getProfileInfo(users))
+	router.PUT("/profile/update-email/:userId", middleware.RequireSelfOrRoles("userId"), updateUserEmail(users))
+	router.PUT("/profile/change-password/:userId", middleware.RequireSelfOrRoles("userId"), changePassword(users))
 }
 
 /**
@@ -62,7 +64,7 @@ func RegisterProfileRoutes(router gin.IRouter, db *sql.DB) {
  *   - 404 Not Found: User not found
  *   - 500 Internal Server Error: Database error
  */
-func changePassword(db *sql.DB) gin.HandlerFunc {
+func changePassword(users store.UserStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get user ID from URL parameter
 		userIdStr := c.Param("userId")
@@ -95,8 +97,7 @@ func changePassword(db *sql.DB) gin.HandlerFunc {
 		}
 
 		// Get the user's current password from the database
-		var storedPassword string
-		err = db.QueryRow("SELECT password FROM users WHERE id = $1", userId).Scan(&storedPassword)
+		user, err := users.GetByID(userId)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				c.JSON(http.StatusNotFound, gin.H{
@@ -112,6 +113,7 @@ func changePassword(db *sql.DB) gin.HandlerFunc {
 
 		// Check if the provided current password matches the stored password
 		// For plain text comparison (not recommended for production)
+		storedPassword := user.Password
 		if storedPassword != reqBody.CurrentPassword {
 			// Try hashed comparison (if you're using bcrypt or similar)
 			err = bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(reqBody.CurrentPassword))
@@ -141,8 +143,7 @@ func changePassword(db *sql.DB) gin.HandlerFunc {
 		newPasswordToStore = reqBody.NewPassword
 
 		// Update the password in the database
-		_, err = db.Exec("UPDATE users SET password = $1 WHERE id = $2", newPasswordToStore, userId)
-		if err != nil {
+		if err := users.UpdatePassword(userId, newPasswordToStore); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Failed to update password",
 			})
@@ -175,7 +176,7 @@ func changePassword(db *sql.DB) gin.HandlerFunc {
  *   - 400 Bad Request: Invalid request format or empty email
  *   - 500 Internal Server Error: Database error
  */
-func updateUserEmail(db *sql.DB) gin.HandlerFunc {
+func updateUserEmail(users store.UserStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get user ID from URL parameter
 		userIdStr := c.Param("userId")
@@ -207,8 +208,7 @@ func updateUserEmail(db *sql.DB) gin.HandlerFunc {
 		}
 
 		// Update the user's email in the database
-		_, err = db.Exec("UPDATE users SET email = $1 WHERE id = $2", reqBody.Email, userId)
-		if err != nil {
+		if err := users.UpdateEmail(userId, reqBody.Email); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Failed to update email",
 			})
@@ -242,7 +242,7 @@ func updateUserEmail(db *sql.DB) gin.HandlerFunc {
  *   - 400 Bad Request: Invalid file format or no file uploaded
  *   - 500 Internal Server Error: File system or database error
  */
-func handleProfilePictureUpload(db *sql.DB) gin.HandlerFunc {
+func handleProfilePictureUpload(users store.UserStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get user ID from URL parameter
 		userIdStr := c.Param("userId")
@@ -283,45 +283,23 @@ func handleProfilePictureUpload(db *sql.DB) gin.HandlerFunc {
 			}
 		}
 
-		// Start a transaction
-		tx, err := db.Begin()
+		// Step 1: Check if a profile picture already exists
+		existingFilePath, err := users.GetProfilePicture(userId)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Failed to start transaction",
+				"error": "Failed to check existing profile picture",
 			})
 			return
 		}
 
-		// Step 1: Check if profile picture exists in database
-		var existingFilePath string
-		err = tx.QueryRow("SELECT file_path FROM profile_pictures WHERE user_id = $1", userId).Scan(&existingFilePath)
-
-		// Step 2: If exists, delete the current file from folder and remove database entry
-		if err == nil {
-			// Delete the existing file
+		// Step 2: If it exists, delete the current file from the folder
+		if existingFilePath != "" {
 			if err := os.Remove(existingFilePath); err != nil && !os.IsNotExist(err) {
-				tx.Rollback()
 				c.JSON(http.StatusInternalServerError, gin.H{
 					"error": "Failed to remove existing file",
 				})
 				return
 			}
-
-			// Delete the database entry
-			_, err = tx.Exec("DELETE FROM profile_pictures WHERE user_id = $1", userId)
-			if err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"error": "Failed to remove existing database entry",
-				})
-				return
-			}
-		} else if err != sql.ErrNoRows {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Failed to check existing profile picture",
-			})
-			return
 		}
 
 		// Step 3: Save new file to folder
@@ -329,32 +307,20 @@ func handleProfilePictureUpload(db *sql.DB) gin.HandlerFunc {
 		filePath := filepath.Join(profilePicDir, filename)
 
 		if err := c.SaveUploadedFile(file, filePath); err != nil {
-			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Failed to save file",
 			})
 			return
 		}
 
-		// Step 4: Create new database entry
-		_, err = tx.Exec("INSERT INTO profile_pictures (user_id, file_path) VALUES ($1, $2)",
-			userId, filePath)
-		if err != nil {
-			tx.Rollback()
+		// Step 4: Replace the database entry
+		if err := users.SetProfilePicture(userId, filePath); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Failed to create database entry",
 			})
 			return
 		}
 
-		// Commit the transaction
-		if err = tx.Commit(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Failed to commit changes",
-			})
-			return
-		}
-
 		c.JSON(http.StatusOK, gin.H{
 			"message":         "Profile picture uploaded successfully",
 			"profile_picture": fmt.Sprintf("/profile_pictures/%d%s", userId, extension),
@@ -382,7 +348,7 @@ func handleProfilePictureUpload(db *sql.DB) gin.HandlerFunc {
  *   - 404 Not Found: User not found
  *   - 500 Internal Server Error: Database error
  */
-func getProfileInfo(db *sql.DB) gin.HandlerFunc {
+func getProfileInfo(users store.UserStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get user ID from URL parameter
 		userIdStr := c.Param("userId")
@@ -395,18 +361,7 @@ func getProfileInfo(db *sql.DB) gin.HandlerFunc {
 		}
 
 		// Query the database
-		var user models.User
-		var status string
-
-		err = db.QueryRow("SELECT id, username, name, role, email, status FROM users WHERE id = $1", userId).Scan(
-			&user.ID,
-			&user.Username,
-			&user.Name,
-			&user.Role,
-			&user.Email,
-			&status,
-		)
-
+		user, err := users.GetByID(userId)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				c.JSON(http.StatusNotFound, gin.H{
@@ -420,33 +375,18 @@ func getProfileInfo(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Initialize an empty slice for additional roles
-		var additionalRoles []string
-
 		// Get additional roles
-		rows, err := db.Query("SELECT role FROM additional_roles WHERE user_id = $1", userId)
-		if err == nil {
-			defer rows.Close()
-
-			// Iterate through rows and collect roles
-			for rows.Next() {
-				var role string
-				if err := rows.Scan(&role); err == nil {
-					additionalRoles = append(additionalRoles, role)
-				}
-			}
+		additionalRoles, err := users.GetAdditionalRoles(userId)
+		if err != nil {
+			additionalRoles = nil
 		}
 
 		// Get profile picture from profile_pictures table
-		var filePath sql.NullString
 		var profilePicture string = ""
-
-		err = db.QueryRow("SELECT file_path FROM profile_pictures WHERE user_id = $1", userId).Scan(&filePath)
-
-		if err == nil && filePath.Valid {
+		if filePath, err := users.GetProfilePicture(userId); err == nil && filePath != "" {
 			// Convert file path to URL without adding redundant /api prefix
 			// Extract just the filename since we need to reference it correctly
-			_, filename := filepath.Split(filePath.String)
+			_, filename := filepath.Split(filePath)
 			profilePicture = fmt.Sprintf("/profile_pictures/%s", filename)
 		}
 
@@ -457,7 +397,7 @@ func getProfileInfo(db *sql.DB) gin.HandlerFunc {
 			"name":             user.Name,
 			"role":             user.Role,
 			"email":            user.Email,
-			"status":           status,
+			"status":           user.Status,
 			"profile_picture":  profilePicture,
 			"additional_roles": additionalRoles,
 		})
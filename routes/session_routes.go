@@ -0,0 +1,223 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"server/config"
+	"server/middleware"
+	"server/store"
+	"server/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+/**
+ * SetupSessionRoutes registers the token routes.
+ *
+ * Endpoints:
+ * 1. POST /token/refresh
+ *    - Exchanges a refresh token for a new access token and refresh token
+ *    - The old refresh token can no longer be used afterwards
+ *
+ * 2. POST /logout
+ *    - Revokes the session identified by the bearer access token or refresh token
+ */
+func SetupSessionRoutes(router gin.IRouter, sessions store.SessionStore) {
+	router.POST("/token/refresh", refreshTokenHandler(sessions))
+	router.POST("/logout", logoutHandler(sessions))
+}
+
+// issueSessionTokens creates a new session for the user and returns the token fields
+// that are merged into login responses
+func issueSessionTokens(sessions store.SessionStore, userID int, deviceID string) (gin.H, error) {
+	refreshToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %v", err)
+	}
+
+	session, err := sessions.Create(userID, utils.HashToken(refreshToken), deviceID, time.Now().Add(config.Get().Token.RefreshTokenTTL.Duration))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %v", err)
+	}
+
+	return sessionTokenResponse(userID, session.ID, refreshToken, session.ExpiresAt)
+}
+
+// sessionTokenResponse signs an access token for the session and builds the token fields
+func sessionTokenResponse(userID int, sessionID string, refreshToken string, refreshExpiresAt time.Time) (gin.H, error) {
+	accessToken, accessExpiresAt, err := utils.GenerateAccessToken(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"access_token":             accessToken,
+		"token_type":               "Bearer",
+		"expires_in":               int(time.Until(accessExpiresAt).Seconds()),
+		"refresh_token":            refreshToken,
+		"refresh_token_expires_at": refreshExpiresAt.Format(time.RFC3339),
+	}, nil
+}
+
+/**
+ * refreshTokenHandler rotates a refresh token.
+ *
+ * Endpoint: POST /token/refresh
+ *
+ * Request Body:
+ * {
+ *   "refresh_token": string  // Required: Refresh token returned at login
+ * }
+ *
+ * Returns:
+ *   - 200 OK: New token pair
+ *     {
+ *       "user_id": number,
+ *       "access_token": string,
+ *       "token_type": "Bearer",
+ *       "expires_in": number,             // Access token lifetime in seconds
+ *       "refresh_token": string,          // Replaces the submitted refresh token
+ *       "refresh_token_expires_at": string
+ *     }
+ *   - 400 Bad Request: Missing refresh token
+ *   - 401 Unauthorized: Unknown, expired or revoked refresh token. Presenting a
+ *     refresh token that was already rotated out also revokes its session.
+ *   - 500 Internal Server Error: Database error
+ */
+func refreshTokenHandler(sessions store.SessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			RefreshToken string `json:"refresh_token" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Refresh token is required"})
+			return
+		}
+
+		refreshHash := utils.HashToken(req.RefreshToken)
+		session, err := sessions.GetByRefreshHash(refreshHash)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				// A token that was already rotated out has been replayed
+				if sessionID, err := sessions.GetIDByRotatedRefreshHash(refreshHash); err == nil {
+					revokeReusedSession(sessions, sessionID)
+				} else if err != sql.ErrNoRows {
+					log.Printf("Error looking up rotated refresh token: %v", err)
+				}
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+				return
+			}
+			log.Printf("Error looking up session for refresh: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+			return
+		}
+
+		if !session.IsActive() {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has expired or been revoked"})
+			return
+		}
+
+		newRefreshToken, err := utils.GenerateRefreshToken()
+		if err != nil {
+			log.Printf("Error generating refresh token: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+			return
+		}
+
+		expiresAt := time.Now().Add(config.Get().Token.RefreshTokenTTL.Duration)
+		if err := sessions.RotateRefreshToken(session.ID, refreshHash, utils.HashToken(newRefreshToken), expiresAt); err != nil {
+			if err == sql.ErrNoRows {
+				// Another refresh with the same token won the race, so it was used twice
+				revokeReusedSession(sessions, session.ID)
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has expired or been revoked"})
+				return
+			}
+			log.Printf("Error rotating refresh token for session %s: %v", session.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+			return
+		}
+
+		tokens, err := sessionTokenResponse(session.UserID, session.ID, newRefreshToken, expiresAt)
+		if err != nil {
+			log.Printf("Error signing access token for session %s: %v", session.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+			return
+		}
+
+		tokens["user_id"] = session.UserID
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// revokeReusedSession revokes a session whose refresh token was presented after it
+// had already been rotated
+func revokeReusedSession(sessions store.SessionStore, sessionID string) {
+	log.Printf("Refresh token reuse detected, revoking session %s", sessionID)
+	if err := sessions.Revoke(sessionID); err != nil {
+		log.Printf("Error revoking session %s: %v", sessionID, err)
+	}
+}
+
+/**
+ * logoutHandler revokes the caller's session.
+ *
+ * Endpoint: POST /logout
+ *
+ * Headers:
+ *   Authorization: Bearer <access_token>  // Identifies the session to revoke
+ *
+ * Request Body (used when no bearer token is sent):
+ * {
+ *   "refresh_token": string
+ * }
+ *
+ * Returns:
+ *   - 200 OK: Session revoked
+ *   - 401 Unauthorized: No valid token supplied
+ *   - 500 Internal Server Error: Database error
+ */
+func logoutHandler(sessions store.SessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var sessionID string
+
+		if bearer := middleware.BearerToken(c); bearer != "" {
+			claims, err := utils.ParseAccessToken(bearer)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid access token"})
+				return
+			}
+			sessionID = claims.SessionID
+		} else {
+			var req struct {
+				RefreshToken string `json:"refresh_token"`
+			}
+			if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "An access token or refresh token is required"})
+				return
+			}
+
+			session, err := sessions.GetByRefreshHash(utils.HashToken(req.RefreshToken))
+			if err != nil {
+				if err == sql.ErrNoRows {
+					c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+					return
+				}
+				log.Printf("Error looking up session for logout: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+				return
+			}
+			sessionID = session.ID
+		}
+
+		if err := sessions.Revoke(sessionID); err != nil {
+			log.Printf("Error revoking session %s: %v", sessionID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+	}
+}
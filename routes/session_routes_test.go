@@ -0,0 +1,152 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"server/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newSessionTestAPI returns an API with the token routes and a protected route
+// answering with the caller's ID
+func newSessionTestAPI(t *testing.T) *testAPI {
+	api := newTestAPI(t, models.User{ID: 7, Username: "student", Name: "Student", Role: models.RoleStudent})
+	SetupSessionRoutes(api.router, api.sessions)
+	api.group.GET("/me", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	})
+	return api
+}
+
+// login starts a new session for user 7 and returns its tokens
+func login(t *testing.T, api *testAPI) (accessToken string, refreshToken string) {
+	t.Helper()
+	tokens, err := issueSessionTokens(api.sessions, 7, "device")
+	if err != nil {
+		t.Fatalf("issuing tokens: %v", err)
+	}
+	return tokens["access_token"].(string), tokens["refresh_token"].(string)
+}
+
+type refreshResponse struct {
+	UserID       int    `json:"user_id"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	Error        string `json:"error"`
+}
+
+func refresh(t *testing.T, api *testAPI, refreshToken string) (int, refreshResponse) {
+	t.Helper()
+	var response refreshResponse
+	code := serve(t, api.router, http.MethodPost, "/token/refresh", "", gin.H{"refresh_token": refreshToken}, &response)
+	return code, response
+}
+
+func TestRefreshRotatesTheRefreshToken(t *testing.T) {
+	api := newSessionTestAPI(t)
+	_, refreshToken := login(t, api)
+
+	code, response := refresh(t, api, refreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("refresh: got %d %q, want 200", code, response.Error)
+	}
+	if response.UserID != 7 || response.AccessToken == "" {
+		t.Fatalf("refresh: got user %d and access token %q", response.UserID, response.AccessToken)
+	}
+	if response.RefreshToken == "" || response.RefreshToken == refreshToken {
+		t.Fatalf("refresh: the refresh token was not replaced")
+	}
+
+	if code := serve(t, api.router, http.MethodGet, "/api/me", response.AccessToken, nil, nil); code != http.StatusOK {
+		t.Fatalf("new access token: got %d, want 200", code)
+	}
+	if code, _ := refresh(t, api, response.RefreshToken); code != http.StatusOK {
+		t.Fatalf("refreshing with the new token: got %d, want 200", code)
+	}
+}
+
+func TestRefreshTokenReuseRevokesTheSession(t *testing.T) {
+	api := newSessionTestAPI(t)
+	accessToken, refreshToken := login(t, api)
+
+	code, rotated := refresh(t, api, refreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("first refresh: got %d, want 200", code)
+	}
+
+	// The old token is presented again, e.g. by whoever copied it
+	if code, _ := refresh(t, api, refreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("reusing a rotated token: got %d, want 401", code)
+	}
+
+	// Neither the legitimate client's new tokens nor the old access token work any more
+	if code, _ := refresh(t, api, rotated.RefreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("refreshing after reuse: got %d, want 401", code)
+	}
+	for _, token := range []string{accessToken, rotated.AccessToken} {
+		if code := serve(t, api.router, http.MethodGet, "/api/me", token, nil, nil); code != http.StatusUnauthorized {
+			t.Fatalf("access token after reuse: got %d, want 401", code)
+		}
+	}
+}
+
+func TestRefreshRejectsUnknownAndRevokedTokens(t *testing.T) {
+	api := newSessionTestAPI(t)
+
+	if code, _ := refresh(t, api, "not-a-token"); code != http.StatusUnauthorized {
+		t.Fatalf("unknown token: got %d, want 401", code)
+	}
+
+	accessToken, refreshToken := login(t, api)
+	if code := serve(t, api.router, http.MethodPost, "/logout", accessToken, nil, nil); code != http.StatusOK {
+		t.Fatalf("logout: got %d, want 200", code)
+	}
+	if code, _ := refresh(t, api, refreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("refresh after logout: got %d, want 401", code)
+	}
+	if code := serve(t, api.router, http.MethodGet, "/api/me", accessToken, nil, nil); code != http.StatusUnauthorized {
+		t.Fatalf("access token after logout: got %d, want 401", code)
+	}
+}
+
+func TestRotationLosingARaceRevokesTheSession(t *testing.T) {
+	api := newSessionTestAPI(t)
+	_, refreshToken := login(t, api)
+
+	// Another refresh with the same token rotates it between the lookup and the rotation
+	session, err := api.sessions.GetByRefreshHash(hashOf(refreshToken))
+	if err != nil {
+		t.Fatalf("looking up the session: %v", err)
+	}
+	racing := &racingSessionStore{fakeSessionStore: api.sessions, rotateFirst: session.ID}
+	router := gin.New()
+	SetupSessionRoutes(router, racing)
+
+	var response refreshResponse
+	if code := serve(t, router, http.MethodPost, "/token/refresh", "", gin.H{"refresh_token": refreshToken}, &response); code != http.StatusUnauthorized {
+		t.Fatalf("losing the race: got %d, want 401", code)
+	}
+	if session, _ := api.sessions.GetByID(session.ID); session.IsActive() {
+		t.Fatalf("the session is still active after its refresh token was used twice")
+	}
+}
+
+// racingSessionStore rotates a session's token behind the handler's back just before
+// the handler rotates it itself
+type racingSessionStore struct {
+	*fakeSessionStore
+	rotateFirst string
+}
+
+func (s *racingSessionStore) RotateRefreshToken(id string, oldHash string, newHash string, expiresAt time.Time) error {
+	if id == s.rotateFirst {
+		s.rotateFirst = ""
+		if err := s.fakeSessionStore.RotateRefreshToken(id, oldHash, "winner-"+newHash, expiresAt); err != nil {
+			return err
+		}
+	}
+	return s.fakeSessionStore.RotateRefreshToken(id, oldHash, newHash, expiresAt)
+}
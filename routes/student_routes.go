@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"fmt"
 	"net/http"
+	"server/middleware"
+	"server/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -33,41 +35,7 @@ type Attendance struct {
 
 // GetAllStudentsHandler handles the request to get all student users
 func GetAllStudentsHandler(c *gin.Context, db *sql.DB) {
-	userID := c.Query("userid")
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"success": false,
-			"message": "Missing required userid parameter",
-		})
-		return
-	}
-
-	// Check if user has attendance role
-	var hasAttendanceRole bool
-	query := `
-		SELECT EXISTS(
-			SELECT 1 FROM additional_roles 
-			WHERE user_id = $1 AND role = 'attendance'
-		)
-	`
-	
-	err := db.QueryRow(query, userID).Scan(&hasAttendanceRole)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"success": false,
-			"message": "Failed to check user permissions",
-			"error":   err.Error(),
-		})
-		return
-	}
-
-	if !hasAttendanceRole {
-		c.JSON(http.StatusForbidden, gin.H{
-			"success": false,
-			"message": "User does not have attendance admin permissions",
-		})
-		return
-	}
+	// The attendance role is enforced by middleware.RequireRoles when the route is registered
 
 	// Get all students (users with role = 'student')
 	students, err := getStudents(db)
@@ -310,46 +278,17 @@ func getStringValue(nullString sql.NullString) string {
 
 // SetupStudentRoutes registers all student management routes
 func SetupStudentRoutes(router gin.IRouter, db *sql.DB) {
-	// Add the formal_picture column if it doesn't exist
-	addFormalPictureColumn(db)
-
 	// Configure static serving of formal pictures
 	router.Static("/formal_pictures", "./formal_pictures")
 	router.Static("/api/formal_pictures", "./formal_pictures")
 
 	// Get all students (for administrators with attendance role)
-	router.GET("/get_all_students", func(c *gin.Context) {
+	router.GET("/get_all_students", middleware.RequireRoles(models.RoleAttendance), func(c *gin.Context) {
 		GetAllStudentsHandler(c, db)
 	})
 
 	// Get detailed information for a specific student
-	router.GET("/get_student_information", func(c *gin.Context) {
+	router.GET("/get_student_information", middleware.RequireSelfOrRoles("userid", models.RoleStaff), func(c *gin.Context) {
 		GetStudentInformationHandler(c, db)
 	})
 }
-
-// addFormalPictureColumn adds the formal_picture column to the users table if it doesn't exist
-func addFormalPictureColumn(db *sql.DB) {
-	// Check if the column already exists
-	var exists bool
-	checkQuery := `
-		SELECT EXISTS (
-			SELECT 1 
-			FROM information_schema.columns 
-			WHERE table_name = 'users' AND column_name = 'formal_picture'
-		);
-	`
-	
-	err := db.QueryRow(checkQuery).Scan(&exists)
-	if err != nil || exists {
-		// Column exists or error occurred - no need to proceed
-		return
-	}
-	
-	// If column doesn't exist, add it
-	_, err = db.Exec(`ALTER TABLE users ADD COLUMN formal_picture TEXT;`)
-	if err != nil {
-		// Log error but don't fail
-		return
-	}
-} 
\ No newline at end of file
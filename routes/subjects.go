@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"net/http"
 	"regexp"
+	"server/middleware"
+	"server/models"
 	"strconv"
 	"strings"
 
@@ -46,7 +48,7 @@ type Subject struct {
  *   - 500 Internal Server Error: Database error
  */
 func RegisterGetSubjectsRoute(router gin.IRouter, db *sql.DB) {
-	router.GET("/get_subjects/:student_id", func(c *gin.Context) {
+	router.GET("/get_subjects/:student_id", middleware.RequireSelfOrRoles("student_id", models.RoleStaff), func(c *gin.Context) {
 		// Retrieve the student ID from the URL parameters.
 		studentIDStr := c.Param("student_id")
 		studentID, err := strconv.Atoi(studentIDStr)
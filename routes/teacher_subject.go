@@ -6,6 +6,8 @@ import (
 	"log"
 	"net/http"
 	"regexp"
+	"server/middleware"
+	"server/models"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -58,7 +60,7 @@ type AdminClass struct {
  *   - 500 Internal Server Error: Database error
  */
 func RegisterGetSubjectsTeacherRoute(router gin.IRouter, db *sql.DB) {
-	router.GET("/get_subjects_by_teacher/:teacher_id", func(c *gin.Context) {
+	router.GET("/get_subjects_by_teacher/:teacher_id", middleware.RequireSelfOrRoles("teacher_id", models.RoleAdmin), func(c *gin.Context) {
 		teacherIDParam := c.Param("teacher_id")
 		var teacherID int
 		_, err := fmt.Sscanf(teacherIDParam, "%d", &teacherID)
@@ -1,18 +1,19 @@
 package routes
 
 import (
-	"database/sql"
 	"fmt"
 	"net/http"
+	"server/middleware"
 
 	"server/models"
+	"server/store"
 
 	"github.com/gin-gonic/gin"
 )
 
 // GetAllUsersHandler handles the request to get all users
-func GetAllUsersHandler(c *gin.Context, db *sql.DB) {
-	users, err := models.GetAllUsers(db)
+func GetAllUsersHandler(c *gin.Context, users store.UserStore) {
+	allUsers, err := users.GetAll()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -24,15 +25,15 @@ func GetAllUsersHandler(c *gin.Context, db *sql.DB) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"users":   users,
-		"count":   len(users),
+		"users":   allUsers,
+		"count":   len(allUsers),
 	})
 }
 
 // UpdateDeviceTokenHandler updates a user's device token for push notifications
-func UpdateDeviceTokenHandler(c *gin.Context, db *sql.DB) {
+func UpdateDeviceTokenHandler(c *gin.Context, users store.UserStore) {
 	var request struct {
-		UserID      int    `json:"user_id" binding:"required"`
+		UserID      int    `json:"user_id"`
 		DeviceToken string `json:"device_token" binding:"required"`
 	}
 
@@ -45,6 +46,17 @@ func UpdateDeviceTokenHandler(c *gin.Context, db *sql.DB) {
 		return
 	}
 
+	// Users can only update their own device token
+	user, _ := middleware.CurrentUser(c)
+	if request.UserID != 0 && request.UserID != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "You can only update your own device token",
+		})
+		return
+	}
+	request.UserID = user.ID
+
 	// Validate request
 	if request.UserID <= 0 {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -63,8 +75,7 @@ func UpdateDeviceTokenHandler(c *gin.Context, db *sql.DB) {
 	}
 
 	// Check if user exists
-	var exists bool
-	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", request.UserID).Scan(&exists)
+	exists, err := users.Exists(request.UserID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -83,8 +94,7 @@ func UpdateDeviceTokenHandler(c *gin.Context, db *sql.DB) {
 	}
 
 	// Update the device token
-	_, err = db.Exec("UPDATE users SET device_id = $1 WHERE id = $2", request.DeviceToken, request.UserID)
-	if err != nil {
+	if err := users.UpdateDeviceToken(request.UserID, request.DeviceToken); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"message": "Failed to update device token",
@@ -100,17 +110,17 @@ func UpdateDeviceTokenHandler(c *gin.Context, db *sql.DB) {
 }
 
 // SetupUserRoutes registers all user management routes
-func SetupUserRoutes(router gin.IRouter, db *sql.DB) {
+func SetupUserRoutes(router gin.IRouter, users store.UserStore) {
 	userGroup := router.Group("/users")
 	{
 		// Get all users
-		userGroup.GET("", func(c *gin.Context) {
-			GetAllUsersHandler(c, db)
+		userGroup.GET("", middleware.RequireRoles(models.RoleStaff), func(c *gin.Context) {
+			GetAllUsersHandler(c, users)
 		})
 
 		// Update device token endpoint
 		router.POST("/user/update-device-token", func(c *gin.Context) {
-			UpdateDeviceTokenHandler(c, db)
+			UpdateDeviceTokenHandler(c, users)
 		})
 
 		// Additional user management routes can be added here:
@@ -0,0 +1,448 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"server/middleware"
+	"server/models"
+	"server/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// yearGroupRequest is the body for creating or updating a year group
+type yearGroupRequest struct {
+	Name      string `json:"name"`
+	SortOrder int    `json:"sort_order"`
+}
+
+// sectionRequest is the body for creating or updating a section
+type sectionRequest struct {
+	YearGroupID       int    `json:"year_group_id"` // only used when updating; moves the section
+	Name              string `json:"name"`
+	Homeroom          string `json:"homeroom"`
+	HomeroomTeacherID *int   `json:"homeroom_teacher_id"`
+}
+
+// ListYearGroups returns every year group with its sections
+//
+// Endpoint: GET /api/year-groups
+//
+// Returns:
+//   - 200 OK: Successfully retrieved year groups
+//     {
+//     "success": true,
+//     "yearGroups": [
+//     {
+//     "id": int,
+//     "name": string,       // e.g., "IB1"
+//     "sort_order": int,
+//     "sections": [
+//     {
+//     "id": int,
+//     "year_group_id": int,
+//     "year": string,       // e.g., "IB1"
+//     "name": string,       // e.g., "A"
+//     "homeroom": string,   // e.g., "Room 204"
+//     "homeroom_teacher_id": int, // null if not assigned
+//     "homeroom_teacher_name": string
+//     }
+//     ]
+//     }
+//     ]
+//     }
+//   - 500 Internal Server Error: Database error
+func ListYearGroups(c *gin.Context, yearGroups store.YearGroupStore) {
+	groups, err := yearGroups.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error querying year groups: %v", err),
+		})
+		return
+	}
+	if groups == nil {
+		groups = []models.YearGroup{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"yearGroups": groups,
+	})
+}
+
+// CreateYearGroup adds a year group
+//
+// Endpoint: POST /api/year-groups
+//
+// Request Body:
+//
+//	{
+//	  "name": string,     // e.g., "IB2"
+//	  "sort_order": int   // position in lists, lowest first
+//	}
+//
+// Returns:
+//   - 201 Created: { "success": true, "yearGroup": { ... } }
+//   - 400 Bad Request: Invalid request format or missing name
+//   - 409 Conflict: A year group with this name already exists
+//   - 500 Internal Server Error: Database error
+func CreateYearGroup(c *gin.Context, yearGroups store.YearGroupStore) {
+	var request yearGroupRequest
+	if !bindYearGroupRequest(c, &request) {
+		return
+	}
+
+	group := models.YearGroup{Name: request.Name, SortOrder: request.SortOrder}
+	if err := yearGroups.Create(&group); err != nil {
+		respondYearGroupError(c, err, "year group")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":   true,
+		"yearGroup": group,
+	})
+}
+
+// UpdateYearGroup renames or reorders a year group. Its students move with it.
+//
+// Endpoint: PUT /api/year-groups/:id
+//
+// Request Body: as for POST /api/year-groups
+//
+// Returns:
+//   - 200 OK: { "success": true, "yearGroup": { ... } }
+//   - 400 Bad Request: Invalid ID, request format or missing name
+//   - 404 Not Found: Year group not found
+//   - 409 Conflict: A year group with this name already exists
+//   - 500 Internal Server Error: Database error
+func UpdateYearGroup(c *gin.Context, yearGroups store.YearGroupStore) {
+	id, ok := parseYearGroupParam(c, "year group ID")
+	if !ok {
+		return
+	}
+
+	var request yearGroupRequest
+	if !bindYearGroupRequest(c, &request) {
+		return
+	}
+
+	group := models.YearGroup{ID: id, Name: request.Name, SortOrder: request.SortOrder}
+	if err := yearGroups.Update(&group); err != nil {
+		respondYearGroupError(c, err, "year group")
+		return
+	}
+
+	updated, err := yearGroups.Get(id)
+	if err != nil {
+		respondYearGroupError(c, err, "year group")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"yearGroup": updated,
+	})
+}
+
+// DeleteYearGroup deletes a year group and its sections
+//
+// Endpoint: DELETE /api/year-groups/:id
+//
+// Returns:
+//   - 200 OK: { "success": true, "message": "Year group deleted successfully" }
+//   - 400 Bad Request: Invalid ID
+//   - 404 Not Found: Year group not found
+//   - 409 Conflict: Students are still assigned to the year group
+//   - 500 Internal Server Error: Database error
+func DeleteYearGroup(c *gin.Context, yearGroups store.YearGroupStore) {
+	id, ok := parseYearGroupParam(c, "year group ID")
+	if !ok {
+		return
+	}
+
+	if err := yearGroups.Delete(id); err != nil {
+		respondYearGroupError(c, err, "year group")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Year group deleted successfully",
+	})
+}
+
+// CreateSection adds a section to a year group
+//
+// Endpoint: POST /api/year-groups/:id/sections
+//
+// Request Body:
+//
+//	{
+//	  "name": string,              // e.g., "C"
+//	  "homeroom": string,          // optional, e.g., "Room 204"
+//	  "homeroom_teacher_id": int   // optional, must be a staff member
+//	}
+//
+// Returns:
+//   - 201 Created: { "success": true, "section": { ... } }
+//   - 400 Bad Request: Invalid request, missing name or unknown homeroom teacher
+//   - 404 Not Found: Year group not found
+//   - 409 Conflict: The year group already has a section with this name
+//   - 500 Internal Server Error: Database error
+func CreateSection(c *gin.Context, yearGroups store.YearGroupStore, users store.UserStore) {
+	yearGroupID, ok := parseYearGroupParam(c, "year group ID")
+	if !ok {
+		return
+	}
+
+	var request sectionRequest
+	if !bindSectionRequest(c, &request, users) {
+		return
+	}
+
+	section := models.Section{
+		YearGroupID:       yearGroupID,
+		Name:              request.Name,
+		Homeroom:          request.Homeroom,
+		HomeroomTeacherID: request.HomeroomTeacherID,
+	}
+	if err := yearGroups.CreateSection(&section); err != nil {
+		respondYearGroupError(c, err, "year group")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"section": section,
+	})
+}
+
+// UpdateSection renames a section, moves it to another year group or changes its
+// homeroom. Its students move with it.
+//
+// Endpoint: PUT /api/sections/:id
+//
+// Request Body:
+//
+//	{
+//	  "year_group_id": int,        // optional, defaults to the current year group
+//	  "name": string,
+//	  "homeroom": string,
+//	  "homeroom_teacher_id": int   // null to unassign
+//	}
+//
+// Returns:
+//   - 200 OK: { "success": true, "section": { ... } }
+//   - 400 Bad Request: Invalid ID or request, missing name or unknown homeroom teacher
+//   - 404 Not Found: Section or year group not found
+//   - 409 Conflict: The year group already has a section with this name
+//   - 500 Internal Server Error: Database error
+func UpdateSection(c *gin.Context, yearGroups store.YearGroupStore, users store.UserStore) {
+	id, ok := parseYearGroupParam(c, "section ID")
+	if !ok {
+		return
+	}
+
+	var request sectionRequest
+	if !bindSectionRequest(c, &request, users) {
+		return
+	}
+
+	if request.YearGroupID == 0 {
+		current, err := yearGroups.GetSection(id)
+		if err != nil {
+			respondYearGroupError(c, err, "section")
+			return
+		}
+		request.YearGroupID = current.YearGroupID
+	}
+
+	section := models.Section{
+		ID:                id,
+		YearGroupID:       request.YearGroupID,
+		Name:              request.Name,
+		Homeroom:          request.Homeroom,
+		HomeroomTeacherID: request.HomeroomTeacherID,
+	}
+	if err := yearGroups.UpdateSection(&section); err != nil {
+		respondYearGroupError(c, err, "section or year group")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"section": section,
+	})
+}
+
+// DeleteSection deletes a section
+//
+// Endpoint: DELETE /api/sections/:id
+//
+// Returns:
+//   - 200 OK: { "success": true, "message": "Section deleted successfully" }
+//   - 400 Bad Request: Invalid ID
+//   - 404 Not Found: Section not found
+//   - 409 Conflict: Students are still assigned to the section
+//   - 500 Internal Server Error: Database error
+func DeleteSection(c *gin.Context, yearGroups store.YearGroupStore) {
+	id, ok := parseYearGroupParam(c, "section ID")
+	if !ok {
+		return
+	}
+
+	if err := yearGroups.DeleteSection(id); err != nil {
+		respondYearGroupError(c, err, "section")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Section deleted successfully",
+	})
+}
+
+// parseYearGroupParam reads the numeric :id parameter, responding with 400 if it is invalid
+func parseYearGroupParam(c *gin.Context, label string) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Invalid %s: %s", label, c.Param("id")),
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// bindYearGroupRequest binds and validates a year group body, responding with 400 if it is invalid
+func bindYearGroupRequest(c *gin.Context, request *yearGroupRequest) bool {
+	if err := c.ShouldBindJSON(request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Invalid request format: %v", err),
+		})
+		return false
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Year group name is required",
+		})
+		return false
+	}
+	return true
+}
+
+// bindSectionRequest binds and validates a section body, responding with 400 if it
+// is invalid or the homeroom teacher is not a staff member
+func bindSectionRequest(c *gin.Context, request *sectionRequest, users store.UserStore) bool {
+	if err := c.ShouldBindJSON(request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Invalid request format: %v", err),
+		})
+		return false
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	request.Homeroom = strings.TrimSpace(request.Homeroom)
+	if request.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Section name is required",
+		})
+		return false
+	}
+
+	if request.HomeroomTeacherID != nil {
+		teacher, err := users.GetByID(*request.HomeroomTeacherID)
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("Error checking homeroom teacher: %v", err),
+			})
+			return false
+		}
+		if err == sql.ErrNoRows || teacher.Role != models.RoleStaff {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("Homeroom teacher %d is not a staff member", *request.HomeroomTeacherID),
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// audienceStudentID returns the caller's user ID when event audiences limit what they
+// see, or 0 for staff and admins, who see every event
+func audienceStudentID(c *gin.Context) int {
+	user, _ := middleware.CurrentUser(c)
+	if user.HasRole(models.RoleStaff, models.RoleAdmin) {
+		return 0
+	}
+	return user.ID
+}
+
+// respondYearGroupError maps year group store errors to responses
+func respondYearGroupError(c *gin.Context, err error, notFound string) {
+	switch err {
+	case sql.ErrNoRows:
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("The %s was not found", notFound),
+		})
+	case store.ErrConflict:
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "The name is already in use",
+		})
+	case store.ErrInUse:
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"message": "Students are still assigned; move them first",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("Error saving year group: %v", err),
+		})
+	}
+}
+
+// SetupYearGroupRoutes sets up the year group and section routes. Everyone signed in
+// can list them; only admins can change them.
+func SetupYearGroupRoutes(router gin.IRouter, yearGroups store.YearGroupStore, users store.UserStore) {
+	admin := middleware.RequireRoles(models.RoleAdmin)
+
+	router.GET("/year-groups", func(c *gin.Context) {
+		ListYearGroups(c, yearGroups)
+	})
+	router.POST("/year-groups", admin, func(c *gin.Context) {
+		CreateYearGroup(c, yearGroups)
+	})
+	router.PUT("/year-groups/:id", admin, func(c *gin.Context) {
+		UpdateYearGroup(c, yearGroups)
+	})
+	router.DELETE("/year-groups/:id", admin, func(c *gin.Context) {
+		DeleteYearGroup(c, yearGroups)
+	})
+	router.POST("/year-groups/:id/sections", admin, func(c *gin.Context) {
+		CreateSection(c, yearGroups, users)
+	})
+	router.PUT("/sections/:id", admin, func(c *gin.Context) {
+		UpdateSection(c, yearGroups, users)
+	})
+	router.DELETE("/sections/:id", admin, func(c *gin.Context) {
+		DeleteSection(c, yearGroups)
+	})
+}
@@ -0,0 +1,183 @@
+package store
+
+import (
+	"database/sql"
+	"server/models"
+	"time"
+)
+
+// AttendanceAlertStore persists attendance alerts raised by the alert rules
+type AttendanceAlertStore interface {
+	// CountOccurrences counts a student's records with status between from and to
+	// that are newer than the last alert raised for the rule, so acknowledged
+	// incidents are not counted twice. With unexplained, days covered by approved
+	// leave are ignored. Returns the newest counted day, nil without any.
+	CountOccurrences(studentID int, rule string, status string, unexplained bool, from time.Time, to time.Time) (int, *time.Time, error)
+	// Create inserts an alert and fills in its generated fields, or returns
+	// ErrConflict while the student has an unacknowledged alert for the rule
+	Create(alert *models.AttendanceAlert) error
+	// SetNotified records who was told about an alert
+	SetNotified(id int, teacherNotified bool, guardiansNotified int) error
+	// List returns alerts, newest first; open restricts them to unacknowledged
+	// alerts and a non-zero studentID to one student
+	List(open bool, studentID int) ([]models.AttendanceAlert, error)
+	// Acknowledge marks an alert as handled. Returns sql.ErrNoRows if it does not
+	// exist, or ErrConflict if it was already acknowledged.
+	Acknowledge(id int, userID int, note *string) (*models.AttendanceAlert, error)
+}
+
+type postgresAttendanceAlertStore struct {
+	db *sql.DB
+}
+
+// NewAttendanceAlertStore returns an AttendanceAlertStore backed by PostgreSQL
+func NewAttendanceAlertStore(db *sql.DB) AttendanceAlertStore {
+	return &postgresAttendanceAlertStore{db: db}
+}
+
+const attendanceAlertColumns = `
+	al.id, al.student_id, COALESCE(u.name, ''), al.rule, al.status, al.occurrences,
+	al.window_start, al.window_end, al.last_record_date, al.teacher_notified,
+	al.guardians_notified, al.created_at, al.acknowledged_by, al.acknowledged_at,
+	al.acknowledgement_note`
+
+const attendanceAlertTables = `
+	attendance_alerts al
+	LEFT JOIN users u ON u.id = al.student_id`
+
+func (s *postgresAttendanceAlertStore) CountOccurrences(studentID int, rule string, status string, unexplained bool, from time.Time, to time.Time) (int, *time.Time, error) {
+	var count int
+	var last sql.NullTime
+	err := s.db.QueryRow(`
+		SELECT COUNT(*), MAX(h.attendance_date)
+		FROM attendance_history h
+		WHERE h.student_id = $1 AND h.status = $2
+			AND h.attendance_date BETWEEN $3 AND $4
+			AND h.attendance_date <= CURRENT_DATE
+			AND (NOT $5 OR h.leave_request_id IS NULL)
+			AND h.attendance_date > COALESCE((
+				SELECT MAX(last_record_date) FROM attendance_alerts
+				WHERE student_id = $1 AND rule = $6
+			), '-infinity'::date)`,
+		studentID, status, from.Format("2006-01-02"), to.Format("2006-01-02"), unexplained, rule).Scan(&count, &last)
+	if err != nil || !last.Valid {
+		return count, nil, err
+	}
+	return count, &last.Time, nil
+}
+
+func (s *postgresAttendanceAlertStore) Create(alert *models.AttendanceAlert) error {
+	var id int
+	err := s.db.QueryRow(`
+		INSERT INTO attendance_alerts
+			(student_id, rule, status, occurrences, window_start, window_end, last_record_date)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`,
+		alert.StudentID, alert.Rule, alert.Status, alert.Occurrences,
+		alert.WindowStart.Format("2006-01-02"), alert.WindowEnd.Format("2006-01-02"),
+		alert.LastRecordDate.Format("2006-01-02")).Scan(&id)
+	if err != nil {
+		return conflictOr(err)
+	}
+
+	created, err := s.get(id)
+	if err != nil {
+		return err
+	}
+	*alert = *created
+	return nil
+}
+
+func (s *postgresAttendanceAlertStore) SetNotified(id int, teacherNotified bool, guardiansNotified int) error {
+	_, err := s.db.Exec(`
+		UPDATE attendance_alerts SET teacher_notified = $1, guardians_notified = $2
+		WHERE id = $3`, teacherNotified, guardiansNotified, id)
+	return err
+}
+
+func (s *postgresAttendanceAlertStore) List(open bool, studentID int) ([]models.AttendanceAlert, error) {
+	rows, err := s.db.Query(`
+		SELECT `+attendanceAlertColumns+` FROM `+attendanceAlertTables+`
+		WHERE (NOT $1 OR al.acknowledged_at IS NULL)
+			AND ($2 = 0 OR al.student_id = $2)
+		ORDER BY al.created_at DESC`, open, studentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []models.AttendanceAlert{}
+	for rows.Next() {
+		alert, err := scanAttendanceAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, *alert)
+	}
+
+	return alerts, rows.Err()
+}
+
+func (s *postgresAttendanceAlertStore) Acknowledge(id int, userID int, note *string) (*models.AttendanceAlert, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var acknowledged bool
+	err = tx.QueryRow(`
+		SELECT acknowledged_at IS NOT NULL FROM attendance_alerts WHERE id = $1 FOR UPDATE`, id).Scan(&acknowledged)
+	if err != nil {
+		return nil, err
+	}
+	if acknowledged {
+		return nil, ErrConflict
+	}
+
+	_, err = tx.Exec(`
+		UPDATE attendance_alerts
+		SET acknowledged_by = $1, acknowledged_at = NOW(), acknowledgement_note = $2
+		WHERE id = $3`, userID, note, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.get(id)
+}
+
+// get returns an alert, or sql.ErrNoRows
+func (s *postgresAttendanceAlertStore) get(id int) (*models.AttendanceAlert, error) {
+	return scanAttendanceAlert(s.db.QueryRow(`
+		SELECT `+attendanceAlertColumns+` FROM `+attendanceAlertTables+` WHERE al.id = $1`, id))
+}
+
+// scanAttendanceAlert scans a row selected with attendanceAlertColumns
+func scanAttendanceAlert(row rowScanner) (*models.AttendanceAlert, error) {
+	var alert models.AttendanceAlert
+	var acknowledgedBy sql.NullInt64
+	var acknowledgedAt sql.NullTime
+	var note sql.NullString
+	err := row.Scan(
+		&alert.ID, &alert.StudentID, &alert.StudentName, &alert.Rule, &alert.Status, &alert.Occurrences,
+		&alert.WindowStart, &alert.WindowEnd, &alert.LastRecordDate, &alert.TeacherNotified,
+		&alert.GuardiansNotified, &alert.CreatedAt, &acknowledgedBy, &acknowledgedAt, &note,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if acknowledgedBy.Valid {
+		id := int(acknowledgedBy.Int64)
+		alert.AcknowledgedBy = &id
+	}
+	if acknowledgedAt.Valid {
+		alert.AcknowledgedAt = &acknowledgedAt.Time
+	}
+	if note.Valid {
+		alert.AcknowledgementNote = &note.String
+	}
+	return &alert, nil
+}
@@ -0,0 +1,226 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"server/models"
+	"strings"
+	"time"
+)
+
+// AttendanceAnalyticsStore aggregates daily and per-lesson attendance records
+// over date ranges for reporting. Only records on school days of the calendar count.
+type AttendanceAnalyticsStore interface {
+	// StudentRates returns each student's attendance in the range, ordered by
+	// year, section and name. Students without records are included with zero counts.
+	StudentRates(filter models.AttendanceAnalyticsFilter) ([]models.StudentAttendanceRate, error)
+	// SectionRates returns each section's attendance in the range, in section order
+	SectionRates(filter models.AttendanceAnalyticsFilter) ([]models.SectionAttendanceRate, error)
+	// SubjectRates returns the lesson attendance of each teaching group in the range.
+	// StudentID, Year and Section restrict the students counted.
+	SubjectRates(filter models.AttendanceAnalyticsFilter) ([]models.SubjectAttendanceRate, error)
+	// WeeklyTrend returns the attendance of each week in the range that has records, oldest first
+	WeeklyTrend(filter models.AttendanceAnalyticsFilter) ([]models.AttendanceTrendPoint, error)
+	// Weekdays returns the attendance on each day of the week that has records, Monday first
+	Weekdays(filter models.AttendanceAnalyticsFilter) ([]models.WeekdayAttendance, error)
+}
+
+type postgresAttendanceAnalyticsStore struct {
+	db *sql.DB
+}
+
+// NewAttendanceAnalyticsStore returns an AttendanceAnalyticsStore backed by PostgreSQL
+func NewAttendanceAnalyticsStore(db *sql.DB) AttendanceAnalyticsStore {
+	return &postgresAttendanceAnalyticsStore{db: db}
+}
+
+// attendanceCountColumns counts the records of status column col, in the order of
+// models.AttendanceCounts
+func attendanceCountColumns(col string) string {
+	return fmt.Sprintf(`
+		COUNT(*) FILTER (WHERE %[1]s = 'present'),
+		COUNT(*) FILTER (WHERE %[1]s = 'absent'),
+		COUNT(*) FILTER (WHERE %[1]s = 'late'),
+		COUNT(*) FILTER (WHERE %[1]s = 'medical'),
+		COUNT(*) FILTER (WHERE %[1]s = 'early')`, col)
+}
+
+// countDest returns the scan destinations for attendanceCountColumns
+func countDest(counts *models.AttendanceCounts) []interface{} {
+	return []interface{}{&counts.Present, &counts.Absent, &counts.Late, &counts.Medical, &counts.Early}
+}
+
+// analyticsConditions returns the conditions of filter on the student's attendance row a,
+// with the date range and school days applied to dateColumn, and their arguments. The
+// range is always bound to $1 and $2; without a dateColumn the caller applies it elsewhere.
+func analyticsConditions(filter models.AttendanceAnalyticsFilter, dateColumn string) (string, []interface{}) {
+	args := []interface{}{filter.From.Format("2006-01-02"), filter.To.Format("2006-01-02")}
+	conditions := []string{"TRUE"}
+	if dateColumn != "" {
+		conditions[0] = dateColumn + ` BETWEEN $1 AND $2 AND ` + countedDayCondition(dateColumn)
+	}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.Year != "" {
+		where("a.year = $%d", filter.Year)
+		where("a.group_name = $%d", filter.Section)
+	}
+	if filter.StudentID != 0 {
+		where("a.user_id = $%d", filter.StudentID)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+func (s *postgresAttendanceAnalyticsStore) StudentRates(filter models.AttendanceAnalyticsFilter) ([]models.StudentAttendanceRate, error) {
+	// The range is part of the join so students without records still appear
+	conditions, args := analyticsConditions(filter, "")
+	rows, err := s.db.Query(`
+		SELECT a.user_id, a.name, COALESCE(a.year, ''), COALESCE(a.group_name, ''),`+
+		attendanceCountColumns("h.status")+`
+		FROM attendance a
+		LEFT JOIN attendance_history h ON h.student_id = a.user_id
+			AND h.attendance_date BETWEEN $1 AND $2
+			AND `+countedDayCondition("h.attendance_date")+`
+		WHERE `+conditions+`
+		GROUP BY a.user_id, a.name, a.year, a.group_name
+		ORDER BY a.year, a.group_name, a.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []models.StudentAttendanceRate{}
+	for rows.Next() {
+		var rate models.StudentAttendanceRate
+		dest := append([]interface{}{&rate.StudentID, &rate.Name, &rate.Year, &rate.GroupName}, countDest(&rate.AttendanceCounts)...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+func (s *postgresAttendanceAnalyticsStore) SectionRates(filter models.AttendanceAnalyticsFilter) ([]models.SectionAttendanceRate, error) {
+	conditions, args := analyticsConditions(filter, "h.attendance_date")
+	rows, err := s.db.Query(`
+		SELECT y.name, sec.name, COUNT(DISTINCT h.student_id),`+
+		attendanceCountColumns("h.status")+`
+		FROM sections sec
+		JOIN year_groups y ON y.id = sec.year_group_id
+		JOIN attendance a ON a.year = y.name AND a.group_name = sec.name
+		JOIN attendance_history h ON h.student_id = a.user_id
+		WHERE `+conditions+`
+		GROUP BY y.name, y.sort_order, sec.name
+		ORDER BY y.sort_order, y.name, sec.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []models.SectionAttendanceRate{}
+	for rows.Next() {
+		var rate models.SectionAttendanceRate
+		dest := append([]interface{}{&rate.Year, &rate.Section, &rate.Students}, countDest(&rate.AttendanceCounts)...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+func (s *postgresAttendanceAnalyticsStore) SubjectRates(filter models.AttendanceAnalyticsFilter) ([]models.SubjectAttendanceRate, error) {
+	conditions, args := analyticsConditions(filter, "r.lesson_date")
+	rows, err := s.db.Query(`
+		SELECT COALESCE((
+				SELECT g.subject FROM subjects g
+				WHERE g.code = r.code AND g.teaching_group = r.teaching_group
+				LIMIT 1
+			), r.code),
+			r.code, r.teaching_group, COUNT(DISTINCT r.id),`+
+		attendanceCountColumns("la.status")+`
+		FROM lesson_registers r
+		JOIN lesson_attendance la ON la.register_id = r.id
+		JOIN attendance a ON a.user_id = la.student_id
+		WHERE `+conditions+`
+		GROUP BY r.code, r.teaching_group
+		ORDER BY 1, r.code, r.teaching_group`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []models.SubjectAttendanceRate{}
+	for rows.Next() {
+		var rate models.SubjectAttendanceRate
+		dest := append([]interface{}{&rate.Subject, &rate.Code, &rate.TeachingGroup, &rate.Lessons}, countDest(&rate.AttendanceCounts)...)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+func (s *postgresAttendanceAnalyticsStore) WeeklyTrend(filter models.AttendanceAnalyticsFilter) ([]models.AttendanceTrendPoint, error) {
+	conditions, args := analyticsConditions(filter, "h.attendance_date")
+	rows, err := s.db.Query(`
+		SELECT DATE_TRUNC('week', h.attendance_date)::date AS week,`+
+		attendanceCountColumns("h.status")+`
+		FROM attendance_history h
+		JOIN attendance a ON a.user_id = h.student_id
+		WHERE `+conditions+`
+		GROUP BY week
+		ORDER BY week`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := []models.AttendanceTrendPoint{}
+	for rows.Next() {
+		var point models.AttendanceTrendPoint
+		if err := rows.Scan(append([]interface{}{&point.WeekStart}, countDest(&point.AttendanceCounts)...)...); err != nil {
+			return nil, err
+		}
+		points = append(points, point)
+	}
+
+	return points, rows.Err()
+}
+
+func (s *postgresAttendanceAnalyticsStore) Weekdays(filter models.AttendanceAnalyticsFilter) ([]models.WeekdayAttendance, error) {
+	conditions, args := analyticsConditions(filter, "h.attendance_date")
+	rows, err := s.db.Query(`
+		SELECT EXTRACT(ISODOW FROM h.attendance_date)::int AS weekday,`+
+		attendanceCountColumns("h.status")+`
+		FROM attendance_history h
+		JOIN attendance a ON a.user_id = h.student_id
+		WHERE `+conditions+`
+		GROUP BY weekday
+		ORDER BY weekday`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := []models.WeekdayAttendance{}
+	for rows.Next() {
+		var day models.WeekdayAttendance
+		var isoWeekday int
+		if err := rows.Scan(append([]interface{}{&isoWeekday}, countDest(&day.AttendanceCounts)...)...); err != nil {
+			return nil, err
+		}
+		// ISO weekdays run from Monday (1) to Sunday (7)
+		day.Weekday = time.Weekday(isoWeekday % 7)
+		days = append(days, day)
+	}
+
+	return days, rows.Err()
+}
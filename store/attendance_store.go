@@ -0,0 +1,845 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"server/models"
+	"strings"
+	"time"
+)
+
+// AttendanceStore persists students' attendance, one record per student per day
+type AttendanceStore interface {
+	// ListByGroup returns every student in a year group section with the status
+	// recorded for the given day in Today
+	ListByGroup(year string, section string, date time.Time) ([]models.Student, error)
+	// ListAll returns every student's attendance, ordered by year, section and name
+	ListAll() ([]models.Student, error)
+	// Get returns a student's attendance, or sql.ErrNoRows
+	Get(userID int) (*models.Student, error)
+	// RecordDay sets each student's status for the given day in one transaction.
+	// An empty or Pending status clears the day's record. Today's register is only
+	// touched when the day is today and has not been rolled over yet. Returns
+	// sql.ErrNoRows if any student has no attendance row.
+	RecordDay(date time.Time, updates []models.AttendanceUpdate, recordedBy int) error
+	// ListHistory returns a student's attendance history, most recent day first
+	ListHistory(studentID int) ([]models.AttendanceHistoryRecord, error)
+	// ListChanges returns the audit trail of a student's daily records, newest first.
+	// Every method changing a record adds to it.
+	ListChanges(studentID int) ([]models.AttendanceChange, error)
+	// Rollover finalises today's register into the records for date and resets it to
+	// Pending; with a skipReason the register is only reset. A date is rolled over at
+	// most once: later calls return the existing report and false.
+	Rollover(date time.Time, skipReason string, triggeredBy *int) (*models.AttendanceRollover, bool, error)
+	// ListRollovers returns the most recent rollover reports, newest first
+	ListRollovers(limit int) ([]models.AttendanceRollover, error)
+	// SkipRollover marks date as rolled over with reason, leaving the register alone.
+	// Like Rollover, later calls for the same date return the existing report and false.
+	SkipRollover(date time.Time, reason string) (*models.AttendanceRollover, bool, error)
+	// ClearStaleRegister resets to Pending the register of every student without a
+	// record on today, i.e. marks left over from an earlier day, and returns how many
+	ClearStaleRegister(today time.Time) (int64, error)
+	// LastRolloverDate returns the latest day rolled over or skipped, or sql.ErrNoRows
+	// if there has been no rollover yet
+	LastRolloverDate() (time.Time, error)
+	// ExportRecords calls each for every daily record matching filter, ordered by
+	// student and date, without loading them all into memory. Iteration stops at
+	// the first error returned by each.
+	ExportRecords(filter models.AttendanceExportFilter, each func(models.AttendanceExportRow) error) error
+	// ApplyLeave marks each day with status on behalf of an approved leave request,
+	// linking the records to it and remembering what they replaced. Returns
+	// sql.ErrNoRows if the leave request does not exist.
+	ApplyLeave(leaveRequestID int, status string, days []time.Time, recordedBy int) error
+	// CheckIn records a student's arrival at reception with status for the day of at
+	// and updates today's register. A student's first check-in of the day wins: later
+	// ones return the existing record and false. Approved leave keeps its status.
+	// Returns sql.ErrNoRows if the student has no attendance row.
+	CheckIn(studentID int, at time.Time, status string) (*models.AttendanceHistoryRecord, bool, error)
+	// RevertLeave undoes ApplyLeave on behalf of revertedBy for the days from from on:
+	// records still linked to the leave request go back to what was marked before, or
+	// to Pending. Records corrected by hand since and earlier days are left alone.
+	RevertLeave(leaveRequestID int, revertedBy int, from time.Time) error
+}
+
+type postgresAttendanceStore struct {
+	db *sql.DB
+}
+
+// NewAttendanceStore returns an AttendanceStore backed by PostgreSQL
+func NewAttendanceStore(db *sql.DB) AttendanceStore {
+	return &postgresAttendanceStore{db: db}
+}
+
+// studentAttendanceColumns selects a student's counters from their daily records
+// and baseline, and the leave behind the day's record; the query must join
+// attendanceCounts, the day's record as d and its leave request as l
+const studentAttendanceColumns = `
+	a.user_id, a.name, COALESCE(a.year, ''), COALESCE(a.group_name, ''), %s,
+	COALESCE(c.present, 0) + COALESCE(b.present, 0), COALESCE(c.absent, 0) + COALESCE(b.absent, 0),
+	COALESCE(c.late, 0) + COALESCE(b.late, 0), COALESCE(c.medical, 0) + COALESCE(b.medical, 0),
+	COALESCE(c.early, 0) + COALESCE(b.early, 0),
+	l.id, l.request_type, l.reason`
+
+// countedDayCondition restricts the date column col to school days up to today.
+// Leave approved ahead of time writes records for future days, which only count
+// once the day comes.
+func countedDayCondition(col string) string {
+	return col + ` <= CURRENT_DATE AND ` + schoolDayCondition(col)
+}
+
+// attendanceCounts joins each student's counters as c, counting only school days
+// up to today, and the counts carried over from the legacy counters as b
+var attendanceCounts = `
+	LEFT JOIN (
+		SELECT student_id,
+			COUNT(*) FILTER (WHERE status = 'present') AS present,
+			COUNT(*) FILTER (WHERE status = 'absent') AS absent,
+			COUNT(*) FILTER (WHERE status = 'late') AS late,
+			COUNT(*) FILTER (WHERE status = 'medical') AS medical,
+			COUNT(*) FILTER (WHERE status = 'early') AS early
+		FROM attendance_history
+		WHERE ` + countedDayCondition("attendance_date") + `
+		GROUP BY student_id
+	) c ON c.student_id = a.user_id
+	LEFT JOIN attendance_baselines b ON b.student_id = a.user_id`
+
+// todayRegister is the Today expression for the current day. The register is reset
+// to Pending every evening, so leave approved ahead of time shows from its record.
+const todayRegister = `
+	CASE WHEN a.today = 'Pending' AND d.leave_request_id IS NOT NULL
+		THEN INITCAP(d.status) ELSE a.today END`
+
+// selectStudentAttendance builds the SELECT clause with the expression used for Today
+// and the placeholder of the day whose record is joined as d
+func selectStudentAttendance(today string, dayParam string) string {
+	return `SELECT ` + fmt.Sprintf(studentAttendanceColumns, today) + `
+		FROM attendance a` + attendanceCounts + `
+		LEFT JOIN attendance_history d ON d.student_id = a.user_id AND d.attendance_date = ` + dayParam + `
+		LEFT JOIN leave_requests l ON l.id = d.leave_request_id`
+}
+
+func (s *postgresAttendanceStore) ListByGroup(year string, section string, date time.Time) ([]models.Student, error) {
+	// Today's register lives on the attendance row; past days come from their records
+	today := "COALESCE(INITCAP(d.status), 'Pending')"
+	if isToday(date) {
+		today = todayRegister
+	}
+
+	return s.list(selectStudentAttendance(today, "$3")+`
+		WHERE a.year = $1 AND a.group_name = $2
+		ORDER BY a.name`, year, section, date.Format("2006-01-02"))
+}
+
+func (s *postgresAttendanceStore) ListAll() ([]models.Student, error) {
+	return s.list(selectStudentAttendance(todayRegister, "$1")+`
+		ORDER BY a.year, a.group_name, a.name`, time.Now().Format("2006-01-02"))
+}
+
+func (s *postgresAttendanceStore) Get(userID int) (*models.Student, error) {
+	return scanStudentAttendance(s.db.QueryRow(selectStudentAttendance(todayRegister, "$2")+`
+		WHERE a.user_id = $1`, userID, time.Now().Format("2006-01-02")))
+}
+
+func (s *postgresAttendanceStore) RecordDay(date time.Time, updates []models.AttendanceUpdate, recordedBy int) error {
+	day := date.Format("2006-01-02")
+	today := isToday(date)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Once today has been rolled over its register is reset, so later corrections
+	// only go to the day's records
+	if today {
+		if today, err = registerOpen(tx, day); err != nil {
+			return err
+		}
+	}
+
+	for _, update := range updates {
+		var exists bool
+		err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM attendance WHERE user_id = $1)`, update.UserID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return sql.ErrNoRows
+		}
+
+		previous, err := recordedStatus(tx, update.UserID, day)
+		if err != nil {
+			return err
+		}
+
+		status := strings.ToLower(update.Status)
+		if update.Status == "" || update.Status == models.AttendancePending {
+			status = ""
+			_, err = tx.Exec(`
+				DELETE FROM attendance_history
+				WHERE student_id = $1 AND attendance_date = $2`, update.UserID, day)
+		} else {
+			_, err = tx.Exec(`
+				INSERT INTO attendance_history (student_id, status, attendance_date, recorded_by)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT (student_id, attendance_date)
+				DO UPDATE SET status = EXCLUDED.status, recorded_by = EXCLUDED.recorded_by, updated_at = NOW(),
+					leave_request_id = NULL, status_before_leave = NULL`,
+				update.UserID, status, day, recordedBy)
+		}
+		if err != nil {
+			return err
+		}
+		err = logChange(tx, update.UserID, day, previous, status, &recordedBy, models.ChangeSourceRegister, update.Note)
+		if err != nil {
+			return err
+		}
+
+		if today {
+			// Always store "Pending" for empty values, never NULL
+			_, err = tx.Exec(`
+				UPDATE attendance
+				SET today = CASE WHEN $1 = '' THEN 'Pending' ELSE $1 END
+				WHERE user_id = $2`, update.Status, update.UserID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *postgresAttendanceStore) ListHistory(studentID int) ([]models.AttendanceHistoryRecord, error) {
+	rows, err := s.db.Query(selectAttendanceHistory+`
+		WHERE h.student_id = $1
+		ORDER BY h.attendance_date DESC`, studentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []models.AttendanceHistoryRecord
+	for rows.Next() {
+		record, err := scanAttendanceHistory(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+
+	return records, rows.Err()
+}
+
+func (s *postgresAttendanceStore) ListChanges(studentID int) ([]models.AttendanceChange, error) {
+	rows, err := s.db.Query(`
+		SELECT c.id, c.student_id, c.attendance_date, COALESCE(c.previous_status, ''),
+			COALESCE(c.new_status, ''), c.changed_by, COALESCE(u.name, ''), c.source, c.note, c.changed_at
+		FROM attendance_changes c
+		LEFT JOIN users u ON u.id = c.changed_by
+		WHERE c.student_id = $1
+		ORDER BY c.changed_at DESC, c.id DESC`, studentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []models.AttendanceChange{}
+	for rows.Next() {
+		var change models.AttendanceChange
+		var changedBy sql.NullInt64
+		var note sql.NullString
+		err := rows.Scan(
+			&change.ID, &change.StudentID, &change.AttendanceDate, &change.PreviousStatus,
+			&change.NewStatus, &changedBy, &change.ChangedByName, &change.Source, &note, &change.ChangedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if changedBy.Valid {
+			id := int(changedBy.Int64)
+			change.ChangedBy = &id
+		}
+		if note.Valid {
+			change.Note = &note.String
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, rows.Err()
+}
+
+func (s *postgresAttendanceStore) CheckIn(studentID int, at time.Time, status string) (*models.AttendanceHistoryRecord, bool, error) {
+	day := at.Format("2006-01-02")
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM attendance WHERE user_id = $1)`, studentID).Scan(&exists)
+	if err != nil {
+		return nil, false, err
+	}
+	if !exists {
+		return nil, false, sql.ErrNoRows
+	}
+
+	var previous string
+	var arrived, onLeave bool
+	err = tx.QueryRow(`
+		SELECT status, arrived_at IS NOT NULL, leave_request_id IS NOT NULL
+		FROM attendance_history
+		WHERE student_id = $1 AND attendance_date = $2
+		FOR UPDATE`, studentID, day).Scan(&previous, &arrived, &onLeave)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return nil, false, err
+	case arrived:
+		// Scanning again keeps the first arrival
+		record, err := scanAttendanceHistory(tx.QueryRow(selectAttendanceHistory+`
+			WHERE h.student_id = $1 AND h.attendance_date = $2`, studentID, day))
+		return record, false, err
+	}
+
+	if onLeave {
+		// Approved leave keeps its status, e.g. a student leaving early still arrived
+		_, err = tx.Exec(`
+			UPDATE attendance_history SET arrived_at = $3, updated_at = NOW()
+			WHERE student_id = $1 AND attendance_date = $2`, studentID, day, at.Format("15:04:05"))
+	} else {
+		_, err = tx.Exec(`
+			INSERT INTO attendance_history (student_id, status, attendance_date, arrived_at, recorded_by)
+			VALUES ($1, $2, $3, $4, $1)
+			ON CONFLICT (student_id, attendance_date)
+			DO UPDATE SET status = EXCLUDED.status, arrived_at = EXCLUDED.arrived_at,
+				recorded_by = EXCLUDED.recorded_by, updated_at = NOW()`,
+			studentID, strings.ToLower(status), day, at.Format("15:04:05"))
+		if err == nil {
+			err = logChange(tx, studentID, day, previous, strings.ToLower(status), &studentID, models.ChangeSourceCheckIn, "")
+		}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !onLeave && isToday(at) {
+		open, err := registerOpen(tx, day)
+		if err != nil {
+			return nil, false, err
+		}
+		if open {
+			if _, err := tx.Exec(`UPDATE attendance SET today = $1 WHERE user_id = $2`, status, studentID); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+
+	record, err := scanAttendanceHistory(tx.QueryRow(selectAttendanceHistory+`
+		WHERE h.student_id = $1 AND h.attendance_date = $2`, studentID, day))
+	if err != nil {
+		return nil, false, err
+	}
+	return record, true, tx.Commit()
+}
+
+const attendanceRolloverColumns = `
+	id, rollover_date, status, COALESCE(reason, ''), recorded_count, reset_count, triggered_by, created_at`
+
+func (s *postgresAttendanceStore) Rollover(date time.Time, skipReason string, triggeredBy *int) (*models.AttendanceRollover, bool, error) {
+	day := date.Format("2006-01-02")
+	status := models.RolloverCompleted
+	if skipReason != "" {
+		status = models.RolloverSkipped
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	// Claim the day first; the unique date makes concurrent or repeated runs no-ops
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO attendance_rollovers (rollover_date, status, reason, triggered_by)
+		VALUES ($1, $2, NULLIF($3, ''), $4)
+		ON CONFLICT (rollover_date) DO NOTHING
+		RETURNING id`, day, status, skipReason, triggeredBy).Scan(&id)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		existing, err := scanAttendanceRollover(s.db.QueryRow(`
+			SELECT `+attendanceRolloverColumns+` FROM attendance_rollovers WHERE rollover_date = $1`, day))
+		return existing, false, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var recorded int64
+	if status == models.RolloverCompleted {
+		// Days already recorded or corrected by a teacher keep their record
+		result, err := tx.Exec(`
+			WITH recorded AS (
+				INSERT INTO attendance_history (student_id, status, attendance_date)
+				SELECT user_id, LOWER(today), $1
+				FROM attendance
+				WHERE today IS NOT NULL AND today <> 'Pending'
+				ON CONFLICT (student_id, attendance_date) DO NOTHING
+				RETURNING student_id, status
+			)
+			INSERT INTO attendance_changes (student_id, attendance_date, new_status, changed_by, source)
+			SELECT student_id, $1::date, status, $2::integer, $3 FROM recorded`, day, triggeredBy, models.ChangeSourceRollover)
+		if err != nil {
+			return nil, false, err
+		}
+		if recorded, err = result.RowsAffected(); err != nil {
+			return nil, false, err
+		}
+	}
+
+	result, err := tx.Exec(`UPDATE attendance SET today = 'Pending' WHERE today IS DISTINCT FROM 'Pending'`)
+	if err != nil {
+		return nil, false, err
+	}
+	reset, err := result.RowsAffected()
+	if err != nil {
+		return nil, false, err
+	}
+
+	report, err := scanAttendanceRollover(tx.QueryRow(`
+		UPDATE attendance_rollovers
+		SET recorded_count = $1, reset_count = $2
+		WHERE id = $3
+		RETURNING `+attendanceRolloverColumns, recorded, reset, id))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	return report, true, nil
+}
+
+func (s *postgresAttendanceStore) SkipRollover(date time.Time, reason string) (*models.AttendanceRollover, bool, error) {
+	day := date.Format("2006-01-02")
+	report, err := scanAttendanceRollover(s.db.QueryRow(`
+		INSERT INTO attendance_rollovers (rollover_date, status, reason)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (rollover_date) DO NOTHING
+		RETURNING `+attendanceRolloverColumns, day, models.RolloverSkipped, reason))
+	if err == sql.ErrNoRows {
+		existing, err := scanAttendanceRollover(s.db.QueryRow(`
+			SELECT `+attendanceRolloverColumns+` FROM attendance_rollovers WHERE rollover_date = $1`, day))
+		return existing, false, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return report, true, nil
+}
+
+func (s *postgresAttendanceStore) ClearStaleRegister(today time.Time) (int64, error) {
+	// Marks taken on the register are recorded as they are made, so a mark without
+	// a record for today cannot be today's
+	result, err := s.db.Exec(`
+		UPDATE attendance a SET today = 'Pending'
+		WHERE a.today IS DISTINCT FROM 'Pending'
+			AND NOT EXISTS (
+				SELECT 1 FROM attendance_history h
+				WHERE h.student_id = a.user_id AND h.attendance_date = $1::date
+			)`, today.Format("2006-01-02"))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *postgresAttendanceStore) LastRolloverDate() (time.Time, error) {
+	var date sql.NullTime
+	if err := s.db.QueryRow(`SELECT MAX(rollover_date) FROM attendance_rollovers`).Scan(&date); err != nil {
+		return time.Time{}, err
+	}
+	if !date.Valid {
+		return time.Time{}, sql.ErrNoRows
+	}
+	return date.Time, nil
+}
+
+func (s *postgresAttendanceStore) ListRollovers(limit int) ([]models.AttendanceRollover, error) {
+	rows, err := s.db.Query(`
+		SELECT `+attendanceRolloverColumns+`
+		FROM attendance_rollovers
+		ORDER BY rollover_date DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []models.AttendanceRollover
+	for rows.Next() {
+		report, err := scanAttendanceRollover(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, *report)
+	}
+
+	return reports, rows.Err()
+}
+
+// scanAttendanceRollover scans a row selected with attendanceRolloverColumns
+func scanAttendanceRollover(row rowScanner) (*models.AttendanceRollover, error) {
+	var report models.AttendanceRollover
+	var triggeredBy sql.NullInt64
+	err := row.Scan(
+		&report.ID, &report.Date, &report.Status, &report.Reason,
+		&report.RecordedCount, &report.ResetCount, &triggeredBy, &report.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if triggeredBy.Valid {
+		id := int(triggeredBy.Int64)
+		report.TriggeredBy = &id
+	}
+	return &report, nil
+}
+
+func (s *postgresAttendanceStore) ExportRecords(filter models.AttendanceExportFilter, each func(models.AttendanceExportRow) error) error {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.Year != "" {
+		where("a.year = $%d", filter.Year)
+		where("a.group_name = $%d", filter.Section)
+	}
+	if filter.StudentID != 0 {
+		where("a.user_id = $%d", filter.StudentID)
+	}
+	if filter.From != nil {
+		where("h.attendance_date >= $%d", filter.From.Format("2006-01-02"))
+	}
+	if filter.To != nil {
+		where("h.attendance_date <= $%d", filter.To.Format("2006-01-02"))
+	}
+
+	query := `
+		SELECT h.attendance_date, a.user_id, a.name, COALESCE(a.year, ''), COALESCE(a.group_name, ''),
+			h.status, h.arrived_at,
+			COUNT(*) FILTER (WHERE h.status = 'present') OVER student,
+			COUNT(*) FILTER (WHERE h.status = 'absent') OVER student,
+			COUNT(*) FILTER (WHERE h.status = 'late') OVER student,
+			COUNT(*) FILTER (WHERE h.status = 'medical') OVER student,
+			COUNT(*) FILTER (WHERE h.status = 'early') OVER student
+		FROM attendance_history h
+		JOIN attendance a ON a.user_id = h.student_id`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += `
+		WINDOW student AS (PARTITION BY h.student_id)
+		ORDER BY a.year, a.group_name, a.name, a.user_id, h.attendance_date`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row models.AttendanceExportRow
+		var arrivedAt sql.NullTime
+		err := rows.Scan(
+			&row.Date, &row.StudentID, &row.Name, &row.Year, &row.GroupName, &row.Status, &arrivedAt,
+			&row.Present, &row.Absent, &row.Late, &row.Medical, &row.Early,
+		)
+		if err != nil {
+			return err
+		}
+		if arrivedAt.Valid {
+			row.ArrivedAt = &arrivedAt.Time
+		}
+		if err := each(row); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *postgresAttendanceStore) ApplyLeave(leaveRequestID int, status string, days []time.Time, recordedBy int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var studentID int
+	err = tx.QueryRow(`SELECT student_id FROM leave_requests WHERE id = $1`, leaveRequestID).Scan(&studentID)
+	if err != nil {
+		return err
+	}
+
+	for _, date := range days {
+		day := date.Format("2006-01-02")
+
+		previous, err := recordedStatus(tx, studentID, day)
+		if err != nil {
+			return err
+		}
+
+		// The first leave to replace a record keeps what it replaced
+		_, err = tx.Exec(`
+			INSERT INTO attendance_history (student_id, status, attendance_date, recorded_by, leave_request_id)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (student_id, attendance_date)
+			DO UPDATE SET
+				status_before_leave = CASE
+					WHEN attendance_history.leave_request_id IS NULL THEN attendance_history.status
+					ELSE attendance_history.status_before_leave END,
+				status = EXCLUDED.status, recorded_by = EXCLUDED.recorded_by,
+				leave_request_id = EXCLUDED.leave_request_id, updated_at = NOW()`,
+			studentID, strings.ToLower(status), day, recordedBy, leaveRequestID)
+		if err != nil {
+			return err
+		}
+		note := fmt.Sprintf("Leave request #%d approved", leaveRequestID)
+		err = logChange(tx, studentID, day, previous, strings.ToLower(status), &recordedBy, models.ChangeSourceLeave, note)
+		if err != nil {
+			return err
+		}
+
+		if isToday(date) {
+			open, err := registerOpen(tx, day)
+			if err != nil {
+				return err
+			}
+			if open {
+				if _, err := tx.Exec(`UPDATE attendance SET today = $1 WHERE user_id = $2`, status, studentID); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *postgresAttendanceStore) RevertLeave(leaveRequestID int, revertedBy int, from time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Restore the records the leave replaced and drop the ones it created; the
+	// self-join returns the status each restored record had under the leave
+	rows, err := tx.Query(`
+		WITH restored AS (
+			UPDATE attendance_history h
+			SET status = h.status_before_leave, status_before_leave = NULL,
+				leave_request_id = NULL, updated_at = NOW()
+			FROM attendance_history old
+			WHERE old.id = h.id AND h.leave_request_id = $1 AND h.status_before_leave IS NOT NULL
+				AND h.attendance_date >= $2::date
+			RETURNING h.student_id, h.attendance_date, old.status AS previous, h.status
+		), removed AS (
+			DELETE FROM attendance_history
+			WHERE leave_request_id = $1 AND status_before_leave IS NULL
+				AND attendance_date >= $2::date
+			RETURNING student_id, attendance_date, status AS previous, '' AS status
+		)
+		SELECT student_id, attendance_date, previous, status FROM restored
+		UNION ALL
+		SELECT student_id, attendance_date, previous, status FROM removed`,
+		leaveRequestID, from.Format("2006-01-02"))
+	if err != nil {
+		return err
+	}
+
+	type revertedRecord struct {
+		studentID int
+		date      time.Time
+		previous  string
+		status    string
+	}
+	var reverted []revertedRecord
+	for rows.Next() {
+		var record revertedRecord
+		if err := rows.Scan(&record.studentID, &record.date, &record.previous, &record.status); err != nil {
+			rows.Close()
+			return err
+		}
+		reverted = append(reverted, record)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	note := fmt.Sprintf("Leave request #%d no longer approved", leaveRequestID)
+	var today []models.AttendanceUpdate
+	for _, record := range reverted {
+		day := record.date.Format("2006-01-02")
+		err := logChange(tx, record.studentID, day, record.previous, record.status, &revertedBy, models.ChangeSourceLeave, note)
+		if err != nil {
+			return err
+		}
+		if isToday(record.date) {
+			status := models.AttendancePending
+			if record.status != "" {
+				status = strings.ToUpper(record.status[:1]) + record.status[1:]
+			}
+			today = append(today, models.AttendanceUpdate{UserID: record.studentID, Status: status})
+		}
+	}
+
+	if len(today) > 0 {
+		open, err := registerOpen(tx, time.Now().Format("2006-01-02"))
+		if err != nil {
+			return err
+		}
+		for _, update := range today {
+			if !open {
+				break
+			}
+			if _, err := tx.Exec(`UPDATE attendance SET today = $1 WHERE user_id = $2`, update.Status, update.UserID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// list runs a query selecting studentAttendanceColumns
+func (s *postgresAttendanceStore) list(query string, args ...interface{}) ([]models.Student, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var students []models.Student
+	for rows.Next() {
+		student, err := scanStudentAttendance(rows)
+		if err != nil {
+			return nil, err
+		}
+		students = append(students, *student)
+	}
+
+	return students, rows.Err()
+}
+
+// scanStudentAttendance scans a row selected with studentAttendanceColumns
+func scanStudentAttendance(row rowScanner) (*models.Student, error) {
+	var student models.Student
+	var leave nullableLeave
+	err := row.Scan(
+		&student.UserID, &student.Name, &student.Year, &student.GroupName, &student.Today,
+		&student.Present, &student.Absent, &student.Late, &student.Medical, &student.Early,
+		&leave.id, &leave.requestType, &leave.reason,
+	)
+	if err != nil {
+		return nil, err
+	}
+	student.Leave = leave.get()
+	return &student, nil
+}
+
+// selectAttendanceHistory selects daily records as h with the leave behind them
+const selectAttendanceHistory = `
+	SELECT h.id, h.student_id, h.status, h.attendance_date, h.arrived_at, h.created_at,
+		l.id, l.request_type, l.reason
+	FROM attendance_history h
+	LEFT JOIN leave_requests l ON l.id = h.leave_request_id`
+
+// scanAttendanceHistory scans a row selected with selectAttendanceHistory
+func scanAttendanceHistory(row rowScanner) (*models.AttendanceHistoryRecord, error) {
+	var record models.AttendanceHistoryRecord
+	var arrivedAt sql.NullTime
+	var leave nullableLeave
+	err := row.Scan(
+		&record.ID, &record.StudentID, &record.Status,
+		&record.AttendanceDate, &arrivedAt, &record.CreatedAt,
+		&leave.id, &leave.requestType, &leave.reason,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if arrivedAt.Valid {
+		record.ArrivedAt = &arrivedAt.Time
+	}
+	record.Leave = leave.get()
+	return &record, nil
+}
+
+// nullableLeave scans the leave request columns of an outer join
+type nullableLeave struct {
+	id          sql.NullInt64
+	requestType sql.NullString
+	reason      sql.NullString
+}
+
+// get returns the scanned leave, or nil if the record has none
+func (n nullableLeave) get() *models.AttendanceLeave {
+	if !n.id.Valid {
+		return nil
+	}
+	leave := &models.AttendanceLeave{RequestID: int(n.id.Int64), RequestType: n.requestType.String}
+	if n.reason.Valid {
+		leave.Reason = &n.reason.String
+	}
+	return leave
+}
+
+// registerOpen reports whether today's register for day has not been rolled over yet
+func registerOpen(tx *sql.Tx, day string) (bool, error) {
+	var rolledOver bool
+	err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM attendance_rollovers WHERE rollover_date = $1)`, day).Scan(&rolledOver)
+	return !rolledOver, err
+}
+
+// recordedStatus returns a student's stored status for day and locks the record,
+// or returns "" if the day has no record
+func recordedStatus(tx *sql.Tx, studentID int, day string) (string, error) {
+	var status string
+	err := tx.QueryRow(`
+		SELECT status FROM attendance_history
+		WHERE student_id = $1 AND attendance_date = $2
+		FOR UPDATE`, studentID, day).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return status, err
+}
+
+// logChange adds a change of a student's stored status for day to the audit trail;
+// "" stands for no record. Nothing is logged if the status did not change.
+func logChange(tx *sql.Tx, studentID int, day string, previous string, status string, changedBy *int, source string, note string) error {
+	if previous == status {
+		return nil
+	}
+	_, err := tx.Exec(`
+		INSERT INTO attendance_changes
+			(student_id, attendance_date, previous_status, new_status, changed_by, source, note)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, NULLIF($7, ''))`,
+		studentID, day, previous, status, changedBy, source, strings.TrimSpace(note))
+	return err
+}
+
+// isToday reports whether date falls on the server's current day
+func isToday(date time.Time) bool {
+	return date.Format("2006-01-02") == time.Now().Format("2006-01-02")
+}
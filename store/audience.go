@@ -0,0 +1,106 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// Audience tables restrict an event to students of some sections.
+// An event without audience rows is visible to everyone.
+const (
+	votingEventAudiences = "voting_event_audiences"
+	eventAudiences       = "event_audiences"
+)
+
+// audienceCondition returns an SQL condition that holds when the event in eventColumn
+// has no audience or the student bound to studentParam belongs to one of its sections
+func audienceCondition(table string, eventColumn string, studentParam string) string {
+	return `(
+		NOT EXISTS (SELECT 1 FROM ` + table + ` aud WHERE aud.event_id = ` + eventColumn + `)
+		OR EXISTS (
+			SELECT 1 FROM ` + table + ` aud
+			JOIN sections s ON s.id = aud.section_id
+			JOIN year_groups y ON y.id = s.year_group_id
+			JOIN attendance a ON a.year = y.name AND a.group_name = s.name
+			WHERE aud.event_id = ` + eventColumn + ` AND a.user_id = ` + studentParam + `
+		)
+	)`
+}
+
+// inAudience reports whether an event has no audience or the user belongs to it
+func inAudience(db *sql.DB, table string, eventID interface{}, userID int) (bool, error) {
+	var visible bool
+	err := db.QueryRow(`SELECT `+audienceCondition(table, "$1", "$2"), eventID, userID).Scan(&visible)
+	return visible, err
+}
+
+// listAudience returns the audience section IDs of an event (never nil)
+func listAudience(db *sql.DB, table string, eventID interface{}) ([]int, error) {
+	rows, err := db.Query(`SELECT section_id FROM `+table+` WHERE event_id = $1 ORDER BY section_id`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sectionIDs := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		sectionIDs = append(sectionIDs, id)
+	}
+
+	return sectionIDs, rows.Err()
+}
+
+// replaceAudience sets the audience of an event, returning ErrInvalidReference if a
+// section does not exist
+func replaceAudience(tx *sql.Tx, table string, eventID interface{}, sectionIDs []int) error {
+	if _, err := tx.Exec(`DELETE FROM `+table+` WHERE event_id = $1`, eventID); err != nil {
+		return err
+	}
+	if len(sectionIDs) == 0 {
+		return nil
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO `+table+` (event_id, section_id)
+		SELECT $1, id FROM sections WHERE id = ANY($2)`, eventID, pq.Array(sectionIDs))
+	if err != nil {
+		return err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	unique := make(map[int]bool)
+	for _, id := range sectionIDs {
+		unique[id] = true
+	}
+	if int(inserted) != len(unique) {
+		return ErrInvalidReference
+	}
+	return nil
+}
+
+// countAudience returns the number of users an event is meant for: every user
+// without an audience, otherwise the students of its sections
+func countAudience(db *sql.DB, table string, eventID interface{}) (int, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT CASE
+			WHEN EXISTS (SELECT 1 FROM `+table+` WHERE event_id = $1)
+			THEN (
+				SELECT COUNT(DISTINCT a.user_id) FROM `+table+` aud
+				JOIN sections s ON s.id = aud.section_id
+				JOIN year_groups y ON y.id = s.year_group_id
+				JOIN attendance a ON a.year = y.name AND a.group_name = s.name
+				WHERE aud.event_id = $1
+			)
+			ELSE (SELECT COUNT(*) FROM users)
+		END`, eventID).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,411 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"server/models"
+)
+
+// ErrOutsideAcademicYear is returned when a term would not fit inside its academic year
+var ErrOutsideAcademicYear = errors.New("term falls outside its academic year")
+
+// CalendarStore persists the school calendar: academic years, their terms, and
+// closures. Dates are YYYY-MM-DD strings.
+type CalendarStore interface {
+	// ListYears returns every academic year with its terms, oldest first
+	ListYears() ([]models.AcademicYear, error)
+	// GetYear returns an academic year with its terms, or sql.ErrNoRows
+	GetYear(id int) (*models.AcademicYear, error)
+	// CreateYear inserts an academic year and fills in its generated fields, or
+	// returns ErrConflict if the name is taken
+	CreateYear(year *models.AcademicYear) error
+	// UpdateYear renames or moves an academic year; returns sql.ErrNoRows,
+	// ErrConflict, or ErrOutsideAcademicYear if its terms would no longer fit
+	UpdateYear(year *models.AcademicYear) error
+	// DeleteYear deletes an academic year and its terms, or returns sql.ErrNoRows
+	DeleteYear(id int) error
+
+	// ListTerms returns every term, in date order
+	ListTerms() ([]models.Term, error)
+	// CreateTerm inserts a term and fills in its generated fields. Returns
+	// ErrInvalidReference if the academic year does not exist, ErrOutsideAcademicYear,
+	// or ErrConflict if the year already has a term with the name.
+	CreateTerm(term *models.Term) error
+	// UpdateTerm renames or moves a term within its academic year; returns
+	// sql.ErrNoRows, ErrOutsideAcademicYear or ErrConflict
+	UpdateTerm(term *models.Term) error
+	// DeleteTerm deletes a term, or returns sql.ErrNoRows
+	DeleteTerm(id int) error
+
+	// ListClosures returns every closure, in date order
+	ListClosures() ([]models.SchoolClosure, error)
+	// CreateClosure inserts a closure and fills in its generated fields
+	CreateClosure(closure *models.SchoolClosure) error
+	// UpdateClosure renames or moves a closure, or returns sql.ErrNoRows
+	UpdateClosure(closure *models.SchoolClosure) error
+	// DeleteClosure deletes a closure, or returns sql.ErrNoRows
+	DeleteClosure(id int) error
+	// ImportHoliday creates a closure named name for a configured holiday unless the
+	// date was imported before or a closure already covers it. Reports whether a
+	// closure was created.
+	ImportHoliday(date string, name string) (bool, error)
+}
+
+type postgresCalendarStore struct {
+	db *sql.DB
+}
+
+// NewCalendarStore returns a CalendarStore backed by PostgreSQL
+func NewCalendarStore(db *sql.DB) CalendarStore {
+	return &postgresCalendarStore{db: db}
+}
+
+const academicYearColumns = `
+	id, name, TO_CHAR(start_date, 'YYYY-MM-DD'), TO_CHAR(end_date, 'YYYY-MM-DD'), created_at`
+
+const termColumns = `
+	id, academic_year_id, name, TO_CHAR(start_date, 'YYYY-MM-DD'), TO_CHAR(end_date, 'YYYY-MM-DD'), created_at`
+
+const closureColumns = `
+	id, name, TO_CHAR(start_date, 'YYYY-MM-DD'), TO_CHAR(end_date, 'YYYY-MM-DD'), created_at`
+
+// schoolDayCondition restricts the date column col to school days of the calendar:
+// weekdays that no closure covers and, once terms are set up, that fall in a term
+func schoolDayCondition(col string) string {
+	return fmt.Sprintf(`(
+		EXTRACT(ISODOW FROM %[1]s) < 6
+		AND NOT EXISTS (SELECT 1 FROM school_closures sc WHERE %[1]s BETWEEN sc.start_date AND sc.end_date)
+		AND (NOT EXISTS (SELECT 1 FROM terms) OR EXISTS (
+			SELECT 1 FROM terms t WHERE %[1]s BETWEEN t.start_date AND t.end_date
+		))
+	)`, col)
+}
+
+func (s *postgresCalendarStore) ListYears() ([]models.AcademicYear, error) {
+	rows, err := s.db.Query(`SELECT ` + academicYearColumns + ` FROM academic_years ORDER BY start_date`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	years := []models.AcademicYear{}
+	index := make(map[int]int)
+	for rows.Next() {
+		year, err := scanAcademicYear(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[year.ID] = len(years)
+		years = append(years, *year)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	terms, err := s.ListTerms()
+	if err != nil {
+		return nil, err
+	}
+	for _, term := range terms {
+		if i, ok := index[term.AcademicYearID]; ok {
+			years[i].Terms = append(years[i].Terms, term)
+		}
+	}
+	return years, nil
+}
+
+func (s *postgresCalendarStore) GetYear(id int) (*models.AcademicYear, error) {
+	year, err := scanAcademicYear(s.db.QueryRow(`SELECT `+academicYearColumns+` FROM academic_years WHERE id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+
+	year.Terms, err = s.listTerms(`SELECT `+termColumns+` FROM terms WHERE academic_year_id = $1 ORDER BY start_date`, id)
+	if err != nil {
+		return nil, err
+	}
+	return year, nil
+}
+
+func (s *postgresCalendarStore) CreateYear(year *models.AcademicYear) error {
+	created, err := scanAcademicYear(s.db.QueryRow(`
+		INSERT INTO academic_years (name, start_date, end_date)
+		VALUES ($1, $2, $3)
+		RETURNING `+academicYearColumns, year.Name, year.StartDate, year.EndDate))
+	if err != nil {
+		return conflictOr(err)
+	}
+	*year = *created
+	return nil
+}
+
+func (s *postgresCalendarStore) UpdateYear(year *models.AcademicYear) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	updated, err := scanAcademicYear(tx.QueryRow(`
+		UPDATE academic_years SET name = $1, start_date = $2, end_date = $3
+		WHERE id = $4
+		RETURNING `+academicYearColumns, year.Name, year.StartDate, year.EndDate, year.ID))
+	if err != nil {
+		return conflictOr(err)
+	}
+
+	var outside bool
+	err = tx.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM terms
+			WHERE academic_year_id = $1 AND (start_date < $2 OR end_date > $3)
+		)`, year.ID, year.StartDate, year.EndDate).Scan(&outside)
+	if err != nil {
+		return err
+	}
+	if outside {
+		return ErrOutsideAcademicYear
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	*year = *updated
+	return nil
+}
+
+func (s *postgresCalendarStore) DeleteYear(id int) error {
+	return s.deleteOne(`DELETE FROM academic_years WHERE id = $1`, id)
+}
+
+func (s *postgresCalendarStore) ListTerms() ([]models.Term, error) {
+	return s.listTerms(`SELECT ` + termColumns + ` FROM terms ORDER BY start_date`)
+}
+
+func (s *postgresCalendarStore) CreateTerm(term *models.Term) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkTermFits(tx, term.AcademicYearID, term.StartDate, term.EndDate); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrInvalidReference
+		}
+		return err
+	}
+
+	created, err := scanTerm(tx.QueryRow(`
+		INSERT INTO terms (academic_year_id, name, start_date, end_date)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+termColumns, term.AcademicYearID, term.Name, term.StartDate, term.EndDate))
+	if err != nil {
+		return conflictOr(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	*term = *created
+	return nil
+}
+
+func (s *postgresCalendarStore) UpdateTerm(term *models.Term) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var yearID int
+	if err := tx.QueryRow(`SELECT academic_year_id FROM terms WHERE id = $1 FOR UPDATE`, term.ID).Scan(&yearID); err != nil {
+		return err
+	}
+	if err := checkTermFits(tx, yearID, term.StartDate, term.EndDate); err != nil {
+		return err
+	}
+
+	updated, err := scanTerm(tx.QueryRow(`
+		UPDATE terms SET name = $1, start_date = $2, end_date = $3
+		WHERE id = $4
+		RETURNING `+termColumns, term.Name, term.StartDate, term.EndDate, term.ID))
+	if err != nil {
+		return conflictOr(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	*term = *updated
+	return nil
+}
+
+func (s *postgresCalendarStore) DeleteTerm(id int) error {
+	return s.deleteOne(`DELETE FROM terms WHERE id = $1`, id)
+}
+
+func (s *postgresCalendarStore) ListClosures() ([]models.SchoolClosure, error) {
+	rows, err := s.db.Query(`SELECT ` + closureColumns + ` FROM school_closures ORDER BY start_date, name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	closures := []models.SchoolClosure{}
+	for rows.Next() {
+		closure, err := scanClosure(rows)
+		if err != nil {
+			return nil, err
+		}
+		closures = append(closures, *closure)
+	}
+
+	return closures, rows.Err()
+}
+
+func (s *postgresCalendarStore) CreateClosure(closure *models.SchoolClosure) error {
+	created, err := scanClosure(s.db.QueryRow(`
+		INSERT INTO school_closures (name, start_date, end_date)
+		VALUES ($1, $2, $3)
+		RETURNING `+closureColumns, closure.Name, closure.StartDate, closure.EndDate))
+	if err != nil {
+		return err
+	}
+	*closure = *created
+	return nil
+}
+
+func (s *postgresCalendarStore) UpdateClosure(closure *models.SchoolClosure) error {
+	updated, err := scanClosure(s.db.QueryRow(`
+		UPDATE school_closures SET name = $1, start_date = $2, end_date = $3
+		WHERE id = $4
+		RETURNING `+closureColumns, closure.Name, closure.StartDate, closure.EndDate, closure.ID))
+	if err != nil {
+		return err
+	}
+	*closure = *updated
+	return nil
+}
+
+func (s *postgresCalendarStore) DeleteClosure(id int) error {
+	return s.deleteOne(`DELETE FROM school_closures WHERE id = $1`, id)
+}
+
+func (s *postgresCalendarStore) ImportHoliday(date string, name string) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// The primary key makes a concurrent import of the same date wait for this one
+	// and then find it recorded
+	result, err := tx.Exec(`
+		INSERT INTO imported_holidays (holiday_date) VALUES ($1)
+		ON CONFLICT (holiday_date) DO NOTHING`, date)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	result, err = tx.Exec(`
+		INSERT INTO school_closures (name, start_date, end_date)
+		SELECT $2, $1::date, $1::date
+		WHERE NOT EXISTS (SELECT 1 FROM school_closures WHERE $1::date BETWEEN start_date AND end_date)`,
+		date, name)
+	if err != nil {
+		return false, err
+	}
+	created, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return created > 0, nil
+}
+
+// checkTermFits returns ErrOutsideAcademicYear unless the dates lie within the
+// academic year, or sql.ErrNoRows if the year does not exist
+func checkTermFits(tx *sql.Tx, yearID int, startDate string, endDate string) error {
+	var fits bool
+	err := tx.QueryRow(`
+		SELECT $2::date >= start_date AND $3::date <= end_date
+		FROM academic_years WHERE id = $1 FOR SHARE`, yearID, startDate, endDate).Scan(&fits)
+	if err != nil {
+		return err
+	}
+	if !fits {
+		return ErrOutsideAcademicYear
+	}
+	return nil
+}
+
+// deleteOne runs a delete that must remove exactly one row
+func (s *postgresCalendarStore) deleteOne(query string, id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := execAffectingOne(tx, query, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// listTerms runs a query selecting termColumns
+func (s *postgresCalendarStore) listTerms(query string, args ...interface{}) ([]models.Term, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	terms := []models.Term{}
+	for rows.Next() {
+		term, err := scanTerm(rows)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, *term)
+	}
+
+	return terms, rows.Err()
+}
+
+// scanAcademicYear scans a row selected with academicYearColumns
+func scanAcademicYear(row rowScanner) (*models.AcademicYear, error) {
+	var year models.AcademicYear
+	if err := row.Scan(&year.ID, &year.Name, &year.StartDate, &year.EndDate, &year.CreatedAt); err != nil {
+		return nil, err
+	}
+	year.Terms = []models.Term{}
+	return &year, nil
+}
+
+// scanTerm scans a row selected with termColumns
+func scanTerm(row rowScanner) (*models.Term, error) {
+	var term models.Term
+	err := row.Scan(&term.ID, &term.AcademicYearID, &term.Name, &term.StartDate, &term.EndDate, &term.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &term, nil
+}
+
+// scanClosure scans a row selected with closureColumns
+func scanClosure(row rowScanner) (*models.SchoolClosure, error) {
+	var closure models.SchoolClosure
+	if err := row.Scan(&closure.ID, &closure.Name, &closure.StartDate, &closure.EndDate, &closure.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &closure, nil
+}
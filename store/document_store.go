@@ -0,0 +1,120 @@
+package store
+
+import (
+	"database/sql"
+	"server/models"
+)
+
+// DocumentStore persists documents in the document hub
+type DocumentStore interface {
+	// ListActive returns all documents that have not been deleted, newest first
+	ListActive() ([]models.Document, error)
+	// GetActive returns a document that has not been deleted, or sql.ErrNoRows
+	GetActive(id string) (*models.Document, error)
+	// Create inserts a document and fills in its generated timestamps, status and version
+	Create(doc *models.Document) error
+	// SoftDelete marks an active document as deleted, or returns sql.ErrNoRows
+	SoftDelete(id string) error
+}
+
+type postgresDocumentStore struct {
+	db *sql.DB
+}
+
+// NewDocumentStore returns a DocumentStore backed by PostgreSQL
+func NewDocumentStore(db *sql.DB) DocumentStore {
+	return &postgresDocumentStore{db: db}
+}
+
+const documentColumns = `
+	d.id, d.file_name, d.file_description, d.file_path,
+	d.file_type, d.file_size, d.uploaded_by,
+	u.name AS uploader_name,
+	d.created_at, d.updated_at, d.status, d.checksum, d.version`
+
+func (s *postgresDocumentStore) ListActive() ([]models.Document, error) {
+	rows, err := s.db.Query(`
+		SELECT ` + documentColumns + `
+		FROM documents d
+		LEFT JOIN users u ON d.uploaded_by = u.id
+		WHERE d.status = 'active'
+		ORDER BY d.created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var documents []models.Document
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, *doc)
+	}
+
+	return documents, rows.Err()
+}
+
+func (s *postgresDocumentStore) GetActive(id string) (*models.Document, error) {
+	return scanDocument(s.db.QueryRow(`
+		SELECT `+documentColumns+`
+		FROM documents d
+		LEFT JOIN users u ON d.uploaded_by = u.id
+		WHERE d.id = $1 AND d.status = 'active'`, id))
+}
+
+func (s *postgresDocumentStore) Create(doc *models.Document) error {
+	return s.db.QueryRow(`
+		INSERT INTO documents (
+			id, file_name, file_description, file_path,
+			file_type, file_size, uploaded_by
+		) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at, updated_at, status, version`,
+		doc.ID, doc.FileName, doc.FileDescription, doc.FilePath,
+		doc.FileType, doc.FileSize, doc.UploadedBy,
+	).Scan(&doc.CreatedAt, &doc.UpdatedAt, &doc.Status, &doc.Version)
+}
+
+func (s *postgresDocumentStore) SoftDelete(id string) error {
+	var result int
+	return s.db.QueryRow(`
+		UPDATE documents
+		SET status = 'deleted', updated_at = NOW()
+		WHERE id = $1 AND status = 'active'
+		RETURNING 1`, id).Scan(&result)
+}
+
+// scanDocument scans a row selected with documentColumns
+func scanDocument(row rowScanner) (*models.Document, error) {
+	var doc models.Document
+	var uploaderName, fileDescription, checksum sql.NullString
+	var createdAt, updatedAt sql.NullTime
+
+	err := row.Scan(
+		&doc.ID,
+		&doc.FileName,
+		&fileDescription,
+		&doc.FilePath,
+		&doc.FileType,
+		&doc.FileSize,
+		&doc.UploadedBy,
+		&uploaderName,
+		&createdAt,
+		&updatedAt,
+		&doc.Status,
+		&checksum,
+		&doc.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	doc.FileDescription = fileDescription.String
+	doc.Checksum = checksum.String
+	doc.UploaderName = uploaderName.String
+	doc.CreatedAt = createdAt.Time
+	doc.UpdatedAt = updatedAt.Time
+
+	return &doc, nil
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"database/sql"
+	"server/models"
+
+	"github.com/google/uuid"
+)
+
+// EventStore persists school events and their images
+type EventStore interface {
+	// List returns every event without its images or audience. When studentID is
+	// non-zero only events whose audience includes that student are returned.
+	List(studentID int) ([]models.Event, error)
+	// GetByID returns an event with its images and audience, or sql.ErrNoRows
+	GetByID(eventID string) (*models.Event, error)
+	// InAudience reports whether an event is open to everyone or includes the user's section
+	InAudience(eventID string, userID int) (bool, error)
+	// Create inserts an event with its audience and the file paths of its already saved
+	// images in one transaction, or returns ErrInvalidReference for an unknown section
+	Create(event models.Event) error
+}
+
+type postgresEventStore struct {
+	db *sql.DB
+}
+
+// NewEventStore returns an EventStore backed by PostgreSQL
+func NewEventStore(db *sql.DB) EventStore {
+	return &postgresEventStore{db: db}
+}
+
+const eventColumns = `
+	event_id, author_id, author_name, title, event_description, address,
+	event_date, is_whole_day, start_time, end_time`
+
+func (s *postgresEventStore) List(studentID int) ([]models.Event, error) {
+	query := `SELECT ` + eventColumns + ` FROM events`
+	var args []interface{}
+	if studentID != 0 {
+		query += ` WHERE ` + audienceCondition(eventAudiences, "events.event_id", "$1")
+		args = append(args, studentID)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.Event
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+
+	return events, rows.Err()
+}
+
+func (s *postgresEventStore) GetByID(eventID string) (*models.Event, error) {
+	event, err := scanEvent(s.db.QueryRow(`SELECT `+eventColumns+` FROM events WHERE event_id = $1`, eventID))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT file_path FROM event_images WHERE event_id = $1`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	event.Images = []models.ImageModel{}
+	for rows.Next() {
+		var filePath string
+		if err := rows.Scan(&filePath); err != nil {
+			return nil, err
+		}
+		event.Images = append(event.Images, models.ImageModel{FilePath: filePath})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	event.AudienceSectionIDs, err = listAudience(s.db, eventAudiences, eventID)
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+func (s *postgresEventStore) InAudience(eventID string, userID int) (bool, error) {
+	return inAudience(s.db, eventAudiences, eventID, userID)
+}
+
+func (s *postgresEventStore) Create(event models.Event) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO events (event_id, author_id, author_name, title, event_description, address, event_date, is_whole_day, start_time, end_time)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		event.EventID, event.AuthorID, event.AuthorName, event.Title, event.EventDescription,
+		event.Address, event.EventDate, event.IsWholeDay, event.StartTime, event.EndTime)
+	if err != nil {
+		return err
+	}
+
+	if err := replaceAudience(tx, eventAudiences, event.EventID, event.AudienceSectionIDs); err != nil {
+		return err
+	}
+
+	for _, image := range event.Images {
+		_, err = tx.Exec(`
+			INSERT INTO event_images (id, event_id, file_path)
+			VALUES ($1, $2, $3)`,
+			uuid.New().String(), event.EventID, image.FilePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// scanEvent scans a row selected with eventColumns
+func scanEvent(row rowScanner) (*models.Event, error) {
+	var event models.Event
+	err := row.Scan(
+		&event.EventID, &event.AuthorID, &event.AuthorName, &event.Title,
+		&event.EventDescription, &event.Address, &event.EventDate,
+		&event.IsWholeDay, &event.StartTime, &event.EndTime,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"server/models"
+
+	"github.com/lib/pq"
+)
+
+// GuardianStore persists the guardians who receive a student's attendance alerts
+type GuardianStore interface {
+	// ListByStudent returns a student's guardians, ordered by name
+	ListByStudent(studentID int) ([]models.Guardian, error)
+	// Create inserts a guardian and fills in its generated fields. Returns
+	// ErrInvalidReference if the student does not exist, or ErrConflict if the
+	// email is already a guardian of the student.
+	Create(guardian *models.Guardian) error
+	// Delete removes a guardian of a student, or returns sql.ErrNoRows
+	Delete(studentID int, id int) error
+}
+
+type postgresGuardianStore struct {
+	db *sql.DB
+}
+
+// NewGuardianStore returns a GuardianStore backed by PostgreSQL
+func NewGuardianStore(db *sql.DB) GuardianStore {
+	return &postgresGuardianStore{db: db}
+}
+
+const guardianColumns = `id, student_id, name, email, relationship, created_at`
+
+func (s *postgresGuardianStore) ListByStudent(studentID int) ([]models.Guardian, error) {
+	rows, err := s.db.Query(`SELECT `+guardianColumns+` FROM student_guardians WHERE student_id = $1 ORDER BY name`, studentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	guardians := []models.Guardian{}
+	for rows.Next() {
+		guardian, err := scanGuardian(rows)
+		if err != nil {
+			return nil, err
+		}
+		guardians = append(guardians, *guardian)
+	}
+
+	return guardians, rows.Err()
+}
+
+func (s *postgresGuardianStore) Create(guardian *models.Guardian) error {
+	created, err := scanGuardian(s.db.QueryRow(`
+		INSERT INTO student_guardians (student_id, name, email, relationship)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+guardianColumns,
+		guardian.StudentID, guardian.Name, guardian.Email, guardian.Relationship))
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return ErrInvalidReference
+		}
+		return conflictOr(err)
+	}
+	*guardian = *created
+	return nil
+}
+
+func (s *postgresGuardianStore) Delete(studentID int, id int) error {
+	result, err := s.db.Exec(`DELETE FROM student_guardians WHERE id = $1 AND student_id = $2`, id, studentID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// scanGuardian scans a row selected with guardianColumns
+func scanGuardian(row rowScanner) (*models.Guardian, error) {
+	var guardian models.Guardian
+	err := row.Scan(
+		&guardian.ID, &guardian.StudentID, &guardian.Name, &guardian.Email,
+		&guardian.Relationship, &guardian.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &guardian, nil
+}
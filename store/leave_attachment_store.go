@@ -0,0 +1,105 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"server/models"
+
+	"github.com/lib/pq"
+)
+
+// LeaveAttachmentStore persists the files attached to leave requests
+type LeaveAttachmentStore interface {
+	// ListByRequest returns the attachments of a leave request, oldest first
+	ListByRequest(requestID int) ([]models.LeaveAttachment, error)
+	// Get returns an attachment of a leave request, or sql.ErrNoRows
+	Get(requestID int, id string) (*models.LeaveAttachment, error)
+	// Create inserts an attachment and fills in its creation time; returns
+	// ErrInvalidReference if the leave request does not exist
+	Create(attachment *models.LeaveAttachment) error
+	// Delete removes an attachment of a leave request, or returns sql.ErrNoRows
+	Delete(requestID int, id string) error
+}
+
+type postgresLeaveAttachmentStore struct {
+	db *sql.DB
+}
+
+// NewLeaveAttachmentStore returns a LeaveAttachmentStore backed by PostgreSQL
+func NewLeaveAttachmentStore(db *sql.DB) LeaveAttachmentStore {
+	return &postgresLeaveAttachmentStore{db: db}
+}
+
+const leaveAttachmentColumns = `
+	a.id, a.leave_request_id, a.file_name, a.file_path, a.file_type, a.file_size,
+	a.uploaded_by, COALESCE(u.name, ''), a.created_at`
+
+func (s *postgresLeaveAttachmentStore) ListByRequest(requestID int) ([]models.LeaveAttachment, error) {
+	rows, err := s.db.Query(`
+		SELECT `+leaveAttachmentColumns+`
+		FROM leave_request_attachments a
+		LEFT JOIN users u ON u.id = a.uploaded_by
+		WHERE a.leave_request_id = $1
+		ORDER BY a.created_at, a.id`, requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []models.LeaveAttachment{}
+	for rows.Next() {
+		attachment, err := scanLeaveAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, *attachment)
+	}
+
+	return attachments, rows.Err()
+}
+
+func (s *postgresLeaveAttachmentStore) Get(requestID int, id string) (*models.LeaveAttachment, error) {
+	return scanLeaveAttachment(s.db.QueryRow(`
+		SELECT `+leaveAttachmentColumns+`
+		FROM leave_request_attachments a
+		LEFT JOIN users u ON u.id = a.uploaded_by
+		WHERE a.leave_request_id = $1 AND a.id = $2`, requestID, id))
+}
+
+func (s *postgresLeaveAttachmentStore) Create(attachment *models.LeaveAttachment) error {
+	err := s.db.QueryRow(`
+		INSERT INTO leave_request_attachments
+			(id, leave_request_id, file_name, file_path, file_type, file_size, uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at`,
+		attachment.ID, attachment.LeaveRequestID, attachment.FileName, attachment.FilePath,
+		attachment.FileType, attachment.FileSize, attachment.UploadedBy,
+	).Scan(&attachment.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		return ErrInvalidReference
+	}
+	return err
+}
+
+func (s *postgresLeaveAttachmentStore) Delete(requestID int, id string) error {
+	var deleted int
+	return s.db.QueryRow(`
+		DELETE FROM leave_request_attachments
+		WHERE leave_request_id = $1 AND id = $2
+		RETURNING 1`, requestID, id).Scan(&deleted)
+}
+
+// scanLeaveAttachment scans a row selected with leaveAttachmentColumns
+func scanLeaveAttachment(row rowScanner) (*models.LeaveAttachment, error) {
+	var attachment models.LeaveAttachment
+	err := row.Scan(
+		&attachment.ID, &attachment.LeaveRequestID, &attachment.FileName, &attachment.FilePath,
+		&attachment.FileType, &attachment.FileSize, &attachment.UploadedBy, &attachment.UploaderName,
+		&attachment.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"server/models"
+	"strings"
+)
+
+// LeaveReportStore aggregates leave requests for reporting. Requests are reported
+// on by the day they were made, and by the year group the student is in now.
+type LeaveReportStore interface {
+	// WeeklyCounts returns the requests made each week by type, status and year
+	// group, oldest week first
+	WeeklyCounts(filter models.LeaveReportFilter) ([]models.LeaveWeeklyCount, error)
+	// ResponseTimes returns how long staff took to approve or reject requests
+	ResponseTimes(filter models.LeaveReportFilter) (*models.LeaveResponseTimes, error)
+	// TopRequesters returns up to limit students with the most requests, most first
+	TopRequesters(filter models.LeaveReportFilter, limit int) ([]models.LeaveRequester, error)
+	// StaffResponses returns the approvals and rejections of each staff member who
+	// answered a request, busiest first
+	StaffResponses(filter models.LeaveReportFilter) ([]models.StaffLeaveResponses, error)
+}
+
+type postgresLeaveReportStore struct {
+	db *sql.DB
+}
+
+// NewLeaveReportStore returns a LeaveReportStore backed by PostgreSQL
+func NewLeaveReportStore(db *sql.DB) LeaveReportStore {
+	return &postgresLeaveReportStore{db: db}
+}
+
+// leaveReportTables joins each leave request lr to the student's attendance row a
+const leaveReportTables = `
+	leave_requests lr
+	LEFT JOIN attendance a ON a.user_id = lr.student_id`
+
+// leaveApproved is true for a leave request lr that staff approved at some point,
+// even if it was later cancelled or finished
+const leaveApproved = `EXISTS (
+	SELECT 1 FROM leave_request_transitions t
+	WHERE t.leave_request_id = lr.id AND t.to_status = 'approved')`
+
+// minutesBetween returns the minutes from timestamp column from to column to
+func minutesBetween(from string, to string) string {
+	return fmt.Sprintf("EXTRACT(EPOCH FROM (%s - %s)) / 60", to, from)
+}
+
+// leaveReportConditions returns the conditions of filter on leaveReportTables and
+// their arguments; the range is bound to $1 and $2
+func leaveReportConditions(filter models.LeaveReportFilter) (string, []interface{}) {
+	args := []interface{}{filter.From.Format("2006-01-02"), filter.To.Format("2006-01-02")}
+	conditions := []string{"lr.created_at::date BETWEEN $1::date AND $2::date"}
+	if filter.YearGroup != "" {
+		args = append(args, filter.YearGroup)
+		conditions = append(conditions, fmt.Sprintf(
+			"(LOWER(a.year) = LOWER($%[1]d) OR LOWER(a.year || '-' || a.group_name) = LOWER($%[1]d))", len(args)))
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+func (s *postgresLeaveReportStore) WeeklyCounts(filter models.LeaveReportFilter) ([]models.LeaveWeeklyCount, error) {
+	conditions, args := leaveReportConditions(filter)
+	rows, err := s.db.Query(`
+		SELECT DATE_TRUNC('week', lr.created_at)::date AS week, lr.request_type, lr.status,
+			COALESCE(a.year, '') AS year_group, COUNT(*)
+		FROM `+leaveReportTables+`
+		WHERE `+conditions+`
+		GROUP BY week, lr.request_type, lr.status, year_group
+		ORDER BY week, year_group, lr.request_type, lr.status`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []models.LeaveWeeklyCount{}
+	for rows.Next() {
+		var count models.LeaveWeeklyCount
+		if err := rows.Scan(&count.WeekStart, &count.RequestType, &count.Status, &count.YearGroup, &count.Requests); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+func (s *postgresLeaveReportStore) ResponseTimes(filter models.LeaveReportFilter) (*models.LeaveResponseTimes, error) {
+	conditions, args := leaveReportConditions(filter)
+	minutes := minutesBetween("lr.created_at", "t.responded_at")
+
+	// Requests are answered by their first approval or rejection, as in StaffResponses
+	var times models.LeaveResponseTimes
+	err := s.db.QueryRow(`
+		SELECT COUNT(*),
+			COALESCE(PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY `+minutes+`), 0),
+			COALESCE(AVG(`+minutes+`), 0)
+		FROM `+leaveReportTables+`
+		JOIN (
+			SELECT leave_request_id, MIN(created_at) AS responded_at
+			FROM leave_request_transitions
+			WHERE to_status IN ('approved', 'rejected') AND actor_id IS NOT NULL
+			GROUP BY leave_request_id
+		) t ON t.leave_request_id = lr.id
+		WHERE `+conditions,
+		args...).Scan(&times.Responded, &times.MedianMinutes, &times.AverageMinutes)
+	if err != nil {
+		return nil, err
+	}
+	return &times, nil
+}
+
+func (s *postgresLeaveReportStore) TopRequesters(filter models.LeaveReportFilter, limit int) ([]models.LeaveRequester, error) {
+	conditions, args := leaveReportConditions(filter)
+	args = append(args, limit)
+	rows, err := s.db.Query(`
+		SELECT lr.student_id, COALESCE(u.name, MAX(lr.student_name)), COALESCE(MAX(a.year), ''),
+			COUNT(*), COUNT(*) FILTER (WHERE `+leaveApproved+`)
+		FROM `+leaveReportTables+`
+		LEFT JOIN users u ON u.id = lr.student_id
+		WHERE `+conditions+`
+		GROUP BY lr.student_id, u.name
+		ORDER BY COUNT(*) DESC, 2
+		LIMIT $`+fmt.Sprint(len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requesters := []models.LeaveRequester{}
+	for rows.Next() {
+		var requester models.LeaveRequester
+		err := rows.Scan(&requester.StudentID, &requester.Name, &requester.YearGroup, &requester.Requests, &requester.Approved)
+		if err != nil {
+			return nil, err
+		}
+		requesters = append(requesters, requester)
+	}
+
+	return requesters, rows.Err()
+}
+
+func (s *postgresLeaveReportStore) StaffResponses(filter models.LeaveReportFilter) ([]models.StaffLeaveResponses, error) {
+	conditions, args := leaveReportConditions(filter)
+
+	// Each approval or rejection is a transition made by the staff member, so
+	// requests answered and later cancelled still count
+	rows, err := s.db.Query(`
+		SELECT t.actor_id, COALESCE(u.name, ''),
+			COUNT(*) FILTER (WHERE t.to_status = 'approved'),
+			COUNT(*) FILTER (WHERE t.to_status = 'rejected'),
+			PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY `+minutesBetween("lr.created_at", "t.created_at")+`)
+		FROM `+leaveReportTables+`
+		JOIN leave_request_transitions t ON t.leave_request_id = lr.id
+		LEFT JOIN users u ON u.id = t.actor_id
+		WHERE `+conditions+` AND t.to_status IN ('approved', 'rejected') AND t.actor_id IS NOT NULL
+		GROUP BY t.actor_id, u.name
+		ORDER BY COUNT(*) DESC, 2`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	staff := []models.StaffLeaveResponses{}
+	for rows.Next() {
+		var responses models.StaffLeaveResponses
+		err := rows.Scan(&responses.StaffID, &responses.Name, &responses.Approved, &responses.Rejected, &responses.MedianMinutes)
+		if err != nil {
+			return nil, err
+		}
+		staff = append(staff, responses)
+	}
+
+	return staff, rows.Err()
+}
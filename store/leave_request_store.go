@@ -0,0 +1,349 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"server/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// likeEscaper escapes the wildcards of a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// TransitionError is returned when a leave request cannot change from its current
+// status to the requested one
+type TransitionError struct {
+	From string
+	To   string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot change a leave request from %s to %s", e.From, e.To)
+}
+
+// LeaveRequestStore persists student leave requests
+type LeaveRequestStore interface {
+	// Create inserts a pending leave request, recording its creation by the student,
+	// and fills in its generated fields. An empty LeaveDate defaults to today.
+	Create(request *models.LeaveRequest) error
+	// GetByID returns a leave request, or sql.ErrNoRows
+	GetByID(id int) (*models.LeaveRequest, error)
+	// GetByActivityID returns the leave request tracked by a Live Activity, or sql.ErrNoRows
+	GetByActivityID(activityID string) (*models.LeaveRequest, error)
+	// ListByStatus returns the leave requests with the given status, the most
+	// escalated first and then newest first
+	ListByStatus(status string) ([]models.LeaveRequest, error)
+	// ListByStudent returns a student's leave requests, newest first
+	ListByStudent(studentID int) ([]models.LeaveRequest, error)
+	// Search returns up to query.Limit leave requests matching the query, in its sort order
+	Search(query models.LeaveRequestQuery) ([]models.LeaveRequest, error)
+	// Transition changes a leave request's status on behalf of actorID and records
+	// the change. Approving or rejecting makes the actor the responding staff member.
+	// Returns sql.ErrNoRows, or a *TransitionError if models.CanTransitionLeave
+	// does not allow the change.
+	Transition(id int, status string, actorID int, at time.Time) (*models.LeaveRequest, error)
+	// ListAwaitingEscalation returns the unanswered leave requests created at or before
+	// createdBefore that have not reached escalation level, oldest first
+	ListAwaitingEscalation(level int, createdBefore time.Time) ([]models.LeaveRequest, error)
+	// Escalate raises an unanswered leave request to level, or returns sql.ErrNoRows
+	// if it was answered or already reached the level
+	Escalate(id int, level int, at time.Time) (*models.LeaveRequest, error)
+	// Return records that the student came back from leave at the given time,
+	// finishing the request like Transition
+	Return(id int, studentID int, at time.Time) (*models.LeaveRequest, error)
+	// ListOverdue returns the approved leave requests whose end time has passed
+	// without the student returning, most overdue first
+	ListOverdue(now time.Time) ([]models.LeaveRequest, error)
+	// ListTransitions returns the status changes of a leave request, oldest first
+	ListTransitions(id int) ([]models.LeaveTransition, error)
+	// SetLiveActivity attaches a Live Activity to a leave request, or returns sql.ErrNoRows
+	SetLiveActivity(id int, activityID string, token string) (*models.LeaveRequest, error)
+	// ClearLiveActivityToken forgets the push token of a request's ended Live Activity
+	// if it is still token. The activity ID is kept so the request can still be found.
+	ClearLiveActivityToken(id int, token string) error
+}
+
+type postgresLeaveRequestStore struct {
+	db *sql.DB
+}
+
+// NewLeaveRequestStore returns a LeaveRequestStore backed by PostgreSQL
+func NewLeaveRequestStore(db *sql.DB) LeaveRequestStore {
+	return &postgresLeaveRequestStore{db: db}
+}
+
+const leaveRequestColumns = `
+	id, student_id, student_name, request_type, reason,
+	TO_CHAR(leave_date, 'YYYY-MM-DD'), TO_CHAR(leave_end_date, 'YYYY-MM-DD'), status,
+	created_at, updated_at, responded_by, response_time,
+	live_activity_id, live_activity_token, starts_at, ends_at, returned_at,
+	escalation_level, escalated_at`
+
+func (s *postgresLeaveRequestStore) Create(request *models.LeaveRequest) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	created, err := scanLeaveRequest(tx.QueryRow(`
+		INSERT INTO leave_requests
+			(student_id, student_name, request_type, reason, leave_date, leave_end_date,
+			status, live_activity_id, live_activity_token, starts_at, ends_at)
+		VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, '')::date, CURRENT_DATE), $6, 'pending', $7, $8, $9, $10)
+		RETURNING `+leaveRequestColumns,
+		request.StudentID, request.StudentName, request.RequestType, request.Reason,
+		request.LeaveDate, request.LeaveEndDate, request.LiveActivityId, request.LiveActivityToken,
+		request.StartsAt, request.EndsAt))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO leave_request_transitions (leave_request_id, from_status, to_status, actor_id, created_at)
+		VALUES ($1, NULL, $2, $3, $4)`, created.ID, created.Status, created.StudentID, created.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	*request = *created
+	return nil
+}
+
+func (s *postgresLeaveRequestStore) GetByID(id int) (*models.LeaveRequest, error) {
+	return scanLeaveRequest(s.db.QueryRow(`SELECT `+leaveRequestColumns+` FROM leave_requests WHERE id = $1`, id))
+}
+
+func (s *postgresLeaveRequestStore) GetByActivityID(activityID string) (*models.LeaveRequest, error) {
+	return scanLeaveRequest(s.db.QueryRow(`SELECT `+leaveRequestColumns+` FROM leave_requests WHERE live_activity_id = $1`, activityID))
+}
+
+func (s *postgresLeaveRequestStore) ListByStatus(status string) ([]models.LeaveRequest, error) {
+	return s.list(`SELECT `+leaveRequestColumns+` FROM leave_requests WHERE status = $1 ORDER BY escalation_level DESC, created_at DESC`, status)
+}
+
+func (s *postgresLeaveRequestStore) ListByStudent(studentID int) ([]models.LeaveRequest, error) {
+	return s.list(`SELECT `+leaveRequestColumns+` FROM leave_requests WHERE student_id = $1 ORDER BY created_at DESC`, studentID)
+}
+
+func (s *postgresLeaveRequestStore) Search(query models.LeaveRequestQuery) ([]models.LeaveRequest, error) {
+	var args []interface{}
+	conditions := []string{"TRUE"}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if len(query.Statuses) > 0 {
+		where("status = ANY($%d)", pq.Array(query.Statuses))
+	}
+	if query.RequestType != "" {
+		where("LOWER(request_type) = LOWER($%d)", query.RequestType)
+	}
+	if query.YearGroup != "" {
+		where(`EXISTS (
+			SELECT 1 FROM attendance a
+			WHERE a.user_id = leave_requests.student_id
+			  AND (LOWER(a.year) = LOWER($%[1]d) OR LOWER(a.year || '-' || a.group_name) = LOWER($%[1]d)))`, query.YearGroup)
+	}
+	if query.From != nil {
+		where("COALESCE(leave_end_date, leave_date) >= $%d::date", query.From.Format("2006-01-02"))
+	}
+	if query.To != nil {
+		where("leave_date <= $%d::date", query.To.Format("2006-01-02"))
+	}
+	if query.RespondedBy != 0 {
+		where("responded_by = $%d", query.RespondedBy)
+	}
+	if query.Reason != "" {
+		where(`reason ILIKE '%%' || $%d || '%%'`, likeEscaper.Replace(query.Reason))
+	}
+
+	// Keyset pagination: continue after the cursor's row in the sort order, using the
+	// ID to break ties
+	column, cast := "created_at", "timestamp"
+	if query.Sort == models.LeaveSortLeaveDate {
+		column, cast = "leave_date", "date"
+	}
+	direction, compare := "DESC", "<"
+	if query.Ascending {
+		direction, compare = "ASC", ">"
+	}
+	if query.After != nil {
+		args = append(args, query.After.Value, query.After.ID)
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s ($%d::%s, $%d)", column, compare, len(args)-1, cast, len(args)))
+	}
+
+	args = append(args, query.Limit)
+	return s.list(`SELECT `+leaveRequestColumns+` FROM leave_requests
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY `+column+` `+direction+`, id `+direction+`
+		LIMIT $`+strconv.Itoa(len(args)), args...)
+}
+
+func (s *postgresLeaveRequestStore) ListAwaitingEscalation(level int, createdBefore time.Time) ([]models.LeaveRequest, error) {
+	return s.list(`
+		SELECT `+leaveRequestColumns+` FROM leave_requests
+		WHERE status IN ('sent', 'pending') AND escalation_level < $1 AND created_at <= $2
+		ORDER BY created_at`, level, createdBefore)
+}
+
+func (s *postgresLeaveRequestStore) Escalate(id int, level int, at time.Time) (*models.LeaveRequest, error) {
+	return scanLeaveRequest(s.db.QueryRow(`
+		UPDATE leave_requests
+		SET escalation_level = $2, escalated_at = $3
+		WHERE id = $1 AND status IN ('sent', 'pending') AND escalation_level < $2
+		RETURNING `+leaveRequestColumns,
+		id, level, at))
+}
+
+func (s *postgresLeaveRequestStore) Transition(id int, status string, actorID int, at time.Time) (*models.LeaveRequest, error) {
+	return s.transition(id, status, actorID, at, false)
+}
+
+func (s *postgresLeaveRequestStore) Return(id int, studentID int, at time.Time) (*models.LeaveRequest, error) {
+	return s.transition(id, models.LeaveFinished, studentID, at, true)
+}
+
+func (s *postgresLeaveRequestStore) ListOverdue(now time.Time) ([]models.LeaveRequest, error) {
+	return s.list(`
+		SELECT `+leaveRequestColumns+` FROM leave_requests
+		WHERE status = 'approved' AND returned_at IS NULL AND ends_at < $1
+		ORDER BY ends_at`, now)
+}
+
+// transition changes the status under a row lock so concurrent changes are checked
+// against the status they actually replace. returned also sets returned_at.
+func (s *postgresLeaveRequestStore) transition(id int, status string, actorID int, at time.Time, returned bool) (*models.LeaveRequest, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var current string
+	if err := tx.QueryRow(`SELECT status FROM leave_requests WHERE id = $1 FOR UPDATE`, id).Scan(&current); err != nil {
+		return nil, err
+	}
+	if !models.CanTransitionLeave(current, status) {
+		return nil, &TransitionError{From: current, To: status}
+	}
+
+	// A response or cancellation ends the wait, so it sets the response time. Only the
+	// first one does: cancelling an approved request keeps the approver's response time.
+	updated, err := scanLeaveRequest(tx.QueryRow(`
+		UPDATE leave_requests
+		SET status = $1, updated_at = $2,
+			responded_by = CASE WHEN $1 IN ('approved', 'rejected') THEN $3::integer ELSE responded_by END,
+			response_time = CASE WHEN $1 IN ('approved', 'rejected', 'cancelled') THEN COALESCE(response_time, $2::timestamp) ELSE response_time END,
+			returned_at = CASE WHEN $5::boolean THEN $2::timestamp ELSE returned_at END
+		WHERE id = $4
+		RETURNING `+leaveRequestColumns,
+		status, at, actorID, id, returned))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO leave_request_transitions (leave_request_id, from_status, to_status, actor_id, created_at)
+		VALUES ($1, $2, $3, $4, $5)`, id, current, status, actorID, at)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (s *postgresLeaveRequestStore) ListTransitions(id int) ([]models.LeaveTransition, error) {
+	rows, err := s.db.Query(`
+		SELECT t.id, t.leave_request_id, t.from_status, t.to_status, t.actor_id,
+			COALESCE(u.name, ''), t.created_at
+		FROM leave_request_transitions t
+		LEFT JOIN users u ON u.id = t.actor_id
+		WHERE t.leave_request_id = $1
+		ORDER BY t.created_at, t.id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transitions := []models.LeaveTransition{}
+	for rows.Next() {
+		var transition models.LeaveTransition
+		err := rows.Scan(
+			&transition.ID, &transition.LeaveRequestID, &transition.FromStatus, &transition.ToStatus,
+			&transition.ActorID, &transition.ActorName, &transition.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, transition)
+	}
+
+	return transitions, rows.Err()
+}
+
+func (s *postgresLeaveRequestStore) SetLiveActivity(id int, activityID string, token string) (*models.LeaveRequest, error) {
+	return scanLeaveRequest(s.db.QueryRow(`
+		UPDATE leave_requests
+		SET live_activity_id = $1, live_activity_token = $2, updated_at = NOW()
+		WHERE id = $3
+		RETURNING `+leaveRequestColumns,
+		activityID, token, id))
+}
+
+func (s *postgresLeaveRequestStore) ClearLiveActivityToken(id int, token string) error {
+	_, err := s.db.Exec(`
+		UPDATE leave_requests
+		SET live_activity_token = NULL, updated_at = NOW()
+		WHERE id = $1 AND live_activity_token = $2`,
+		id, token)
+	return err
+}
+
+// list runs a query selecting leaveRequestColumns
+func (s *postgresLeaveRequestStore) list(query string, args ...interface{}) ([]models.LeaveRequest, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []models.LeaveRequest
+	for rows.Next() {
+		request, err := scanLeaveRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, *request)
+	}
+
+	return requests, rows.Err()
+}
+
+// scanLeaveRequest scans a row selected with leaveRequestColumns
+func scanLeaveRequest(row rowScanner) (*models.LeaveRequest, error) {
+	var request models.LeaveRequest
+	err := row.Scan(
+		&request.ID, &request.StudentID, &request.StudentName, &request.RequestType,
+		&request.Reason, &request.LeaveDate, &request.LeaveEndDate, &request.Status,
+		&request.CreatedAt, &request.UpdatedAt,
+		&request.RespondedBy, &request.ResponseTime, &request.LiveActivityId, &request.LiveActivityToken,
+		&request.StartsAt, &request.EndsAt, &request.ReturnedAt,
+		&request.EscalationLevel, &request.EscalatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
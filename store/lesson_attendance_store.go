@@ -0,0 +1,194 @@
+package store
+
+import (
+	"database/sql"
+	"server/models"
+	"strings"
+	"time"
+)
+
+// LessonAttendanceStore persists per-lesson registers of teaching groups, kept
+// separate from homeroom attendance
+type LessonAttendanceStore interface {
+	// GetRegister returns a teaching group's register for one lesson, listing every
+	// enrolled student; students not yet marked are Pending. Returns sql.ErrNoRows
+	// if the teaching group does not exist.
+	GetRegister(code string, teachingGroup string, date time.Time, period int) (*models.LessonRegister, error)
+	// IsTeacher reports whether the user teaches the teaching group
+	IsTeacher(code string, teachingGroup string, userID int) (bool, error)
+	// RecordRegister saves a lesson's marks in one transaction; an empty or Pending
+	// status clears a student's mark. Returns sql.ErrNoRows if the teaching group
+	// does not exist, or ErrInvalidReference if a student is not enrolled in it.
+	RecordRegister(code string, teachingGroup string, date time.Time, period int, updates []models.AttendanceUpdate, takenBy int) error
+	// ListStudentSubjects returns a student's lesson attendance per subject they take
+	ListStudentSubjects(studentID int) ([]models.SubjectAttendance, error)
+}
+
+type postgresLessonAttendanceStore struct {
+	db *sql.DB
+}
+
+// NewLessonAttendanceStore returns a LessonAttendanceStore backed by PostgreSQL
+func NewLessonAttendanceStore(db *sql.DB) LessonAttendanceStore {
+	return &postgresLessonAttendanceStore{db: db}
+}
+
+func (s *postgresLessonAttendanceStore) GetRegister(code string, teachingGroup string, date time.Time, period int) (*models.LessonRegister, error) {
+	register := models.LessonRegister{
+		Code:          code,
+		TeachingGroup: teachingGroup,
+		Date:          date.Format("2006-01-02"),
+		Period:        period,
+		Students:      []models.LessonStudent{},
+	}
+
+	err := s.db.QueryRow(`
+		SELECT subject FROM subjects
+		WHERE code = $1 AND teaching_group = $2
+		LIMIT 1`, code, teachingGroup).Scan(&register.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	var registerID int
+	var updatedAt time.Time
+	err = s.db.QueryRow(`
+		SELECT id, taken_by, updated_at FROM lesson_registers
+		WHERE code = $1 AND teaching_group = $2 AND lesson_date = $3 AND period = $4`,
+		code, teachingGroup, register.Date, period).Scan(&registerID, &register.TakenBy, &updatedAt)
+	switch {
+	case err == nil:
+		register.Taken = true
+		register.UpdatedAt = &updatedAt
+	case err != sql.ErrNoRows:
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT u.id, u.name, COALESCE(INITCAP(la.status), 'Pending')
+		FROM users u
+		LEFT JOIN lesson_attendance la ON la.student_id = u.id AND la.register_id = $3
+		WHERE u.id IN (SELECT student_id FROM subjects WHERE code = $1 AND teaching_group = $2)
+		ORDER BY u.name`, code, teachingGroup, registerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var student models.LessonStudent
+		if err := rows.Scan(&student.UserID, &student.Name, &student.Status); err != nil {
+			return nil, err
+		}
+		register.Students = append(register.Students, student)
+	}
+
+	return &register, rows.Err()
+}
+
+func (s *postgresLessonAttendanceStore) IsTeacher(code string, teachingGroup string, userID int) (bool, error) {
+	var teaches bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM subjects WHERE code = $1 AND teaching_group = $2 AND teacher_id = $3)`,
+		code, teachingGroup, userID).Scan(&teaches)
+	return teaches, err
+}
+
+func (s *postgresLessonAttendanceStore) RecordRegister(code string, teachingGroup string, date time.Time, period int, updates []models.AttendanceUpdate, takenBy int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM subjects WHERE code = $1 AND teaching_group = $2)`,
+		code, teachingGroup).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	var registerID int
+	err = tx.QueryRow(`
+		INSERT INTO lesson_registers (code, teaching_group, lesson_date, period, taken_by)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (code, teaching_group, lesson_date, period)
+		DO UPDATE SET taken_by = EXCLUDED.taken_by, updated_at = NOW()
+		RETURNING id`,
+		code, teachingGroup, date.Format("2006-01-02"), period, takenBy).Scan(&registerID)
+	if err != nil {
+		return err
+	}
+
+	for _, update := range updates {
+		var enrolled bool
+		err := tx.QueryRow(`
+			SELECT EXISTS(SELECT 1 FROM subjects WHERE code = $1 AND teaching_group = $2 AND student_id = $3)`,
+			code, teachingGroup, update.UserID).Scan(&enrolled)
+		if err != nil {
+			return err
+		}
+		if !enrolled {
+			return ErrInvalidReference
+		}
+
+		if update.Status == "" || update.Status == models.AttendancePending {
+			_, err = tx.Exec(`
+				DELETE FROM lesson_attendance WHERE register_id = $1 AND student_id = $2`,
+				registerID, update.UserID)
+		} else {
+			_, err = tx.Exec(`
+				INSERT INTO lesson_attendance (register_id, student_id, status)
+				VALUES ($1, $2, $3)
+				ON CONFLICT (register_id, student_id) DO UPDATE SET status = EXCLUDED.status`,
+				registerID, update.UserID, strings.ToLower(update.Status))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *postgresLessonAttendanceStore) ListStudentSubjects(studentID int) ([]models.SubjectAttendance, error) {
+	rows, err := s.db.Query(`
+		SELECT g.subject, g.code, g.teaching_group,
+			COUNT(*) FILTER (WHERE la.status = 'present'),
+			COUNT(*) FILTER (WHERE la.status = 'absent'),
+			COUNT(*) FILTER (WHERE la.status = 'late'),
+			COUNT(*) FILTER (WHERE la.status = 'medical'),
+			COUNT(*) FILTER (WHERE la.status = 'early')
+		FROM (
+			SELECT DISTINCT subject, COALESCE(code, '') AS code, COALESCE(teaching_group, '') AS teaching_group
+			FROM subjects
+			WHERE student_id = $1
+		) g
+		LEFT JOIN lesson_registers r ON r.code = g.code AND r.teaching_group = g.teaching_group
+		LEFT JOIN lesson_attendance la ON la.register_id = r.id AND la.student_id = $1
+		GROUP BY g.subject, g.code, g.teaching_group
+		ORDER BY g.subject, g.code`, studentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subjects := []models.SubjectAttendance{}
+	for rows.Next() {
+		var subject models.SubjectAttendance
+		err := rows.Scan(
+			&subject.Subject, &subject.Code, &subject.TeachingGroup,
+			&subject.Present, &subject.Absent, &subject.Late, &subject.Medical, &subject.Early,
+		)
+		if err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, subject)
+	}
+
+	return subjects, rows.Err()
+}
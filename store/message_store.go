@@ -0,0 +1,402 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"server/models"
+	"strings"
+)
+
+// MessageStore persists conversations, their participants and messages
+type MessageStore interface {
+	// ListConversations returns the user's conversations, most recently active first
+	ListConversations(userID int) ([]models.ConversationSummary, error)
+	// ConversationExists reports whether a conversation exists
+	ConversationExists(conversationID int) (bool, error)
+	// IsParticipant reports whether the user is a member of the conversation
+	IsParticipant(conversationID int, userID int) (bool, error)
+	// MarkRead marks every message in the conversation not sent by readerID as read,
+	// returning how many were unread
+	MarkRead(conversationID int, readerID int) (int, error)
+	// ListMessages returns up to limit messages in chronological order. When beforeID
+	// is non-zero only messages older than that message are returned.
+	ListMessages(conversationID int, beforeID int, limit int) ([]models.Message, error)
+	// HasMessagesBefore reports whether the conversation has messages older than messageID
+	HasMessagesBefore(conversationID int, messageID int) (bool, error)
+	// CountMessages returns the number of messages in the conversation
+	CountMessages(conversationID int) (int, error)
+	// CreateMessage inserts an unread message and returns it with the sender's name
+	CreateMessage(conversationID int, senderID int, content string) (*models.Message, error)
+	// FindDirectConversation returns a conversation both users take part in, or sql.ErrNoRows
+	FindDirectConversation(userA int, userB int) (int, error)
+	// CreateConversation creates a conversation with the given members and returns its ID
+	CreateConversation(userIDs []int) (int, error)
+	// ListParticipants returns every member of the conversation
+	ListParticipants(conversationID int) ([]models.ConversationParticipant, error)
+	// ListChatUsers returns the users with the given role, ordered by name
+	ListChatUsers(role string) ([]models.ChatUser, error)
+	// ListPushRecipients returns the members of the conversation other than the
+	// sender that have a device token registered
+	ListPushRecipients(conversationID int, senderID int) ([]models.PushRecipient, error)
+}
+
+type postgresMessageStore struct {
+	db *sql.DB
+}
+
+// NewMessageStore returns a MessageStore backed by PostgreSQL
+func NewMessageStore(db *sql.DB) MessageStore {
+	return &postgresMessageStore{db: db}
+}
+
+const messageColumns = `
+	m.id, m.conversation_id, m.sender_id, u.name AS sender_name,
+	m.content, m.created_at, m.read`
+
+func (s *postgresMessageStore) ListConversations(userID int) ([]models.ConversationSummary, error) {
+	// Fetch every conversation with its unread count, latest message and
+	// other participants in a single round trip
+	rows, err := s.db.Query(`
+		WITH UserConversations AS (
+			SELECT
+				c.id AS conversation_id,
+				c.created_at AS conversation_created_at
+			FROM conversations c
+			JOIN conversation_participants cp ON c.id = cp.conversation_id
+			WHERE cp.user_id = $1
+		),
+		UnreadCounts AS (
+			SELECT m.conversation_id, COUNT(*) AS unread_count
+			FROM messages m
+			JOIN UserConversations uc ON m.conversation_id = uc.conversation_id
+			WHERE m.sender_id != $1 AND m.read = false
+			GROUP BY m.conversation_id
+		),
+		LatestMessages AS (
+			SELECT DISTINCT ON (conversation_id)
+				m.id AS message_id,
+				m.conversation_id,
+				m.sender_id,
+				u.name AS sender_name,
+				m.content,
+				m.created_at,
+				m.read
+			FROM messages m
+			JOIN UserConversations uc ON m.conversation_id = uc.conversation_id
+			JOIN users u ON m.sender_id = u.id
+			ORDER BY m.conversation_id, m.created_at DESC
+		),
+		ConversationParticipants AS (
+			SELECT
+				cp.conversation_id,
+				json_agg(
+					json_build_object(
+						'id', u.id,
+						'first_name', COALESCE(u.first_name, ''),
+						'last_name', COALESCE(u.last_name, ''),
+						'name', u.name,
+						'role', u.role
+					)
+				) AS participants
+			FROM conversation_participants cp
+			JOIN UserConversations uc ON cp.conversation_id = uc.conversation_id
+			JOIN users u ON cp.user_id = u.id
+			WHERE cp.user_id != $1
+			GROUP BY cp.conversation_id
+		)
+		SELECT
+			uc.conversation_id,
+			uc.conversation_created_at,
+			COALESCE(cp.participants, '[]'::json) AS participants,
+			COALESCE(uc2.unread_count, 0) AS unread_count,
+			lm.message_id,
+			lm.sender_id,
+			lm.sender_name,
+			lm.content,
+			lm.created_at,
+			lm.read
+		FROM UserConversations uc
+		LEFT JOIN ConversationParticipants cp ON uc.conversation_id = cp.conversation_id
+		LEFT JOIN UnreadCounts uc2 ON uc.conversation_id = uc2.conversation_id
+		LEFT JOIN LatestMessages lm ON uc.conversation_id = lm.conversation_id
+		ORDER BY COALESCE(lm.created_at, uc.conversation_created_at) DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conversations []models.ConversationSummary
+	for rows.Next() {
+		var conversation models.ConversationSummary
+		var participantsJSON []byte
+		var messageID, senderID sql.NullInt64
+		var senderName, content sql.NullString
+		var createdAt sql.NullTime
+		var read sql.NullBool
+
+		err := rows.Scan(
+			&conversation.ID, &conversation.CreatedAt, &participantsJSON, &conversation.UnreadCount,
+			&messageID, &senderID, &senderName, &content, &createdAt, &read,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(participantsJSON, &conversation.Participants); err != nil {
+			return nil, err
+		}
+
+		if messageID.Valid {
+			conversation.LatestMessage = &models.Message{
+				ID:             int(messageID.Int64),
+				ConversationID: conversation.ID,
+				SenderID:       int(senderID.Int64),
+				SenderName:     senderName.String,
+				Content:        content.String,
+				CreatedAt:      createdAt.Time,
+				Read:           read.Bool,
+			}
+		}
+
+		conversations = append(conversations, conversation)
+	}
+
+	return conversations, rows.Err()
+}
+
+func (s *postgresMessageStore) ConversationExists(conversationID int) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM conversations WHERE id = $1)`, conversationID).Scan(&exists)
+	return exists, err
+}
+
+func (s *postgresMessageStore) IsParticipant(conversationID int, userID int) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM conversation_participants WHERE conversation_id = $1 AND user_id = $2)`,
+		conversationID, userID).Scan(&exists)
+	return exists, err
+}
+
+func (s *postgresMessageStore) MarkRead(conversationID int, readerID int) (int, error) {
+	result, err := s.db.Exec(`
+		UPDATE messages
+		SET read = true
+		WHERE conversation_id = $1 AND sender_id != $2 AND read = false`,
+		conversationID, readerID)
+	if err != nil {
+		return 0, err
+	}
+	marked, err := result.RowsAffected()
+	return int(marked), err
+}
+
+func (s *postgresMessageStore) ListMessages(conversationID int, beforeID int, limit int) ([]models.Message, error) {
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages m
+		JOIN users u ON m.sender_id = u.id
+		WHERE m.conversation_id = $1`
+	args := []interface{}{conversationID}
+	if beforeID > 0 {
+		query += ` AND m.id < $2 ORDER BY m.created_at DESC LIMIT $3`
+		args = append(args, beforeID, limit)
+	} else {
+		query += ` ORDER BY m.created_at DESC LIMIT $2`
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []models.Message
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Newest messages were selected first; return them oldest first
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	return messages, nil
+}
+
+func (s *postgresMessageStore) HasMessagesBefore(conversationID int, messageID int) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM messages WHERE conversation_id = $1 AND id < $2)`,
+		conversationID, messageID).Scan(&exists)
+	return exists, err
+}
+
+func (s *postgresMessageStore) CountMessages(conversationID int) (int, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM messages WHERE conversation_id = $1`, conversationID).Scan(&count)
+	return count, err
+}
+
+func (s *postgresMessageStore) CreateMessage(conversationID int, senderID int, content string) (*models.Message, error) {
+	return scanMessage(s.db.QueryRow(`
+		WITH inserted AS (
+			INSERT INTO messages (conversation_id, sender_id, content, created_at, read)
+			VALUES ($1, $2, $3, (CURRENT_TIMESTAMP AT TIME ZONE 'UTC')::timestamp, false)
+			RETURNING *
+		)
+		SELECT `+messageColumns+`
+		FROM inserted m
+		JOIN users u ON m.sender_id = u.id`,
+		conversationID, senderID, content))
+}
+
+func (s *postgresMessageStore) FindDirectConversation(userA int, userB int) (int, error) {
+	var conversationID int
+	err := s.db.QueryRow(`
+		SELECT c.id
+		FROM conversations c
+		JOIN conversation_participants cp1 ON c.id = cp1.conversation_id AND cp1.user_id = $1
+		JOIN conversation_participants cp2 ON c.id = cp2.conversation_id AND cp2.user_id = $2
+		LIMIT 1`, userA, userB).Scan(&conversationID)
+	return conversationID, err
+}
+
+func (s *postgresMessageStore) CreateConversation(userIDs []int) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var conversationID int
+	err = tx.QueryRow(`
+		INSERT INTO conversations (created_at)
+		VALUES ((CURRENT_TIMESTAMP AT TIME ZONE 'UTC')::timestamp)
+		RETURNING id`).Scan(&conversationID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, userID := range userIDs {
+		_, err := tx.Exec(`
+			INSERT INTO conversation_participants (conversation_id, user_id)
+			VALUES ($1, $2)`, conversationID, userID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return conversationID, tx.Commit()
+}
+
+func (s *postgresMessageStore) ListParticipants(conversationID int) ([]models.ConversationParticipant, error) {
+	rows, err := s.db.Query(`
+		SELECT u.id, COALESCE(u.first_name, ''), COALESCE(u.last_name, ''), u.name, u.role
+		FROM users u
+		JOIN conversation_participants cp ON u.id = cp.user_id
+		WHERE cp.conversation_id = $1`, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var participants []models.ConversationParticipant
+	for rows.Next() {
+		var participant models.ConversationParticipant
+		if err := rows.Scan(&participant.ID, &participant.FirstName, &participant.LastName, &participant.Name, &participant.Role); err != nil {
+			return nil, err
+		}
+		participants = append(participants, participant)
+	}
+
+	return participants, rows.Err()
+}
+
+func (s *postgresMessageStore) ListChatUsers(role string) ([]models.ChatUser, error) {
+	rows, err := s.db.Query(`
+		SELECT
+			u.id,
+			COALESCE(u.first_name, ''),
+			COALESCE(u.last_name, ''),
+			u.name,
+			u.role,
+			COALESCE(pp.file_path, '') AS profile_picture,
+			COALESCE(string_agg(DISTINCT ar.role, ', '), '') AS additional_roles
+		FROM users u
+		LEFT JOIN profile_pictures pp ON u.id = pp.user_id
+		LEFT JOIN additional_roles ar ON u.id = ar.user_id
+		WHERE u.role = $1
+		GROUP BY u.id, u.first_name, u.last_name, u.name, u.role, pp.file_path
+		ORDER BY u.name`, role)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.ChatUser
+	for rows.Next() {
+		var user models.ChatUser
+		var additionalRoles string
+		err := rows.Scan(
+			&user.ID, &user.FirstName, &user.LastName, &user.Name, &user.Role,
+			&user.ProfilePicture, &additionalRoles,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		user.AdditionalRoles = []string{}
+		if additionalRoles != "" {
+			user.AdditionalRoles = strings.Split(additionalRoles, ", ")
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+func (s *postgresMessageStore) ListPushRecipients(conversationID int, senderID int) ([]models.PushRecipient, error) {
+	rows, err := s.db.Query(`
+		SELECT u.id, u.device_id
+		FROM users u
+		JOIN conversation_participants cp ON u.id = cp.user_id
+		WHERE cp.conversation_id = $1 AND u.id != $2 AND u.device_id IS NOT NULL AND u.device_id != ''`,
+		conversationID, senderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []models.PushRecipient
+	for rows.Next() {
+		var recipient models.PushRecipient
+		if err := rows.Scan(&recipient.UserID, &recipient.DeviceToken); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, rows.Err()
+}
+
+// scanMessage scans a row selected with messageColumns
+func scanMessage(row rowScanner) (*models.Message, error) {
+	var message models.Message
+	err := row.Scan(
+		&message.ID, &message.ConversationID, &message.SenderID, &message.SenderName,
+		&message.Content, &message.CreatedAt, &message.Read,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"database/sql"
+	"server/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SessionStore keeps the server-side login sessions behind refresh tokens
+type SessionStore interface {
+	// Create stores a new session for a user and returns it
+	Create(userID int, refreshTokenHash string, deviceID string, expiresAt time.Time) (*models.Session, error)
+	// GetByID returns a session, or sql.ErrNoRows
+	GetByID(id string) (*models.Session, error)
+	// GetByRefreshHash returns the session owning the refresh token hash, or sql.ErrNoRows
+	GetByRefreshHash(refreshTokenHash string) (*models.Session, error)
+	// GetIDByRotatedRefreshHash returns the ID of the session a refresh token belonged
+	// to before it was rotated out, or sql.ErrNoRows
+	GetIDByRotatedRefreshHash(refreshTokenHash string) (string, error)
+	// RotateRefreshToken replaces the refresh token of an active session if it is
+	// still oldRefreshTokenHash, remembering the old token so its reuse can be
+	// detected. It returns sql.ErrNoRows if the session was revoked, expired or
+	// already rotated in the meantime.
+	RotateRefreshToken(id string, oldRefreshTokenHash string, newRefreshTokenHash string, expiresAt time.Time) error
+	// Revoke marks a session as revoked so its tokens are no longer accepted
+	Revoke(id string) error
+}
+
+type postgresSessionStore struct {
+	db *sql.DB
+}
+
+// NewSessionStore returns a SessionStore backed by PostgreSQL
+func NewSessionStore(db *sql.DB) SessionStore {
+	return &postgresSessionStore{db: db}
+}
+
+const sessionColumns = `
+	id, user_id, device_id, created_at, expires_at, last_used_at, revoked_at`
+
+func (s *postgresSessionStore) Create(userID int, refreshTokenHash string, deviceID string, expiresAt time.Time) (*models.Session, error) {
+	var device *string
+	if deviceID != "" {
+		device = &deviceID
+	}
+
+	return scanSession(s.db.QueryRow(`
+		INSERT INTO user_sessions (id, user_id, refresh_token_hash, device_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+sessionColumns,
+		uuid.New().String(), userID, refreshTokenHash, device, expiresAt))
+}
+
+func (s *postgresSessionStore) GetByID(id string) (*models.Session, error) {
+	return scanSession(s.db.QueryRow(`SELECT `+sessionColumns+` FROM user_sessions WHERE id = $1`, id))
+}
+
+func (s *postgresSessionStore) GetByRefreshHash(refreshTokenHash string) (*models.Session, error) {
+	return scanSession(s.db.QueryRow(`
+		SELECT `+sessionColumns+` FROM user_sessions WHERE refresh_token_hash = $1`, refreshTokenHash))
+}
+
+func (s *postgresSessionStore) GetIDByRotatedRefreshHash(refreshTokenHash string) (string, error) {
+	var id string
+	err := s.db.QueryRow(`SELECT session_id FROM rotated_refresh_tokens WHERE token_hash = $1`, refreshTokenHash).Scan(&id)
+	return id, err
+}
+
+func (s *postgresSessionStore) RotateRefreshToken(id string, oldRefreshTokenHash string, newRefreshTokenHash string, expiresAt time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = execAffectingOne(tx, `
+		UPDATE user_sessions
+		SET refresh_token_hash = $1, expires_at = $2, last_used_at = NOW()
+		WHERE id = $3 AND refresh_token_hash = $4 AND revoked_at IS NULL AND expires_at > NOW()`,
+		newRefreshTokenHash, expiresAt, id, oldRefreshTokenHash)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO rotated_refresh_tokens (token_hash, session_id)
+		VALUES ($1, $2)
+		ON CONFLICT (token_hash) DO NOTHING`,
+		oldRefreshTokenHash, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *postgresSessionStore) Revoke(id string) error {
+	_, err := s.db.Exec(`
+		UPDATE user_sessions
+		SET revoked_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL`, id)
+	return err
+}
+
+// scanSession scans a row selected with sessionColumns
+func scanSession(row rowScanner) (*models.Session, error) {
+	var session models.Session
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.DeviceID,
+		&session.CreatedAt,
+		&session.ExpiresAt,
+		&session.LastUsedAt,
+		&session.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
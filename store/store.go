@@ -0,0 +1,93 @@
+// Package store holds the data access layer. Handlers depend on the store
+// interfaces rather than on *sql.DB; the Postgres implementations all share the
+// application's connection pool. Handler and job tests substitute in-memory fakes.
+package store
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrConflict is returned when a write would duplicate a unique value
+	ErrConflict = errors.New("conflicts with an existing record")
+	// ErrInUse is returned when deleting a record that others still depend on
+	ErrInUse = errors.New("record is still in use")
+	// ErrInvalidReference is returned when a write refers to a record that does not exist
+	ErrInvalidReference = errors.New("references a record that does not exist")
+)
+
+// Stores bundles every store used by the HTTP handlers
+type Stores struct {
+	Users            UserStore
+	Sessions         SessionStore
+	Attendance       AttendanceStore
+	LeaveRequests    LeaveRequestStore
+	LeaveAttachments LeaveAttachmentStore
+	LeaveReports     LeaveReportStore
+	Messages         MessageStore
+	Voting           VotingStore
+	Documents        DocumentStore
+	Events           EventStore
+	YearGroups       YearGroupStore
+	Lessons          LessonAttendanceStore
+	Analytics        AttendanceAnalyticsStore
+	Alerts           AttendanceAlertStore
+	Guardians        GuardianStore
+	Calendar         CalendarStore
+}
+
+// NewPostgres builds all stores on top of a shared connection pool
+func NewPostgres(db *sql.DB) *Stores {
+	return &Stores{
+		Users:            NewUserStore(db),
+		Sessions:         NewSessionStore(db),
+		Attendance:       NewAttendanceStore(db),
+		LeaveRequests:    NewLeaveRequestStore(db),
+		LeaveAttachments: NewLeaveAttachmentStore(db),
+		LeaveReports:     NewLeaveReportStore(db),
+		Messages:         NewMessageStore(db),
+		Voting:           NewVotingStore(db),
+		Documents:        NewDocumentStore(db),
+		Events:           NewEventStore(db),
+		YearGroups:       NewYearGroupStore(db),
+		Lessons:          NewLessonAttendanceStore(db),
+		Analytics:        NewAttendanceAnalyticsStore(db),
+		Alerts:           NewAttendanceAlertStore(db),
+		Guardians:        NewGuardianStore(db),
+		Calendar:         NewCalendarStore(db),
+	}
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// conflictOr maps unique constraint violations to ErrConflict and returns other errors unchanged
+func conflictOr(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrConflict
+	}
+	return err
+}
+
+// execAffectingOne runs a statement that must affect exactly one row, returning
+// sql.ErrNoRows if it affected none
+func execAffectingOne(tx *sql.Tx, query string, args ...interface{}) error {
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package store
+
+import (
+	"database/sql"
+	"server/models"
+)
+
+// UserStore reads and updates user accounts and their profile data
+type UserStore interface {
+	// GetAll returns every user, ordered by ID, with passwords cleared
+	GetAll() ([]models.User, error)
+	// GetByID returns a user including the stored password hash, or sql.ErrNoRows
+	GetByID(id int) (*models.User, error)
+	// GetByUsername returns a user including the stored password hash, or sql.ErrNoRows
+	GetByUsername(username string) (*models.User, error)
+	// Exists reports whether a user with the given ID exists
+	Exists(id int) (bool, error)
+	// UpdatePassword stores a new password value for the user
+	UpdatePassword(id int, password string) error
+	// UpdateEmail changes the user's email address
+	UpdateEmail(id int, email string) error
+	// UpdateDeviceToken stores the APNs device token used for push notifications
+	UpdateDeviceToken(id int, deviceToken string) error
+	// GetLiveActivityStartToken returns the user's Live Activity push-to-start token,
+	// or "" if there is none
+	GetLiveActivityStartToken(id int) (string, error)
+	// SetLiveActivityStartToken replaces the user's Live Activity push-to-start token
+	SetLiveActivityStartToken(id int, token string) error
+	// ClearLiveActivityStartToken forgets the user's push-to-start token if it is still
+	// token, or any token when token is ""
+	ClearLiveActivityStartToken(id int, token string) error
+	// ListByRole returns the users whose primary or additional role is role, ordered
+	// by ID, with passwords cleared
+	ListByRole(role string) ([]models.User, error)
+	// GetAdditionalRoles returns the user's additional roles (never nil)
+	GetAdditionalRoles(id int) ([]string, error)
+	// GetProfilePicture returns the stored profile picture path, or "" if there is none
+	GetProfilePicture(id int) (string, error)
+	// SetProfilePicture replaces the user's profile picture path
+	SetProfilePicture(id int, filePath string) error
+}
+
+type postgresUserStore struct {
+	db *sql.DB
+}
+
+// NewUserStore returns a UserStore backed by PostgreSQL
+func NewUserStore(db *sql.DB) UserStore {
+	return &postgresUserStore{db: db}
+}
+
+const userColumns = `
+	id, COALESCE(first_name, ''), COALESCE(last_name, ''), name, username,
+	password, role, COALESCE(device_id, ''), COALESCE(email, ''), status`
+
+func (s *postgresUserStore) GetAll() ([]models.User, error) {
+	rows, err := s.db.Query(`SELECT ` + userColumns + ` FROM users ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		// For security, clear the password before sending to client
+		user.Password = ""
+		users = append(users, *user)
+	}
+
+	return users, rows.Err()
+}
+
+func (s *postgresUserStore) GetByID(id int) (*models.User, error) {
+	return scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+}
+
+func (s *postgresUserStore) GetByUsername(username string) (*models.User, error) {
+	return scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE username = $1`, username))
+}
+
+func (s *postgresUserStore) Exists(id int) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", id).Scan(&exists)
+	return exists, err
+}
+
+func (s *postgresUserStore) UpdatePassword(id int, password string) error {
+	_, err := s.db.Exec("UPDATE users SET password = $1 WHERE id = $2", password, id)
+	return err
+}
+
+func (s *postgresUserStore) UpdateEmail(id int, email string) error {
+	_, err := s.db.Exec("UPDATE users SET email = $1 WHERE id = $2", email, id)
+	return err
+}
+
+func (s *postgresUserStore) UpdateDeviceToken(id int, deviceToken string) error {
+	_, err := s.db.Exec("UPDATE users SET device_id = $1 WHERE id = $2", deviceToken, id)
+	return err
+}
+
+func (s *postgresUserStore) GetLiveActivityStartToken(id int) (string, error) {
+	var token string
+	err := s.db.QueryRow("SELECT token FROM live_activity_start_tokens WHERE user_id = $1", id).Scan(&token)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return token, err
+}
+
+func (s *postgresUserStore) SetLiveActivityStartToken(id int, token string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO live_activity_start_tokens (user_id, token, updated_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET token = EXCLUDED.token, updated_at = NOW()`,
+		id, token)
+	return err
+}
+
+func (s *postgresUserStore) ClearLiveActivityStartToken(id int, token string) error {
+	_, err := s.db.Exec(`
+		DELETE FROM live_activity_start_tokens
+		WHERE user_id = $1 AND ($2 = '' OR token = $2)`,
+		id, token)
+	return err
+}
+
+func (s *postgresUserStore) ListByRole(role string) ([]models.User, error) {
+	rows, err := s.db.Query(`
+		SELECT `+userColumns+` FROM users
+		WHERE role = $1
+		   OR EXISTS (SELECT 1 FROM additional_roles ar WHERE ar.user_id = users.id AND ar.role = $1)
+		ORDER BY id`, role)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		user.Password = ""
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+func (s *postgresUserStore) GetAdditionalRoles(id int) ([]string, error) {
+	return models.GetAdditionalRoles(s.db, id)
+}
+
+func (s *postgresUserStore) GetProfilePicture(id int) (string, error) {
+	var filePath sql.NullString
+	err := s.db.QueryRow("SELECT file_path FROM profile_pictures WHERE user_id = $1", id).Scan(&filePath)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return filePath.String, err
+}
+
+func (s *postgresUserStore) SetProfilePicture(id int, filePath string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM profile_pictures WHERE user_id = $1", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO profile_pictures (user_id, file_path) VALUES ($1, $2)", id, filePath); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// scanUser scans a row selected with userColumns
+func scanUser(row rowScanner) (*models.User, error) {
+	var user models.User
+	err := row.Scan(
+		&user.ID,
+		&user.FirstName,
+		&user.LastName,
+		&user.Name,
+		&user.Username,
+		&user.Password,
+		&user.Role,
+		&user.DeviceID,
+		&user.Email,
+		&user.Status,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
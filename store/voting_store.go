@@ -0,0 +1,544 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"server/models"
+	"time"
+)
+
+// VotingStore persists voting events, their sub-votes and options, and the votes cast
+type VotingStore interface {
+	// ListEvents returns voting events newest first, optionally filtered by status.
+	// When userID is non-zero each sub-vote carries that user's vote. When studentID
+	// is non-zero only events whose audience includes that student are returned.
+	ListEvents(status string, userID int, studentID int) ([]models.VotingEvent, error)
+	// GetEvent returns a voting event with its sub-votes, or sql.ErrNoRows
+	GetEvent(eventID int, userID int) (*models.VotingEvent, error)
+	// EventExists reports whether a voting event exists
+	EventExists(eventID int) (bool, error)
+	// InAudience reports whether a voting event is open to everyone or includes the user's section
+	InAudience(eventID int, userID int) (bool, error)
+	// CreateEvent inserts a voting event with its sub-votes, options and audience and
+	// returns its ID, or ErrInvalidReference for an unknown audience section
+	CreateEvent(request models.VotingEventRequest, organizerID int) (int, error)
+	// UpdateEvent replaces a voting event's details, sub-votes, options and audience,
+	// or returns ErrInvalidReference for an unknown audience section
+	UpdateEvent(eventID int, request models.VotingEventRequest) error
+	// DeleteEvent deletes a voting event; sub-votes, options and votes cascade
+	DeleteEvent(eventID int) error
+
+	// GetSubVoteWindow returns the event a sub-vote belongs to with its status and deadline, or sql.ErrNoRows
+	GetSubVoteWindow(subVoteID int) (eventID int, status string, deadline time.Time, err error)
+	// OptionBelongsTo reports whether an option is part of a sub-vote
+	OptionBelongsTo(optionID int, subVoteID int) (bool, error)
+	// SubmitVote records or replaces the user's vote in a sub-vote and refreshes the option counts
+	SubmitVote(userID int, vote models.UserVoteRequest) error
+	// ListUserVotes returns every vote cast by a user, newest first
+	ListUserVotes(userID int) ([]models.UserVoteWithDetails, error)
+	// DeleteUserVote deletes one of the user's votes, or returns sql.ErrNoRows
+	DeleteUserVote(voteID int, userID int) error
+	// GetStatistics returns the per-option results of every sub-vote in an event
+	GetStatistics(eventID int) ([]models.SubVoteStats, error)
+}
+
+type postgresVotingStore struct {
+	db *sql.DB
+}
+
+// NewVotingStore returns a VotingStore backed by PostgreSQL
+func NewVotingStore(db *sql.DB) VotingStore {
+	return &postgresVotingStore{db: db}
+}
+
+const votingEventColumns = `
+	ve.id, ve.title,
+	COALESCE(ve.description, '') AS description,
+	ve.deadline,
+	ve.status,
+	COALESCE(ve.organizer_id, 0) AS organizer_id,
+	COALESCE(u.name, 'Unknown') AS organizer_name,
+	COALESCE(u.role, 'User') AS organizer_role,
+	ve.created_at`
+
+func (s *postgresVotingStore) ListEvents(status string, userID int, studentID int) ([]models.VotingEvent, error) {
+	query := `
+		SELECT ` + votingEventColumns + `
+		FROM voting_events ve
+		LEFT JOIN users u ON ve.organizer_id = u.id
+		WHERE TRUE`
+	var args []interface{}
+	if status != "" {
+		args = append(args, status)
+		query += fmt.Sprintf(` AND ve.status = $%d`, len(args))
+	}
+	if studentID != 0 {
+		args = append(args, studentID)
+		query += ` AND ` + audienceCondition(votingEventAudiences, "ve.id", fmt.Sprintf("$%d", len(args)))
+	}
+	query += ` ORDER BY ve.created_at DESC`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var events []models.VotingEvent
+	for rows.Next() {
+		event, err := scanVotingEvent(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range events {
+		if err := s.loadEventDetails(&events[i], userID); err != nil {
+			return nil, err
+		}
+	}
+
+	return events, nil
+}
+
+func (s *postgresVotingStore) GetEvent(eventID int, userID int) (*models.VotingEvent, error) {
+	event, err := scanVotingEvent(s.db.QueryRow(`
+		SELECT `+votingEventColumns+`
+		FROM voting_events ve
+		LEFT JOIN users u ON ve.organizer_id = u.id
+		WHERE ve.id = $1`, eventID))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loadEventDetails(event, userID); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// loadEventDetails fills in the vote counts and sub-votes of an event
+func (s *postgresVotingStore) loadEventDetails(event *models.VotingEvent, userID int) error {
+	err := s.db.QueryRow(`
+		SELECT COUNT(DISTINCT uv.user_id)
+		FROM user_votes uv
+		JOIN sub_votes sv ON uv.sub_vote_id = sv.id
+		WHERE sv.event_id = $1`, event.ID).Scan(&event.VoteCount)
+	if err != nil {
+		return err
+	}
+
+	event.AudienceSectionIDs, err = listAudience(s.db, votingEventAudiences, event.ID)
+	if err != nil {
+		return err
+	}
+
+	// Everyone in the audience is eligible to vote
+	event.TotalVotes, err = countAudience(s.db, votingEventAudiences, event.ID)
+	if err != nil {
+		return err
+	}
+
+	event.SubVotes, err = s.getSubVotes(event.ID, userID)
+	return err
+}
+
+// getSubVotes returns the sub-votes of an event with their options and, if userID is set, the user's vote
+func (s *postgresVotingStore) getSubVotes(eventID int, userID int) ([]models.SubVote, error) {
+	rows, err := s.db.Query(`
+		SELECT id, event_id, title, COALESCE(description, '') AS description, created_at
+		FROM sub_votes
+		WHERE event_id = $1
+		ORDER BY id`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	subVotes := []models.SubVote{}
+	for rows.Next() {
+		var subVote models.SubVote
+		if err := rows.Scan(&subVote.ID, &subVote.EventID, &subVote.Title, &subVote.Description, &subVote.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		subVotes = append(subVotes, subVote)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range subVotes {
+		subVotes[i].Options, err = s.getOptions(subVotes[i].ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if userID == 0 {
+			continue
+		}
+		var userVote models.UserVote
+		err = s.db.QueryRow(`
+			SELECT id, user_id, sub_vote_id, option_id, COALESCE(custom_input, '') AS custom_input, created_at
+			FROM user_votes
+			WHERE user_id = $1 AND sub_vote_id = $2`, userID, subVotes[i].ID).Scan(
+			&userVote.ID, &userVote.UserID, &userVote.SubVoteID, &userVote.OptionID, &userVote.CustomInput, &userVote.CreatedAt)
+		if err == nil {
+			subVotes[i].UserVote = &userVote
+		} else if err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+
+	return subVotes, nil
+}
+
+// getOptions returns the options of a sub-vote
+func (s *postgresVotingStore) getOptions(subVoteID int) ([]models.VoteOption, error) {
+	rows, err := s.db.Query(`
+		SELECT id, sub_vote_id, text, has_custom_input, vote_count, created_at
+		FROM vote_options
+		WHERE sub_vote_id = $1
+		ORDER BY id`, subVoteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	options := []models.VoteOption{}
+	for rows.Next() {
+		var option models.VoteOption
+		if err := rows.Scan(&option.ID, &option.SubVoteID, &option.Text, &option.HasCustomInput, &option.VoteCount, &option.CreatedAt); err != nil {
+			return nil, err
+		}
+		options = append(options, option)
+	}
+
+	return options, rows.Err()
+}
+
+func (s *postgresVotingStore) EventExists(eventID int) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM voting_events WHERE id = $1)`, eventID).Scan(&exists)
+	return exists, err
+}
+
+func (s *postgresVotingStore) InAudience(eventID int, userID int) (bool, error) {
+	return inAudience(s.db, votingEventAudiences, eventID, userID)
+}
+
+func (s *postgresVotingStore) CreateEvent(request models.VotingEventRequest, organizerID int) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var eventID int
+	err = tx.QueryRow(`
+		INSERT INTO voting_events (title, description, deadline, status, organizer_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`,
+		request.Title, request.Description, request.Deadline, request.Status, organizerID).Scan(&eventID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := insertSubVotes(tx, eventID, request.SubVotes); err != nil {
+		return 0, err
+	}
+	if err := replaceAudience(tx, votingEventAudiences, eventID, request.AudienceSectionIDs); err != nil {
+		return 0, err
+	}
+
+	return eventID, tx.Commit()
+}
+
+func (s *postgresVotingStore) UpdateEvent(eventID int, request models.VotingEventRequest) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE voting_events
+		SET title = $1, description = $2, deadline = $3, status = $4
+		WHERE id = $5`,
+		request.Title, request.Description, request.Deadline, request.Status, eventID)
+	if err != nil {
+		return err
+	}
+
+	// Sub-votes are replaced wholesale; their options and votes cascade
+	if _, err := tx.Exec(`DELETE FROM sub_votes WHERE event_id = $1`, eventID); err != nil {
+		return err
+	}
+	if err := insertSubVotes(tx, eventID, request.SubVotes); err != nil {
+		return err
+	}
+	if err := replaceAudience(tx, votingEventAudiences, eventID, request.AudienceSectionIDs); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertSubVotes inserts the sub-votes and options of an event
+func insertSubVotes(tx *sql.Tx, eventID int, subVotes []models.SubVoteRequest) error {
+	for _, subVoteReq := range subVotes {
+		var subVoteID int
+		err := tx.QueryRow(`
+			INSERT INTO sub_votes (event_id, title, description)
+			VALUES ($1, $2, $3)
+			RETURNING id`,
+			eventID, subVoteReq.Title, subVoteReq.Description).Scan(&subVoteID)
+		if err != nil {
+			return err
+		}
+
+		for _, optionReq := range subVoteReq.Options {
+			_, err = tx.Exec(`
+				INSERT INTO vote_options (sub_vote_id, text, has_custom_input)
+				VALUES ($1, $2, $3)`,
+				subVoteID, optionReq.Text, optionReq.HasCustomInput)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *postgresVotingStore) DeleteEvent(eventID int) error {
+	_, err := s.db.Exec(`DELETE FROM voting_events WHERE id = $1`, eventID)
+	return err
+}
+
+func (s *postgresVotingStore) GetSubVoteWindow(subVoteID int) (int, string, time.Time, error) {
+	var eventID int
+	var status string
+	var deadline time.Time
+	err := s.db.QueryRow(`
+		SELECT ve.id, ve.status, ve.deadline
+		FROM sub_votes sv
+		JOIN voting_events ve ON sv.event_id = ve.id
+		WHERE sv.id = $1`, subVoteID).Scan(&eventID, &status, &deadline)
+	return eventID, status, deadline, err
+}
+
+func (s *postgresVotingStore) OptionBelongsTo(optionID int, subVoteID int) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM vote_options WHERE id = $1 AND sub_vote_id = $2)`,
+		optionID, subVoteID).Scan(&exists)
+	return exists, err
+}
+
+func (s *postgresVotingStore) SubmitVote(userID int, vote models.UserVoteRequest) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO user_votes (user_id, sub_vote_id, option_id, custom_input)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, sub_vote_id)
+		DO UPDATE SET option_id = EXCLUDED.option_id, custom_input = EXCLUDED.custom_input`,
+		userID, vote.SubVoteID, vote.OptionID, vote.CustomInput)
+	if err != nil {
+		return err
+	}
+
+	if err := updateVoteCounts(tx, vote.SubVoteID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateVoteCounts recalculates the vote counts of all options in a sub-vote
+func updateVoteCounts(tx *sql.Tx, subVoteID int) error {
+	_, err := tx.Exec(`
+		UPDATE vote_options vo
+		SET vote_count = (
+			SELECT COUNT(*)
+			FROM user_votes uv
+			WHERE uv.option_id = vo.id
+		)
+		WHERE vo.sub_vote_id = $1`, subVoteID)
+	return err
+}
+
+func (s *postgresVotingStore) ListUserVotes(userID int) ([]models.UserVoteWithDetails, error) {
+	rows, err := s.db.Query(`
+		SELECT uv.id, uv.user_id, uv.sub_vote_id, uv.option_id,
+			   COALESCE(uv.custom_input, ''), uv.created_at,
+			   sv.title AS sub_vote_title,
+			   vo.text AS option_text
+		FROM user_votes uv
+		JOIN sub_votes sv ON uv.sub_vote_id = sv.id
+		JOIN vote_options vo ON uv.option_id = vo.id
+		WHERE uv.user_id = $1
+		ORDER BY uv.created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var votes []models.UserVoteWithDetails
+	for rows.Next() {
+		var vote models.UserVoteWithDetails
+		err := rows.Scan(
+			&vote.ID, &vote.UserID, &vote.SubVoteID, &vote.OptionID,
+			&vote.CustomInput, &vote.CreatedAt, &vote.SubVoteTitle, &vote.OptionText,
+		)
+		if err != nil {
+			return nil, err
+		}
+		votes = append(votes, vote)
+	}
+
+	return votes, rows.Err()
+}
+
+func (s *postgresVotingStore) DeleteUserVote(voteID int, userID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var subVoteID int
+	err = tx.QueryRow(`
+		DELETE FROM user_votes
+		WHERE id = $1 AND user_id = $2
+		RETURNING sub_vote_id`, voteID, userID).Scan(&subVoteID)
+	if err != nil {
+		return err
+	}
+
+	if err := updateVoteCounts(tx, subVoteID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *postgresVotingStore) GetStatistics(eventID int) ([]models.SubVoteStats, error) {
+	rows, err := s.db.Query(`
+		SELECT id, title, COALESCE(description, '')
+		FROM sub_votes
+		WHERE event_id = $1
+		ORDER BY id`, eventID)
+	if err != nil {
+		return nil, err
+	}
+	var stats []models.SubVoteStats
+	for rows.Next() {
+		var stat models.SubVoteStats
+		if err := rows.Scan(&stat.SubVoteID, &stat.Title, &stat.Description); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range stats {
+		if err := s.loadOptionStats(&stats[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
+
+// loadOptionStats fills in the vote totals, percentages and custom inputs of a sub-vote
+func (s *postgresVotingStore) loadOptionStats(stat *models.SubVoteStats) error {
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM user_votes WHERE sub_vote_id = $1`, stat.SubVoteID).Scan(&stat.TotalVotes)
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, text, vote_count, has_custom_input
+		FROM vote_options
+		WHERE sub_vote_id = $1
+		ORDER BY id`, stat.SubVoteID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var option models.OptionStats
+		if err := rows.Scan(&option.OptionID, &option.Text, &option.VoteCount, &option.HasCustomInput); err != nil {
+			rows.Close()
+			return err
+		}
+		if stat.TotalVotes > 0 {
+			option.Percentage = int(float64(option.VoteCount) / float64(stat.TotalVotes) * 100)
+		}
+		stat.OptionStats = append(stat.OptionStats, option)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range stat.OptionStats {
+		option := &stat.OptionStats[i]
+		if !option.HasCustomInput || option.VoteCount == 0 {
+			continue
+		}
+		option.CustomInputs, err = s.getCustomInputs(stat.SubVoteID, option.OptionID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getCustomInputs returns the free-text answers given for an option
+func (s *postgresVotingStore) getCustomInputs(subVoteID int, optionID int) ([]string, error) {
+	rows, err := s.db.Query(`
+		SELECT custom_input FROM user_votes
+		WHERE sub_vote_id = $1 AND option_id = $2 AND custom_input IS NOT NULL AND custom_input != ''`,
+		subVoteID, optionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var inputs []string
+	for rows.Next() {
+		var input string
+		if err := rows.Scan(&input); err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, input)
+	}
+
+	return inputs, rows.Err()
+}
+
+// scanVotingEvent scans a row selected with votingEventColumns
+func scanVotingEvent(row rowScanner) (*models.VotingEvent, error) {
+	var event models.VotingEvent
+	err := row.Scan(
+		&event.ID, &event.Title, &event.Description, &event.Deadline, &event.Status,
+		&event.OrganizerID, &event.OrganizerName, &event.OrganizerRole, &event.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
@@ -0,0 +1,347 @@
+package store
+
+import (
+	"database/sql"
+	"server/models"
+	"strings"
+)
+
+// YearGroupStore persists year groups and their sections.
+// Students belong to a section through attendance.year and attendance.group_name,
+// so renaming a year group or section moves its students with it.
+type YearGroupStore interface {
+	// List returns every year group with its sections, in display order
+	List() ([]models.YearGroup, error)
+	// Get returns a year group with its sections, or sql.ErrNoRows
+	Get(id int) (*models.YearGroup, error)
+	// Create inserts a year group and fills in its generated fields, or returns ErrConflict
+	Create(group *models.YearGroup) error
+	// Update renames or reorders a year group; returns sql.ErrNoRows or ErrConflict
+	Update(group *models.YearGroup) error
+	// Delete deletes a year group and its sections; returns sql.ErrNoRows, or ErrInUse
+	// while students are assigned to it
+	Delete(id int) error
+
+	// ListSections returns every section, in display order
+	ListSections() ([]models.Section, error)
+	// GetSection returns a section, or sql.ErrNoRows
+	GetSection(id int) (*models.Section, error)
+	// GetSectionBySlug returns the section with an ID such as "ib1-a", or sql.ErrNoRows
+	GetSectionBySlug(slug string) (*models.Section, error)
+	// GetStudentSection returns the section a student belongs to, or sql.ErrNoRows
+	GetStudentSection(studentID int) (*models.Section, error)
+	// CreateSection inserts a section and fills in its generated fields; returns
+	// sql.ErrNoRows if the year group does not exist, or ErrConflict
+	CreateSection(section *models.Section) error
+	// UpdateSection changes a section's year group, name or homeroom; returns
+	// sql.ErrNoRows if the section or year group does not exist, or ErrConflict
+	UpdateSection(section *models.Section) error
+	// DeleteSection deletes a section; returns sql.ErrNoRows, or ErrInUse while
+	// students are assigned to it
+	DeleteSection(id int) error
+}
+
+type postgresYearGroupStore struct {
+	db *sql.DB
+}
+
+// NewYearGroupStore returns a YearGroupStore backed by PostgreSQL
+func NewYearGroupStore(db *sql.DB) YearGroupStore {
+	return &postgresYearGroupStore{db: db}
+}
+
+const yearGroupColumns = `id, name, sort_order, created_at`
+
+const sectionColumns = `
+	s.id, s.year_group_id, y.name, s.name, COALESCE(s.homeroom, ''),
+	s.homeroom_teacher_id, COALESCE(t.name, ''), s.created_at`
+
+const sectionTables = `
+	sections s
+	JOIN year_groups y ON y.id = s.year_group_id
+	LEFT JOIN users t ON t.id = s.homeroom_teacher_id`
+
+const sectionOrder = ` ORDER BY y.sort_order, y.name, s.name`
+
+func (s *postgresYearGroupStore) List() ([]models.YearGroup, error) {
+	rows, err := s.db.Query(`SELECT ` + yearGroupColumns + ` FROM year_groups ORDER BY sort_order, name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []models.YearGroup
+	index := make(map[int]int)
+	for rows.Next() {
+		group, err := scanYearGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		group.Sections = []models.Section{}
+		index[group.ID] = len(groups)
+		groups = append(groups, *group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sections, err := s.ListSections()
+	if err != nil {
+		return nil, err
+	}
+	for _, section := range sections {
+		if i, ok := index[section.YearGroupID]; ok {
+			groups[i].Sections = append(groups[i].Sections, section)
+		}
+	}
+
+	return groups, nil
+}
+
+func (s *postgresYearGroupStore) Get(id int) (*models.YearGroup, error) {
+	group, err := scanYearGroup(s.db.QueryRow(`SELECT `+yearGroupColumns+` FROM year_groups WHERE id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+
+	group.Sections, err = s.listSections(`SELECT `+sectionColumns+` FROM `+sectionTables+` WHERE s.year_group_id = $1`+sectionOrder, id)
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+func (s *postgresYearGroupStore) Create(group *models.YearGroup) error {
+	created, err := scanYearGroup(s.db.QueryRow(`
+		INSERT INTO year_groups (name, sort_order)
+		VALUES ($1, $2)
+		RETURNING `+yearGroupColumns, group.Name, group.SortOrder))
+	if err != nil {
+		return conflictOr(err)
+	}
+	*group = *created
+	group.Sections = []models.Section{}
+	return nil
+}
+
+func (s *postgresYearGroupStore) Update(group *models.YearGroup) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldName string
+	if err := tx.QueryRow(`SELECT name FROM year_groups WHERE id = $1 FOR UPDATE`, group.ID).Scan(&oldName); err != nil {
+		return err
+	}
+
+	updated, err := scanYearGroup(tx.QueryRow(`
+		UPDATE year_groups SET name = $1, sort_order = $2
+		WHERE id = $3
+		RETURNING `+yearGroupColumns, group.Name, group.SortOrder, group.ID))
+	if err != nil {
+		return conflictOr(err)
+	}
+
+	// Move the students of the renamed year group along with it
+	if oldName != updated.Name {
+		if _, err := tx.Exec(`UPDATE attendance SET year = $1 WHERE year = $2`, updated.Name, oldName); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	sections := group.Sections
+	*group = *updated
+	group.Sections = sections
+	return nil
+}
+
+func (s *postgresYearGroupStore) Delete(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inUse bool
+	err = tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM attendance a JOIN year_groups y ON y.name = a.year WHERE y.id = $1)`,
+		id).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrInUse
+	}
+
+	if err := execAffectingOne(tx, `DELETE FROM year_groups WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *postgresYearGroupStore) ListSections() ([]models.Section, error) {
+	return s.listSections(`SELECT ` + sectionColumns + ` FROM ` + sectionTables + sectionOrder)
+}
+
+func (s *postgresYearGroupStore) GetSection(id int) (*models.Section, error) {
+	return scanSection(s.db.QueryRow(`SELECT `+sectionColumns+` FROM `+sectionTables+` WHERE s.id = $1`, id))
+}
+
+func (s *postgresYearGroupStore) GetSectionBySlug(slug string) (*models.Section, error) {
+	return scanSection(s.db.QueryRow(`
+		SELECT `+sectionColumns+` FROM `+sectionTables+`
+		WHERE LOWER(y.name || '-' || s.name) = $1`, strings.ToLower(slug)))
+}
+
+func (s *postgresYearGroupStore) GetStudentSection(studentID int) (*models.Section, error) {
+	return scanSection(s.db.QueryRow(`
+		SELECT `+sectionColumns+` FROM `+sectionTables+`
+		JOIN attendance a ON a.year = y.name AND a.group_name = s.name
+		WHERE a.user_id = $1`, studentID))
+}
+
+func (s *postgresYearGroupStore) CreateSection(section *models.Section) error {
+	var id int
+	err := s.db.QueryRow(`
+		INSERT INTO sections (year_group_id, name, homeroom, homeroom_teacher_id)
+		SELECT id, $2, NULLIF($3, ''), $4 FROM year_groups WHERE id = $1
+		RETURNING id`,
+		section.YearGroupID, section.Name, section.Homeroom, section.HomeroomTeacherID).Scan(&id)
+	if err != nil {
+		return conflictOr(err)
+	}
+
+	created, err := s.GetSection(id)
+	if err != nil {
+		return err
+	}
+	*section = *created
+	return nil
+}
+
+func (s *postgresYearGroupStore) UpdateSection(section *models.Section) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldYear, oldName string
+	err = tx.QueryRow(`
+		SELECT y.name, s.name FROM sections s JOIN year_groups y ON y.id = s.year_group_id
+		WHERE s.id = $1 FOR UPDATE OF s`, section.ID).Scan(&oldYear, &oldName)
+	if err != nil {
+		return err
+	}
+
+	var newYear string
+	if err := tx.QueryRow(`SELECT name FROM year_groups WHERE id = $1`, section.YearGroupID).Scan(&newYear); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE sections
+		SET year_group_id = $1, name = $2, homeroom = NULLIF($3, ''), homeroom_teacher_id = $4
+		WHERE id = $5`,
+		section.YearGroupID, section.Name, section.Homeroom, section.HomeroomTeacherID, section.ID)
+	if err != nil {
+		return conflictOr(err)
+	}
+
+	// Move the section's students along with it
+	if oldYear != newYear || oldName != section.Name {
+		_, err := tx.Exec(`
+			UPDATE attendance SET year = $1, group_name = $2
+			WHERE year = $3 AND group_name = $4`, newYear, section.Name, oldYear, oldName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	updated, err := s.GetSection(section.ID)
+	if err != nil {
+		return err
+	}
+	*section = *updated
+	return nil
+}
+
+func (s *postgresYearGroupStore) DeleteSection(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inUse bool
+	err = tx.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM attendance a
+			JOIN year_groups y ON y.name = a.year
+			JOIN sections s ON s.year_group_id = y.id AND s.name = a.group_name
+			WHERE s.id = $1
+		)`, id).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrInUse
+	}
+
+	if err := execAffectingOne(tx, `DELETE FROM sections WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// listSections runs a query selecting sectionColumns
+func (s *postgresYearGroupStore) listSections(query string, args ...interface{}) ([]models.Section, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sections := []models.Section{}
+	for rows.Next() {
+		section, err := scanSection(rows)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, *section)
+	}
+
+	return sections, rows.Err()
+}
+
+// scanYearGroup scans a row selected with yearGroupColumns
+func scanYearGroup(row rowScanner) (*models.YearGroup, error) {
+	var group models.YearGroup
+	if err := row.Scan(&group.ID, &group.Name, &group.SortOrder, &group.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// scanSection scans a row selected with sectionColumns
+func scanSection(row rowScanner) (*models.Section, error) {
+	var section models.Section
+	err := row.Scan(
+		&section.ID, &section.YearGroupID, &section.Year, &section.Name, &section.Homeroom,
+		&section.HomeroomTeacherID, &section.HomeroomTeacherName, &section.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &section, nil
+}
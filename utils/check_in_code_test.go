@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyCheckInCode(t *testing.T) {
+	code, expiresAt, err := GenerateCheckInCode()
+	if err != nil {
+		t.Fatalf("generating a code: %v", err)
+	}
+	if !expiresAt.After(time.Now()) {
+		t.Fatalf("a new code expires at %s, in the past", expiresAt)
+	}
+	if err := VerifyCheckInCode(code); err != nil {
+		t.Fatalf("verifying a new code: %v", err)
+	}
+
+	// Signs a payload the way GenerateCheckInCode does, expiring at expires
+	sign := func(prefix string, expires string) string {
+		payload := fmt.Sprintf("%s.%s.bm9uY2U", prefix, expires)
+		return payload + "." + signCheckInCode(payload)
+	}
+	parts := strings.Split(code, ".")
+
+	tests := []struct {
+		name string
+		code string
+		want error
+	}{
+		{name: "empty", code: "", want: ErrInvalidCheckInCode},
+		{name: "missing signature", code: strings.Join(parts[:3], "."), want: ErrInvalidCheckInCode},
+		{name: "wrong signature", code: strings.Join(parts[:3], ".") + "." + signCheckInCode("something else"), want: ErrInvalidCheckInCode},
+		{name: "extended expiry", code: fmt.Sprintf("%s.%d.%s.%s", parts[0], time.Now().Add(time.Hour).Unix(), parts[2], parts[3]), want: ErrInvalidCheckInCode},
+		{name: "other prefix", code: sign("hsci0", fmt.Sprint(time.Now().Add(time.Hour).Unix())), want: ErrInvalidCheckInCode},
+		{name: "malformed expiry", code: sign(checkInCodePrefix, "soon"), want: ErrInvalidCheckInCode},
+		{name: "expired", code: sign(checkInCodePrefix, fmt.Sprint(time.Now().Add(-time.Second).Unix())), want: ErrExpiredCheckInCode},
+	}
+	for _, test := range tests {
+		if err := VerifyCheckInCode(test.code); err != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}